@@ -1,21 +1,48 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/balance"
+	"github.com/ety001/lzc-mobile/internal/calls"
 	"github.com/ety001/lzc-mobile/internal/config"
 	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/diagnostics"
+	"github.com/ety001/lzc-mobile/internal/discovery"
+	"github.com/ety001/lzc-mobile/internal/events"
+	"github.com/ety001/lzc-mobile/internal/lifecycle"
+	"github.com/ety001/lzc-mobile/internal/recording"
 	"github.com/ety001/lzc-mobile/internal/sms"
+	"github.com/ety001/lzc-mobile/internal/ussd"
 	"github.com/ety001/lzc-mobile/internal/web"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// shutdownTimeout 优雅退出的最长时间（docker stop 默认 10 秒后发送 SIGKILL）
+	shutdownTimeout = 8 * time.Second
+	// amiInitRetries 等待 Asterisk 启动时初始化 AMI 的最大次数
+	amiInitRetries = 15
+	// amiInitRetryInterval AMI 初始化失败后的重试间隔
+	amiInitRetryInterval = 2 * time.Second
+)
+
 func main() {
+	// 日志同时保存最近的若干行，用于诊断包
+	log.SetOutput(io.MultiWriter(os.Stderr, diagnostics.GetLogBuffer()))
+
 	// 运行 web 服务器
 	// 初始化数据库
 	if err := database.Init(); err != nil {
@@ -55,35 +82,21 @@ func main() {
 		}
 	}
 
-	// 初始化 AMI 管理器（延迟重试，等待 Asterisk 启动）
-	amiManager := ami.GetManager()
-	// 在后台异步初始化 AMI，避免阻塞主程序启动
-	go func() {
-		// 等待 Asterisk 启动（最多等待 30 秒）
-		maxRetries := 15
-		retryInterval := 2 * time.Second
-		var err error
-		for i := 0; i < maxRetries; i++ {
-			if err = amiManager.Init(); err == nil {
-				log.Println("AMI manager initialized successfully")
-				// 注册 SMS handler，通过 AMI 事件接收的 SMS 也会保存到数据库
-				smsHandler := sms.NewHandler()
-				smsHandler.Register()
-
-				// 设置 dongle 设备健康检查的通知回调
-				amiManager.SetDongleAlertFn(func(deviceID, message string) {
-					smsHandler.SendAlert(deviceID, message)
-				})
-				return
-			}
-			if i < maxRetries-1 {
-				log.Printf("Failed to initialize AMI manager (attempt %d/%d): %v, retrying in %v...", i+1, maxRetries, err, retryInterval)
-				time.Sleep(retryInterval)
-			}
-		}
-		log.Printf("Warning: Failed to initialize AMI manager after %d attempts: %v", maxRetries, err)
-		log.Println("AMI features will be unavailable, but the web server will still start")
-	}()
+	// 设置工作目录为 /app（与容器内的工作目录一致）
+	// 这样 static.LocalFile 可以使用相对路径
+	if err := os.Chdir("/app"); err != nil {
+		log.Printf("Warning: Failed to change working directory to /app: %v", err)
+	}
+
+	// 收到 SIGTERM（docker stop/restart）或 SIGINT 时优雅退出
+	ctx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// 进程内唯一的短信处理器：AMI 事件和 dialplan 回调（/sms/receive）两个入口共用，在同一个队列中去重和串行处理
+	smsHandler := sms.NewHandler()
+
+	// 按依赖顺序注册后台组件，停止时按相反顺序：先停止 watcher 和定时任务，再处理完短信队列，最后关闭 AMI
+	lc := newLifecycle(renderer, smsHandler)
 
 	// 设置 Gin 模式
 	gin.SetMode(gin.ReleaseMode)
@@ -91,14 +104,9 @@ func main() {
 	// 创建 Gin 引擎
 	engine := gin.Default()
 
-	// 设置工作目录为 /app（与容器内的工作目录一致）
-	// 这样 static.LocalFile 可以使用相对路径
-	if err := os.Chdir("/app"); err != nil {
-		log.Printf("Warning: Failed to change working directory to /app: %v", err)
-	}
-
 	// 创建路由并设置
-	router := web.NewRouter(renderer)
+	router := web.NewRouter(renderer, smsHandler)
+	router.SetLifecycle(lc)
 	router.SetupRoutes(engine)
 
 	// 获取端口
@@ -107,12 +115,192 @@ func main() {
 		port = "8071"
 	}
 
-	// 启动服务器
-	addr := fmt.Sprintf(":%s", port)
-	log.Printf("Starting web server on %s", addr)
-	if err := engine.Run(addr); err != nil {
-		log.Fatalf("Failed to start web server: %v", err)
+	// 所有请求的 context 都派生自 baseCtx，关闭时取消，结束 SSE/WebSocket 长连接
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	server := &http.Server{
+		Addr:        fmt.Sprintf(":%s", port),
+		Handler:     engine,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	server.RegisterOnShutdown(cancelBase)
+
+	// 内部回调接口（Asterisk dialplan 调用），只监听本机回环地址，使用共享密钥认证
+	ingestEngine := gin.New()
+	ingestEngine.Use(gin.Logger(), gin.Recovery())
+	router.SetupIngestRoutes(ingestEngine)
+	ingestServer := &http.Server{
+		Addr:    config.IngestAddr(),
+		Handler: ingestEngine,
+	}
+
+	// 启动服务器（不等待 AMI，Asterisk 启动期间也可以访问管理界面）
+	serverErr := make(chan error, 2)
+	for _, srv := range []*http.Server{server, ingestServer} {
+		go func(srv *http.Server) {
+			log.Printf("Starting web server on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}(srv)
+	}
+
+	// 在后台按顺序启动组件（AMI 需要等待 Asterisk 启动）
+	startCtx, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
+	go func() {
+		if err := lc.Start(startCtx); err != nil && startCtx.Err() == nil {
+			log.Printf("Warning: %v", err)
+			log.Println("Components depending on it will be unavailable, but the web server will still run")
+		}
+	}()
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		log.Println("Shutdown signal received, shutting down...")
+	case err := <-serverErr:
+		log.Printf("Failed to start web server: %v", err)
+		exitCode = 1
+	}
+	// 再次收到信号时直接退出
+	stopSignals()
+	cancelStart()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// 先停止接收新请求，再停止后台组件
+	for _, srv := range []*http.Server{server, ingestServer} {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Warning: Failed to shut down web server %s gracefully: %v", srv.Addr, err)
+		}
+	}
+	if err := lc.Stop(shutdownCtx); err != nil {
+		log.Printf("Warning: Shutdown incomplete: %v", err)
+		exitCode = 1
+	}
+	// AMI 没有启动成功时 sms 组件不会停止，这里处理完 /sms/receive 收到的短信
+	if err := smsHandler.Close(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
+		exitCode = 1
+	}
+	log.Println("Shutdown complete")
+	os.Exit(exitCode)
+}
+
+// newLifecycle 注册后台组件（按启动顺序）
+func newLifecycle(renderer *config.Renderer, smsHandler *sms.Handler) *lifecycle.Manager {
+	lc := lifecycle.New()
+	amiManager := ami.GetManager()
+
+	// 录音保留期和存储上限清理（不依赖 AMI）
+	cleaner := recording.GetCleaner()
+	lc.Add(lifecycle.Component{
+		Name:  "recording-cleaner",
+		Start: func(context.Context) error { cleaner.Start(); return nil },
+		Stop:  func(context.Context) error { cleaner.Stop(); return nil },
+	})
+
+	// AMI 管理器（重试等待 Asterisk 启动）
+	lc.Add(lifecycle.Component{
+		Name:  "ami",
+		Start: func(ctx context.Context) error { return initAMI(ctx, amiManager) },
+		Stop:  func(context.Context) error { return amiManager.Close() },
+	})
+
+	// SMS handler 订阅 AMI 短信事件
+	// 停止时（AMI 关闭之前）处理完队列中的短信（入库和推送通知），之后收到的短信留在 SIM 卡上，重启后重新处理
+	lc.Add(lifecycle.Component{
+		Name:      "sms",
+		DependsOn: []string{"ami"},
+		Start: func(context.Context) error {
+			smsHandler.Register()
+			// 设置 dongle 设备健康检查的通知回调
+			amiManager.SetDongleAlertFn(func(deviceID, message string) {
+				smsHandler.SendAlert(deviceID, message)
+			})
+			return nil
+		},
+		Stop: func(ctx context.Context) error { return smsHandler.Close(ctx) },
+	})
+
+	lc.Add(lifecycle.Component{
+		Name:      "ami-subscribers",
+		DependsOn: []string{"ami"},
+		Start: func(context.Context) error {
+			// 注册 USSD 服务，接收 AMI 中的 USSD 事件
+			ussd.GetService().Register()
+			// 注册点击拨号跟踪和活动通话监控，接收 AMI 通话事件
+			calls.GetTracker().Register()
+			calls.GetMonitor().Register()
+			// 将 Asterisk 状态和 dongle 状态变化推送到实时事件流
+			events.GetAMIFeed().Register()
+			return nil
+		},
+	})
+
+	// 余额和套餐有效期定时查询（不依赖 AMI 启动成功，查询时 AMI 不可用只记录失败）
+	balanceScheduler := balance.GetScheduler()
+	lc.Add(lifecycle.Component{
+		Name: "balance-scheduler",
+		Start: func(context.Context) error {
+			balanceScheduler.SetAlertFn(smsHandler.SendAlert)
+			balanceScheduler.Start()
+			return nil
+		},
+		Stop: func(context.Context) error { balanceScheduler.Stop(); return nil },
+	})
+
+	// USB 模块端口校正和热插拔检测（直接访问串口，不依赖 AMI）
+	watcher := discovery.GetWatcher()
+	lc.Add(lifecycle.Component{
+		Name: "dongle-discovery",
+		Start: func(context.Context) error {
+			// 按 IMEI 校正 dongle 端口（重启后 USB 串口编号可能变化）
+			if changed, err := discovery.NewScanner().Reconcile(); err != nil {
+				log.Printf("Warning: Failed to reconcile dongle ports: %v", err)
+			} else if len(changed) > 0 {
+				log.Printf("Dongle ports changed for %v, re-rendering quectel.conf", changed)
+				if err := renderer.RenderAll(); err != nil {
+					log.Printf("Warning: Failed to render config after port change: %v", err)
+				} else if err := amiManager.ReloadQuectel(); err != nil {
+					log.Printf("Warning: Failed to reload Asterisk after port change: %v", err)
+				}
+			}
+
+			watcher.SetAlertFn(smsHandler.SendAlert)
+			watcher.SetRenderFn(renderer.RenderAll)
+			watcher.Start()
+			return nil
+		},
+		Stop: func(context.Context) error { watcher.Stop(); return nil },
+	})
+
+	return lc
+}
+
+// initAMI 初始化 AMI 管理器，失败时重试（等待 Asterisk 启动），ctx 取消时放弃
+func initAMI(ctx context.Context, amiManager *ami.Manager) error {
+	var err error
+	for i := 0; i < amiInitRetries; i++ {
+		if err = amiManager.InitContext(ctx); err == nil {
+			log.Println("AMI manager initialized successfully")
+			return nil
+		}
+		if i < amiInitRetries-1 {
+			log.Printf("Failed to initialize AMI manager (attempt %d/%d): %v, retrying in %v...", i+1, amiInitRetries, err, amiInitRetryInterval)
+			select {
+			case <-time.After(amiInitRetryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return fmt.Errorf("failed to initialize AMI manager after %d attempts: %w", amiInitRetries, err)
 }
 
 // reloadAsteriskManager 重新加载 Asterisk manager 配置
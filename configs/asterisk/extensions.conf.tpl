@@ -7,6 +7,18 @@ priorityjumping=no
 
 [globals]
 ; 全局变量
+; 录音目录和录音策略（always、ondemand、never），由 [recording] 子程序读取
+REC_DIR={{.RecordingDir}}
+; webpanel 内部回调接口（只监听本机）和共享密钥，dialplan 中的 curl 调用通过 X-Ingest-Token 请求头携带密钥
+INGEST_URL={{.IngestURL}}
+INGEST_TOKEN={{.IngestSecret}}
+; clearglobalvars=no 时 reload 不会清除旧变量，因此 never 也要写出
+{{range .Extensions}}
+REC_EXT_{{.Username}}={{.RecordingPolicy}}
+{{end}}
+{{range .Dongles}}
+REC_DONGLE_{{.DeviceID}}={{.RecordingPolicy}}
+{{end}}
 
 [default]
 ; 默认上下文
@@ -16,11 +28,35 @@ priorityjumping=no
 {{if not .Disable}}
 ; Dongle {{.DeviceID}} 外呼前缀 {{.DialPrefix}}
 exten => _{{.DialPrefix}}X.,1,NoOp(Outgoing call via {{.DeviceID}} to ${EXTEN:{{len .DialPrefix}}})
-exten => _{{.DialPrefix}}X.,n,Dial(Quectel/{{.DeviceID}}/${EXTEN:{{len .DialPrefix}}})
+exten => _{{.DialPrefix}}X.,n,Dial(Quectel/{{.DeviceID}}/${EXTEN:{{len .DialPrefix}}},,U(recording^outbound^{{.DeviceID}}^${CHANNEL(endpoint)}^${EXTEN:{{len .DialPrefix}}}^${UNIQUEID}))
 exten => _{{.DialPrefix}}X.,n,Hangup()
 {{end}}
 {{end}}
 
+; 外呼路由：按号码模式选择 dongle，遇到 CHANUNAVAIL/CONGESTION（设备忙或不可用）时尝试下一个
+; 同一模式的多条路由按优先级依次尝试，不在生效时间内的路由直接跳过
+; 运营商前缀按去掉 strip 位、添加 prepend 之前的号码匹配
+{{range .OutboundPatterns}}{{$pattern := .Pattern}}
+exten => {{$pattern}},1,NoOp(Outbound call to ${EXTEN})
+{{range .Routes}}{{$route := .}}exten => {{$pattern}},n({{.Label}}),NoOp(Trying outbound route {{.Name}})
+{{if .TimeCondLabel}}exten => {{$pattern}},n,Gosub(time-conditions,{{.TimeCondLabel}},1)
+exten => {{$pattern}},n,GotoIf($["${TC_RESULT}" = "open"]?:{{.NextLabel}})
+{{else if .TimeCondition}}exten => {{$pattern}},n,GotoIfTime({{.TimeCondition}}?:{{.NextLabel}})
+{{end}}exten => {{$pattern}},n,Set(DIALNUM=${EXTEN:{{.Strip}}})
+exten => {{$pattern}},n,Set(OUTNUM={{.Prepend}}${DIALNUM})
+{{range .Carriers}}exten => {{$pattern}},n,GotoIf($["${DIALNUM:0:{{.PrefixLen}}}" = "{{.Prefix}}"]?{{.Label}})
+{{end}}{{range .Dials}}exten => {{$pattern}},n,Dial({{.}}/${OUTNUM},,U(recording^outbound^^${CHANNEL(endpoint)}^${OUTNUM}^${UNIQUEID}))
+exten => {{$pattern}},n,GotoIf($[$["${DIALSTATUS}" = "CHANUNAVAIL"] | $["${DIALSTATUS}" = "CONGESTION"]]?:done)
+{{end}}exten => {{$pattern}},n,Goto({{.NextLabel}})
+{{range .Carriers}}exten => {{$pattern}},n({{.Label}}),NoOp(Destination prefix {{.Prefix}} - same-carrier SIM first)
+{{range .Dials}}exten => {{$pattern}},n,Dial({{.}}/${OUTNUM},,U(recording^outbound^^${CHANNEL(endpoint)}^${OUTNUM}^${UNIQUEID}))
+exten => {{$pattern}},n,GotoIf($[$["${DIALSTATUS}" = "CHANUNAVAIL"] | $["${DIALSTATUS}" = "CONGESTION"]]?:done)
+{{end}}exten => {{$pattern}},n,Goto({{$route.NextLabel}})
+{{end}}{{end}}exten => {{$pattern}},n(failed),NoOp(All outbound routes failed: ${DIALSTATUS})
+exten => {{$pattern}},n,Congestion()
+exten => {{$pattern}},n(done),Hangup()
+{{end}}
+
 ; Extension 之间互相呼叫
 {{range .Extensions}}
 exten => {{.Username}},1,NoOp(Call from ${CALLERID(num)} to extension {{.Username}})
@@ -53,26 +89,58 @@ exten => _X.,n,Hangup()
 exten => sms,1,Verbose(Incoming SMS from ${CALLERID(num)} on ${QUECTELNAME}: ${BASE64_DECODE(${SMS_BASE64})})
 exten => sms,n,System(echo '${STRFTIME(${EPOCH},,%Y-%m-%d %H:%M:%S)} - ${QUECTELNAME} - From: ${CALLERID(num)} - Base64: ${SMS_BASE64}' >> /var/log/asterisk/sms.txt)
 ; 通过 curl 调用 API 处理短信，避免 AMI 协议解析中文字符的问题
-; 使用容器内的 webpanel 服务地址（localhost:8071）
-exten => sms,n,System(curl -X POST http://localhost:8071/api/v1/sms/receive -H "Content-Type: application/json" -d '{"device":"${QUECTELNAME}","sender":"${CALLERID(num)}","message":"${SMS_BASE64}","timestamp":"${SMS_TIMESTAMP}"}' > /dev/null 2>&1)
+; 使用 webpanel 的内部回调接口（INGEST_URL）
+exten => sms,n,System(curl -X POST ${INGEST_URL}/api/v1/sms/receive -H "X-Ingest-Token: ${INGEST_TOKEN}" -H "Content-Type: application/json" -d '{"device":"${QUECTELNAME}","sender":"${CALLERID(num)}","message":"${SMS_BASE64}","timestamp":"${SMS_TIMESTAMP}"}' > /dev/null 2>&1)
 exten => sms,n,Hangup()
 
 ; 处理收到的 USSD
 exten => ussd,1,Verbose(Incoming USSD on ${QUECTELNAME}: ${BASE64_DECODE(${USSD_BASE64})})
 exten => ussd,n,System(echo '${STRFTIME(${EPOCH},,%Y-%m-%d %H:%M:%S)} - ${QUECTELNAME} - Base64: ${USSD_BASE64}' >> /var/log/asterisk/ussd.txt)
+; 通过 curl 调用 API 保存 USSD 响应（USSD_TYPE 为 +CUSD 的 <m>，1 表示菜单等待回复）
+exten => ussd,n,System(curl -X POST ${INGEST_URL}/api/v1/ussd/receive -H "X-Ingest-Token: ${INGEST_TOKEN}" -H "Content-Type: application/json" -d '{"device":"${QUECTELNAME}","message":"${USSD_BASE64}","type":"${USSD_TYPE}"}' > /dev/null 2>&1)
 exten => ussd,n,Hangup()
 
 ; 处理来电：根据 QUECTELNAME 路由到绑定的 extension（同时振铃）
 exten => s,1,NoOp(Incoming call from quectel ${QUECTELNAME})
 exten => s,n,GotoIf($["${QUECTELNAME}" = ""]?no-binding)
+; 黑白名单检查：webpanel 返回 allow、reject、busy、drop 或 voicemail:<信箱>（查询失败时放行）
+exten => s,n,Set(CURLOPT(conntimeout)=2)
+exten => s,n,Set(CURLOPT(httptimeout)=3)
+exten => s,n,Set(CURLOPT(httpheader)=X-Ingest-Token: ${INGEST_TOKEN})
+exten => s,n,Set(BLOCK_RESULT=${CURL(${INGEST_URL}/api/v1/blocklist/check?kind=call&device=${QUECTELNAME}&number=${URIENCODE(${CALLERID(num)})}&unique_id=${UNIQUEID})})
+exten => s,n,Set(BLOCK_ACTION=${CUT(BLOCK_RESULT,:,1)})
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "reject"]?blocked-reject)
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "busy"]?blocked-busy)
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "voicemail"]?blocked-voicemail)
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "drop"]?blocked-drop)
+; 配置了呼叫转移的 dongle 先检查转移规则（无条件转移直接转出，忙/无人接听转移记录到 FWD_<DIALSTATUS> 后回到 routing）
+exten => s,n,Set(FWD_CONTEXT=${CONTEXT})
+{{range .CallForwards}}
+exten => s,n,GotoIf($["${QUECTELNAME}" = "{{.DongleID}}"]?call-forward,{{.DongleID}},1)
+{{end}}
+exten => s,n(routing),NoOp(Routing incoming call from quectel ${QUECTELNAME})
+; 配置了来电路由的 dongle 优先走来电路由
+{{range .InboundRoutes}}
+exten => s,n,GotoIf($["${QUECTELNAME}" = "{{.DongleID}}"]?inbound-routes,{{.DongleID}},1)
+{{end}}
 {{range $dongleID, $extensions := .InboundBindingsByDongle}}
 exten => s,n,GotoIf($["${QUECTELNAME}" = "{{$dongleID}}"]?binding-{{$dongleID}})
 {{end}}
 exten => s,n(no-binding),NoOp(No extension binding found for quectel ${QUECTELNAME})
+exten => s,n,GotoIf($["${FWD_CHANUNAVAIL}" != ""]?call-forward,${FWD_CHANUNAVAIL},1)
+exten => s,n,Hangup()
+; 黑名单处理：拒接、回忙音、转语音信箱，或一直振铃不接听（静默丢弃）
+exten => s,n(blocked-reject),Hangup(21)
+exten => s,n(blocked-busy),Busy(10)
+exten => s,n(blocked-voicemail),VoiceMail(${CUT(BLOCK_RESULT,:,2)}@default,u)
+exten => s,n,Hangup()
+exten => s,n(blocked-drop),Ringing()
+exten => s,n,Wait(20)
 exten => s,n,Hangup()
 {{range $dongleID, $extensions := .InboundBindingsByDongle}}
 exten => s,n(binding-{{$dongleID}}),NoOp(Routing quectel {{$dongleID}} - simultaneous ring to {{len $extensions}} extension(s))
-exten => s,n,Dial({{range $i, $ext := $extensions}}{{if $i}}&{{end}}PJSIP/{{$ext.Username}}{{end}},30)
+exten => s,n,Dial({{range $i, $ext := $extensions}}{{if $i}}&{{end}}PJSIP/{{$ext.Username}}{{end}},30,U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))
+exten => s,n,GotoIf($["${FWD_${DIALSTATUS}}" != ""]?call-forward,${FWD_${DIALSTATUS}},1)
 exten => s,n,Hangup()
 {{end}}
 
@@ -83,26 +151,58 @@ exten => s,n,Hangup()
 exten => sms,1,Verbose(Incoming SMS from ${CALLERID(num)} on ${QUECTELNAME}: ${BASE64_DECODE(${SMS_BASE64})})
 exten => sms,n,System(echo '${STRFTIME(${EPOCH},,%Y-%m-%d %H:%M:%S)} - ${QUECTELNAME} - From: ${CALLERID(num)} - Base64: ${SMS_BASE64}' >> /var/log/asterisk/sms.txt)
 ; 通过 curl 调用 API 处理短信，避免 AMI 协议解析中文字符的问题
-; 使用容器内的 webpanel 服务地址（localhost:8071）
-exten => sms,n,System(curl -X POST http://localhost:8071/api/v1/sms/receive -H "Content-Type: application/json" -d '{"device":"${QUECTELNAME}","sender":"${CALLERID(num)}","message":"${SMS_BASE64}","timestamp":"${SMS_TIMESTAMP}"}' > /dev/null 2>&1)
+; 使用 webpanel 的内部回调接口（INGEST_URL）
+exten => sms,n,System(curl -X POST ${INGEST_URL}/api/v1/sms/receive -H "X-Ingest-Token: ${INGEST_TOKEN}" -H "Content-Type: application/json" -d '{"device":"${QUECTELNAME}","sender":"${CALLERID(num)}","message":"${SMS_BASE64}","timestamp":"${SMS_TIMESTAMP}"}' > /dev/null 2>&1)
 exten => sms,n,Hangup()
 
 ; 处理收到的 USSD
 exten => ussd,1,Verbose(Incoming USSD on ${QUECTELNAME}: ${BASE64_DECODE(${USSD_BASE64})})
 exten => ussd,n,System(echo '${STRFTIME(${EPOCH},,%Y-%m-%d %H:%M:%S)} - ${QUECTELNAME} - Base64: ${USSD_BASE64}' >> /var/log/asterisk/ussd.txt)
+; 通过 curl 调用 API 保存 USSD 响应（USSD_TYPE 为 +CUSD 的 <m>，1 表示菜单等待回复）
+exten => ussd,n,System(curl -X POST ${INGEST_URL}/api/v1/ussd/receive -H "X-Ingest-Token: ${INGEST_TOKEN}" -H "Content-Type: application/json" -d '{"device":"${QUECTELNAME}","message":"${USSD_BASE64}","type":"${USSD_TYPE}"}' > /dev/null 2>&1)
 exten => ussd,n,Hangup()
 
 ; 处理来电：根据 QUECTELNAME 路由到绑定的 extension（同时振铃）
 exten => s,1,NoOp(Incoming call from quectel ${QUECTELNAME})
 exten => s,n,GotoIf($["${QUECTELNAME}" = ""]?no-binding)
+; 黑白名单检查：webpanel 返回 allow、reject、busy、drop 或 voicemail:<信箱>（查询失败时放行）
+exten => s,n,Set(CURLOPT(conntimeout)=2)
+exten => s,n,Set(CURLOPT(httptimeout)=3)
+exten => s,n,Set(CURLOPT(httpheader)=X-Ingest-Token: ${INGEST_TOKEN})
+exten => s,n,Set(BLOCK_RESULT=${CURL(${INGEST_URL}/api/v1/blocklist/check?kind=call&device=${QUECTELNAME}&number=${URIENCODE(${CALLERID(num)})}&unique_id=${UNIQUEID})})
+exten => s,n,Set(BLOCK_ACTION=${CUT(BLOCK_RESULT,:,1)})
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "reject"]?blocked-reject)
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "busy"]?blocked-busy)
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "voicemail"]?blocked-voicemail)
+exten => s,n,GotoIf($["${BLOCK_ACTION}" = "drop"]?blocked-drop)
+; 配置了呼叫转移的 dongle 先检查转移规则（无条件转移直接转出，忙/无人接听转移记录到 FWD_<DIALSTATUS> 后回到 routing）
+exten => s,n,Set(FWD_CONTEXT=${CONTEXT})
+{{range .CallForwards}}
+exten => s,n,GotoIf($["${QUECTELNAME}" = "{{.DongleID}}"]?call-forward,{{.DongleID}},1)
+{{end}}
+exten => s,n(routing),NoOp(Routing incoming call from quectel ${QUECTELNAME})
+; 配置了来电路由的 dongle 优先走来电路由
+{{range .InboundRoutes}}
+exten => s,n,GotoIf($["${QUECTELNAME}" = "{{.DongleID}}"]?inbound-routes,{{.DongleID}},1)
+{{end}}
 {{range $dongleID, $extensions := .InboundBindingsByDongle}}
 exten => s,n,GotoIf($["${QUECTELNAME}" = "{{$dongleID}}"]?binding-{{$dongleID}})
 {{end}}
 exten => s,n(no-binding),NoOp(No extension binding found for quectel ${QUECTELNAME})
+exten => s,n,GotoIf($["${FWD_CHANUNAVAIL}" != ""]?call-forward,${FWD_CHANUNAVAIL},1)
+exten => s,n,Hangup()
+; 黑名单处理：拒接、回忙音、转语音信箱，或一直振铃不接听（静默丢弃）
+exten => s,n(blocked-reject),Hangup(21)
+exten => s,n(blocked-busy),Busy(10)
+exten => s,n(blocked-voicemail),VoiceMail(${CUT(BLOCK_RESULT,:,2)}@default,u)
+exten => s,n,Hangup()
+exten => s,n(blocked-drop),Ringing()
+exten => s,n,Wait(20)
 exten => s,n,Hangup()
 {{range $dongleID, $extensions := .InboundBindingsByDongle}}
 exten => s,n(binding-{{$dongleID}}),NoOp(Routing quectel {{$dongleID}} - simultaneous ring to {{len $extensions}} extension(s))
-exten => s,n,Dial({{range $i, $ext := $extensions}}{{if $i}}&{{end}}PJSIP/{{$ext.Username}}{{end}},30)
+exten => s,n,Dial({{range $i, $ext := $extensions}}{{if $i}}&{{end}}PJSIP/{{$ext.Username}}{{end}},30,U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))
+exten => s,n,GotoIf($["${FWD_${DIALSTATUS}}" != ""]?call-forward,${FWD_${DIALSTATUS}},1)
 exten => s,n,Hangup()
 {{end}}
 
@@ -111,11 +211,166 @@ exten => s,n,Hangup()
 {{if .Outbound}}
 ; Extension {{.Extension.Username}} 通过 Quectel {{.DongleID}} 去电
 exten => {{.Extension.Username}},1,NoOp(Outgoing call from extension {{.Extension.Username}} via quectel {{.DongleID}} to ${EXTEN:{{len .Extension.Username}}})
-exten => {{.Extension.Username}},n,Dial(Quectel/{{.DongleID}}/${EXTEN:{{len .Extension.Username}}})
+exten => {{.Extension.Username}},n,Dial(Quectel/{{.DongleID}}/${EXTEN:{{len .Extension.Username}}},,U(recording^outbound^{{.DongleID}}^${CHANNEL(endpoint)}^${EXTEN:{{len .Extension.Username}}}^${UNIQUEID}))
 exten => {{.Extension.Username}},n,Hangup()
 {{end}}
 {{end}}
 
+; 时间条件子程序：Gosub(time-conditions,tc-<ID>,1) 后 TC_RESULT 为 open（工作时间）或 closed
+; 判断顺序：调休上班日（只看时间段）> 节假日 > 每周工作时间
+[time-conditions]
+{{range $c := .TimeConditions}}
+exten => {{$c.Label}},1,NoOp(Time condition {{$c.Name}})
+exten => {{$c.Label}},n,Set(TC_RESULT=closed)
+exten => {{$c.Label}},n,Set(TC_TODAY=${STRFTIME(${EPOCH},{{$c.Timezone}},%Y%m%d)})
+{{range $c.Open}}
+exten => {{$c.Label}},n,GotoIf($[${TC_TODAY} >= {{.Start}} & ${TC_TODAY} <= {{.End}}]?workday)
+{{end}}
+{{range $c.Closed}}
+exten => {{$c.Label}},n,GotoIf($[${TC_TODAY} >= {{.Start}} & ${TC_TODAY} <= {{.End}}]?done)
+{{end}}
+{{range $c.Rules}}
+exten => {{$c.Label}},n,GotoIfTime({{.Times}},{{.Weekdays}},*,*{{if $c.Timezone}},{{$c.Timezone}}{{end}}?open)
+{{end}}
+exten => {{$c.Label}},n,Goto(done)
+exten => {{$c.Label}},n(workday),NoOp(Make-up workday)
+{{range $c.Rules}}
+exten => {{$c.Label}},n,GotoIfTime({{.Times}},*,*,*{{if $c.Timezone}},{{$c.Timezone}}{{end}}?open)
+{{end}}
+exten => {{$c.Label}},n,Goto(done)
+exten => {{$c.Label}},n(open),Set(TC_RESULT=open)
+exten => {{$c.Label}},n(done),Return()
+{{end}}
+
+; 呼叫转移：每个 dongle 一个 exten 按顺序检查规则，fwd-<ID> 执行转移
+; 无条件转移直接转出；忙/无人接听转移只记录 FWD_<DIALSTATUS>，由本地振铃失败后跳转
+[call-forward]
+{{range $f := .CallForwards}}
+exten => {{$f.DongleID}},1,NoOp(Checking call forwarding for quectel {{$f.DongleID}})
+{{range $i, $rule := $f.Rules}}
+exten => {{$f.DongleID}},n,NoOp(Forward rule {{$rule.ID}}: {{$rule.Mode}} to {{$rule.Number}})
+{{if $rule.TimeCondLabel}}
+exten => {{$f.DongleID}},n,Gosub(time-conditions,{{$rule.TimeCondLabel}},1)
+exten => {{$f.DongleID}},n,GotoIf($["${TC_RESULT}" != "{{$rule.ActiveWhen}}"]?skip-{{$i}})
+{{end}}
+{{if eq $rule.Mode "unconditional"}}
+exten => {{$f.DongleID}},n,Goto({{$rule.Label}},1)
+{{else}}
+{{range $rule.Statuses}}
+exten => {{$f.DongleID}},n,ExecIf($["${FWD_{{.}}}" = ""]?Set(FWD_{{.}}={{$rule.Label}}))
+{{end}}
+{{end}}
+exten => {{$f.DongleID}},n(skip-{{$i}}),NoOp()
+{{end}}
+exten => {{$f.DongleID}},n,Goto(${FWD_CONTEXT},s,routing)
+{{range $f.Rules}}
+exten => {{.Label}},1,NoOp(Forwarding ${CALLERID(num)} from quectel ${QUECTELNAME} to {{.Number}} via quectel {{.Via}})
+{{if eq .CallerIDMode "hidden"}}
+exten => {{.Label}},n,Set(CALLERID(num-pres)=prohib)
+{{else if eq .CallerIDMode "sms"}}
+exten => {{.Label}},n,QuectelSendSMS({{.Via}},{{.Number}},Call from ${CALLERID(num)} to ${QUECTELNAME},1440,no,"fwd")
+{{end}}
+exten => {{.Label}},n,Dial(Quectel/{{.Via}}/{{.Number}},{{.Timeout}})
+exten => {{.Label}},n,Hangup()
+{{end}}
+{{end}}
+
+; 来电路由：按 dongle 配置的振铃策略呼叫成员，无人接听时转到最终去向
+; ringall 同时振铃；sequential 按顺序逐个振铃；roundrobin 每次从上次的下一个成员开始；random 随机起点
+[inbound-routes]
+{{range $r := .InboundRoutes}}
+exten => {{$r.DongleID}},1,NoOp(Inbound route for quectel {{$r.DongleID}}: strategy={{$r.Strategy}}, {{len $r.Members}} member(s))
+{{if $r.TimeConditionLabel}}
+exten => {{$r.DongleID}},n,Gosub(time-conditions,{{$r.TimeConditionLabel}},1)
+exten => {{$r.DongleID}},n,GotoIf($["${TC_RESULT}" = "open"]?open)
+exten => {{$r.DongleID}},n,NoOp(Off hours on quectel {{$r.DongleID}}, destination: {{$r.OffHoursType}})
+{{if eq $r.OffHoursType "voicemail"}}
+exten => {{$r.DongleID}},n,VoiceMail({{$r.OffHoursTarget}}@default,u)
+{{else if $r.OffHoursDial}}
+exten => {{$r.DongleID}},n,Dial({{$r.OffHoursDial}},{{$r.FinalTimeout}})
+{{end}}
+exten => {{$r.DongleID}},n,Hangup()
+exten => {{$r.DongleID}},n(open),NoOp(Within working hours)
+{{end}}
+{{if eq $r.Strategy "ringall"}}
+{{if $r.Members}}
+exten => {{$r.DongleID}},n,Dial({{range $i, $m := $r.Members}}{{if $i}}&{{end}}PJSIP/{{$m.Username}}{{end}},{{$r.RingTimeout}},U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))
+exten => {{$r.DongleID}},n,GotoIf($["${DIALSTATUS}" = "ANSWER"]?done)
+{{end}}
+{{else}}
+{{if eq $r.Strategy "roundrobin"}}
+exten => {{$r.DongleID}},n,Set(HUNT_START=${IF($["${GLOBAL(RR_{{$r.DongleID}})}" = ""]?0:${GLOBAL(RR_{{$r.DongleID}})})})
+exten => {{$r.DongleID}},n,Set(GLOBAL(RR_{{$r.DongleID}})=$[(${HUNT_START} + 1) % {{len $r.Rotations}}])
+exten => {{$r.DongleID}},n,Goto(start-${HUNT_START})
+{{else if eq $r.Strategy "random"}}
+exten => {{$r.DongleID}},n,Set(HUNT_START=${RAND(0,{{$r.LastRotation}})})
+exten => {{$r.DongleID}},n,Goto(start-${HUNT_START})
+{{end}}
+{{range $i, $rotation := $r.Rotations}}
+exten => {{$r.DongleID}},n(start-{{$i}}),NoOp(Hunting from member {{$i}})
+{{range $rotation}}
+exten => {{$r.DongleID}},n,Dial(PJSIP/{{.Username}},{{.Timeout}},U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))
+exten => {{$r.DongleID}},n,GotoIf($["${DIALSTATUS}" = "ANSWER"]?done)
+{{end}}
+exten => {{$r.DongleID}},n,Goto(final)
+{{end}}
+{{end}}
+exten => {{$r.DongleID}},n(final),NoOp(No answer on quectel {{$r.DongleID}}, final destination: {{$r.FinalType}})
+exten => {{$r.DongleID}},n,GotoIf($["${FWD_${DIALSTATUS}}" != ""]?call-forward,${FWD_${DIALSTATUS}},1)
+{{if eq $r.FinalType "voicemail"}}
+exten => {{$r.DongleID}},n,VoiceMail({{$r.FinalTarget}}@default,u)
+{{else if $r.FinalDial}}
+exten => {{$r.DongleID}},n,Dial({{$r.FinalDial}},{{$r.FinalTimeout}})
+{{end}}
+exten => {{$r.DongleID}},n(done),Hangup()
+{{end}}
+
+; 点击拨号：webpanel 通过 AMI Originate 先呼叫分机，分机接听后进入本上下文
+; 通过通道变量 CLICK_DONGLE 指定的 dongle 拨打 ${EXTEN}，分机通道的 UNIQUEID 即呼叫 ID
+[click-to-call]
+exten => _[+0-9].,1,NoOp(Click-to-call from extension ${CHANNEL(endpoint)} via quectel ${CLICK_DONGLE} to ${EXTEN})
+exten => _[+0-9].,n,Dial(Quectel/${CLICK_DONGLE}/${EXTEN},,U(recording^outbound^${CLICK_DONGLE}^${CHANNEL(endpoint)}^${EXTEN}^${UNIQUEID}))
+exten => _[+0-9].,n,Hangup()
+
+; 通话录音：通过 Dial 的 U() 在被叫通道接听后执行
+; 参数：ARG1 方向（inbound/outbound），ARG2 dongle（为空时从被叫通道名解析），ARG3 分机（为空时取被叫 PJSIP endpoint），
+; ARG4 对方号码，ARG5 主叫通道 UNIQUEID（用于关联通话记录）
+; 分机或 dongle 任一方为 always 时自动录音；任一方为 ondemand 时分机可在通话中按键开始/停止录音
+; MixMonitor 结束时调用 webpanel 登记录音文件
+[recording]
+exten => s,1,Set(REC_DIRECTION=${ARG1})
+exten => s,n,Set(REC_DONGLE=${ARG2})
+exten => s,n,Set(REC_EXT=${ARG3})
+exten => s,n,Set(REC_PEER=${CUT(CHANNEL,/,2)})
+exten => s,n,ExecIf($["${REC_DONGLE}" = ""]?Set(REC_DONGLE=${CUT(REC_PEER,-,1)}))
+exten => s,n,GotoIf($["${REC_EXT}" != ""]?policy)
+exten => s,n,Set(REC_EXT=${CHANNEL(endpoint)})
+exten => s,n(policy),Set(REC_POLICY=never)
+exten => s,n,ExecIf($[$["${REC_DONGLE_${REC_DONGLE}}" = "ondemand"] | $["${REC_EXT_${REC_EXT}}" = "ondemand"]]?Set(REC_POLICY=ondemand))
+exten => s,n,ExecIf($[$["${REC_DONGLE_${REC_DONGLE}}" = "always"] | $["${REC_EXT_${REC_EXT}}" = "always"]]?Set(REC_POLICY=always))
+exten => s,n,GotoIf($["${REC_POLICY}" = "never"]?done)
+exten => s,n,Set(REC_FILE=${STRFTIME(${EPOCH},,%Y%m%d-%H%M%S)}-${ARG5}.wav)
+exten => s,n,Set(REC_POST=curl -s -X POST -H 'X-Ingest-Token: ${INGEST_TOKEN}' '${INGEST_URL}/api/v1/recordings/receive?file=${REC_FILE}&unique_id=${ARG5}&direction=${REC_DIRECTION}&dongle=${REC_DONGLE}&extension=${REC_EXT}&number=${URIENCODE(${ARG4})}' > /dev/null 2>&1)
+exten => s,n,GotoIf($["${REC_POLICY}" = "ondemand"]?ondemand)
+exten => s,n,MixMonitor(${REC_DIR}/${REC_FILE},ab,${REC_POST})
+exten => s,n,Set(REC_ACTIVE=1)
+exten => s,n,Return()
+; 来电时分机是被叫（本通道），外呼时分机是主叫（MASTER_CHANNEL），按键后在本通道执行 toggle
+exten => s,n(ondemand),GotoIf($["${REC_DIRECTION}" = "outbound"]?ondemand-peer)
+exten => s,n,Set(DYNAMIC_FEATURES=recordtoggle)
+exten => s,n,Return()
+exten => s,n(ondemand-peer),Set(MASTER_CHANNEL(DYNAMIC_FEATURES)=recordtogglepeer)
+exten => s,n(done),Return()
+; 按需录音开关：录音文件以追加方式写入，暂停后继续录音仍是同一个文件
+exten => toggle,1,GotoIf($["${REC_POLICY}" != "ondemand"]?done)
+exten => toggle,n,GotoIf($["${REC_ACTIVE}" = "1"]?stop)
+exten => toggle,n,MixMonitor(${REC_DIR}/${REC_FILE},ab,${REC_POST})
+exten => toggle,n,Set(REC_ACTIVE=1)
+exten => toggle,n,Return()
+exten => toggle,n(stop),StopMixMonitor()
+exten => toggle,n,Set(REC_ACTIVE=0)
+exten => toggle,n(done),Return()
+
 ; Quectel 短信发送上下文（用于通过 AMI Originate 发送短信）
 ; 使用 _[+0-9]. 匹配以 + 或数字开头的号码（支持国际号码格式）
 [quectel-sms]
@@ -0,0 +1,12 @@
+[general]
+
+[featuremap]
+; 咨询转接：通话中按 {{.AttendedTransferCode}} 拨打转接目标（Dial 带 t/T 选项时可用），AMI Atxfer 也需要该设置
+atxfer => {{.AttendedTransferCode}}
+
+[applicationmap]
+; 按需录音：录音策略为 ondemand 时，分机在通话中按 {{.RecordingToggleCode}} 开始/停止录音
+; 来电时录音状态在分机自己的通道上（self），外呼时在 dongle 通道上（peer）
+; 由 [recording] 子程序按需设置 DYNAMIC_FEATURES 启用
+recordtoggle => {{.RecordingToggleCode}},self,Gosub(recording,toggle,1)
+recordtogglepeer => {{.RecordingToggleCode}},peer,Gosub(recording,toggle,1)
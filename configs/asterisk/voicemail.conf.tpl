@@ -0,0 +1,15 @@
+[general]
+format=wav49|wav
+maxmsg=100
+maxsecs=300
+minsecs=2
+maxsilence=10
+; 不发送邮件通知
+attach=no
+
+[default]
+; 来电路由最终去向为语音信箱时使用，信箱号即分机号
+; dialplan 中没有 VoiceMailMain 入口，信箱密码仅占位
+{{range .VoicemailBoxes}}
+{{.Username}} => {{.Username}},Extension {{.Username}}
+{{end}}
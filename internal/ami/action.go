@@ -0,0 +1,195 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/staskobzar/goami2"
+)
+
+// Response AMI 动作的响应消息
+type Response struct {
+	*goami2.Message
+}
+
+// OK 响应是否成功（旧版 Asterisk 的 Command 返回 Follows）
+func (r Response) OK() bool {
+	if r.Message == nil {
+		return false
+	}
+	status := r.Field("Response")
+	return status == "Success" || status == "Follows"
+}
+
+// Output Command 动作的输出
+func (r Response) Output() string {
+	if r.Message == nil {
+		return ""
+	}
+	return commandOutput(r.Message)
+}
+
+// Event 列表类动作返回的事件（如 CoreShowChannel、AorDetail）
+type Event struct {
+	*goami2.Message
+}
+
+// Name 事件名称
+func (e Event) Name() string {
+	return e.Field("Event")
+}
+
+// ActionError 动作返回了 Response: Error
+type ActionError struct {
+	Action  string
+	Message string
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Action, e.Message)
+}
+
+// pendingAction 等待响应的动作
+type pendingAction struct {
+	response *goami2.Message
+	events   []*goami2.Message
+	err      error
+	done     chan struct{}
+}
+
+// Do 发送动作并等待响应；列表类动作（响应带 EventList: start）会继续收集同一 ActionID 的事件，
+// 直到 *Complete 事件（EventList: Complete）为止
+// 没有 ActionID 时自动生成；ctx 取消或超时、连接断开时返回错误
+// 响应为 Error 时返回 *ActionError（同时返回响应本身）
+// 收集的事件仍会分发给 Manager 的订阅者，只有响应消息被 Do 消费
+func (c *Client) Do(ctx context.Context, action *goami2.Message) (Response, []Event, error) {
+	name := action.Field("Action")
+	if action.Field("ActionID") == "" {
+		action.AddActionID()
+	}
+	actionID := action.Field("ActionID")
+
+	p := &pendingAction{done: make(chan struct{})}
+	c.pendingMu.Lock()
+	c.pending[actionID] = p
+	c.pendingMu.Unlock()
+
+	// 超时或取消时确保清理
+	defer func() {
+		c.pendingMu.Lock()
+		if c.pending[actionID] == p {
+			delete(c.pending, actionID)
+		}
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.SendAction(action); err != nil {
+		return Response{}, nil, fmt.Errorf("failed to send %s: %w", name, err)
+	}
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Response{}, nil, fmt.Errorf("timeout waiting for %s response: %w", name, ctx.Err())
+		}
+		return Response{}, nil, fmt.Errorf("%s cancelled: %w", name, ctx.Err())
+	}
+	if p.err != nil {
+		return Response{}, nil, fmt.Errorf("%s: %w", name, p.err)
+	}
+
+	resp := Response{p.response}
+	events := make([]Event, 0, len(p.events))
+	for _, msg := range p.events {
+		events = append(events, Event{msg})
+	}
+	if !resp.OK() {
+		return resp, events, &ActionError{Action: name, Message: resp.Field("Message")}
+	}
+	return resp, events, nil
+}
+
+// doWithTimeout 带超时调用 Do
+func (c *Client) doWithTimeout(action *goami2.Message, timeout time.Duration) (Response, []Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.Do(ctx, action)
+}
+
+// Command 执行 Asterisk CLI 命令并返回输出
+func (c *Client) Command(ctx context.Context, command string) (string, error) {
+	action := goami2.NewAction("Command")
+	action.SetField("Command", command)
+	resp, _, err := c.Do(ctx, action)
+	if err != nil {
+		return "", err
+	}
+	return resp.Output(), nil
+}
+
+// deliver 将消息交给等待中的 Do，返回 true 表示消息已被消费（不再分发）
+func (c *Client) deliver(actionID string, msg *goami2.Message) bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	p, ok := c.pending[actionID]
+	if !ok {
+		return false
+	}
+
+	if msg.Field("Response") != "" {
+		if p.response != nil {
+			return false
+		}
+		p.response = msg
+		if !isListStart(msg) {
+			c.finishLocked(actionID, p)
+		}
+		return true
+	}
+
+	// 列表事件：响应之前的同 ID 事件不属于本次动作
+	if p.response == nil || msg.Field("Event") == "" {
+		return false
+	}
+	p.events = append(p.events, msg)
+	if isListComplete(msg) {
+		c.finishLocked(actionID, p)
+	}
+	return false
+}
+
+// finishLocked 完成等待中的动作
+func (c *Client) finishLocked(actionID string, p *pendingAction) {
+	delete(c.pending, actionID)
+	close(p.done)
+}
+
+// failPending 连接断开时结束所有等待中的动作
+func (c *Client) failPending(err error) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	for actionID, p := range c.pending {
+		p.err = err
+		c.finishLocked(actionID, p)
+	}
+}
+
+// isListStart 响应是否表示后续还有列表事件
+func isListStart(msg *goami2.Message) bool {
+	if msg.Field("Response") != "Success" {
+		return false
+	}
+	return strings.EqualFold(msg.Field("EventList"), "start") ||
+		strings.Contains(msg.Field("Message"), "will follow")
+}
+
+// isListComplete 是否是列表结束事件
+func isListComplete(msg *goami2.Message) bool {
+	return strings.EqualFold(msg.Field("EventList"), "Complete") ||
+		strings.HasSuffix(msg.Field("Event"), "Complete")
+}
@@ -0,0 +1,185 @@
+package ami
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/staskobzar/goami2"
+)
+
+// OriginateRequest AMI Originate 参数
+type OriginateRequest struct {
+	Channel   string            // 先呼叫的通道（如 PJSIP/100）
+	Context   string            // 通道接听后进入的上下文
+	Exten     string            // 通道接听后进入的 exten
+	Priority  int               // 默认 1
+	App       string            // 通道接听后执行的应用（设置时忽略 Context/Exten，如 ChanSpy）
+	AppData   string            // 应用参数
+	ChannelID string            // 指定通道的 UNIQUEID，同时作为 ActionID（用于关联后续事件）
+	CallerID  string            // 呼叫 Channel 时显示的主叫
+	Timeout   time.Duration     // Channel 振铃超时
+	Variables map[string]string // 通道变量
+}
+
+// ChannelEvent 通话相关的 AMI 事件（只保留通话跟踪需要的字段）
+type ChannelEvent struct {
+	Event            string // Newchannel、Newstate、DialBegin、DialEnd、Hangup、OriginateResponse 等
+	ActionID         string
+	Channel          string
+	UniqueID         string
+	LinkedID         string
+	ChannelState     string
+	ChannelStateDesc string
+	CallerIDNum      string
+	CallerIDName     string
+	ConnectedLineNum string
+	Context          string
+	Exten            string
+	DestChannel      string // DialBegin/DialEnd/BridgeEnter 的对端
+	DestUniqueID     string
+	DialString       string // DialBegin 的拨号串（如 quectel0/13800000000）
+	DialStatus       string // DialEnd 的结果（ANSWER、BUSY、NOANSWER...）
+	Cause            string // Hangup 原因码
+	CauseTxt         string
+	Response         string // OriginateResponse 的 Success/Failure
+	Reason           string // OriginateResponse 的原因码
+	BridgeUniqueID   string // BridgeEnter/BridgeLeave 的桥 ID（CoreShowChannel 为 BridgeId）
+	Duration         string // CoreShowChannel 的通道时长（HH:MM:SS）
+	Time             time.Time
+}
+
+// channelEvents 需要分发给通话跟踪的事件
+var channelEvents = map[string]bool{
+	"Newchannel":        true,
+	"Newstate":          true,
+	"DialBegin":         true,
+	"DialEnd":           true,
+	"BridgeEnter":       true,
+	"BridgeLeave":       true,
+	"Hangup":            true,
+	"OriginateResponse": true,
+	// CoreShowChannels 的结果（状态轮询时定期查询，用于校正通道列表）
+	"CoreShowChannel":          true,
+	"CoreShowChannelsComplete": true,
+}
+
+// parseChannelEvent 解析通话事件，非通话事件返回 nil
+func parseChannelEvent(msg *goami2.Message) *ChannelEvent {
+	event := msg.Field("Event")
+	if !channelEvents[event] {
+		return nil
+	}
+	ev := &ChannelEvent{
+		Event:            event,
+		ActionID:         msg.Field("ActionID"),
+		Channel:          msg.Field("Channel"),
+		UniqueID:         msg.Field("Uniqueid"),
+		LinkedID:         msg.Field("Linkedid"),
+		ChannelState:     msg.Field("ChannelState"),
+		ChannelStateDesc: msg.Field("ChannelStateDesc"),
+		CallerIDNum:      msg.Field("CallerIDNum"),
+		CallerIDName:     msg.Field("CallerIDName"),
+		ConnectedLineNum: msg.Field("ConnectedLineNum"),
+		Context:          msg.Field("Context"),
+		Exten:            msg.Field("Exten"),
+		DestChannel:      msg.Field("DestChannel"),
+		DestUniqueID:     msg.Field("DestUniqueid"),
+		DialString:       msg.Field("DialString"),
+		DialStatus:       msg.Field("DialStatus"),
+		Cause:            msg.Field("Cause"),
+		CauseTxt:         msg.Field("Cause-txt"),
+		Response:         msg.Field("Response"),
+		Reason:           msg.Field("Reason"),
+		BridgeUniqueID:   msg.Field("BridgeUniqueid"),
+		Duration:         msg.Field("Duration"),
+		Time:             time.Now(),
+	}
+	if ev.BridgeUniqueID == "" {
+		ev.BridgeUniqueID = msg.Field("BridgeId")
+	}
+	return ev
+}
+
+// Originate 异步发起呼叫（结果通过 OriginateResponse 事件返回）
+func (c *Client) Originate(req OriginateRequest) error {
+	action := goami2.NewAction("Originate")
+	action.SetField("Channel", req.Channel)
+	if req.App != "" {
+		action.SetField("Application", req.App)
+		action.SetField("Data", req.AppData)
+	} else {
+		action.SetField("Context", req.Context)
+		action.SetField("Exten", req.Exten)
+		priority := req.Priority
+		if priority <= 0 {
+			priority = 1
+		}
+		action.SetField("Priority", fmt.Sprintf("%d", priority))
+	}
+	if req.ChannelID != "" {
+		action.SetField("ChannelId", req.ChannelID)
+	}
+	if req.CallerID != "" {
+		action.SetField("CallerID", req.CallerID)
+	}
+	if req.Timeout > 0 {
+		action.SetField("Timeout", fmt.Sprintf("%d", req.Timeout.Milliseconds()))
+	}
+	for name, value := range req.Variables {
+		action.AddField("Variable", fmt.Sprintf("%s=%s", name, value))
+	}
+	action.SetField("Async", "true")
+	if req.ChannelID != "" {
+		// OriginateResponse 事件带回同一个 ActionID
+		action.SetField("ActionID", req.ChannelID)
+	} else {
+		action.AddActionID()
+	}
+
+	if _, _, err := c.doWithTimeout(action, 10*time.Second); err != nil {
+		return err
+	}
+
+	log.Printf("[Call] Originate queued: channel=%s, exten=%s@%s, app=%s, id=%s",
+		req.Channel, req.Exten, req.Context, req.App, req.ChannelID)
+	return nil
+}
+
+// sendCallAction 发送通话控制动作并检查响应
+func (c *Client) sendCallAction(action *goami2.Message) error {
+	_, _, err := c.doWithTimeout(action, 10*time.Second)
+	return err
+}
+
+// Hangup 挂断通道
+func (c *Client) Hangup(channel string) error {
+	action := goami2.NewAction("Hangup")
+	action.SetField("Channel", channel)
+	return c.sendCallAction(action)
+}
+
+// Redirect 将通道转到指定的 dialplan 位置（盲转），extraChannel 不为空时同时转移另一个通道
+func (c *Client) Redirect(channel, extraChannel, context, exten string) error {
+	action := goami2.NewAction("Redirect")
+	action.SetField("Channel", channel)
+	if extraChannel != "" {
+		action.SetField("ExtraChannel", extraChannel)
+		action.SetField("ExtraContext", context)
+		action.SetField("ExtraExten", exten)
+		action.SetField("ExtraPriority", "1")
+	}
+	action.SetField("Context", context)
+	action.SetField("Exten", exten)
+	action.SetField("Priority", "1")
+	return c.sendCallAction(action)
+}
+
+// Atxfer 由 channel（转接发起方）咨询转接到 exten@context，发起方挂机后完成转接
+func (c *Client) Atxfer(channel, context, exten string) error {
+	action := goami2.NewAction("Atxfer")
+	action.SetField("Channel", channel)
+	action.SetField("Context", context)
+	action.SetField("Exten", exten)
+	return c.sendCallAction(action)
+}
@@ -1,16 +1,20 @@
 package ami
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ety001/lzc-mobile/internal/at"
 	"github.com/staskobzar/goami2"
 )
 
@@ -21,10 +25,13 @@ type Client struct {
 	mu          sync.RWMutex
 	status      Status
 	restartTime *time.Time // 记录重启开始时间
+	fullyBooted bool       // 收到 FullyBooted 事件（登录时 Asterisk 已启动完成也会发送）
 	errCh       chan error
 	msgCh       chan *goami2.Message
-	responseChs map[string]chan *goami2.Message
-	responseMu  sync.RWMutex
+
+	// 等待响应的动作（ActionID -> 请求），见 Do
+	pending   map[string]*pendingAction
+	pendingMu sync.Mutex
 
 	// SIP peer 注册跟踪
 	peerRegistrations map[string]bool // peer => registered (true) 状态
@@ -34,9 +41,10 @@ type Client struct {
 	channelCount   int
 	channelCountMu sync.RWMutex
 
-	// 等待中的通道查询
-	pendingChannelQueries map[string]chan int // actionID -> result channel
-	pendingChannelMu      sync.RWMutex
+	// 连接断开通知：listen 退出或 Close 时关闭 done，disconnectErr 为断开原因
+	done          chan struct{}
+	doneOnce      sync.Once
+	disconnectErr error
 }
 
 // Status Asterisk 状态
@@ -58,6 +66,9 @@ type StatusInfo struct {
 	LastUpdate    time.Time `json:"last_update"`
 }
 
+// dialTimeout 建立 AMI TCP 连接的超时时间
+const dialTimeout = 5 * time.Second
+
 // NewClient 创建新的 AMI 客户端
 func NewClient() (*Client, error) {
 	// 从环境变量读取配置
@@ -85,7 +96,7 @@ func NewClient() (*Client, error) {
 	}
 	// 使用 net.JoinHostPort 正确处理 IPv4 和 IPv6 地址
 	address := net.JoinHostPort(host, port)
-	conn, err := net.Dial("tcp", address)
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to AMI: %w", err)
 	}
@@ -98,15 +109,15 @@ func NewClient() (*Client, error) {
 	}
 
 	c := &Client{
-		conn:                  conn,
-		client:                client,
-		status:                StatusUnknown,
-		errCh:                 make(chan error, 10),
-		msgCh:                 make(chan *goami2.Message, 100),
-		responseChs:           make(map[string]chan *goami2.Message),
-		peerRegistrations:     make(map[string]bool),
-		channelCount:          0,
-		pendingChannelQueries: make(map[string]chan int),
+		conn:              conn,
+		client:            client,
+		status:            StatusUnknown,
+		errCh:             make(chan error, 10),
+		msgCh:             make(chan *goami2.Message, 100),
+		pending:           make(map[string]*pendingAction),
+		peerRegistrations: make(map[string]bool),
+		channelCount:      0,
+		done:              make(chan struct{}),
 	}
 
 	// 启动消息监听
@@ -128,22 +139,34 @@ func NewClient() (*Client, error) {
 
 // listen 监听 AMI 消息和错误
 func (c *Client) listen() {
+	// Close 会把 c.client 置空，这里先取出通道；通道关闭表示连接已被主动关闭
+	msgs := c.client.AllMessages()
+	errs := c.client.Err()
 	for {
 		select {
-		case msg := <-c.client.AllMessages():
+		case msg, ok := <-msgs:
+			if !ok {
+				c.disconnect(ErrNotConnected)
+				return
+			}
 			if msg != nil {
 				c.handleMessage(msg)
 			}
-		case err := <-c.client.Err():
+		case err, ok := <-errs:
+			if !ok {
+				c.disconnect(ErrNotConnected)
+				return
+			}
 			if err != nil {
-				if errors.Is(err, goami2.ErrEOF) {
-					log.Println("AMI connection closed")
+				if isDisconnectError(err) {
+					log.Printf("AMI connection closed: %v", err)
 					c.mu.Lock()
 					// 如果当前状态是 restarting，保持为 restarting，否则设置为 error
 					if c.status != StatusRestarting {
 						c.status = StatusError
 					}
 					c.mu.Unlock()
+					c.disconnect(err)
 					return
 				}
 				// 检查是否是协议解析错误（通常由非 ASCII 字符引起）
@@ -156,7 +179,11 @@ func (c *Client) listen() {
 					continue
 				}
 				log.Printf("AMI client error: %v", err)
-				c.errCh <- err
+				select {
+				case c.errCh <- err:
+				default:
+					// 没有人读取错误通道时不阻塞消息处理
+				}
 			}
 		}
 	}
@@ -164,27 +191,9 @@ func (c *Client) listen() {
 
 // handleMessage 处理收到的 AMI 消息
 func (c *Client) handleMessage(msg *goami2.Message) {
-	// 检查是否是等待的响应
-	actionID := msg.Field("ActionID")
-	if actionID != "" {
-		c.responseMu.RLock()
-		responseCh, exists := c.responseChs[actionID]
-		c.responseMu.RUnlock()
-
-		if exists {
-			// 发送到响应通道
-			select {
-			case responseCh <- msg:
-			default:
-				// 通道已满，丢弃消息
-			}
-			// 清理响应通道
-			c.responseMu.Lock()
-			delete(c.responseChs, actionID)
-			close(responseCh)
-			c.responseMu.Unlock()
-			return
-		}
+	// 检查是否是等待的响应（列表事件被 Do 收集后仍继续分发）
+	if actionID := msg.Field("ActionID"); actionID != "" && c.deliver(actionID, msg) {
+		return
 	}
 
 	// 将消息发送到消息通道
@@ -201,6 +210,7 @@ func (c *Client) handleMessage(msg *goami2.Message) {
 	case "FullyBooted":
 		log.Println("Asterisk fully booted")
 		c.mu.Lock()
+		c.fullyBooted = true
 		// 如果当前状态是 restarting，则恢复为 normal
 		if c.status == StatusRestarting {
 			c.status = StatusNormal
@@ -213,6 +223,7 @@ func (c *Client) handleMessage(msg *goami2.Message) {
 	case "Shutdown":
 		log.Println("Asterisk shutdown")
 		c.mu.Lock()
+		c.fullyBooted = false
 		// 如果当前状态是 restarting，保持为 restarting（因为这是预期的）
 		if c.status != StatusRestarting {
 			c.status = StatusError
@@ -245,14 +256,14 @@ func (c *Client) handleMessage(msg *goami2.Message) {
 	}
 }
 
-// subscribeEvents 订阅 AMI 事件
+// subscribeEvents 订阅 AMI 事件（每次连接/重连都要重新订阅），等待 Asterisk 确认
 func (c *Client) subscribeEvents() error {
 	// 订阅所有事件类型
 	action := goami2.NewAction("Events")
 	action.SetField("EventMask", "on")
-	action.AddActionID()
-
-	c.client.Send(action.Byte())
+	if _, _, err := c.doWithTimeout(action, 5*time.Second); err != nil {
+		return err
+	}
 
 	// 查询初始 SIP peer 状态
 	go c.queryInitialPeerStatus()
@@ -266,32 +277,45 @@ func (c *Client) queryInitialPeerStatus() {
 	time.Sleep(500 * time.Millisecond)
 
 	// 查询 PJSIP AORs（包含 contact 注册状态）
-	// 这会返回 AorDetail 事件，包含每个 AOR 的 contact 信息
-	action := goami2.NewAction("PJSIPShowAors")
-	action.AddActionID()
-	if err := c.SendAction(action); err != nil {
+	// 返回的 AorList/AorDetail 事件由 handleMessage 更新注册状态
+	_, aors, err := c.doWithTimeout(goami2.NewAction("PJSIPShowAors"), 10*time.Second)
+	if err != nil {
 		log.Printf("[AMI] Failed to query AORs: %v", err)
 	} else {
-		log.Println("[AMI] Sent PJSIPShowAors to query initial registration status")
+		log.Printf("[AMI] Loaded initial registration status of %d AOR(s)", countEvents(aors, "AorList", "AorDetail"))
 	}
 
 	// 查询 PJSIP endpoints（可选，用于获取设备状态）
-	endpointAction := goami2.NewAction("PJSIPShowEndpoints")
-	endpointAction.AddActionID()
-	if err := c.SendAction(endpointAction); err != nil {
+	_, endpoints, err := c.doWithTimeout(goami2.NewAction("PJSIPShowEndpoints"), 10*time.Second)
+	if err != nil {
 		log.Printf("[AMI] Failed to query endpoints: %v", err)
 	} else {
-		log.Println("[AMI] Sent PJSIPShowEndpoints to query initial peer status")
+		log.Printf("[AMI] Found %d PJSIP endpoint(s)", countEvents(endpoints, "EndpointList"))
 	}
 }
 
+// countEvents 统计指定名称的事件数量
+func countEvents(events []Event, names ...string) int {
+	count := 0
+	for _, ev := range events {
+		for _, name := range names {
+			if ev.Name() == name {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
 // SendAction 发送 AMI 动作
 func (c *Client) SendAction(action *goami2.Message) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if c.status == StatusError {
-		return fmt.Errorf("AMI client is not connected")
+	// Close 之后 c.client 为 nil（如重连后旧客户端上延迟执行的查询）
+	if c.status == StatusError || c.client == nil {
+		return ErrNotConnected
 	}
 
 	c.client.Send(action.Byte())
@@ -338,13 +362,12 @@ func (c *Client) SendSMS(device, number, message string) error {
 	// 使用 AMI Command 动作直接执行 quectel sms CLI 命令
 	// 绕过 dialplan，避免 QuectelSendSMS 应用的 payload 空值检查问题
 	cmd := fmt.Sprintf("quectel sms %s %s %s", device, number, message)
-	msg, err := c.sendCommand(cmd, 15*time.Second)
+	output, err := c.sendCommand(cmd, 15*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to send SMS command: %w", err)
 	}
 
 	// 检查命令输出中是否包含错误信息
-	output := msg.Field("Output")
 	if output != "" && !strings.Contains(output, "SMS queued for send") {
 		return fmt.Errorf("SMS send failed: %s", output)
 	}
@@ -353,92 +376,82 @@ func (c *Client) SendSMS(device, number, message string) error {
 	return nil
 }
 
-// sendCommand 发送 AMI Command 并等待响应
-// command: 要执行的命令（如 "quectel cmd quectel0 AT+CMGF=1"）
-// timeout: 超时时间
-// 返回响应消息和错误
-func (c *Client) sendCommand(command string, timeout time.Duration) (*goami2.Message, error) {
-	action := goami2.NewAction("Command")
-	action.SetField("Command", command)
-	action.AddActionID()
-	actionID := action.Field("ActionID")
-
-	// 创建响应通道
-	responseCh := make(chan *goami2.Message, 1)
-	c.responseMu.Lock()
-	c.responseChs[actionID] = responseCh
-	c.responseMu.Unlock()
-
-	// 确保清理响应通道
-	defer func() {
-		c.responseMu.Lock()
-		if _, exists := c.responseChs[actionID]; exists {
-			delete(c.responseChs, actionID)
-			close(responseCh)
-		}
-		c.responseMu.Unlock()
-	}()
+// SendUSSD 通过 quectel 发送 USSD 请求（如 *100#）
+// 响应是异步的：通过 QuectelNewUSSD 事件或 dialplan 的 ussd 扩展返回
+// 在多级菜单中，回复菜单选项同样使用此方法
+func (c *Client) SendUSSD(device, code string) error {
+	cmd := fmt.Sprintf("quectel ussd %s %s", device, code)
+	output, err := c.sendCommand(cmd, 15*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to send USSD command: %w", err)
+	}
 
-	// 发送动作
-	if err := c.SendAction(action); err != nil {
-		return nil, fmt.Errorf("failed to send command: %w", err)
+	if output != "" && !strings.Contains(output, "queued for send") {
+		return fmt.Errorf("USSD send failed: %s", output)
 	}
 
-	// 等待响应
-	select {
-	case msg := <-responseCh:
-		// 检查响应状态
-		if msg.Field("Response") != "Success" {
-			return nil, fmt.Errorf("command failed: %s", msg.Field("Message"))
-		}
-		return msg, nil
-	case <-time.After(timeout):
-		return nil, fmt.Errorf("timeout waiting for command response")
+	log.Printf("[USSD] Sent via CLI: device=%s, code=%s, output=%s", device, code, output)
+	return nil
+}
+
+// CancelUSSD 结束设备上正在进行的 USSD 会话（AT+CUSD=2）
+func (c *Client) CancelUSSD(device string) error {
+	if _, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CUSD=2", device), 5*time.Second); err != nil {
+		return fmt.Errorf("failed to cancel USSD session (AT+CUSD=2): %w", err)
 	}
+	return nil
 }
 
-// SendCommand 发送 AMI Command 并等待响应（导出方法，供 Manager 等外部调用）
-func (c *Client) SendCommand(command string, timeout time.Duration) (*goami2.Message, error) {
-	return c.sendCommand(command, timeout)
+// RestartDevice 只重启指定的 quectel 设备（重新打开串口并初始化），不影响其他设备上的通话
+func (c *Client) RestartDevice(device string) error {
+	out, err := c.sendCommand(fmt.Sprintf("quectel restart now %s", device), 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to restart %s: %w", device, err)
+	}
+	if strings.Contains(out, "not found") || strings.Contains(out, "No such device") {
+		return fmt.Errorf("failed to restart %s: %s", device, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// ReloadQuectel 重新加载 quectel.conf（gracefully：有通话的设备在通话结束后再应用）
+func (c *Client) ReloadQuectel() error {
+	if _, err := c.sendCommand("quectel reload gracefully", 10*time.Second); err != nil {
+		return fmt.Errorf("failed to reload quectel config: %w", err)
+	}
+	return nil
+}
+
+// sendCommand 执行 CLI 命令并返回输出
+// command: 要执行的命令（如 "quectel cmd quectel0 AT+CMGF=1"）
+// timeout: 超时时间
+func (c *Client) sendCommand(command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.Command(ctx, command)
 }
 
 // ListSMS 查询 SIM 卡中的所有短信
 // device: Dongle 设备名称（如 quectel0）
 // 返回短信列表（索引和内容）
-// 注意：需要先执行 AT+CMGF=1 设置文本模式，再执行 AT+CMGL="ALL" 获取所有短信
+// 注意：chan_quectel 工作在 PDU 模式（AT+CMGF=0），这里直接用 AT+CMGL=4 读取并解码 PDU，
+// 不再切换到文本模式，避免丢失 UCS-2 内容和长短信分段头
 func (c *Client) ListSMS(device string) ([]SMSInfo, error) {
-	// 确保 chan_quectel 发送短信时处于 PDU 模式，退出时恢复
-	defer func() {
-		log.Printf("[SMS] Restoring SMS format to PDU mode (AT+CMGF=0) for device %s", device)
-		c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGF=0", device), 5*time.Second)
-	}()
-
-	// 步骤1：设置短信格式为文本模式（AT+CMGF=1）
-	log.Printf("[SMS] Setting SMS format to text mode (AT+CMGF=1) for device %s", device)
-	_, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGF=1", device), 5*time.Second)
+	log.Printf("[SMS] Listing SMS from device %s (AT+CMGL=4)", device)
+	output, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGL=4", device), 10*time.Second)
 	if err != nil {
-		// 如果设置文本模式失败，可能设备已经是文本模式，继续尝试列出短信
-		log.Printf("[SMS] Warning: failed to set SMS format (AT+CMGF=1): %v", err)
+		return nil, fmt.Errorf("failed to list SMS (AT+CMGL=4): %w", err)
 	}
 
-	// 等待设备处理模式切换
-	time.Sleep(500 * time.Millisecond)
-
-	// 步骤2：列出所有短信（AT+CMGL="ALL"）
-	log.Printf("[SMS] Listing SMS from device %s (AT+CMGL=\"ALL\")", device)
-	msg, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGL=\"ALL\"", device), 10*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list SMS (AT+CMGL=\"ALL\"): %w", err)
-	}
-
-	// 解析输出（data 字段包含命令输出）
-	output := msg.Field("data")
 	if output == "" {
 		return []SMSInfo{}, nil // 空列表，没有短信
 	}
 
-	// 解析 CMGL 输出格式
-	smsList := parseCMGL(output)
+	records := at.ParseCMGL(output)
+	smsList := make([]SMSInfo, 0, len(records))
+	for _, rec := range records {
+		smsList = append(smsList, smsInfoFromRecord(rec))
+	}
 	log.Printf("[SMS] Found %d SMS(s) on device %s", len(smsList), device)
 	return smsList, nil
 }
@@ -446,30 +459,11 @@ func (c *Client) ListSMS(device string) ([]SMSInfo, error) {
 // DeleteSMS 删除 SIM 卡中的短信
 // device: Dongle 设备名称（如 quectel0）
 // index: SMS 在 SIM 卡中的索引（从 1 开始）
-// 使用 AT+CMGD 命令删除短信
-// 注意：需要先执行 AT+CMGF=1 设置文本模式
+// 使用 AT+CMGD 命令删除短信（与短信格式无关，无需切换文本模式）
 func (c *Client) DeleteSMS(device string, index int) error {
-	// 确保 chan_quectel 发送短信时处于 PDU 模式，退出时恢复
-	defer func() {
-		log.Printf("[SMS] Restoring SMS format to PDU mode (AT+CMGF=0) for device %s", device)
-		c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGF=0", device), 5*time.Second)
-	}()
-
-	// 步骤1：设置短信格式为文本模式（AT+CMGF=1）
-	log.Printf("[SMS] Setting SMS format to text mode (AT+CMGF=1) for device %s", device)
-	_, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGF=1", device), 5*time.Second)
-	if err != nil {
-		// 如果设置文本模式失败，可能设备已经是文本模式，继续尝试删除
-		log.Printf("[SMS] Warning: failed to set SMS format (AT+CMGF=1): %v", err)
-	}
-
-	// 等待设备处理模式切换
-	time.Sleep(500 * time.Millisecond)
-
-	// 步骤2：删除指定索引的短信（AT+CMGD=<index>,<delflag>）
 	// delflag=0 表示只删除指定索引的短信
 	log.Printf("[SMS] Deleting SMS from device %s at index %d (AT+CMGD=%d,0)", device, index, index)
-	_, err = c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGD=%d,0", device, index), 5*time.Second)
+	_, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGD=%d,0", device, index), 5*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to delete SMS (AT+CMGD=%d,0): %w", index, err)
 	}
@@ -479,29 +473,10 @@ func (c *Client) DeleteSMS(device string, index int) error {
 
 // DeleteAllSMS 删除 SIM 卡中的所有短信
 // device: Dongle 设备名称（如 quectel0）
-// 注意：需要先执行 AT+CMGF=1 设置文本模式
 func (c *Client) DeleteAllSMS(device string) error {
-	// 确保 chan_quectel 发送短信时处于 PDU 模式，退出时恢复
-	defer func() {
-		log.Printf("[SMS] Restoring SMS format to PDU mode (AT+CMGF=0) for device %s", device)
-		c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGF=0", device), 5*time.Second)
-	}()
-
-	// 步骤1：设置短信格式为文本模式（AT+CMGF=1）
-	log.Printf("[SMS] Setting SMS format to text mode (AT+CMGF=1) for device %s", device)
-	_, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGF=1", device), 5*time.Second)
-	if err != nil {
-		// 如果设置文本模式失败，可能设备已经是文本模式，继续尝试删除
-		log.Printf("[SMS] Warning: failed to set SMS format (AT+CMGF=1): %v", err)
-	}
-
-	// 等待设备处理模式切换
-	time.Sleep(500 * time.Millisecond)
-
-	// 步骤2：删除所有短信（AT+CMGD=1,4）
 	// delflag=4 表示删除所有短信
 	log.Printf("[SMS] Deleting ALL SMS from device %s (AT+CMGD=1,4)", device)
-	_, err = c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGD=1,4", device), 10*time.Second)
+	_, err := c.sendCommand(fmt.Sprintf("quectel cmd %s AT+CMGD=1,4", device), 10*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to delete all SMS (AT+CMGD=1,4): %w", err)
 	}
@@ -509,6 +484,15 @@ func (c *Client) DeleteAllSMS(device string) error {
 	return nil
 }
 
+// commandOutput 提取 Command 响应的输出
+// 新版 Asterisk 使用多个 Output 字段，旧版使用 data 字段
+func commandOutput(msg *goami2.Message) string {
+	if lines := msg.FieldValues("Output"); len(lines) > 0 {
+		return strings.Join(lines, "\n")
+	}
+	return msg.Field("data")
+}
+
 // FindAndDeleteSMS 查找并删除匹配的短信
 // device: 设备名称
 // sender: 发送者号码
@@ -541,84 +525,100 @@ type DongleStatus struct {
 	DeviceID       string
 	IMEI           string
 	IMSI           string
+	ICCID          string
+	Model          string
 	Operator       string
 	SignalStrength int
-	Status         string
+	State          string // chan_quectel 原始状态（如 Free、In use、Not connected）
+	Status         string // online / offline
 }
 
 // GetDongleStatus 获取 Dongle 设备状态
+// 命令失败或超时返回 nil；设备不存在或未连接时 Status 为 offline
 func (c *Client) GetDongleStatus(deviceID string) *DongleStatus {
-	action := goami2.NewAction("Command")
-	action.SetField("Command", fmt.Sprintf("quectel show device state %s", deviceID))
-	action.AddActionID()
-	actionID := action.Field("ActionID")
-
-	// 创建响应通道
-	responseCh := make(chan *goami2.Message, 1)
-	c.responseMu.Lock()
-	c.responseChs[actionID] = responseCh
-	c.responseMu.Unlock()
-
-	// 确保清理响应通道
-	defer func() {
-		c.responseMu.Lock()
-		if _, exists := c.responseChs[actionID]; exists {
-			delete(c.responseChs, actionID)
-			close(responseCh)
-		}
-		c.responseMu.Unlock()
-	}()
-
-	// 发送动作
-	if err := c.SendAction(action); err != nil {
-		log.Printf("[AMI] Failed to send dongle status command: %v", err)
+	output, err := c.sendCommand(fmt.Sprintf("quectel show device state %s", deviceID), 5*time.Second)
+	if err != nil {
+		log.Printf("[AMI] Failed to get dongle status for %s: %v", deviceID, err)
 		return nil
 	}
 
-	// 等待响应，最多等待 5 秒
-	select {
-	case msg := <-responseCh:
-		// 检查响应状态
-		if msg.Field("Response") != "Success" {
-			log.Printf("[AMI] Dongle status command failed: %s", msg.Field("Message"))
-			return nil
+	status := parseDongleState(output)
+	status.DeviceID = deviceID
+
+	// 部分 chan_quectel 版本的 state 输出不包含 ICCID，改用 AT 命令查询
+	if status.Status == "online" && status.IMSI != "" && status.ICCID == "" {
+		status.ICCID = c.queryICCID(deviceID)
+	}
+	return status
+}
+
+// queryICCID 通过 AT+QCCID（Quectel）或 AT+CCID 查询 SIM 卡 ICCID
+func (c *Client) queryICCID(deviceID string) string {
+	for _, cmd := range []string{"AT+QCCID", "AT+CCID"} {
+		output, err := c.sendCommand(fmt.Sprintf("quectel cmd %s %s", deviceID, cmd), 5*time.Second)
+		if err != nil {
+			continue
 		}
+		if m := iccidRegex.FindStringSubmatch(output); m != nil {
+			return strings.ToUpper(m[1])
+		}
+	}
+	return ""
+}
 
-		// 解析输出（data 字段包含命令输出）
-		output := msg.Field("data")
-		if output == "" {
-			// 设备可能不存在或未连接
-			return &DongleStatus{
-				DeviceID: deviceID,
-				Status:   "offline",
-			}
+// iccidRegex 匹配 +QCCID: / +CCID: 响应中的 ICCID（19-20 位，末位可能为 F）
+var iccidRegex = regexp.MustCompile(`\+Q?CCID:\s*"?([0-9]{18,19}[0-9A-Fa-f]?)`)
+
+// parseDongleState 解析 "quectel show device state" 的输出
+// 输出格式示例（"字段 : 值"）：
+// -------------- Status -------------
+// Device                  : quectel0
+// State                   : Free
+// Model                   : EC20F
+// IMEI                    : 861234567890123
+// IMSI                    : 460012345678901
+// RSSI                    : 23, -67 dBm
+// Provider Name           : CHINA MOBILE
+func parseDongleState(output string) *DongleStatus {
+	status := &DongleStatus{Status: "offline"}
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if value == "Unknown" || value == "unknown" {
+			value = ""
 		}
 
-		// 解析输出提取状态信息
-		// 输出格式示例：
-		// ----
-		// Device Name: quectel0
-		// Audio Device: /dev/ttyUSB1
-		// Data Device: /dev/ttyUSB2
-		// IMEI: 123456789012345
-		// IMSI: 460012345678901
-		// Operator: China Mobile
-		// Signal Strength: 23
-		// State: Up
-		// ----
-
-		status := &DongleStatus{
-			DeviceID: deviceID,
-			Status:   "online",
+		switch key {
+		case "State":
+			status.State = value
+		case "Model":
+			status.Model = value
+		case "IMEI":
+			status.IMEI = value
+		case "IMSI":
+			status.IMSI = value
+		case "ICCID":
+			status.ICCID = strings.ToUpper(value)
+		case "Provider Name":
+			status.Operator = value
+		case "RSSI":
+			// "23, -67 dBm"：取第一个数字
+			rssi, _, _ := strings.Cut(value, ",")
+			if n, err := strconv.Atoi(strings.TrimSpace(rssi)); err == nil {
+				status.SignalStrength = n
+			}
 		}
+	}
 
-		// 简单解析：按行分割并查找关键字
-		// 实际项目中应该使用更健壮的解析方式
-		return status
-	case <-time.After(5 * time.Second):
-		log.Printf("[AMI] Timeout waiting for dongle status: %s", deviceID)
-		return nil
+	if status.State != "" && status.State != "Not connected" {
+		status.Status = "online"
 	}
+	return status
 }
 
 // GetStatus 获取当前状态
@@ -628,6 +628,33 @@ func (c *Client) GetStatus() Status {
 	return c.status
 }
 
+// FullyBooted Asterisk 是否已完全启动（所有模块加载完成）
+// 登录时 FullyBooted 事件可能与登录响应一起到达而被 goami2 丢弃，没有收到事件时用 core waitfullybooted 确认，
+// ctx 结束前 Asterisk 还没有启动完成时返回 false
+func (c *Client) FullyBooted(ctx context.Context) (bool, error) {
+	c.mu.RLock()
+	booted := c.fullyBooted
+	c.mu.RUnlock()
+	if booted {
+		return true, nil
+	}
+
+	output, err := c.Command(ctx, "core waitfullybooted")
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !strings.Contains(output, "fully booted") {
+		return false, nil
+	}
+	c.mu.Lock()
+	c.fullyBooted = true
+	c.mu.Unlock()
+	return true, nil
+}
+
 // GetStatusInfo 获取详细状态信息
 func (c *Client) GetStatusInfo() (*StatusInfo, error) {
 	status := c.GetStatus()
@@ -646,54 +673,32 @@ func (c *Client) GetStatusInfo() (*StatusInfo, error) {
 		info.Registrations = registrations
 	}
 
-	// 获取运行时间
-	if uptime, err := c.GetUptime(); err == nil {
+	// 获取运行时间；CoreStatus 超时或连接已断开说明连接不可用（Asterisk 回复错误则连接仍然正常）
+	uptime, err := c.GetUptime()
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNotConnected)) {
+		return info, fmt.Errorf("AMI connection unresponsive: %w", err)
+	}
+	if err == nil {
 		info.Uptime = uptime
 	}
 
 	return info, nil
 }
 
-// getChannelCount 获取活动通道数
+// getChannelCount 获取活动通道数（CoreShowChannels 返回的 CoreShowChannel 事件数）
 func (c *Client) getChannelCount() (int, error) {
-	action := goami2.NewAction("CoreShowChannels")
-	action.AddActionID()
-	actionID := action.Field("ActionID")
-
-	// 创建结果通道
-	resultCh := make(chan int, 1)
-	c.pendingChannelMu.Lock()
-	c.pendingChannelQueries[actionID] = resultCh
-	c.pendingChannelMu.Unlock()
-
-	// 确保清理
-	defer func() {
-		c.pendingChannelMu.Lock()
-		if _, exists := c.pendingChannelQueries[actionID]; exists {
-			delete(c.pendingChannelQueries, actionID)
-			close(resultCh)
-		}
-		c.pendingChannelMu.Unlock()
-	}()
-
-	if err := c.SendAction(action); err != nil {
-		return 0, err
-	}
-
-	// 等待 CoreShowChannelsComplete 事件
-	select {
-	case count := <-resultCh:
-		return count, nil
-	case <-time.After(3 * time.Second):
-		// 超时，返回缓存的值
+	_, events, err := c.doWithTimeout(goami2.NewAction("CoreShowChannels"), 3*time.Second)
+	if err != nil {
+		// 超时等失败时返回缓存的值
 		c.channelCountMu.RLock()
 		cachedCount := c.channelCount
 		c.channelCountMu.RUnlock()
 		if cachedCount > 0 {
 			return cachedCount, nil
 		}
-		return 0, fmt.Errorf("timeout waiting for CoreShowChannelsComplete")
+		return 0, err
 	}
+	return countEvents(events, "CoreShowChannel"), nil
 }
 
 // getRegistrationCount 获取 SIP 注册数
@@ -704,71 +709,39 @@ func (c *Client) getRegistrationCount() (int, error) {
 
 // GetUptime 获取运行时间（秒）
 func (c *Client) GetUptime() (int64, error) {
-	action := goami2.NewAction("CoreStatus")
-	action.AddActionID()
-	actionID := action.Field("ActionID")
-
-	// 创建响应通道
-	responseCh := make(chan *goami2.Message, 1)
-	c.responseMu.Lock()
-	c.responseChs[actionID] = responseCh
-	c.responseMu.Unlock()
-
-	// 确保清理响应通道（如果超时，通道还未被 handleMessage 关闭）
-	defer func() {
-		c.responseMu.Lock()
-		if _, exists := c.responseChs[actionID]; exists {
-			// 如果通道还在 map 中，说明超时了，需要关闭通道
-			delete(c.responseChs, actionID)
-			close(responseCh)
-		}
-		c.responseMu.Unlock()
-	}()
-
-	// 发送动作
-	if err := c.SendAction(action); err != nil {
+	msg, _, err := c.doWithTimeout(goami2.NewAction("CoreStatus"), 5*time.Second)
+	if err != nil {
 		return 0, err
 	}
 
-	// 等待响应，最多等待 5 秒
-	select {
-	case msg := <-responseCh:
-		// 检查响应状态
-		if msg.Field("Response") != "Success" {
-			return 0, fmt.Errorf("CoreStatus action failed: %s", msg.Field("Message"))
-		}
-
-		// 解析启动日期和时间
-		startupDate := msg.Field("CoreStartupDate")
-		startupTime := msg.Field("CoreStartupTime")
+	// 解析启动日期和时间
+	startupDate := msg.Field("CoreStartupDate")
+	startupTime := msg.Field("CoreStartupTime")
 
-		if startupDate == "" || startupTime == "" {
-			return 0, fmt.Errorf("missing startup date or time in response")
-		}
-
-		// 解析启动时间
-		// 注意：Asterisk 返回的时间实际上是本地时间（而不是文档说的 UTC）
-		// 所以直接解析为本地时间即可
-		startupStr := startupDate + " " + startupTime
-		startup, err := time.ParseInLocation("2006-01-02 15:04:05", startupStr, time.Local)
-		if err != nil {
-			return 0, fmt.Errorf("failed to parse startup time: %w", err)
-		}
+	if startupDate == "" || startupTime == "" {
+		return 0, fmt.Errorf("missing startup date or time in response")
+	}
 
-		// 计算运行时间（秒）
-		uptime := time.Since(startup).Seconds()
+	// 解析启动时间
+	// 注意：Asterisk 返回的时间实际上是本地时间（而不是文档说的 UTC）
+	// 所以直接解析为本地时间即可
+	startupStr := startupDate + " " + startupTime
+	startup, err := time.ParseInLocation("2006-01-02 15:04:05", startupStr, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse startup time: %w", err)
+	}
 
-		// 如果运行时间为负数，说明系统时间可能有问题，返回0
-		if uptime < 0 {
-			log.Printf("Warning: negative uptime calculated: %f, startup time: %s, current time: %s",
-				uptime, startup.Format(time.RFC3339), time.Now().Format(time.RFC3339))
-			return 0, nil
-		}
+	// 计算运行时间（秒）
+	uptime := time.Since(startup).Seconds()
 
-		return int64(uptime), nil
-	case <-time.After(5 * time.Second):
-		return 0, fmt.Errorf("timeout waiting for CoreStatus response")
+	// 如果运行时间为负数，说明系统时间可能有问题，返回0
+	if uptime < 0 {
+		log.Printf("Warning: negative uptime calculated: %f, startup time: %s, current time: %s",
+			uptime, startup.Format(time.RFC3339), time.Now().Format(time.RFC3339))
+		return 0, nil
 	}
+
+	return int64(uptime), nil
 }
 
 // Messages 返回消息通道
@@ -784,15 +757,57 @@ func (c *Client) Errors() <-chan error {
 // Close 关闭 AMI 客户端连接
 func (c *Client) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
 
-	if c.client != nil {
-		c.client.Close()
-		c.client = nil
+	if client != nil {
+		client.Close()
 	}
+	c.disconnect(ErrNotConnected)
 	return nil
 }
 
+// Disconnected 返回连接断开（包括 Close）时关闭的通道
+func (c *Client) Disconnected() <-chan struct{} {
+	return c.done
+}
+
+// DisconnectErr 返回连接断开的原因，连接正常时返回 nil
+func (c *Client) DisconnectErr() error {
+	select {
+	case <-c.done:
+		return c.disconnectErr
+	default:
+		return nil
+	}
+}
+
+// IsConnected 连接是否仍然可用
+func (c *Client) IsConnected() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// disconnect 标记连接已断开：通知 Disconnected 的等待者，并让等待中的 Do 立即失败
+func (c *Client) disconnect(err error) {
+	c.doneOnce.Do(func() {
+		c.disconnectErr = err
+		close(c.done)
+	})
+	c.failPending(ErrNotConnected)
+}
+
+// isDisconnectError 是否为连接已断开的错误（goami2 读取失败、网络错误）
+func isDisconnectError(err error) bool {
+	return errors.Is(err, goami2.ErrEOF) || errors.Is(err, goami2.ErrConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
 // handlePeerEntry 处理 PeerEntry 事件（SIP peer 注册状态变更）
 func (c *Client) handlePeerEntry(msg *goami2.Message) {
 	peerName := msg.Field("ObjectName")
@@ -859,34 +874,13 @@ func (c *Client) GetPeerRegistrationCount() int {
 	return count
 }
 
-// handleCoreShowChannelsComplete 处理 CoreShowChannelsComplete 事件
+// handleCoreShowChannelsComplete 处理 CoreShowChannelsComplete 事件，更新通道数缓存
 func (c *Client) handleCoreShowChannelsComplete(msg *goami2.Message) {
-	actionID := msg.Field("ActionID")
-	listItemsStr := msg.Field("ListItems")
-	count, _ := strconv.Atoi(listItemsStr)
+	count, _ := strconv.Atoi(msg.Field("ListItems"))
 
-	// 更新缓存
 	c.channelCountMu.Lock()
 	c.channelCount = count
 	c.channelCountMu.Unlock()
-
-	// 通知等待的查询
-	if actionID != "" {
-		c.pendingChannelMu.RLock()
-		ch, exists := c.pendingChannelQueries[actionID]
-		c.pendingChannelMu.RUnlock()
-
-		if exists {
-			select {
-			case ch <- count:
-			default:
-			}
-			c.pendingChannelMu.Lock()
-			delete(c.pendingChannelQueries, actionID)
-			close(ch)
-			c.pendingChannelMu.Unlock()
-		}
-	}
 	log.Printf("[AMI] Channel count: %d", count)
 }
 
@@ -0,0 +1,245 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/amitest"
+	"github.com/staskobzar/goami2"
+)
+
+// newTestServer 启动模拟 AMI 服务器，并设置 NewClient 使用的环境变量
+func newTestServer(t *testing.T) *amitest.Server {
+	t.Helper()
+	srv, err := amitest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	t.Setenv("ASTERISK_AMI_HOST", srv.Host())
+	t.Setenv("ASTERISK_AMI_PORT", srv.Port())
+	t.Setenv("ASTERISK_AMI_USERNAME", srv.Username)
+	t.Setenv("ASTERISK_AMI_PASSWORD", srv.Password)
+	return srv
+}
+
+// newTestClient 启动模拟服务器并连接客户端
+func newTestClient(t *testing.T) (*amitest.Server, *Client) {
+	t.Helper()
+	srv := newTestServer(t)
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+// waitForMessage 从客户端消息通道读取，直到收到满足条件的消息
+func waitForMessage(t *testing.T, c *Client, match func(*goami2.Message) bool) *goami2.Message {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-c.Messages():
+			if msg != nil && match(msg) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for AMI message")
+			return nil
+		}
+	}
+}
+
+func TestNewClientLoginFailure(t *testing.T) {
+	srv := newTestServer(t)
+	t.Setenv("ASTERISK_AMI_PASSWORD", "wrong")
+
+	if _, err := NewClient(); err == nil {
+		t.Fatal("expected login failure")
+	}
+	if srv.Logins() != 0 {
+		t.Fatalf("logins = %d, want 0", srv.Logins())
+	}
+}
+
+func TestClientCommandOutput(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.SetCommand("core show version", "Asterisk 20.5.0 built by root\nsecond line")
+
+	output, err := c.Command(context.Background(), "core show version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "Asterisk 20.5.0 built by root\nsecond line" {
+		t.Fatalf("output = %q", output)
+	}
+}
+
+func TestClientGetDongleStatus(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	status := c.GetDongleStatus("quectel0")
+	if status == nil {
+		t.Fatal("GetDongleStatus returned nil")
+	}
+	if status.Status != "online" || status.State != "Free" {
+		t.Fatalf("status = %s, state = %s", status.Status, status.State)
+	}
+	if status.IMEI != "861234567890123" || status.IMSI != "460001234567890" {
+		t.Fatalf("IMEI/IMSI = %s/%s", status.IMEI, status.IMSI)
+	}
+	if status.Operator != "CHINA MOBILE" || status.SignalStrength != 23 {
+		t.Fatalf("operator = %q, rssi = %d", status.Operator, status.SignalStrength)
+	}
+	// state 输出没有 ICCID，通过 AT+QCCID 查询
+	if status.ICCID != "89860012345678901234" {
+		t.Fatalf("ICCID = %q", status.ICCID)
+	}
+	if !srv.WaitForCommand("quectel cmd quectel0 AT+QCCID", time.Second) {
+		t.Fatal("AT+QCCID was not sent")
+	}
+}
+
+func TestClientDoCollectsListEvents(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.SetListItems("CoreShowChannels",
+		amitest.NewMessage("Channel", "PJSIP/100-00000001", "Uniqueid", "1.1", "Linkedid", "1.1"),
+		amitest.NewMessage("Channel", "Quectel/quectel0-0100000000", "Uniqueid", "1.2", "Linkedid", "1.1"),
+	)
+
+	resp, events, err := c.Do(context.Background(), goami2.NewAction("CoreShowChannels"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.OK() {
+		t.Fatalf("response = %v", resp.Field("Response"))
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 2 items and the complete event", len(events))
+	}
+	if events[0].Field("Channel") != "PJSIP/100-00000001" || events[2].Name() != "CoreShowChannelsComplete" {
+		t.Fatalf("unexpected events: %s, %s", events[0].Field("Channel"), events[2].Name())
+	}
+
+	count, err := c.getChannelCount()
+	if err != nil || count != 2 {
+		t.Fatalf("getChannelCount = %d, %v", count, err)
+	}
+}
+
+func TestClientDoDispatchesListEvents(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.SetListItems("CoreShowChannels", amitest.NewMessage("Channel", "PJSIP/100-00000001"))
+
+	action := goami2.NewAction("CoreShowChannels")
+	action.AddActionID()
+	actionID := action.Field("ActionID")
+	if _, _, err := c.Do(context.Background(), action); err != nil {
+		t.Fatal(err)
+	}
+
+	// 列表事件也要分发给 Manager（活动通话监控依赖 CoreShowChannel 校正通道）
+	waitForMessage(t, c, func(msg *goami2.Message) bool {
+		return msg.Field("Event") == "CoreShowChannel" && msg.Field("ActionID") == actionID
+	})
+}
+
+func TestClientDoActionError(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.Handle("Hangup", func(action amitest.Message) []amitest.Message {
+		return []amitest.Message{amitest.Error("No such channel")}
+	})
+
+	err := c.Hangup("PJSIP/404-00000001")
+	var actionErr *ActionError
+	if !errors.As(err, &actionErr) {
+		t.Fatalf("err = %v, want *ActionError", err)
+	}
+	if actionErr.Action != "Hangup" || actionErr.Message != "No such channel" {
+		t.Fatalf("action error = %+v", actionErr)
+	}
+	if action, ok := srv.WaitForAction(time.Second, func(m amitest.Message) bool { return m.Get("Action") == "Hangup" }); !ok || action.Get("Channel") != "PJSIP/404-00000001" {
+		t.Fatalf("hangup action = %v", action)
+	}
+}
+
+func TestClientDoContextTimeout(t *testing.T) {
+	srv, c := newTestClient(t)
+	// 不回复，模拟 Asterisk 卡住
+	srv.Handle("Slow", func(action amitest.Message) []amitest.Message { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err := c.Do(ctx, goami2.NewAction("Slow"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	c.pendingMu.Lock()
+	pending := len(c.pending)
+	c.pendingMu.Unlock()
+	if pending != 0 {
+		t.Fatalf("%d pending actions left after timeout", pending)
+	}
+}
+
+func TestClientDoFailsOnDisconnect(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.Handle("Slow", func(action amitest.Message) []amitest.Message { return nil })
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := c.Do(context.Background(), goami2.NewAction("Slow"))
+		errCh <- err
+	}()
+	if _, ok := srv.WaitForAction(time.Second, func(m amitest.Message) bool { return m.Get("Action") == "Slow" }); !ok {
+		t.Fatal("action was not received")
+	}
+	srv.DropConnections()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrNotConnected) {
+			t.Fatalf("err = %v, want ErrNotConnected", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Do did not return after disconnect")
+	}
+	if c.GetStatus() != StatusError {
+		t.Fatalf("status = %s, want error", c.GetStatus())
+	}
+}
+
+func TestClientSendSMS(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	if err := c.SendSMS("quectel0", "10086", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.WaitForCommand("quectel sms quectel0 10086 hello", time.Second) {
+		t.Fatalf("commands = %v", srv.Commands())
+	}
+
+	srv.SetCommand("quectel sms quectel9 10086 hello", "Device quectel9 not found")
+	if err := c.SendSMS("quectel9", "10086", "hello"); err == nil {
+		t.Fatal("expected error for unknown device")
+	}
+}
+
+func TestClientGetUptime(t *testing.T) {
+	_, c := newTestClient(t)
+
+	uptime, err := c.GetUptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟服务器的启动时间为一小时前
+	if uptime < 3500 || uptime > 3700 {
+		t.Fatalf("uptime = %d, want about 3600", uptime)
+	}
+}
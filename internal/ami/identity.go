@@ -0,0 +1,218 @@
+package ami
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// identityCheckInterval 检查设备状态变化的间隔
+const identityCheckInterval = 30 * time.Second
+
+// dongleIdentityLoop 定期检查 dongle 设备状态，设备（重新）连接或状态变化时读取 IMEI/IMSI/ICCID
+// 与数据库中记录的身份比较，发现换卡、模块错位（USB 端口重新枚举）或 SIM 卡丢失时发送通知
+// ctx 取消（Close）时退出
+func (m *Manager) dongleIdentityLoop(ctx context.Context) {
+	ticker := time.NewTicker(identityCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		m.mu.RLock()
+		client := m.client
+		m.mu.RUnlock()
+
+		if client == nil {
+			continue
+		}
+
+		output, err := client.sendCommand("quectel show devices", 5*time.Second)
+		if err != nil {
+			log.Printf("[DongleIdentity] Failed to query devices: %v", err)
+			continue
+		}
+
+		for _, dev := range parseQuectelDevices(output) {
+			m.mu.Lock()
+			if m.dongleStates == nil {
+				m.dongleStates = make(map[string]string)
+			}
+			last, seen := m.dongleStates[dev.ID]
+			m.dongleStates[dev.ID] = dev.State
+			m.mu.Unlock()
+
+			if seen && last != dev.State {
+				m.notifyDongleState(dev.ID, last, dev.State)
+			}
+
+			// 只在首次发现（含 AMI 重连后）和状态变化时检查，避免每轮都查询模块
+			if seen && last == dev.State {
+				continue
+			}
+			if dev.State == "Not connected" {
+				// 模块不在线，读不到身份信息
+				continue
+			}
+
+			status := client.GetDongleStatus(dev.ID)
+			if status == nil || status.IMEI == "" {
+				// 模块尚未初始化完成，下一轮重新检查
+				m.mu.Lock()
+				delete(m.dongleStates, dev.ID)
+				m.mu.Unlock()
+				continue
+			}
+			m.CheckDongleIdentity(dev.ID, status)
+		}
+	}
+}
+
+// notifyDongleState 通知实现了 OnDongleStateChanged 的订阅者 dongle 状态变化
+func (m *Manager) notifyDongleState(device, previous, state string) {
+	m.mu.RLock()
+	subscribers := make([]StatusSubscriber, len(m.subscribers))
+	copy(subscribers, m.subscribers)
+	m.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		if s, ok := sub.(interface {
+			OnDongleStateChanged(device, previous, state string)
+		}); ok {
+			s.OnDongleStateChanged(device, previous, state)
+		}
+	}
+}
+
+// resetDongleStates 清空已记录的设备状态，下一轮对所有设备重新做身份检查（调用方需持有 m.mu）
+func (m *Manager) resetDongleStates() {
+	m.dongleStates = make(map[string]string)
+}
+
+// CheckDongleIdentity 比较设备当前身份与数据库记录，持久化新身份并写入变更历史
+// 换卡、模块变化和 SIM 卡丢失会通过 dongle 告警回调发送通知
+func (m *Manager) CheckDongleIdentity(deviceID string, status *DongleStatus) {
+	var dongle database.Dongle
+	if err := database.DB.Where("device_id = ?", deviceID).First(&dongle).Error; err != nil {
+		// 未在面板中配置的设备不跟踪
+		return
+	}
+
+	prev := dongle
+	events := identityEvents(&prev, status, lastKnownIMSI(deviceID))
+
+	now := time.Now()
+	if err := database.DB.Model(&database.Dongle{}).Where("id = ?", dongle.ID).Updates(map[string]interface{}{
+		"imei":                status.IMEI,
+		"imsi":                status.IMSI,
+		"iccid":               status.ICCID,
+		"identity_checked_at": &now,
+	}).Error; err != nil {
+		log.Printf("[DongleIdentity] Failed to save identity for %s: %v", deviceID, err)
+	}
+
+	m.mu.RLock()
+	alertFn := m.dongleAlertFn
+	m.mu.RUnlock()
+
+	for _, event := range events {
+		record := database.DongleIdentityHistory{
+			DongleID:  deviceID,
+			Event:     event,
+			IMEI:      status.IMEI,
+			IMSI:      status.IMSI,
+			ICCID:     status.ICCID,
+			PrevIMEI:  prev.IMEI,
+			PrevIMSI:  prev.IMSI,
+			PrevICCID: prev.ICCID,
+		}
+		if err := database.DB.Create(&record).Error; err != nil {
+			log.Printf("[DongleIdentity] Failed to save %s history for %s: %v", event, deviceID, err)
+		}
+
+		alertMsg := identityAlertMessage(deviceID, event, &prev, status)
+		if alertMsg == "" {
+			log.Printf("[DongleIdentity] %s: %s (IMEI=%s, IMSI=%s, ICCID=%s)", deviceID, event, status.IMEI, status.IMSI, status.ICCID)
+			continue
+		}
+		log.Printf("[DongleIdentity] %s", alertMsg)
+		if alertFn != nil {
+			alertFn(deviceID, alertMsg)
+		}
+	}
+}
+
+// identityEvents 根据之前记录的身份和当前身份计算变更事件
+// lastIMSI 为历史中最近一次记录的非空 IMSI，用于判断 SIM 卡重新插入的是否为原来的卡
+func identityEvents(prev *database.Dongle, cur *DongleStatus, lastIMSI string) []string {
+	if prev.IMEI == "" && prev.IMSI == "" && prev.ICCID == "" && lastIMSI == "" {
+		return []string{database.IdentityEventFirstSeen}
+	}
+
+	var events []string
+	if prev.IMEI != "" && prev.IMEI != cur.IMEI {
+		events = append(events, database.IdentityEventIMEIChanged)
+	}
+
+	switch {
+	case cur.IMSI == "" && prev.IMSI != "":
+		events = append(events, database.IdentityEventSIMMissing)
+	case cur.IMSI != "" && prev.IMSI == "":
+		if lastIMSI != "" && lastIMSI != cur.IMSI {
+			events = append(events, database.IdentityEventSIMChanged)
+		} else {
+			events = append(events, database.IdentityEventSIMRestored)
+		}
+	case cur.IMSI != prev.IMSI:
+		events = append(events, database.IdentityEventSIMChanged)
+	case cur.ICCID != "" && prev.ICCID != "" && cur.ICCID != prev.ICCID:
+		// IMSI 相同但 ICCID 不同：同号补卡
+		events = append(events, database.IdentityEventSIMChanged)
+	}
+	return events
+}
+
+// identityAlertMessage 生成告警内容；不需要告警的事件返回空字符串
+func identityAlertMessage(deviceID, event string, prev *database.Dongle, cur *DongleStatus) string {
+	switch event {
+	case database.IdentityEventIMEIChanged:
+		msg := fmt.Sprintf("Device %s is now modem IMEI %s (was %s). USB ports may have been reshuffled, calls and SMS may be routed through the wrong SIM.",
+			deviceID, cur.IMEI, prev.IMEI)
+		var other database.Dongle
+		if err := database.DB.Where("imei = ? AND device_id <> ?", cur.IMEI, deviceID).First(&other).Error; err == nil {
+			msg += fmt.Sprintf(" This modem was previously %s.", other.DeviceID)
+		}
+		return msg
+	case database.IdentityEventSIMChanged:
+		return fmt.Sprintf("SIM card in %s changed: IMSI %s (ICCID %s), was IMSI %s (ICCID %s).",
+			deviceID, cur.IMSI, valueOrUnknown(cur.ICCID), valueOrUnknown(prev.IMSI), valueOrUnknown(prev.ICCID))
+	case database.IdentityEventSIMMissing:
+		return fmt.Sprintf("SIM card missing in %s (last IMSI %s, ICCID %s).",
+			deviceID, prev.IMSI, valueOrUnknown(prev.ICCID))
+	default:
+		return ""
+	}
+}
+
+// lastKnownIMSI 返回历史中最近一次记录的非空 IMSI
+func lastKnownIMSI(deviceID string) string {
+	var record database.DongleIdentityHistory
+	if err := database.DB.Where("dongle_id = ? AND imsi <> ''", deviceID).Order("id DESC").First(&record).Error; err != nil {
+		return ""
+	}
+	return record.IMSI
+}
+
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -1,6 +1,7 @@
 package ami
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"log"
@@ -27,6 +28,17 @@ type Manager struct {
 	dongleAlertFn    DongleAlertFunc // 故障通知回调
 	dongleFailCount  int             // dongle 连续检测失败次数
 	dongleNotified   bool            // 是否已发送故障通知（故障解除后重置）
+
+	// dongle 身份跟踪：设备 ID -> 上一轮的 State，用于检测设备（重新）连接
+	dongleStates map[string]string
+
+	// 热插拔：被拔出的设备 ID（由 discovery 的 watcher 更新）
+	unpluggedDevices map[string]time.Time
+
+	// 连接监督（见 supervisor.go）
+	cancel    context.CancelFunc // 停止连接监督循环
+	connState ConnectionState
+	connStats ConnectionStats
 }
 
 // StatusSubscriber 状态订阅者接口
@@ -51,79 +63,48 @@ func GetManager() *Manager {
 }
 
 // Init 初始化 AMI 管理器
+// 首次连接最多尝试 initConnectAttempts 次（webpanel 启动时 Asterisk 可能还没有完全启动），
+// 连接成功后由 supervise 在后台处理消息，并在断线后自动重连
 func (m *Manager) Init() error {
-	// 重试连接 AMI，最多重试 10 次，每次间隔 2 秒
-	// 因为 webpanel 启动时 Asterisk 可能还没有完全启动
-	maxRetries := 10
-	retryInterval := 2 * time.Second
-
-	var client *Client
-	var err error
+	return m.InitContext(context.Background())
+}
 
-	for i := 0; i < maxRetries; i++ {
-		client, err = NewClient()
-		if err == nil {
-			break
-		}
-		if i < maxRetries-1 {
-			log.Printf("Failed to connect to AMI (attempt %d/%d): %v, retrying in %v...", i+1, maxRetries, err, retryInterval)
-			time.Sleep(retryInterval)
-		}
+// InitContext 与 Init 相同，但 ctx 在首次连接完成前取消时放弃连接（如启动过程中收到退出信号）
+// 连接成功后 ctx 不再影响连接，由 Close 停止
+func (m *Manager) InitContext(parent context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopWatch := context.AfterFunc(parent, cancel)
+	client, err := m.connect(ctx, initConnectAttempts)
+	if !stopWatch() && err == nil {
+		// 连接成功的同时 ctx 被取消
+		client.Close()
+		err = parent.Err()
 	}
-
 	if err != nil {
+		cancel()
+		m.setConnState(ConnStateDisconnected, err)
 		return err
 	}
 
 	m.mu.Lock()
-	m.client = client
+	m.cancel = cancel
 	m.mu.Unlock()
+	m.setClient(client)
 
-	// 启动消息处理循环
-	go m.handleMessages()
+	// 启动连接监督和消息处理循环
+	go m.supervise(ctx)
 
 	// 启动状态更新循环
-	go m.statusUpdateLoop()
+	go m.statusUpdateLoop(ctx)
 
 	// 启动 dongle 设备健康检查循环
-	go m.dongleHealthLoop()
-
-	return nil
-}
+	go m.dongleHealthLoop(ctx)
 
-// handleMessages 处理 AMI 消息
-func (m *Manager) handleMessages() {
-	for {
-		m.mu.RLock()
-		client := m.client
-		m.mu.RUnlock()
-
-		if client == nil {
-			// 如果客户端为 nil，尝试重新连接
-			if err := m.reconnect(); err != nil {
-				log.Printf("Failed to reconnect AMI: %v, retrying in 5s...", err)
-				time.Sleep(5 * time.Second)
-				continue
-			}
-			client = m.client
-		}
+	// 启动 dongle 身份（IMEI/IMSI/ICCID）跟踪循环
+	go m.dongleIdentityLoop(ctx)
 
-		select {
-		case msg := <-client.Messages():
-			if msg != nil {
-				m.processMessage(msg)
-			}
-		case err := <-client.Errors():
-			if err != nil {
-				log.Printf("AMI error: %v", err)
-				// 如果是连接错误，尝试重新连接
-				if err.Error() == "EOF" || err.Error() == "connection closed" {
-					log.Println("AMI connection lost, attempting to reconnect...")
-					m.reconnect()
-				}
-			}
-		}
-	}
+	return nil
 }
 
 // processMessage 处理单个 AMI 消息
@@ -154,7 +135,12 @@ func (m *Manager) processMessage(msg *goami2.Message) {
 						smsIndex = idx
 					}
 				}
-				m.notifySMSWithIndex(device, number, message, timestamp, smsIndex)
+				// 长短信分段信息（PDU 或 chan_quectel 提供的分段字段）
+				if part := parseSMSPart(msg); part != nil {
+					m.notifySMSPart(device, number, message, timestamp, smsIndex, *part)
+				} else {
+					m.notifySMSWithIndex(device, number, message, timestamp, smsIndex)
+				}
 			}
 		} else if eventType == "DongleSMSReceived" || eventType == "QuectelSMSReceived" {
 			device := msg.Field("Device")
@@ -183,9 +169,45 @@ func (m *Manager) processMessage(msg *goami2.Message) {
 				m.notifySMS(device, number, message, timestamp)
 			}
 		}
+	case "QuectelNewUSSD", "DongleNewUSSD", "QuectelNewUSSDBase64", "DongleNewUSSDBase64":
+		// 处理收到的 USSD 响应
+		device := msg.Field("Device")
+		if device == "" {
+			device = msg.Field("QuectelName")
+		}
+		message := parseUSSDMessage(msg)
+		// 事件中不一定带响应类型，未知时为 -1
+		ussdType := -1
+		if t, err := strconv.Atoi(msg.Field("Type")); err == nil {
+			ussdType = t
+		}
+		if device != "" && message != "" {
+			m.notifyUSSD(device, message, ussdType)
+		}
 	case "FullyBooted":
 		// Asterisk 完全启动完成，状态会在 Client.handleMessage 中更新
 		log.Println("Asterisk fully booted event received")
+	default:
+		// 通话事件（通道状态、拨号、挂机、Originate 结果）
+		if ev := parseChannelEvent(msg); ev != nil {
+			m.notifyChannelEvent(*ev)
+		}
+	}
+}
+
+// notifyChannelEvent 通知实现了 OnChannelEvent 的订阅者
+func (m *Manager) notifyChannelEvent(ev ChannelEvent) {
+	m.mu.RLock()
+	subscribers := make([]StatusSubscriber, len(m.subscribers))
+	copy(subscribers, m.subscribers)
+	m.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		if s, ok := sub.(interface {
+			OnChannelEvent(ev ChannelEvent)
+		}); ok {
+			s.OnChannelEvent(ev)
+		}
 	}
 }
 
@@ -218,32 +240,118 @@ func (m *Manager) notifySMSWithIndex(device, number, message, timestamp string,
 	}
 }
 
+// notifySMSPart 通知订阅者收到长短信的一个分段
+// 订阅者未实现 OnSMSPartReceived 时退化为普通短信通知
+func (m *Manager) notifySMSPart(device, number, message, timestamp string, smsIndex int, part SMSPart) {
+	message = strings.ReplaceAll(message, "\r", " ")
+	message = strings.ReplaceAll(message, "\n", " ")
+
+	m.mu.RLock()
+	subscribers := make([]StatusSubscriber, len(m.subscribers))
+	copy(subscribers, m.subscribers)
+	m.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		if s, ok := sub.(interface {
+			OnSMSPartReceived(device, number, message, timestamp string, index int, part SMSPart)
+		}); ok {
+			s.OnSMSPartReceived(device, number, message, timestamp, smsIndex, part)
+		} else if s, ok := sub.(interface {
+			OnSMSReceivedWithIndex(device, number, message, timestamp string, index int)
+		}); ok {
+			s.OnSMSReceivedWithIndex(device, number, message, timestamp, smsIndex)
+		} else {
+			sub.OnSMSReceived(device, number, message, timestamp)
+		}
+	}
+}
+
+// parseSMSPart 从 UserEvent 中提取长短信分段信息
+// 支持 PDU 字段（原始 PDU 十六进制）和 ConcatRef/ConcatTotal/ConcatSeq 字段
+// 两者都没有时返回 nil
+func parseSMSPart(msg *goami2.Message) *SMSPart {
+	part := SMSPart{PDU: msg.Field("PDU")}
+	part.Ref, _ = strconv.Atoi(msg.Field("ConcatRef"))
+	part.Total, _ = strconv.Atoi(msg.Field("ConcatTotal"))
+	part.Seq, _ = strconv.Atoi(msg.Field("ConcatSeq"))
+	if part.PDU == "" && part.Total <= 1 {
+		return nil
+	}
+	return &part
+}
+
+// parseUSSDMessage 从 USSD 事件中提取响应内容
+// Base64 事件使用 Message 字段（Base64 编码），普通事件按 MessageLine0..N 分行给出
+func parseUSSDMessage(msg *goami2.Message) string {
+	eventType := msg.Field("Event")
+	message := msg.Field("Message")
+	if strings.HasSuffix(eventType, "Base64") {
+		decoded, err := base64.StdEncoding.DecodeString(message)
+		if err != nil {
+			log.Printf("[USSD] Failed to decode Base64 USSD message: %v", err)
+			return ""
+		}
+		return string(decoded)
+	}
+	if message != "" {
+		return message
+	}
+
+	lineCount, _ := strconv.Atoi(msg.Field("LineCount"))
+	lines := make([]string, 0, lineCount)
+	for i := 0; i < lineCount; i++ {
+		lines = append(lines, msg.Field(fmt.Sprintf("MessageLine%d", i)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notifyUSSD 通知实现了 OnUSSDReceived 的订阅者收到 USSD 响应
+// ussdType 为 +CUSD 的 <m> 值（0=无需操作，1=需要用户回复，2=网络结束会话...），-1 表示未知
+func (m *Manager) notifyUSSD(device, message string, ussdType int) {
+	m.mu.RLock()
+	subscribers := make([]StatusSubscriber, len(m.subscribers))
+	copy(subscribers, m.subscribers)
+	m.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		if s, ok := sub.(interface {
+			OnUSSDReceived(device, message string, ussdType int)
+		}); ok {
+			s.OnUSSDReceived(device, message, ussdType)
+		}
+	}
+}
+
 // DeleteSMS 删除 SIM 卡中的短信
 func (m *Manager) DeleteSMS(device string, index int) error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if err := m.checkClientHealth(); err != nil {
+	client, err := m.activeClient()
+	if err != nil {
 		return err
 	}
-	return m.client.DeleteSMS(device, index)
+	return client.DeleteSMS(device, index)
 }
 
 // DeleteAllSMS 删除 SIM 卡中的所有短信
 func (m *Manager) DeleteAllSMS(device string) error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if err := m.checkClientHealth(); err != nil {
+	client, err := m.activeClient()
+	if err != nil {
 		return err
 	}
-	return m.client.DeleteAllSMS(device)
+	return client.DeleteAllSMS(device)
 }
 
 // statusUpdateLoop 状态更新循环
-func (m *Manager) statusUpdateLoop() {
+func (m *Manager) statusUpdateLoop(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
 		m.updateStatus()
 	}
 }
@@ -310,17 +418,10 @@ func (m *Manager) updateStatus() {
 		m.mu.Unlock()
 		log.Printf("Failed to get status info: %v (consecutive failures: %d)", err, failCount)
 
-		// 连续失败超过 3 次，判定 AMI 连接已断开，触发重连
+		// 连续失败超过 3 次，判定 AMI 连接已断开，由连接监督在后台重连
 		if failCount >= 3 {
 			log.Println("AMI connection health check failed 3 times in a row, forcing reconnect...")
-			if rerr := m.reconnect(); rerr != nil {
-				log.Printf("AMI reconnect failed: %v", rerr)
-			} else {
-				m.mu.Lock()
-				m.statusFailCount = 0
-				m.mu.Unlock()
-				log.Println("AMI reconnected successfully after health check failure")
-			}
+			m.requestReconnect(client)
 		}
 		return
 	}
@@ -363,7 +464,7 @@ func (m *Manager) GetClient() *Client {
 
 // checkClientHealth 检查 AMI 客户端是否健康（连接正常且近期通信成功）
 func (m *Manager) checkClientHealth() error {
-	if m.client == nil {
+	if m.client == nil || !m.client.IsConnected() {
 		return ErrNotConnected
 	}
 	if m.statusFailCount > 0 {
@@ -372,95 +473,208 @@ func (m *Manager) checkClientHealth() error {
 	return nil
 }
 
-// Reload 重新加载配置
-func (m *Manager) Reload() error {
+// activeClient 返回健康的客户端，未连接时立即返回 ErrNotConnected
+// 调用方在锁外使用返回的客户端，避免慢的 AMI 动作阻塞重连和其他调用方
+func (m *Manager) activeClient() (*Client, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if err := m.checkClientHealth(); err != nil {
+		return nil, err
+	}
+	return m.client, nil
+}
+
+// Reload 重新加载配置
+func (m *Manager) Reload() error {
+	client, err := m.activeClient()
+	if err != nil {
 		return err
 	}
-	return m.client.Reload()
+	return client.Reload()
 }
 
 // Restart 重启 Asterisk
 func (m *Manager) Restart() error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if err := m.checkClientHealth(); err != nil {
+	client, err := m.activeClient()
+	if err != nil {
 		return err
 	}
-	return m.client.Restart()
+	return client.Restart()
 }
 
 // SendSMS 发送短信
 func (m *Manager) SendSMS(device, number, message string) error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if err := m.checkClientHealth(); err != nil {
+	client, err := m.activeClient()
+	if err != nil {
 		return err
 	}
-	return m.client.SendSMS(device, number, message)
+	return client.SendSMS(device, number, message)
 }
 
-// SetDongleAlertFn 设置 dongle 设备故障通知回调
-func (m *Manager) SetDongleAlertFn(fn DongleAlertFunc) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.dongleAlertFn = fn
+// SendUSSD 发送 USSD 请求
+func (m *Manager) SendUSSD(device, code string) error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
+	}
+	return client.SendUSSD(device, code)
 }
 
-// reconnect 重新连接 AMI
-func (m *Manager) reconnect() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// CancelUSSD 结束设备上正在进行的 USSD 会话
+func (m *Manager) CancelUSSD(device string) error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
+	}
+	return client.CancelUSSD(device)
+}
 
-	// 关闭旧连接
-	if m.client != nil {
-		m.client.Close()
-		m.client = nil
+// RestartDevice 只重启指定的 quectel 设备
+func (m *Manager) RestartDevice(device string) error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
 	}
+	return client.RestartDevice(device)
+}
 
-	// 重试连接 AMI，最多重试 10 次，每次间隔 2 秒
-	maxRetries := 10
-	retryInterval := 2 * time.Second
+// ReloadQuectel 重新加载 quectel.conf（端口变化后调用）
+func (m *Manager) ReloadQuectel() error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
+	}
+	return client.ReloadQuectel()
+}
 
-	var client *Client
-	var err error
+// Command 执行 Asterisk CLI 命令并返回输出
+func (m *Manager) Command(ctx context.Context, command string) (string, error) {
+	client, err := m.activeClient()
+	if err != nil {
+		return "", err
+	}
+	return client.Command(ctx, command)
+}
 
-	for i := 0; i < maxRetries; i++ {
-		client, err = NewClient()
-		if err == nil {
-			break
-		}
-		if i < maxRetries-1 {
-			log.Printf("Failed to reconnect to AMI (attempt %d/%d): %v, retrying in %v...", i+1, maxRetries, err, retryInterval)
-			time.Sleep(retryInterval)
-		}
+// DongleStates 查询所有 dongle 设备的当前状态（设备 ID -> 状态，如 Free、In use、Not connected）
+func (m *Manager) DongleStates(ctx context.Context) (map[string]string, error) {
+	output, err := m.Command(ctx, "quectel show devices")
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]string)
+	for _, dev := range parseQuectelDevices(output) {
+		states[dev.ID] = dev.State
 	}
+	return states, nil
+}
 
+// FullyBooted 当前连接的 Asterisk 是否已完全启动
+func (m *Manager) FullyBooted(ctx context.Context) (bool, error) {
+	client, err := m.activeClient()
+	if err != nil {
+		return false, err
+	}
+	return client.FullyBooted(ctx)
+}
+
+// Originate 异步发起呼叫
+func (m *Manager) Originate(req OriginateRequest) error {
+	client, err := m.activeClient()
 	if err != nil {
 		return err
 	}
+	return client.Originate(req)
+}
 
-	m.client = client
-	log.Println("AMI reconnected successfully")
-	return nil
+// Hangup 挂断通道
+func (m *Manager) Hangup(channel string) error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
+	}
+	return client.Hangup(channel)
+}
+
+// Redirect 将通道转到指定的 dialplan 位置
+func (m *Manager) Redirect(channel, extraChannel, context, exten string) error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
+	}
+	return client.Redirect(channel, extraChannel, context, exten)
+}
+
+// Atxfer 咨询转接
+func (m *Manager) Atxfer(channel, context, exten string) error {
+	client, err := m.activeClient()
+	if err != nil {
+		return err
+	}
+	return client.Atxfer(channel, context, exten)
+}
+
+// SetDevicePresent 更新设备的插拔状态
+func (m *Manager) SetDevicePresent(device string, present bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unpluggedDevices == nil {
+		m.unpluggedDevices = make(map[string]time.Time)
+	}
+	if present {
+		delete(m.unpluggedDevices, device)
+	} else if _, ok := m.unpluggedDevices[device]; !ok {
+		m.unpluggedDevices[device] = time.Now()
+	}
+}
+
+// IsDeviceUnplugged 设备是否已被拔出
+func (m *Manager) IsDeviceUnplugged(device string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.unpluggedDevices[device]
+	return ok
+}
+
+// GetDongleStatus 获取 Dongle 设备状态（含 IMEI/IMSI/ICCID）
+func (m *Manager) GetDongleStatus(deviceID string) *DongleStatus {
+	m.mu.RLock()
+	client := m.client
+	m.mu.RUnlock()
+	if client == nil {
+		return nil
+	}
+	return client.GetDongleStatus(deviceID)
+}
+
+// SetDongleAlertFn 设置 dongle 设备故障通知回调
+func (m *Manager) SetDongleAlertFn(fn DongleAlertFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dongleAlertFn = fn
 }
 
+// dongle 健康检查参数（测试中可以缩短）
+var (
+	dongleHealthInterval  = 30 * time.Second // 每 30 秒检查一次
+	dongleRestartCooldown = 60 * time.Second // 每次重启后等待设备重新初始化的时间
+)
+
+// dongleMaxRestarts 连续重启失败多少次后发通知
+const dongleMaxRestarts = 3
+
 // dongleHealthLoop 定期检查 dongle 设备健康状态
-// 检测到设备离线时尝试 module reload chan_quectel.so 恢复
-// 连续恢复失败后发送一次通知，故障解除后重置通知状态
-func (m *Manager) dongleHealthLoop() {
-	const (
-		checkInterval    = 30 * time.Second // 每 30 秒检查一次
-		maxReloadRetries = 3                // 连续 reload 失败多少次后发通知
-		reloadCooldown   = 60 * time.Second // 每次 reload 后等待时间
-	)
-
-	ticker := time.NewTicker(checkInterval)
+func (m *Manager) dongleHealthLoop(ctx context.Context) {
+	ticker := time.NewTicker(dongleHealthInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
 		// 检查全局开关
 		var gc database.GlobalConfig
 		if err := database.DB.FirstOrCreate(&gc, database.GlobalConfig{ID: 1}).Error; err == nil {
@@ -477,79 +691,90 @@ func (m *Manager) dongleHealthLoop() {
 			}
 		}
 
-		m.mu.RLock()
-		client := m.client
-		alertFn := m.dongleAlertFn
-		m.mu.RUnlock()
+		m.checkDongleHealth()
+	}
+}
 
-		if client == nil {
-			continue
-		}
+// checkDongleHealth 检查一轮 dongle 设备健康状态
+// 检测到设备离线时只重启该设备（quectel restart），不 module reload chan_quectel.so（会中断所有设备上的通话）
+// restart 命令失败也计入失败次数，达到阈值后发送告警
+// 已被拔出的设备由热插拔 watcher 处理，这里跳过
+// 连续恢复失败后发送一次通知，故障解除后重置通知状态
+func (m *Manager) checkDongleHealth() {
+	m.mu.RLock()
+	client := m.client
+	alertFn := m.dongleAlertFn
+	m.mu.RUnlock()
 
-		// 查询所有 dongle 设备列表
-		msg, err := client.SendCommand("quectel show devices", 5*time.Second)
-		if err != nil {
-			log.Printf("[DongleHealth] Failed to query devices: %v", err)
-			continue
-		}
+	if client == nil {
+		return
+	}
 
-		output := msg.Field("data")
-		if output == "" {
-			continue
-		}
+	// 查询所有 dongle 设备列表
+	output, err := client.sendCommand("quectel show devices", 5*time.Second)
+	if err != nil {
+		log.Printf("[DongleHealth] Failed to query devices: %v", err)
+		return
+	}
 
-		// 解析输出，检查每个设备的 State 列
-		// 输出格式（表头 + 数据行，字段按空格/多空格分隔）：
-		// ID           Group State      RSSI ...
-		// quectel0     0     Free       31  ...
-		devices := parseQuectelDevices(output)
+	if output == "" {
+		return
+	}
 
-		for _, dev := range devices {
-			if dev.State == "Free" || dev.State == "In use" {
-				// 设备正常，重置失败计数和通知状态
-				m.mu.Lock()
-				if m.dongleFailCount > 0 || m.dongleNotified {
-					log.Printf("[DongleHealth] Device %s recovered (state=%s), resetting alert state", dev.ID, dev.State)
-					m.dongleFailCount = 0
-					m.dongleNotified = false
-				}
-				m.mu.Unlock()
-				continue
-			}
+	// 解析输出，检查每个设备的 State 列
+	// 输出格式（表头 + 数据行，字段按空格/多空格分隔）：
+	// ID           Group State      RSSI ...
+	// quectel0     0     Free       31  ...
+	devices := parseQuectelDevices(output)
 
-			// 设备异常（Not connected / Not initialized 等）
+	for _, dev := range devices {
+		if dev.State == "Free" || dev.State == "In use" {
+			// 设备正常，重置失败计数和通知状态
 			m.mu.Lock()
-			m.dongleFailCount++
-			failCount := m.dongleFailCount
-			notified := m.dongleNotified
+			if m.dongleFailCount > 0 || m.dongleNotified {
+				log.Printf("[DongleHealth] Device %s recovered (state=%s), resetting alert state", dev.ID, dev.State)
+				m.dongleFailCount = 0
+				m.dongleNotified = false
+			}
 			m.mu.Unlock()
+			continue
+		}
 
-			log.Printf("[DongleHealth] Device %s unhealthy (state=%s), consecutive failures: %d", dev.ID, dev.State, failCount)
+		// 设备已拔出，重启没有意义，等待重新插入
+		if m.IsDeviceUnplugged(dev.ID) {
+			continue
+		}
 
-			log.Printf("[DongleHealth] Device %s unhealthy (state=%s), attempting module reload chan_quectel.so (attempt %d/%d)",
-				dev.ID, dev.State, failCount, maxReloadRetries)
+		// 设备异常（Not connected / Not initialized 等）
+		m.mu.Lock()
+		m.dongleFailCount++
+		failCount := m.dongleFailCount
+		notified := m.dongleNotified
+		m.mu.Unlock()
 
-			_, rerr := client.SendCommand("module reload chan_quectel.so", 10*time.Second)
-			if rerr != nil {
-				log.Printf("[DongleHealth] module reload failed: %v", rerr)
-			} else {
-				log.Printf("[DongleHealth] module reload chan_quectel.so executed")
-			}
+		log.Printf("[DongleHealth] Device %s unhealthy (state=%s), consecutive failures: %d", dev.ID, dev.State, failCount)
 
-			// reload 后等待设备重新初始化
-			time.Sleep(reloadCooldown)
+		log.Printf("[DongleHealth] Device %s unhealthy (state=%s), attempting quectel restart (attempt %d/%d)",
+			dev.ID, dev.State, failCount, dongleMaxRestarts)
+
+		if rerr := client.RestartDevice(dev.ID); rerr != nil {
+			log.Printf("[DongleHealth] quectel restart %s failed: %v", dev.ID, rerr)
+		} else {
+			log.Printf("[DongleHealth] quectel restart %s executed", dev.ID)
+			// 重启后等待设备重新初始化
+			time.Sleep(dongleRestartCooldown)
+		}
 
-			// 连续失败达到阈值，发送一次通知
-			if failCount >= maxReloadRetries && !notified && alertFn != nil {
-				alertMsg := fmt.Sprintf("[DongleHealth] ALERT: Device %s failed after %d reload attempts (state=%s). 需要物理操作：到懒猫微服旁边拔插一下 USB dongle，或者重启懒猫微服硬件。",
-					dev.ID, failCount, dev.State)
-				log.Println(alertMsg)
-				alertFn(dev.ID, alertMsg)
+		// 连续失败达到阈值，发送一次通知
+		if failCount >= dongleMaxRestarts && !notified && alertFn != nil {
+			alertMsg := fmt.Sprintf("[DongleHealth] ALERT: Device %s failed after %d restart attempts (state=%s). 需要物理操作：到懒猫微服旁边拔插一下 USB dongle，或者重启懒猫微服硬件。",
+				dev.ID, failCount, dev.State)
+			log.Println(alertMsg)
+			alertFn(dev.ID, alertMsg)
 
-				m.mu.Lock()
-				m.dongleNotified = true
-				m.mu.Unlock()
-			}
+			m.mu.Lock()
+			m.dongleNotified = true
+			m.mu.Unlock()
 		}
 	}
 }
@@ -577,8 +802,8 @@ func parseQuectelDevices(output string) []quectelDeviceInfo {
 		// fields[0]=ID, fields[1]=Group, fields[2]=State(可能截断)
 		// State 列可能是 "Free", "Not", "In" 等
 		state := fields[2]
-		// "Not" 可能是 "Not connected" 或 "Not initialized" 被截断
-		if state == "Not" && len(fields) > 3 {
+		// "Not" 可能是 "Not connected" 或 "Not initialized" 被截断，"In" 是 "In use" 被截断
+		if (state == "Not" || state == "In") && len(fields) > 3 {
 			state = state + " " + fields[3]
 		}
 		devices = append(devices, quectelDeviceInfo{
@@ -589,12 +814,20 @@ func parseQuectelDevices(output string) []quectelDeviceInfo {
 	return devices
 }
 
-// Close 关闭 AMI 管理器
+// Close 关闭 AMI 管理器（停止连接监督，不再重连）
 func (m *Manager) Close() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if m.client != nil {
-		return m.client.Close()
+	cancel := m.cancel
+	client := m.client
+	m.cancel = nil
+	m.client = nil
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if client != nil {
+		return client.Close()
 	}
 	return nil
 }
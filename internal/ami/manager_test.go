@@ -0,0 +1,237 @@
+package ami
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/amitest"
+	"github.com/staskobzar/goami2"
+)
+
+// smsRecorder 记录收到的短信通知
+type smsRecorder struct {
+	mu    sync.Mutex
+	sms   []string
+	parts []SMSPart
+}
+
+func (r *smsRecorder) OnStatusUpdate(info *StatusInfo) {}
+
+func (r *smsRecorder) OnSMSReceived(device, number, message, timestamp string) {
+	r.OnSMSReceivedWithIndex(device, number, message, timestamp, 0)
+}
+
+func (r *smsRecorder) OnSMSReceivedWithIndex(device, number, message, timestamp string, index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sms = append(r.sms, strings.Join([]string{device, number, message, timestamp}, "|"))
+}
+
+func (r *smsRecorder) OnSMSPartReceived(device, number, message, timestamp string, index int, part SMSPart) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parts = append(r.parts, part)
+}
+
+// newTestManager 创建连接到模拟服务器的 Manager（不启动后台循环）
+func newTestManager(t *testing.T) (*amitest.Server, *Manager) {
+	t.Helper()
+	srv, c := newTestClient(t)
+	m := &Manager{client: c}
+	t.Cleanup(func() { m.Close() })
+	return srv, m
+}
+
+// dispatchUntil 像 handleMessages 一样把客户端消息交给 processMessage，直到条件满足
+func dispatchUntil(t *testing.T, m *Manager, done func() bool) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for !done() {
+		select {
+		case msg := <-m.GetClient().Messages():
+			if msg != nil {
+				m.processMessage(msg)
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for AMI events")
+		}
+	}
+}
+
+func TestManagerDispatchesSMSEvents(t *testing.T) {
+	srv, m := newTestManager(t)
+	rec := &smsRecorder{}
+	m.Subscribe(rec)
+
+	// dialplan 通过 UserEvent 上报的短信（内容 Base64 编码）
+	srv.Emit(amitest.Event("UserEvent",
+		"UserEvent", "SMSReceived",
+		"Device", "quectel0",
+		"Sender", "+8613800000000",
+		"Message", "ignored",
+		"MessageBase64", base64.StdEncoding.EncodeToString([]byte("验证码 1234\n请勿泄露")),
+		"Timestamp", "24/05/01 10:00:00",
+		"SMSIndex", "3",
+	))
+	// 长短信分段
+	srv.Emit(amitest.Event("UserEvent",
+		"UserEvent", "SMSReceived",
+		"Device", "quectel0",
+		"Sender", "10086",
+		"Message", "part one",
+		"ConcatRef", "42",
+		"ConcatTotal", "2",
+		"ConcatSeq", "1",
+	))
+
+	dispatchUntil(t, m, func() bool {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		return len(rec.sms) == 1 && len(rec.parts) == 1
+	})
+
+	// 换行被替换为空格，避免破坏日志
+	if want := "quectel0|+8613800000000|验证码 1234 请勿泄露|24/05/01 10:00:00"; rec.sms[0] != want {
+		t.Fatalf("sms = %q, want %q", rec.sms[0], want)
+	}
+	if part := rec.parts[0]; part.Ref != 42 || part.Total != 2 || part.Seq != 1 {
+		t.Fatalf("part = %+v", part)
+	}
+}
+
+// setDongleHealthCooldown 测试中跳过重启后的等待
+func setDongleHealthCooldown(t *testing.T, d time.Duration) {
+	t.Helper()
+	old := dongleRestartCooldown
+	dongleRestartCooldown = d
+	t.Cleanup(func() { dongleRestartCooldown = old })
+}
+
+const devicesHeader = "ID           Group State      RSSI Mode Submode Provider Name  Model      Firmware          IMEI             IMSI             Number\n"
+
+func TestCheckDongleHealthRestartsAndAlertsOnce(t *testing.T) {
+	srv, m := newTestManager(t)
+	setDongleHealthCooldown(t, 0)
+
+	var alerts []string
+	m.SetDongleAlertFn(func(deviceID, message string) {
+		alerts = append(alerts, deviceID)
+	})
+	srv.SetCommand("quectel show devices", devicesHeader+"quectel1     0     Not connected")
+
+	for i := 0; i < dongleMaxRestarts+1; i++ {
+		m.checkDongleHealth()
+	}
+
+	restarts := 0
+	for _, cmd := range srv.Commands() {
+		if cmd == "quectel restart now quectel1" {
+			restarts++
+		}
+	}
+	if restarts != dongleMaxRestarts+1 {
+		t.Fatalf("restarts = %d, want %d", restarts, dongleMaxRestarts+1)
+	}
+	if len(alerts) != 1 || alerts[0] != "quectel1" {
+		t.Fatalf("alerts = %v, want exactly one for quectel1", alerts)
+	}
+
+	// 设备恢复后重置告警状态
+	srv.SetCommand("quectel show devices", devicesHeader+
+		"quectel0     0     Free       23   0    0       CHINA MOBILE   EC20F      EC20CEFAGR06A05M4G 861234567890123 460001234567890  Unknown\n"+
+		"quectel1     0     In use     23")
+	before := len(srv.Commands())
+	m.checkDongleHealth()
+	for _, cmd := range srv.Commands()[before:] {
+		if strings.HasPrefix(cmd, "quectel restart") {
+			t.Fatalf("healthy device was restarted: %q", cmd)
+		}
+	}
+	if m.dongleFailCount != 0 || m.dongleNotified {
+		t.Fatalf("alert state not reset: failCount=%d notified=%v", m.dongleFailCount, m.dongleNotified)
+	}
+}
+
+func TestCheckDongleHealthRestartFailureAlertsWithoutModuleReload(t *testing.T) {
+	srv, m := newTestManager(t)
+	setDongleHealthCooldown(t, 0)
+
+	var alerts []string
+	m.SetDongleAlertFn(func(deviceID, message string) {
+		alerts = append(alerts, deviceID)
+	})
+	srv.SetCommand("quectel show devices", devicesHeader+"quectel1     0     Not initialized")
+	srv.SetCommand("quectel restart now quectel1", "Device quectel1 not found")
+
+	for i := 0; i < dongleMaxRestarts; i++ {
+		m.checkDongleHealth()
+	}
+
+	// module reload 会中断所有设备上的通话，restart 失败也不能使用
+	for _, cmd := range srv.Commands() {
+		if strings.HasPrefix(cmd, "module reload") {
+			t.Fatalf("chan_quectel reloaded: %q", cmd)
+		}
+	}
+	if m.dongleFailCount != dongleMaxRestarts {
+		t.Fatalf("failCount = %d, want %d", m.dongleFailCount, dongleMaxRestarts)
+	}
+	if len(alerts) != 1 || alerts[0] != "quectel1" {
+		t.Fatalf("alerts = %v, want exactly one for quectel1", alerts)
+	}
+}
+
+func TestCheckDongleHealthSkipsUnpluggedDevice(t *testing.T) {
+	srv, m := newTestManager(t)
+	setDongleHealthCooldown(t, 0)
+
+	srv.SetCommand("quectel show devices", devicesHeader+"quectel1     0     Not connected")
+	m.SetDevicePresent("quectel1", false)
+
+	m.checkDongleHealth()
+	for _, cmd := range srv.Commands() {
+		if strings.HasPrefix(cmd, "quectel restart") || strings.HasPrefix(cmd, "module reload") {
+			t.Fatalf("unplugged device should not be restarted, got %q", cmd)
+		}
+	}
+}
+
+func TestManagerOriginateUsesChannelIDAsActionID(t *testing.T) {
+	srv, m := newTestManager(t)
+	srv.Handle("Originate", func(action amitest.Message) []amitest.Message {
+		return []amitest.Message{
+			amitest.Success("Message", "Originate successfully queued"),
+			amitest.Event("OriginateResponse", "Response", "Success", "Uniqueid", action.Get("ChannelId")),
+		}
+	})
+
+	err := m.Originate(OriginateRequest{
+		Channel:   "PJSIP/100",
+		Context:   "click-to-call",
+		Exten:     "10086",
+		ChannelID: "c2c-test",
+		Variables: map[string]string{"CLICK_DONGLE": "quectel0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action, ok := srv.WaitForAction(time.Second, func(m amitest.Message) bool { return m.Get("Action") == "Originate" })
+	if !ok {
+		t.Fatal("Originate was not sent")
+	}
+	if action.Get("ActionID") != "c2c-test" || action.Get("Async") != "true" || action.Get("Variable") != "CLICK_DONGLE=quectel0" {
+		t.Fatalf("originate action = %v", action)
+	}
+
+	// OriginateResponse 在响应之后到达，继续分发给通话跟踪
+	msg := waitForMessage(t, m.GetClient(), func(msg *goami2.Message) bool {
+		return msg.Field("Event") == "OriginateResponse"
+	})
+	if msg.Field("ActionID") != "c2c-test" {
+		t.Fatalf("OriginateResponse ActionID = %q", msg.Field("ActionID"))
+	}
+}
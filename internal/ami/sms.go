@@ -1,85 +1,52 @@
 package ami
 
 import (
+	"fmt"
 	"log"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ety001/lzc-mobile/internal/at"
 )
 
 // SMSInfo SIM 卡短信信息
 type SMSInfo struct {
-	Index     int    // 短信索引（从1开始）
-	Status    string // 状态：REC READ/REC UNREAD/STO SENT/STO UNSENT
-	Sender    string // 发送者号码
-	Timestamp string // 时间戳（原始格式，如 "25/01/22 13:53:08+32"）
-	Content   string // 短信内容
+	Index     int     // 短信索引（从1开始）
+	Status    string  // 状态：REC READ/REC UNREAD/STO SENT/STO UNSENT
+	Sender    string  // 发送者号码
+	Timestamp string  // 时间戳（原始格式，如 "25/01/22 13:53:08+32"）
+	Content   string  // 短信内容
+	PDU       *at.PDU // PDU 解码结果（包含编码、分段头、短信中心等信息）
 }
 
-// parseCMGL 解析 AT+CMGL 命令的输出
-// 输入格式示例（文本模式 AT+CMGF=1）：
-// +CMGL: 1,"REC READ","+861790013744",,"25/01/22 13:53:08+32"
-// Test message
-// +CMGL: 2,"REC READ","10010",,"25/01/22 13:50:00+32"
-// Another message
-// 注意：短信内容可能跨多行，直到遇到下一个 +CMGL 行或空行为止
-func parseCMGL(output string) []SMSInfo {
-	smsList := []SMSInfo{}
-
-	// 按行分割
-	lines := strings.Split(output, "\n")
-
-	var currentSMS *SMSInfo
-	var contentLines []string
-
-	// 正则表达式匹配 CMGL 行
-	// 格式：+CMGL: <index>,"<status>","<sender>",,"<timestamp>"
-	cmglRegex := regexp.MustCompile(`\+CMGL:\s*(\d+),"([^"]+)","([^"]*)",*"([^"]*)"`)
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// 检查是否是 CMGL 行
-		if matches := cmglRegex.FindStringSubmatch(line); matches != nil {
-			// 如果之前有未完成的短信，先保存它
-			if currentSMS != nil {
-				currentSMS.Content = strings.Join(contentLines, "\n")
-				smsList = append(smsList, *currentSMS)
-				contentLines = []string{}
-			}
-
-			// 解析索引
-			index, _ := strconv.Atoi(matches[1])
+// SMSPart 长短信分段元数据
+// 来源可以是 chan_quectel 提供的分段字段，也可以是原始 PDU（由 sms 包解析 UDH）
+type SMSPart struct {
+	PDU   string // 原始 PDU（十六进制，可选）
+	Ref   int    // 分段参考号（UDH concatenation reference）
+	Total int    // 总段数
+	Seq   int    // 当前段序号（从 1 开始）
+}
 
-			// 创建新的短信信息
-			currentSMS = &SMSInfo{
-				Index:     index,
-				Status:    matches[2],
-				Sender:    matches[3],
-				Timestamp: matches[4],
-			}
-		} else if currentSMS != nil {
-			// 这是短信内容行（可能跨多行）
-			if line != "" {
-				contentLines = append(contentLines, line)
-			} else if len(contentLines) > 0 {
-				// 遇到空行，如果已有内容，保存当前短信
-				currentSMS.Content = strings.Join(contentLines, "\n")
-				smsList = append(smsList, *currentSMS)
-				currentSMS = nil
-				contentLines = []string{}
-			}
-		}
+// smsInfoFromRecord 将 PDU 模式读取的 SIM 卡短信转换为 SMSInfo
+func smsInfoFromRecord(rec at.SMSRecord) SMSInfo {
+	info := SMSInfo{
+		Index:   rec.Index,
+		Status:  rec.Status.String(),
+		Sender:  rec.PDU.Address.Number,
+		Content: rec.PDU.Text,
+		PDU:     rec.PDU,
 	}
-
-	// 处理最后一个短信（如果没有空行结尾）
-	if currentSMS != nil && len(contentLines) > 0 {
-		currentSMS.Content = strings.Join(contentLines, "\n")
-		smsList = append(smsList, *currentSMS)
+	if !rec.PDU.Timestamp.IsZero() {
+		info.Timestamp = formatSIMTimestamp(rec.PDU.Timestamp)
 	}
+	return info
+}
 
-	return smsList
+// formatSIMTimestamp 按文本模式的格式输出时间戳（如 "25/01/22 13:53:08+32"，时区单位为 15 分钟）
+func formatSIMTimestamp(t time.Time) string {
+	_, offset := t.Zone()
+	return fmt.Sprintf("%s%+03d", t.Format("06/01/02 15:04:05"), offset/(15*60))
 }
 
 // MatchSMS 匹配短信（通过发送者、时间和内容）
@@ -97,16 +64,13 @@ func MatchSMS(sender, timestamp, content string, smsList []SMSInfo) int {
 	var targetTime time.Time
 	var err error
 	if timestamp != "" {
-		// SIM 卡时间戳格式: "YY/MM/DD HH:MM:SS"
+		// SIM 卡时间戳格式: "YY/MM/DD HH:MM:SS"（两位年份解析为 20YY）
 		// 例如: "25/01/22 13:53:08"
 		targetTime, err = time.Parse("06/01/02 15:04:05", timestamp)
 		if err != nil {
 			// 时间解析失败，只匹配发送者和内容
 			log.Printf("[SMS] Failed to parse timestamp '%s': %v, matching by sender and content only", timestamp, err)
 			targetTime = time.Time{}
-		} else {
-			// 转换为 2000 年代
-			targetTime = targetTime.AddDate(2000, 0, 0)
 		}
 	}
 
@@ -128,11 +92,12 @@ func MatchSMS(sender, timestamp, content string, smsList []SMSInfo) int {
 		// 4. 如果时间戳有效，匹配时间
 		if !targetTime.IsZero() && sms.Timestamp != "" {
 			// 解析短信时间戳
-			smsTimeStr := strings.Split(sms.Timestamp, "+")[0]
+			smsTimeStr := sms.Timestamp
+			if len(smsTimeStr) > len("06/01/02 15:04:05") {
+				smsTimeStr = smsTimeStr[:len("06/01/02 15:04:05")]
+			}
 			smsTime, err := time.Parse("06/01/02 15:04:05", smsTimeStr)
 			if err == nil {
-				smsTime = smsTime.AddDate(2000, 0, 0)
-
 				// 计算时间差（允许5分钟误差）
 				diff := targetTime.Sub(smsTime)
 				if diff < 0 {
@@ -0,0 +1,251 @@
+package ami
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// ConnectionState AMI 连接状态
+type ConnectionState string
+
+const (
+	ConnStateDisconnected ConnectionState = "disconnected"
+	ConnStateConnecting   ConnectionState = "connecting"
+	ConnStateConnected    ConnectionState = "connected"
+)
+
+// ConnectionStateChange 连接状态变化（通知实现了 OnConnectionStateChanged 的订阅者）
+type ConnectionStateChange struct {
+	State    ConnectionState `json:"state"`
+	Previous ConnectionState `json:"previous"`
+	Error    string          `json:"error,omitempty"` // 断开或连接失败的原因
+	Time     time.Time       `json:"time"`
+}
+
+// ConnectionStats 连接状态和重连统计
+type ConnectionStats struct {
+	State              ConnectionState `json:"state"`
+	Since              time.Time       `json:"since"`           // 进入当前状态的时间
+	Connects           int             `json:"connects"`        // 成功连接次数（包括首次连接）
+	Disconnects        int             `json:"disconnects"`     // 连接断开次数
+	FailedAttempts     int             `json:"failed_attempts"` // 累计连接失败次数
+	Attempt            int             `json:"attempt"`         // 当前这轮重连已失败的次数
+	LastError          string          `json:"last_error,omitempty"`
+	LastConnectedAt    *time.Time      `json:"last_connected_at,omitempty"`
+	LastDisconnectedAt *time.Time      `json:"last_disconnected_at,omitempty"`
+	NextRetryAt        *time.Time      `json:"next_retry_at,omitempty"` // 连接中时下一次重试的时间
+}
+
+// initConnectAttempts Init 首次连接的最大尝试次数
+const initConnectAttempts = 10
+
+// 重连退避参数（测试中可以缩短）
+var (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// backoffDelay 第 attempt 次（从 1 开始）连接失败后的等待时间
+// 从 reconnectMinDelay 开始指数增长，上限 reconnectMaxDelay，再加 ±20% 的抖动
+func backoffDelay(attempt int) time.Duration {
+	delay := reconnectMinDelay
+	for i := 1; i < attempt && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)*2/5+1)) - delay/5
+	return delay + jitter
+}
+
+// connect 连接 AMI，失败时按退避时间重试，直到成功、ctx 取消或达到 maxAttempts（0 表示不限次数）
+// 连接过程中不持有 m.mu，调用方在此期间会立即收到 ErrNotConnected
+func (m *Manager) connect(ctx context.Context, maxAttempts int) (*Client, error) {
+	m.setConnState(ConnStateConnecting, nil)
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		client, err := NewClient()
+		if err == nil {
+			return client, nil
+		}
+
+		delay := backoffDelay(attempt)
+		next := time.Now().Add(delay)
+		m.mu.Lock()
+		m.connStats.FailedAttempts++
+		m.connStats.Attempt = attempt
+		m.connStats.LastError = err.Error()
+		m.connStats.NextRetryAt = &next
+		m.mu.Unlock()
+
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			return nil, err
+		}
+		log.Printf("Failed to connect to AMI (attempt %d): %v, retrying in %v...", attempt, err, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// setClient 切换到新连接的客户端
+func (m *Manager) setClient(client *Client) {
+	m.mu.Lock()
+	m.client = client
+	m.statusFailCount = 0
+	// Asterisk 可能已重启，重新检查所有设备的身份
+	m.resetDongleStates()
+	m.mu.Unlock()
+
+	m.setConnState(ConnStateConnected, nil)
+}
+
+// supervise 连接监督循环：分发当前连接的消息，检测到断开后在后台按退避时间重连
+// 新连接在 NewClient 中重新订阅事件并查询注册状态，订阅者通过 OnConnectionStateChanged 得知重连
+// ctx 取消（Close）时退出
+func (m *Manager) supervise(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		client := m.GetClient()
+		if client == nil {
+			newClient, err := m.connect(ctx, 0)
+			if err != nil {
+				return
+			}
+			if ctx.Err() != nil {
+				newClient.Close()
+				return
+			}
+			m.setClient(newClient)
+			log.Println("AMI reconnected successfully")
+			continue
+		}
+
+		select {
+		case msg := <-client.Messages():
+			if msg != nil {
+				m.processMessage(msg)
+			}
+		case err := <-client.Errors():
+			if err != nil {
+				log.Printf("AMI error: %v", err)
+			}
+		case <-client.Disconnected():
+			m.drainMessages(client)
+			m.dropClient(client)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drainMessages 处理断开前已收到但还没分发的消息
+func (m *Manager) drainMessages(client *Client) {
+	for {
+		select {
+		case msg := <-client.Messages():
+			if msg != nil {
+				m.processMessage(msg)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// dropClient 丢弃已断开的客户端，之后由 supervise 重连
+func (m *Manager) dropClient(client *Client) {
+	err := client.DisconnectErr()
+
+	m.mu.Lock()
+	if m.client == client {
+		m.client = nil
+	}
+	m.mu.Unlock()
+	client.Close()
+
+	log.Printf("AMI connection lost (%v), reconnecting in background", err)
+	m.setConnState(ConnStateDisconnected, err)
+}
+
+// requestReconnect 关闭指定的客户端（如健康检查判定连接已失效），supervise 检测到断开后重连
+func (m *Manager) requestReconnect(client *Client) {
+	if client != nil {
+		client.Close()
+	}
+}
+
+// setConnState 更新连接状态，状态变化时通知订阅者
+func (m *Manager) setConnState(state ConnectionState, err error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	previous := m.connState
+	if previous == "" {
+		previous = ConnStateDisconnected
+	}
+	if err != nil {
+		m.connStats.LastError = err.Error()
+	}
+	if previous == state && m.connState != "" {
+		m.mu.Unlock()
+		return
+	}
+	m.connState = state
+	m.connStats.State = state
+	m.connStats.Since = now
+	switch state {
+	case ConnStateConnected:
+		m.connStats.Connects++
+		m.connStats.Attempt = 0
+		m.connStats.LastConnectedAt = &now
+		m.connStats.NextRetryAt = nil
+	case ConnStateDisconnected:
+		if previous == ConnStateConnected {
+			m.connStats.Disconnects++
+			m.connStats.LastDisconnectedAt = &now
+		}
+		m.connStats.NextRetryAt = nil
+	}
+	subscribers := make([]StatusSubscriber, len(m.subscribers))
+	copy(subscribers, m.subscribers)
+	m.mu.Unlock()
+
+	change := ConnectionStateChange{State: state, Previous: previous, Time: now}
+	if err != nil {
+		change.Error = err.Error()
+	}
+	log.Printf("[AMI] Connection state %s -> %s", previous, state)
+
+	for _, sub := range subscribers {
+		if s, ok := sub.(interface {
+			OnConnectionStateChanged(change ConnectionStateChange)
+		}); ok {
+			s.OnConnectionStateChanged(change)
+		}
+	}
+}
+
+// ConnectionStats 获取连接状态和重连统计
+func (m *Manager) ConnectionStats() ConnectionStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := m.connStats
+	if stats.State == "" {
+		stats.State = ConnStateDisconnected
+	}
+	return stats
+}
@@ -0,0 +1,215 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/amitest"
+)
+
+// connRecorder 记录连接状态变化和收到的短信
+type connRecorder struct {
+	smsRecorder
+	changes []ConnectionStateChange
+}
+
+func (r *connRecorder) OnConnectionStateChanged(change ConnectionStateChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, change)
+}
+
+func (r *connRecorder) states() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make([]string, 0, len(r.changes))
+	for _, change := range r.changes {
+		states = append(states, string(change.State))
+	}
+	return states
+}
+
+// setReconnectDelay 测试中缩短重连退避时间
+func setReconnectDelay(t *testing.T, min, max time.Duration) {
+	t.Helper()
+	oldMin, oldMax := reconnectMinDelay, reconnectMaxDelay
+	reconnectMinDelay, reconnectMaxDelay = min, max
+	t.Cleanup(func() { reconnectMinDelay, reconnectMaxDelay = oldMin, oldMax })
+}
+
+// newSupervisedManager 创建连接到模拟服务器并运行连接监督的 Manager（不启动状态和健康检查循环）
+func newSupervisedManager(t *testing.T, subscribers ...StatusSubscriber) (*amitest.Server, *Manager) {
+	t.Helper()
+	srv := newTestServer(t)
+	m := &Manager{subscribers: subscribers}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := m.connect(ctx, 1)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	m.cancel = cancel
+	m.setClient(client)
+	go m.supervise(ctx)
+	t.Cleanup(func() { m.Close() })
+	return srv, m
+}
+
+// waitFor 轮询等待条件满足
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	setReconnectDelay(t, 100*time.Millisecond, time.Second)
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000, 1000}
+	for i, base := range want {
+		base *= time.Millisecond
+		for n := 0; n < 20; n++ {
+			delay := backoffDelay(i + 1)
+			if delay < base*8/10 || delay > base*12/10 {
+				t.Fatalf("attempt %d: delay %v outside %v ±20%%", i+1, delay, base)
+			}
+		}
+	}
+}
+
+func TestManagerReconnectsAfterDisconnect(t *testing.T) {
+	setReconnectDelay(t, 10*time.Millisecond, 50*time.Millisecond)
+	rec := &connRecorder{}
+	srv, m := newSupervisedManager(t, rec)
+	old := m.GetClient()
+
+	m.mu.Lock()
+	m.dongleStates["quectel0"] = "Free"
+	m.mu.Unlock()
+
+	// Asterisk 重启：连接断开
+	srv.DropConnections()
+	waitFor(t, "reconnect", func() bool {
+		stats := m.ConnectionStats()
+		return stats.State == ConnStateConnected && stats.Connects == 2
+	})
+
+	if m.GetClient() == old {
+		t.Fatal("client was not replaced")
+	}
+	if srv.Logins() != 2 {
+		t.Fatalf("logins = %d, want 2", srv.Logins())
+	}
+	m.mu.RLock()
+	states := len(m.dongleStates)
+	m.mu.RUnlock()
+	if states != 0 {
+		t.Fatal("dongle states not reset after reconnect")
+	}
+
+	// 新连接重新订阅了事件
+	events := 0
+	for _, action := range srv.Actions() {
+		if action.Get("Action") == "Events" {
+			events++
+		}
+	}
+	if events != 2 {
+		t.Fatalf("Events sent %d times, want 2", events)
+	}
+
+	if got, want := strings.Join(rec.states(), ","), "connecting,connected,disconnected,connecting,connected"; got != want {
+		t.Fatalf("state changes = %s, want %s", got, want)
+	}
+	stats := m.ConnectionStats()
+	if stats.Disconnects != 1 || stats.LastDisconnectedAt == nil || stats.LastError == "" {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// 新连接上的动作和事件正常工作（事件由 supervise 分发）
+	if err := m.SendSMS("quectel0", "10086", "after restart"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Emit(amitest.Event("UserEvent", "UserEvent", "SMSReceived",
+		"Device", "quectel0", "Sender", "10086", "Message", "hi"))
+	waitFor(t, "SMS event", func() bool {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		return len(rec.sms) == 1
+	})
+}
+
+func TestManagerFailsFastWhileDisconnected(t *testing.T) {
+	setReconnectDelay(t, 20*time.Millisecond, 50*time.Millisecond)
+	srv, m := newSupervisedManager(t)
+
+	// 登录失败，重连一直失败
+	srv.SetPassword("changed")
+	srv.DropConnections()
+	waitFor(t, "failed reconnect attempts", func() bool {
+		stats := m.ConnectionStats()
+		return stats.State == ConnStateConnecting && stats.FailedAttempts >= 2
+	})
+
+	start := time.Now()
+	err := m.SendSMS("quectel0", "10086", "hello")
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("err = %v, want ErrNotConnected", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("SendSMS took %v while disconnected", elapsed)
+	}
+	if stats := m.ConnectionStats(); stats.NextRetryAt == nil || stats.LastError == "" {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// Asterisk 恢复后自动重连
+	srv.SetPassword(amitest.DefaultPassword)
+	waitFor(t, "reconnect", func() bool {
+		return m.ConnectionStats().State == ConnStateConnected
+	})
+	if stats := m.ConnectionStats(); stats.Attempt != 0 || stats.NextRetryAt != nil {
+		t.Fatalf("retry state not reset: %+v", stats)
+	}
+	if err := m.SendSMS("quectel0", "10086", "hello"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerHealthCheckForcesReconnect(t *testing.T) {
+	setReconnectDelay(t, 10*time.Millisecond, 50*time.Millisecond)
+	srv, m := newSupervisedManager(t)
+
+	// 连接没有断开但已不可用（如半开连接），健康检查失败后请求重连
+	m.requestReconnect(m.GetClient())
+	waitFor(t, "reconnect", func() bool {
+		return m.ConnectionStats().Connects == 2
+	})
+	if srv.Logins() != 2 {
+		t.Fatalf("logins = %d, want 2", srv.Logins())
+	}
+}
+
+func TestManagerCloseStopsSupervisor(t *testing.T) {
+	setReconnectDelay(t, 10*time.Millisecond, 50*time.Millisecond)
+	srv, m := newSupervisedManager(t)
+
+	m.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if srv.Logins() != 1 {
+		t.Fatalf("logins = %d after Close, want no reconnect", srv.Logins())
+	}
+	if !errors.Is(m.SendSMS("quectel0", "10086", "hello"), ErrNotConnected) {
+		t.Fatal("SendSMS should fail after Close")
+	}
+}
@@ -0,0 +1,149 @@
+package amitest
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// field AMI 消息中的一个字段（同名字段可以出现多次，如 Output、Variable）
+type field struct {
+	Key   string
+	Value string
+}
+
+// Message AMI 消息（动作、响应或事件），保留字段顺序
+type Message struct {
+	fields []field
+}
+
+// NewMessage 按 key, value, key, value... 构造消息
+func NewMessage(kv ...string) Message {
+	if len(kv)%2 != 0 {
+		panic("amitest: NewMessage requires key/value pairs")
+	}
+	var m Message
+	for i := 0; i < len(kv); i += 2 {
+		m.Add(kv[i], kv[i+1])
+	}
+	return m
+}
+
+// Add 追加字段
+func (m *Message) Add(key, value string) {
+	m.fields = append(m.fields, field{Key: key, Value: value})
+}
+
+// Set 设置字段（替换同名字段的第一个值，不存在时追加）
+func (m *Message) Set(key, value string) {
+	for i := range m.fields {
+		if strings.EqualFold(m.fields[i].Key, key) {
+			m.fields[i].Value = value
+			return
+		}
+	}
+	m.Add(key, value)
+}
+
+// Get 获取字段的第一个值（键不区分大小写）
+func (m Message) Get(key string) string {
+	for _, f := range m.fields {
+		if strings.EqualFold(f.Key, key) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values 获取同名字段的所有值
+func (m Message) Values(key string) []string {
+	var values []string
+	for _, f := range m.fields {
+		if strings.EqualFold(f.Key, key) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Has 是否包含字段
+func (m Message) Has(key string) bool {
+	for _, f := range m.fields {
+		if strings.EqualFold(f.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bytes 编码为 AMI 协议格式（每行 "Key: Value\r\n"，以空行结束）
+func (m Message) Bytes() []byte {
+	var b strings.Builder
+	for _, f := range m.fields {
+		fmt.Fprintf(&b, "%s: %s\r\n", f.Key, f.Value)
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// String 便于测试失败时打印
+func (m Message) String() string {
+	parts := make([]string, 0, len(m.fields))
+	for _, f := range m.fields {
+		parts = append(parts, f.Key+": "+f.Value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// readMessage 读取一条 AMI 消息（空行结束），连接断开时返回错误
+func readMessage(r *bufio.Reader) (Message, error) {
+	var m Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return m, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(m.fields) == 0 {
+				continue
+			}
+			return m, nil
+		}
+		key, value, _ := strings.Cut(line, ":")
+		m.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+}
+
+// Success 构造成功响应
+func Success(kv ...string) Message {
+	return NewMessage(append([]string{"Response", "Success"}, kv...)...)
+}
+
+// Error 构造错误响应
+func Error(message string) Message {
+	return NewMessage("Response", "Error", "Message", message)
+}
+
+// Event 构造事件
+func Event(name string, kv ...string) Message {
+	return NewMessage(append([]string{"Event", name}, kv...)...)
+}
+
+// List 构造列表类动作的完整回复：EventList: start 响应、各条目事件和 *Complete 事件
+// items 中没有 Event 字段的条目使用 itemEvent 作为事件名
+func List(itemEvent, completeEvent string, items ...Message) []Message {
+	msgs := []Message{Success("EventList", "start", "Message", "Events will follow")}
+	for _, item := range items {
+		if !item.Has("Event") {
+			ev := Event(itemEvent)
+			ev.fields = append(ev.fields, item.fields...)
+			item = ev
+		}
+		msgs = append(msgs, item)
+	}
+	msgs = append(msgs, Event(completeEvent,
+		"EventList", "Complete",
+		"ListItems", fmt.Sprintf("%d", len(items))))
+	return msgs
+}
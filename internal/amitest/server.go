@@ -0,0 +1,546 @@
+// Package amitest 提供进程内的模拟 Asterisk AMI 服务器，用于集成测试
+//
+// 服务器监听本地 TCP 端口并实现 AMI 协议：登录、Events、Command（输出来自 fixtures）、
+// CoreStatus、列表类动作（CoreShowChannels、PJSIPShowAors 等），并可以向已登录的连接注入事件。
+// 收到的所有动作都会被记录，测试可以等待并断言某个动作或 CLI 命令。
+package amitest
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认登录凭据
+const (
+	DefaultUsername = "admin"
+	DefaultPassword = "amitest"
+)
+
+// banner AMI 连接建立时发送的欢迎行
+const banner = "Asterisk Call Manager/7.0.3\r\n"
+
+//go:embed fixtures/*.txt
+var defaultFixtures embed.FS
+
+// Handler 自定义动作处理，返回依次发送的消息（响应和事件），未设置 ActionID 的消息自动使用动作的 ActionID
+type Handler func(action Message) []Message
+
+// CommandFunc 按前缀匹配的 CLI 命令处理，返回命令输出；返回错误时回复 Response: Error
+type CommandFunc func(command string) (string, error)
+
+// listAction 内置的列表类动作：条目事件名和结束事件名
+type listAction struct {
+	itemEvent     string
+	completeEvent string
+}
+
+var listActions = map[string]listAction{
+	"coreshowchannels":   {"CoreShowChannel", "CoreShowChannelsComplete"},
+	"pjsipshowaors":      {"AorList", "AorListComplete"},
+	"pjsipshowendpoints": {"EndpointList", "EndpointListComplete"},
+}
+
+// Server 模拟的 AMI 服务器
+type Server struct {
+	Username string
+	Password string
+
+	ln        net.Listener
+	startedAt time.Time
+
+	mu           sync.Mutex
+	conns        map[*conn]struct{}
+	handlers     map[string]Handler     // 小写动作名 -> 处理函数
+	commands     map[string]string      // CLI 命令 -> 输出（完全匹配）
+	commandFuncs map[string]CommandFunc // CLI 命令前缀 -> 处理函数
+	lists        map[string][]Message   // 小写动作名 -> 列表条目
+	actions      []Message              // 收到的所有动作
+	logins       int
+	changed      chan struct{} // 每次收到动作或登录时关闭并替换，用于等待
+	closed       bool
+	wg           sync.WaitGroup
+}
+
+// conn 一个客户端连接
+type conn struct {
+	net.Conn
+	writeMu  sync.Mutex
+	loggedIn bool
+}
+
+func (c *conn) send(msgs ...Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	for _, msg := range msgs {
+		if _, err := c.Write(msg.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewServer 在 127.0.0.1 的随机端口启动模拟服务器，并加载默认的 chan_quectel fixtures
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Username:     DefaultUsername,
+		Password:     DefaultPassword,
+		ln:           ln,
+		startedAt:    time.Now().Add(-time.Hour),
+		conns:        make(map[*conn]struct{}),
+		handlers:     make(map[string]Handler),
+		commands:     make(map[string]string),
+		commandFuncs: make(map[string]CommandFunc),
+		lists:        make(map[string][]Message),
+		changed:      make(chan struct{}),
+	}
+	if err := s.LoadFixtures(defaultFixtures, "fixtures/*.txt"); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	s.setDefaultCommands()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// setDefaultCommands 按前缀处理的常用 chan_quectel 命令
+func (s *Server) setDefaultCommands() {
+	s.HandleCommand("quectel sms ", func(command string) (string, error) {
+		return fmt.Sprintf("[%s] SMS queued for send with id 0x1", commandArg(command, 2)), nil
+	})
+	s.HandleCommand("quectel ussd ", func(command string) (string, error) {
+		return fmt.Sprintf("[%s] USSD queued for send with id 0x1", commandArg(command, 2)), nil
+	})
+	s.HandleCommand("quectel cmd ", func(command string) (string, error) {
+		return "OK", nil
+	})
+	s.HandleCommand("quectel restart ", func(command string) (string, error) {
+		return fmt.Sprintf("[%s] restart scheduled", commandArg(command, 3)), nil
+	})
+	s.HandleCommand("quectel reload", func(command string) (string, error) {
+		return "", nil
+	})
+	s.HandleCommand("module reload ", func(command string) (string, error) {
+		return "Module '" + commandArg(command, 2) + "' reloaded successfully.", nil
+	})
+}
+
+// commandArg 取命令的第 n 个参数（从 0 开始）
+func commandArg(command string, n int) string {
+	fields := strings.Fields(command)
+	if n < len(fields) {
+		return fields[n]
+	}
+	return ""
+}
+
+// Addr 监听地址（host:port）
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Host 监听的主机
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port 监听的端口
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	return port
+}
+
+// Setenv 设置 ami.NewClient 读取的 ASTERISK_AMI_* 环境变量，使客户端连接到本服务器
+func (s *Server) Setenv() {
+	os.Setenv("ASTERISK_AMI_HOST", s.Host())
+	os.Setenv("ASTERISK_AMI_PORT", s.Port())
+	os.Setenv("ASTERISK_AMI_USERNAME", s.Username)
+	os.Setenv("ASTERISK_AMI_PASSWORD", s.Password)
+}
+
+// Close 关闭服务器和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.ln.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+// DropConnections 断开所有客户端连接（模拟 Asterisk 重启），服务器继续接受新连接
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// SetPassword 修改登录密码（用于模拟登录失败，之后的登录使用新密码校验）
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Password = password
+}
+
+// Handle 注册自定义动作处理（覆盖内置处理）
+func (s *Server) Handle(action string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[strings.ToLower(action)] = h
+}
+
+// SetCommand 设置 CLI 命令的输出（完全匹配，优先于前缀处理）
+func (s *Server) SetCommand(command, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[command] = output
+}
+
+// HandleCommand 注册按前缀匹配的 CLI 命令处理（多个前缀匹配时使用最长的）
+func (s *Server) HandleCommand(prefix string, fn CommandFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commandFuncs[prefix] = fn
+}
+
+// SetListItems 设置列表类动作（CoreShowChannels、PJSIPShowAors、PJSIPShowEndpoints）返回的条目
+func (s *Server) SetListItems(action string, items ...Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists[strings.ToLower(action)] = items
+}
+
+// LoadFixtures 从 fixtures 文件加载 CLI 命令输出
+// 文件格式：以 "> " 开头的行是命令，之后到下一个命令之前的行是该命令的输出，"#" 开头的行在第一个命令之前时为注释
+func (s *Server) LoadFixtures(fsys fs.FS, pattern string) error {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		for command, output := range parseFixtures(string(data)) {
+			s.SetCommand(command, output)
+		}
+	}
+	return nil
+}
+
+// parseFixtures 解析 fixtures 文件内容
+func parseFixtures(data string) map[string]string {
+	fixtures := make(map[string]string)
+	var command string
+	var output []string
+	flush := func() {
+		if command != "" {
+			fixtures[command] = strings.Join(output, "\n")
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "> ") {
+			flush()
+			command = strings.TrimSpace(line[2:])
+			output = nil
+			continue
+		}
+		if command == "" {
+			continue
+		}
+		output = append(output, line)
+	}
+	flush()
+	for command, output := range fixtures {
+		fixtures[command] = strings.TrimRight(output, "\n")
+	}
+	return fixtures
+}
+
+// Emit 向所有已登录的连接发送事件
+func (s *Server) Emit(event Message) {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		if c.loggedIn {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		if err := c.send(event); err != nil {
+			log.Printf("[amitest] Failed to emit event: %v", err)
+		}
+	}
+}
+
+// Actions 收到的所有动作（按顺序）
+func (s *Server) Actions() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.actions...)
+}
+
+// Commands 收到的所有 CLI 命令（按顺序）
+func (s *Server) Commands() []string {
+	var commands []string
+	for _, action := range s.Actions() {
+		if strings.EqualFold(action.Get("Action"), "Command") {
+			commands = append(commands, action.Get("Command"))
+		}
+	}
+	return commands
+}
+
+// Logins 成功登录的次数
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// WaitForAction 等待收到满足条件的动作（包括之前已收到的），超时返回 false
+func (s *Server) WaitForAction(timeout time.Duration, match func(Message) bool) (Message, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		for _, action := range s.actions {
+			if match(action) {
+				s.mu.Unlock()
+				return action, true
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return Message{}, false
+		}
+	}
+}
+
+// WaitForCommand 等待收到指定的 CLI 命令
+func (s *Server) WaitForCommand(command string, timeout time.Duration) bool {
+	_, ok := s.WaitForAction(timeout, func(action Message) bool {
+		return strings.EqualFold(action.Get("Action"), "Command") && action.Get("Command") == command
+	})
+	return ok
+}
+
+// WaitForLogins 等待成功登录次数达到 n
+func (s *Server) WaitForLogins(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		logins := s.logins
+		changed := s.changed
+		s.mu.Unlock()
+		if logins >= n {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+// notifyLocked 唤醒等待者
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// serve 接受连接
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{Conn: nc}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handleConn(c)
+	}
+}
+
+// handleConn 处理一个连接上的动作
+func (s *Server) handleConn(c *conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	c.writeMu.Lock()
+	_, err := c.Write([]byte(banner))
+	c.writeMu.Unlock()
+	if err != nil {
+		return
+	}
+
+	r := bufio.NewReader(c)
+	for {
+		action, err := readMessage(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.actions = append(s.actions, action)
+		s.notifyLocked()
+		s.mu.Unlock()
+
+		replies, closeConn := s.reply(c, action)
+		actionID := action.Get("ActionID")
+		for i := range replies {
+			if actionID != "" && !replies[i].Has("ActionID") {
+				replies[i].Add("ActionID", actionID)
+			}
+		}
+		if err := c.send(replies...); err != nil || closeConn {
+			return
+		}
+	}
+}
+
+// reply 生成动作的回复，closeConn 为 true 时回复后断开连接
+func (s *Server) reply(c *conn, action Message) (replies []Message, closeConn bool) {
+	name := strings.ToLower(action.Get("Action"))
+
+	if name == "login" {
+		s.mu.Lock()
+		username, password := s.Username, s.Password
+		s.mu.Unlock()
+		if action.Get("Username") != username || action.Get("Secret") != password {
+			return []Message{Error("Authentication failed")}, true
+		}
+		s.mu.Lock()
+		c.loggedIn = true
+		s.logins++
+		s.notifyLocked()
+		s.mu.Unlock()
+		return []Message{
+			Success("Message", "Authentication accepted"),
+			Event("FullyBooted", "Privilege", "system,all", "Uptime", "3600", "Status", "Fully Booted"),
+		}, false
+	}
+	if !c.loggedIn {
+		return []Message{Error("Permission denied")}, false
+	}
+
+	s.mu.Lock()
+	handler := s.handlers[name]
+	items, isList := s.lists[name]
+	s.mu.Unlock()
+	if handler != nil {
+		return handler(action), false
+	}
+	if list, ok := listActions[name]; ok {
+		if !isList {
+			items = nil
+		}
+		return List(list.itemEvent, list.completeEvent, items...), false
+	}
+
+	switch name {
+	case "logoff":
+		return []Message{NewMessage("Response", "Goodbye", "Message", "Thanks for all the fish.")}, true
+	case "events":
+		return []Message{Success("Events", "On")}, false
+	case "ping":
+		return []Message{Success("Ping", "Pong", "Timestamp", fmt.Sprintf("%d.000000", time.Now().Unix()))}, false
+	case "corestatus":
+		return []Message{Success(
+			"CoreStartupDate", s.startedAt.Format("2006-01-02"),
+			"CoreStartupTime", s.startedAt.Format("15:04:05"),
+			"CoreReloadDate", s.startedAt.Format("2006-01-02"),
+			"CoreReloadTime", s.startedAt.Format("15:04:05"),
+			"CoreCurrentCalls", "0",
+		)}, false
+	case "command":
+		output, err := s.runCommand(action.Get("Command"))
+		if err != nil {
+			return []Message{Error(err.Error())}, false
+		}
+		resp := Success("Message", "Command output follows")
+		if output != "" {
+			for _, line := range strings.Split(output, "\n") {
+				resp.Add("Output", line)
+			}
+		}
+		return []Message{resp}, false
+	}
+	return []Message{Error("Invalid/unknown command")}, false
+}
+
+// runCommand 执行 CLI 命令：先查完全匹配的 fixture，再查最长前缀的处理函数
+func (s *Server) runCommand(command string) (string, error) {
+	s.mu.Lock()
+	output, ok := s.commands[command]
+	var fn CommandFunc
+	longest := -1
+	for prefix, f := range s.commandFuncs {
+		if strings.HasPrefix(command, prefix) && len(prefix) > longest {
+			fn, longest = f, len(prefix)
+		}
+	}
+	s.mu.Unlock()
+
+	if ok {
+		return output, nil
+	}
+	if fn != nil {
+		return fn(command)
+	}
+	return fmt.Sprintf("No such command '%s' (type 'core show help %s' for other possible commands)", command, command), nil
+}
@@ -3,7 +3,6 @@ package at
 import (
 	"fmt"
 	"log"
-	"regexp"
 	"strings"
 	"time"
 
@@ -88,61 +87,25 @@ func (e *CommandExecutor) DeleteSMS(index int, deleteFlag int) error {
 }
 
 // ListSMS 列出 SIM 卡中的短信
-func (e *CommandExecutor) ListSMS() ([]map[string]string, error) {
-	cmd := "AT+CMGL=4" // 读取所有短信
-	resp, err := e.ExecuteCommand(cmd, 10*time.Second)
+// 使用 PDU 模式（AT+CMGF=0）读取，保留 UCS-2 内容、长短信分段头、短信中心地址和送达报告
+func (e *CommandExecutor) ListSMS() ([]SMSRecord, error) {
+	resp, err := e.ExecuteCommand("AT+CMGF=0", 5*time.Second)
 	if err != nil {
 		return nil, err
 	}
-
 	if !strings.Contains(resp, "OK") {
-		return nil, fmt.Errorf("failed to list SMS: %s", resp)
-	}
-
-	// 解析响应
-	lines := strings.Split(resp, "\n")
-	messages := []map[string]string{}
-
-	re := regexp.MustCompile(`\+CMGL:\s*(\d+),"([^"]+)","([^"]+)",.*?,"(.+)"`)
-	for i, line := range lines {
-		if matches := re.FindStringSubmatch(line); len(matches) > 0 {
-			msg := map[string]string{
-				"index":     matches[1],
-				"status":    matches[2],
-				"number":    matches[3],
-				"timestamp": matches[4],
-			}
-			// 下一行是短信内容
-			if i+1 < len(lines) {
-				msg["content"] = strings.TrimSpace(lines[i+1])
-			}
-			messages = append(messages, msg)
-		}
+		return nil, fmt.Errorf("failed to set PDU mode: %s", resp)
 	}
 
-	return messages, nil
-}
-
-// GetDevicePort 获取 dongle 对应的数据端口
-// dongleID: 例如 "quectel0"
-// 返回: "/dev/ttyUSB2" 或错误
-func GetDevicePort(dongleID string) (string, error) {
-	// 根据 dongleID 查找对应的数据端口
-	// quectel0 -> /dev/ttyUSB2 (数据端口)
-	// quectel1 -> /dev/ttyUSB5 (假设第二个设备)
-
-	// 简化实现: 使用硬编码的映射关系
-	// 实际应用中应该从配置或数据库中查询
-	portMap := map[string]string{
-		"quectel0": "/dev/ttyUSB2",
-		"quectel1": "/dev/ttyUSB5",
-		"quectel2": "/dev/ttyUSB8",
+	cmd := "AT+CMGL=4" // 读取所有短信
+	resp, err = e.ExecuteCommand(cmd, 10*time.Second)
+	if err != nil {
+		return nil, err
 	}
 
-	port, ok := portMap[dongleID]
-	if !ok {
-		return "", fmt.Errorf("unknown dongle ID: %s", dongleID)
+	if !strings.Contains(resp, "OK") {
+		return nil, fmt.Errorf("failed to list SMS: %s", resp)
 	}
 
-	return port, nil
+	return ParseCMGL(resp), nil
 }
@@ -0,0 +1,143 @@
+package at
+
+import "strings"
+
+// gsm7Escape GSM 7-bit 默认字母表中的转义字符，后跟扩展表中的字符
+const gsm7Escape = 0x1B
+
+// gsm7Default GSM 7-bit 默认字母表（3GPP TS 23.038 6.2.1）
+// 0x1B 为扩展表转义字符，这里用空格占位（实际由 gsm7Escape 处理）
+var gsm7Default = [128]rune{
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì', 'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
+	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ', 'Σ', 'Θ', 'Ξ', ' ', 'Æ', 'æ', 'ß', 'É',
+	' ', '!', '"', '#', '¤', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
+}
+
+// gsm7Extension GSM 7-bit 默认扩展表（3GPP TS 23.038 6.2.1.1）
+var gsm7Extension = map[byte]rune{
+	0x0A: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2F: '\\',
+	0x3C: '[',
+	0x3D: '~',
+	0x3E: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+// 反向查找表（字符 -> septet）
+var (
+	gsm7DefaultReverse   = make(map[rune]byte, len(gsm7Default))
+	gsm7ExtensionReverse = make(map[rune]byte, len(gsm7Extension))
+)
+
+func init() {
+	for i, r := range gsm7Default {
+		if i == gsm7Escape {
+			continue
+		}
+		gsm7DefaultReverse[r] = byte(i)
+	}
+	for code, r := range gsm7Extension {
+		gsm7ExtensionReverse[r] = code
+	}
+}
+
+// IsGSM7 检查文本是否可以完全用 GSM 7-bit 字母表（含扩展表）表示
+func IsGSM7(text string) bool {
+	for _, r := range text {
+		if _, ok := gsm7DefaultReverse[r]; ok {
+			continue
+		}
+		if _, ok := gsm7ExtensionReverse[r]; ok {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// encodeGSM7 将文本转换为 septet 序列（未打包），扩展表字符编码为转义 + 字符两个 septet
+func encodeGSM7(text string) ([]byte, bool) {
+	septets := make([]byte, 0, len(text))
+	for _, r := range text {
+		if s, ok := gsm7DefaultReverse[r]; ok {
+			septets = append(septets, s)
+			continue
+		}
+		if s, ok := gsm7ExtensionReverse[r]; ok {
+			septets = append(septets, gsm7Escape, s)
+			continue
+		}
+		return nil, false
+	}
+	return septets, true
+}
+
+// decodeGSM7 将 septet 序列（未打包）转换为文本
+// 扩展表中未定义的转义序列按规范显示默认字母表中的对应字符
+func decodeGSM7(septets []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(septets); i++ {
+		s := septets[i] & 0x7F
+		if s != gsm7Escape {
+			sb.WriteRune(gsm7Default[s])
+			continue
+		}
+		if i+1 >= len(septets) {
+			// 结尾孤立的转义字符按空格处理
+			sb.WriteRune(' ')
+			break
+		}
+		i++
+		next := septets[i] & 0x7F
+		if r, ok := gsm7Extension[next]; ok {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune(gsm7Default[next])
+		}
+	}
+	return sb.String()
+}
+
+// packSeptets 将 septet 打包为字节流
+// fillBits 为打包前的填充位数（UDH 之后用于对齐 septet 边界）
+func packSeptets(septets []byte, fillBits int) []byte {
+	totalBits := fillBits + len(septets)*7
+	out := make([]byte, (totalBits+7)/8)
+	bit := fillBits
+	for _, s := range septets {
+		v := uint16(s&0x7F) << (bit % 8)
+		out[bit/8] |= byte(v)
+		if bit/8+1 < len(out) {
+			out[bit/8+1] |= byte(v >> 8)
+		}
+		bit += 7
+	}
+	return out
+}
+
+// unpackSeptets 从字节流中解包 count 个 septet（从第 0 位开始）
+func unpackSeptets(data []byte, count int) []byte {
+	septets := make([]byte, 0, count)
+	for i := 0; i < count; i++ {
+		bit := i * 7
+		idx := bit / 8
+		if idx >= len(data) {
+			break
+		}
+		v := uint16(data[idx])
+		if idx+1 < len(data) {
+			v |= uint16(data[idx+1]) << 8
+		}
+		septets = append(septets, byte(v>>(bit%8))&0x7F)
+	}
+	return septets
+}
@@ -0,0 +1,1050 @@
+package at
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrInvalidPDU PDU 格式错误
+var ErrInvalidPDU = errors.New("invalid PDU")
+
+// maxUserDataOctets 单条短信 TP-UD 的最大字节数
+const maxUserDataOctets = 140
+
+// MessageType TP-MTI 消息类型（3GPP TS 23.040 9.2.3.1）
+type MessageType int
+
+const (
+	MessageDeliver      MessageType = iota // SMS-DELIVER（短信中心 -> 终端，收到的短信）
+	MessageSubmit                          // SMS-SUBMIT（终端 -> 短信中心，发送的短信）
+	MessageStatusReport                    // SMS-STATUS-REPORT（短信中心 -> 终端，送达报告）
+)
+
+// String 返回消息类型名称
+func (t MessageType) String() string {
+	switch t {
+	case MessageDeliver:
+		return "SMS-DELIVER"
+	case MessageSubmit:
+		return "SMS-SUBMIT"
+	case MessageStatusReport:
+		return "SMS-STATUS-REPORT"
+	default:
+		return fmt.Sprintf("MessageType(%d)", int(t))
+	}
+}
+
+// Encoding 用户数据编码（由 TP-DCS 决定）
+type Encoding int
+
+const (
+	EncodingGSM7 Encoding = iota // GSM 7-bit 默认字母表
+	Encoding8Bit                 // 8-bit 二进制数据
+	EncodingUCS2                 // UCS-2（UTF-16BE，支持代理对）
+)
+
+// MessageClass 短信类别（TP-DCS 中的 message class）
+type MessageClass int
+
+const (
+	ClassNone MessageClass = iota // 未指定类别
+	Class0                        // 闪信（直接显示，不存储）
+	Class1                        // 存储到终端
+	Class2                        // 存储到 SIM 卡
+	Class3                        // 存储到 TE
+)
+
+// 号码类型（Type of Number）
+const (
+	TONUnknown       byte = 0
+	TONInternational byte = 1
+	TONNational      byte = 2
+	TONAlphanumeric  byte = 5
+)
+
+// NPIISDN 号码计划：ISDN/电话号码（E.164）
+const NPIISDN byte = 1
+
+// Address 短信地址（TP-OA/TP-DA/TP-RA 或短信中心地址）
+type Address struct {
+	Number string // 号码；国际号码带 "+" 前缀，字母数字地址为解码后的文本
+	TON    byte   // 号码类型
+	NPI    byte   // 号码计划
+}
+
+// InformationElement UDH 信息元素
+type InformationElement struct {
+	ID   byte   // IEI
+	Data []byte // IED
+}
+
+// ConcatInfo 长短信分段信息（UDH IEI 0x00 / 0x08）
+type ConcatInfo struct {
+	Ref   int // 分段参考号，同一条长短信的所有分段相同
+	Total int // 总段数
+	Seq   int // 当前段序号（从 1 开始）
+}
+
+// PDU 解码后的短信 TPDU（3GPP TS 23.040）
+type PDU struct {
+	SMSC Address     // 短信中心地址（为空表示使用 SIM 卡默认短信中心）
+	Type MessageType // 消息类型
+
+	MoreMessages     bool // 短信中心还有更多消息待发送（TP-MMS 取反，DELIVER/STATUS-REPORT）
+	ReplyPath        bool // TP-RP（DELIVER/SUBMIT）
+	StatusReport     bool // DELIVER: TP-SRI；SUBMIT: TP-SRR；STATUS-REPORT: TP-SRQ
+	RejectDuplicates bool // TP-RD（SUBMIT）
+
+	MessageRef int     // TP-MR（SUBMIT/STATUS-REPORT）
+	Address    Address // DELIVER: 发送方；SUBMIT: 接收方；STATUS-REPORT: 接收方
+	PID        byte    // TP-PID
+	DCS        byte    // TP-DCS
+	Encoding   Encoding
+	Class      MessageClass
+
+	Timestamp      time.Time     // TP-SCTS 短信中心时间戳（DELIVER/STATUS-REPORT）
+	ValidityPeriod time.Duration // 相对有效期（SUBMIT，0 表示不指定）
+	ValidityTime   time.Time     // 绝对有效期（SUBMIT，优先于 ValidityPeriod）
+	DischargeTime  time.Time     // TP-DT 送达/失败时间（STATUS-REPORT）
+	Status         byte          // TP-ST 送达状态（STATUS-REPORT，0x00 表示成功送达）
+
+	UDH  []InformationElement // 用户数据头
+	Text string               // 文本内容（GSM 7-bit / UCS-2）
+	Data []byte               // 二进制内容（8-bit，不含 UDH）
+}
+
+// Concat 返回 UDH 中的长短信分段信息，没有分段信息时返回 nil
+func (p *PDU) Concat() *ConcatInfo {
+	for _, ie := range p.UDH {
+		switch {
+		case ie.ID == 0x00 && len(ie.Data) == 3:
+			return &ConcatInfo{Ref: int(ie.Data[0]), Total: int(ie.Data[1]), Seq: int(ie.Data[2])}
+		case ie.ID == 0x08 && len(ie.Data) == 4:
+			return &ConcatInfo{Ref: int(ie.Data[0])<<8 | int(ie.Data[1]), Total: int(ie.Data[2]), Seq: int(ie.Data[3])}
+		}
+	}
+	return nil
+}
+
+// SetConcat 设置长短信分段信息（替换已有的分段信息元素）
+// 参考号不超过 255 时使用 8-bit 参考号（IEI 0x00），否则使用 16-bit 参考号（IEI 0x08）
+func (p *PDU) SetConcat(c ConcatInfo) {
+	udh := p.UDH[:0:0]
+	for _, ie := range p.UDH {
+		if ie.ID != 0x00 && ie.ID != 0x08 {
+			udh = append(udh, ie)
+		}
+	}
+	if c.Ref <= 0xFF {
+		udh = append(udh, InformationElement{ID: 0x00, Data: []byte{byte(c.Ref), byte(c.Total), byte(c.Seq)}})
+	} else {
+		udh = append(udh, InformationElement{ID: 0x08, Data: []byte{byte(c.Ref >> 8), byte(c.Ref), byte(c.Total), byte(c.Seq)}})
+	}
+	p.UDH = udh
+}
+
+// DecodePDU 解码 AT 命令中的十六进制 PDU（包含短信中心地址前缀，即 +CMGL/+CMGR/+CMT 返回的格式）
+func DecodePDU(pduHex string) (*PDU, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(pduHex))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad hex: %v", ErrInvalidPDU, err)
+	}
+
+	r := &pduReader{b: b}
+	smsc, err := r.smscAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := DecodeTPDU(b[r.pos:])
+	if err != nil {
+		return nil, err
+	}
+	p.SMSC = smsc
+	return p, nil
+}
+
+// DecodeTPDU 解码不含短信中心地址的 TPDU
+// TP-MTI 为 01 时按 SMS-SUBMIT 解码（SIM 卡中存储的已发送/未发送短信）
+func DecodeTPDU(b []byte) (*PDU, error) {
+	r := &pduReader{b: b}
+	first, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PDU{}
+	switch first & 0x03 {
+	case 0x00:
+		p.Type = MessageDeliver
+		err = p.decodeDeliver(r, first)
+	case 0x01:
+		p.Type = MessageSubmit
+		err = p.decodeSubmit(r, first)
+	case 0x02:
+		p.Type = MessageStatusReport
+		err = p.decodeStatusReport(r, first)
+	default:
+		return nil, fmt.Errorf("%w: reserved TP-MTI", ErrInvalidPDU)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// decodeDeliver 解码 SMS-DELIVER（首字节之后的部分）
+func (p *PDU) decodeDeliver(r *pduReader, first byte) error {
+	p.MoreMessages = first&0x04 == 0
+	p.StatusReport = first&0x20 != 0
+	p.ReplyPath = first&0x80 != 0
+
+	var err error
+	if p.Address, err = r.address(); err != nil {
+		return err
+	}
+	if err := p.decodeProtocol(r); err != nil {
+		return err
+	}
+	if p.Timestamp, err = r.timestamp(); err != nil {
+		return err
+	}
+	return p.decodeUserData(r, first&0x40 != 0)
+}
+
+// decodeSubmit 解码 SMS-SUBMIT（首字节之后的部分）
+func (p *PDU) decodeSubmit(r *pduReader, first byte) error {
+	p.RejectDuplicates = first&0x04 != 0
+	p.StatusReport = first&0x20 != 0
+	p.ReplyPath = first&0x80 != 0
+
+	mr, err := r.byte()
+	if err != nil {
+		return err
+	}
+	p.MessageRef = int(mr)
+
+	if p.Address, err = r.address(); err != nil {
+		return err
+	}
+	if err := p.decodeProtocol(r); err != nil {
+		return err
+	}
+
+	// TP-VPF（bit 3-4）
+	switch (first >> 3) & 0x03 {
+	case 0x02: // 相对格式
+		v, err := r.byte()
+		if err != nil {
+			return err
+		}
+		p.ValidityPeriod = decodeRelativeValidity(v)
+	case 0x01: // 增强格式
+		vp, err := r.bytes(7)
+		if err != nil {
+			return err
+		}
+		p.ValidityPeriod = decodeEnhancedValidity(vp)
+	case 0x03: // 绝对格式
+		if p.ValidityTime, err = r.timestamp(); err != nil {
+			return err
+		}
+	}
+
+	return p.decodeUserData(r, first&0x40 != 0)
+}
+
+// decodeStatusReport 解码 SMS-STATUS-REPORT（首字节之后的部分）
+func (p *PDU) decodeStatusReport(r *pduReader, first byte) error {
+	p.MoreMessages = first&0x04 == 0
+	p.StatusReport = first&0x20 != 0
+
+	mr, err := r.byte()
+	if err != nil {
+		return err
+	}
+	p.MessageRef = int(mr)
+
+	if p.Address, err = r.address(); err != nil {
+		return err
+	}
+	if p.Timestamp, err = r.timestamp(); err != nil {
+		return err
+	}
+	if p.DischargeTime, err = r.timestamp(); err != nil {
+		return err
+	}
+	if p.Status, err = r.byte(); err != nil {
+		return err
+	}
+
+	// 可选部分：TP-PI 指示后面是否有 TP-PID / TP-DCS / TP-UDL
+	if r.remaining() == 0 {
+		return nil
+	}
+	pi, _ := r.byte()
+	if pi == 0xFF {
+		// 部分模块用 0xFF 填充
+		return nil
+	}
+	if pi&0x01 != 0 {
+		if p.PID, err = r.byte(); err != nil {
+			return err
+		}
+	}
+	if pi&0x02 != 0 {
+		if p.DCS, err = r.byte(); err != nil {
+			return err
+		}
+		p.Encoding, p.Class = decodeDCS(p.DCS)
+	}
+	if pi&0x04 != 0 {
+		return p.decodeUserData(r, first&0x40 != 0)
+	}
+	return nil
+}
+
+// decodeProtocol 读取 TP-PID 和 TP-DCS
+func (p *PDU) decodeProtocol(r *pduReader) error {
+	var err error
+	if p.PID, err = r.byte(); err != nil {
+		return err
+	}
+	if p.DCS, err = r.byte(); err != nil {
+		return err
+	}
+	p.Encoding, p.Class = decodeDCS(p.DCS)
+	return nil
+}
+
+// decodeUserData 读取 TP-UDL 和 TP-UD，并解析 UDH
+func (p *PDU) decodeUserData(r *pduReader, udhi bool) error {
+	udl, err := r.byte()
+	if err != nil {
+		return err
+	}
+
+	// GSM 7-bit 的 TP-UDL 为 septet 数，其余编码为字节数
+	udLen := int(udl)
+	if p.Encoding == EncodingGSM7 {
+		udLen = (int(udl)*7 + 7) / 8
+	}
+	ud, err := r.bytes(udLen)
+	if err != nil {
+		return err
+	}
+
+	hdrLen := 0
+	if udhi {
+		if len(ud) == 0 {
+			return fmt.Errorf("%w: missing UDH", ErrInvalidPDU)
+		}
+		udhl := int(ud[0])
+		if 1+udhl > len(ud) {
+			return fmt.Errorf("%w: UDH length %d exceeds user data", ErrInvalidPDU, udhl)
+		}
+		if p.UDH, err = parseUDH(ud[1 : 1+udhl]); err != nil {
+			return err
+		}
+		hdrLen = 1 + udhl
+	}
+
+	switch p.Encoding {
+	case EncodingGSM7:
+		// UDH 之后填充到 septet 边界，跳过 UDH 占用的 septet
+		septets := unpackSeptets(ud, int(udl))
+		skip := (hdrLen*8 + 6) / 7
+		if skip > len(septets) {
+			skip = len(septets)
+		}
+		p.Text = decodeGSM7(septets[skip:])
+	case EncodingUCS2:
+		p.Text = decodeUCS2(ud[hdrLen:])
+	default:
+		p.Data = append([]byte(nil), ud[hdrLen:]...)
+	}
+	return nil
+}
+
+// parseUDH 解析用户数据头（不含 UDHL 长度字节）
+func parseUDH(b []byte) ([]InformationElement, error) {
+	var ies []InformationElement
+	for i := 0; i < len(b); {
+		if i+2 > len(b) {
+			return nil, fmt.Errorf("%w: truncated UDH", ErrInvalidPDU)
+		}
+		id, l := b[i], int(b[i+1])
+		if i+2+l > len(b) {
+			return nil, fmt.Errorf("%w: UDH element 0x%02X exceeds header", ErrInvalidPDU, id)
+		}
+		ies = append(ies, InformationElement{ID: id, Data: append([]byte(nil), b[i+2:i+2+l]...)})
+		i += 2 + l
+	}
+	return ies, nil
+}
+
+// Encode 编码为 AT+CMGS/AT+CMGW 使用的十六进制 PDU（包含短信中心地址前缀）
+// 返回 PDU 和 TPDU 长度（不含短信中心地址，即 AT+CMGS=<length> 的参数）
+func (p *PDU) Encode() (string, int, error) {
+	tpdu, err := p.MarshalTPDU()
+	if err != nil {
+		return "", 0, err
+	}
+	smsc, err := encodeSMSCAddress(p.SMSC)
+	if err != nil {
+		return "", 0, err
+	}
+	return strings.ToUpper(hex.EncodeToString(append(smsc, tpdu...))), len(tpdu), nil
+}
+
+// MarshalTPDU 编码为不含短信中心地址的 TPDU
+func (p *PDU) MarshalTPDU() ([]byte, error) {
+	ud, udl, udhi, dcs, err := p.encodeUserData()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := encodeAddress(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var first byte
+	if udhi {
+		first |= 0x40
+	}
+
+	var b []byte
+	switch p.Type {
+	case MessageDeliver:
+		if !p.MoreMessages {
+			first |= 0x04
+		}
+		if p.StatusReport {
+			first |= 0x20
+		}
+		if p.ReplyPath {
+			first |= 0x80
+		}
+		b = append(b, first)
+		b = append(b, addr...)
+		b = append(b, p.PID, dcs)
+		b = append(b, encodeTimestamp(p.Timestamp)...)
+		b = append(b, udl)
+		b = append(b, ud...)
+
+	case MessageSubmit:
+		first |= 0x01
+		if p.RejectDuplicates {
+			first |= 0x04
+		}
+		var vp []byte
+		switch {
+		case !p.ValidityTime.IsZero():
+			first |= 0x18
+			vp = encodeTimestamp(p.ValidityTime)
+		case p.ValidityPeriod > 0:
+			first |= 0x10
+			vp = []byte{encodeRelativeValidity(p.ValidityPeriod)}
+		}
+		if p.StatusReport {
+			first |= 0x20
+		}
+		if p.ReplyPath {
+			first |= 0x80
+		}
+		b = append(b, first, byte(p.MessageRef))
+		b = append(b, addr...)
+		b = append(b, p.PID, dcs)
+		b = append(b, vp...)
+		b = append(b, udl)
+		b = append(b, ud...)
+
+	case MessageStatusReport:
+		first |= 0x02
+		if !p.MoreMessages {
+			first |= 0x04
+		}
+		if p.StatusReport {
+			first |= 0x20
+		}
+		b = append(b, first, byte(p.MessageRef))
+		b = append(b, addr...)
+		b = append(b, encodeTimestamp(p.Timestamp)...)
+		b = append(b, encodeTimestamp(p.DischargeTime)...)
+		b = append(b, p.Status)
+		// 只有携带用户数据时才输出可选部分
+		if len(ud) > 0 {
+			b = append(b, 0x07, p.PID, dcs, udl)
+			b = append(b, ud...)
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported message type %v", ErrInvalidPDU, p.Type)
+	}
+	return b, nil
+}
+
+// encodeUserData 编码 TP-UD，返回用户数据、TP-UDL、是否包含 UDH 以及实际使用的 TP-DCS
+func (p *PDU) encodeUserData() (ud []byte, udl byte, udhi bool, dcs byte, err error) {
+	// TP-DCS 与编码一致时保留原值（例如 MWI 分组），否则按编码和类别重新生成
+	dcs = p.DCS
+	if enc, _ := decodeDCS(dcs); enc != p.Encoding {
+		dcs = encodeDCS(p.Encoding, p.Class)
+	}
+
+	var hdr []byte
+	if len(p.UDH) > 0 {
+		hdr = append(hdr, 0)
+		for _, ie := range p.UDH {
+			hdr = append(hdr, ie.ID, byte(len(ie.Data)))
+			hdr = append(hdr, ie.Data...)
+		}
+		hdr[0] = byte(len(hdr) - 1)
+	}
+
+	switch p.Encoding {
+	case EncodingGSM7:
+		septets, ok := encodeGSM7(p.Text)
+		if !ok {
+			return nil, 0, false, 0, fmt.Errorf("%w: text contains characters outside the GSM 7-bit alphabet", ErrInvalidPDU)
+		}
+		fill, hdrSeptets := udhSeptets(len(hdr))
+		total := hdrSeptets + len(septets)
+		if total > maxUserDataOctets*8/7 {
+			return nil, 0, false, 0, fmt.Errorf("%w: user data too long (%d septets)", ErrInvalidPDU, total)
+		}
+		ud = append(hdr, packSeptets(septets, fill)...)
+		udl = byte(total)
+	case EncodingUCS2:
+		ud = append(hdr, encodeUCS2(p.Text)...)
+		udl = byte(len(ud))
+	default:
+		ud = append(hdr, p.Data...)
+		udl = byte(len(ud))
+	}
+
+	if len(ud) > maxUserDataOctets {
+		return nil, 0, false, 0, fmt.Errorf("%w: user data too long (%d octets)", ErrInvalidPDU, len(ud))
+	}
+	return ud, udl, len(hdr) > 0, dcs, nil
+}
+
+// udhSeptets 计算 GSM 7-bit 编码下 UDH（含 UDHL）之后的填充位数和 UDH 占用的 septet 数
+func udhSeptets(hdrLen int) (fillBits, septets int) {
+	if hdrLen == 0 {
+		return 0, 0
+	}
+	fillBits = (7 - hdrLen*8%7) % 7
+	return fillBits, (hdrLen*8 + fillBits) / 7
+}
+
+// SubmitOptions 发送短信的编码选项
+type SubmitOptions struct {
+	SMSC           string        // 短信中心号码（为空使用 SIM 卡默认短信中心）
+	Number         string        // 接收方号码
+	Text           string        // 文本内容
+	Data           []byte        // 二进制内容（非空时按 8-bit 编码发送，忽略 Text）
+	ForceUCS2      bool          // 强制使用 UCS-2 编码
+	Class          MessageClass  // 短信类别
+	ValidityPeriod time.Duration // 相对有效期（0 表示不指定）
+	StatusReport   bool          // 是否请求送达报告
+	MessageRef     int           // 消息参考号（多段时依次递增）
+	ConcatRef      int           // 长短信参考号（0 表示自动分配，大于 255 时使用 16-bit 参考号）
+}
+
+// EncodedPDU 编码后的 SMS-SUBMIT
+type EncodedPDU struct {
+	Hex    string // 十六进制 PDU（包含短信中心地址前缀）
+	Length int    // TPDU 长度，即 AT+CMGS=<length> 的参数
+}
+
+// concatRefCounter 自动分配长短信参考号
+var concatRefCounter uint32
+
+// nextConcatRef 返回下一个 8-bit 长短信参考号（1-255 循环）
+func nextConcatRef() int {
+	return int(atomic.AddUint32(&concatRefCounter, 1)%255) + 1
+}
+
+// EncodeSubmit 将短信编码为一个或多个 SMS-SUBMIT PDU
+// 文本包含 GSM 7-bit 字母表以外的字符时自动使用 UCS-2 编码；超出单条长度时按 UDH 分段
+func EncodeSubmit(opts SubmitOptions) ([]EncodedPDU, error) {
+	base := PDU{
+		SMSC:           Address{Number: opts.SMSC},
+		Type:           MessageSubmit,
+		Address:        Address{Number: opts.Number},
+		Class:          opts.Class,
+		ValidityPeriod: opts.ValidityPeriod,
+		StatusReport:   opts.StatusReport,
+	}
+	switch {
+	case opts.Data != nil:
+		base.Encoding = Encoding8Bit
+	case opts.ForceUCS2 || !IsGSM7(opts.Text):
+		base.Encoding = EncodingUCS2
+	default:
+		base.Encoding = EncodingGSM7
+	}
+	base.DCS = encodeDCS(base.Encoding, base.Class)
+
+	concatRef := opts.ConcatRef
+	if concatRef == 0 {
+		concatRef = nextConcatRef()
+	}
+	hdrLen := 6 // UDHL + IEI 0x00（8-bit 参考号）
+	if concatRef > 0xFF {
+		hdrLen = 7 // UDHL + IEI 0x08（16-bit 参考号）
+	}
+
+	var parts []PDU
+	switch base.Encoding {
+	case EncodingGSM7:
+		septets, _ := encodeGSM7(opts.Text)
+		for _, chunk := range splitGSM7(septets, hdrLen) {
+			part := base
+			part.Text = decodeGSM7(chunk)
+			parts = append(parts, part)
+		}
+	case EncodingUCS2:
+		for _, chunk := range splitUCS2(utf16.Encode([]rune(opts.Text)), hdrLen) {
+			part := base
+			part.Text = string(utf16.Decode(chunk))
+			parts = append(parts, part)
+		}
+	default:
+		for _, chunk := range splitOctets(opts.Data, hdrLen) {
+			part := base
+			part.Data = chunk
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) > 255 {
+		return nil, fmt.Errorf("%w: message too long (%d parts)", ErrInvalidPDU, len(parts))
+	}
+
+	encoded := make([]EncodedPDU, 0, len(parts))
+	for i := range parts {
+		parts[i].MessageRef = (opts.MessageRef + i) & 0xFF
+		if len(parts) > 1 {
+			parts[i].SetConcat(ConcatInfo{Ref: concatRef, Total: len(parts), Seq: i + 1})
+		}
+		pduHex, length, err := parts[i].Encode()
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, EncodedPDU{Hex: pduHex, Length: length})
+	}
+	return encoded, nil
+}
+
+// splitGSM7 按单条/分段容量切分 septet 序列，不拆开扩展表转义序列
+func splitGSM7(septets []byte, hdrLen int) [][]byte {
+	single := maxUserDataOctets * 8 / 7
+	if len(septets) <= single {
+		return [][]byte{septets}
+	}
+	_, hdrSeptets := udhSeptets(hdrLen)
+	size := single - hdrSeptets
+	var chunks [][]byte
+	for len(septets) > 0 {
+		n := size
+		if n >= len(septets) {
+			n = len(septets)
+		} else if septets[n-1] == gsm7Escape {
+			n--
+		}
+		chunks = append(chunks, septets[:n])
+		septets = septets[n:]
+	}
+	return chunks
+}
+
+// splitUCS2 按单条/分段容量切分 UTF-16 码元序列，不拆开代理对
+func splitUCS2(units []uint16, hdrLen int) [][]uint16 {
+	if len(units)*2 <= maxUserDataOctets {
+		return [][]uint16{units}
+	}
+	size := (maxUserDataOctets - hdrLen) / 2
+	var chunks [][]uint16
+	for len(units) > 0 {
+		n := size
+		if n >= len(units) {
+			n = len(units)
+		} else if utf16.IsSurrogate(rune(units[n-1])) && units[n-1] < 0xDC00 {
+			n--
+		}
+		chunks = append(chunks, units[:n])
+		units = units[n:]
+	}
+	return chunks
+}
+
+// splitOctets 按单条/分段容量切分二进制数据
+func splitOctets(data []byte, hdrLen int) [][]byte {
+	if len(data) <= maxUserDataOctets {
+		return [][]byte{data}
+	}
+	size := maxUserDataOctets - hdrLen
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// decodeDCS 解析 TP-DCS（3GPP TS 23.038 4）
+func decodeDCS(dcs byte) (Encoding, MessageClass) {
+	class := ClassNone
+	switch dcs >> 4 {
+	case 0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7:
+		// 通用数据编码（0x4-0x7 为自动删除分组）
+		if dcs&0x10 != 0 {
+			class = MessageClass(dcs&0x03) + Class0
+		}
+		if dcs&0x20 != 0 {
+			// 压缩数据无法解码为文本，按二进制数据处理
+			return Encoding8Bit, class
+		}
+		switch (dcs >> 2) & 0x03 {
+		case 0x01:
+			return Encoding8Bit, class
+		case 0x02:
+			return EncodingUCS2, class
+		default:
+			return EncodingGSM7, class
+		}
+	case 0xE:
+		// 消息等待指示（UCS-2）
+		return EncodingUCS2, class
+	case 0xF:
+		class = MessageClass(dcs&0x03) + Class0
+		if dcs&0x04 != 0 {
+			return Encoding8Bit, class
+		}
+		return EncodingGSM7, class
+	default:
+		// 消息等待指示（GSM 7-bit）及保留分组
+		return EncodingGSM7, class
+	}
+}
+
+// encodeDCS 按编码和类别生成通用数据编码分组的 TP-DCS
+func encodeDCS(enc Encoding, class MessageClass) byte {
+	var dcs byte
+	switch enc {
+	case Encoding8Bit:
+		dcs = 0x04
+	case EncodingUCS2:
+		dcs = 0x08
+	}
+	if class != ClassNone {
+		dcs |= 0x10 | byte(class-Class0)&0x03
+	}
+	return dcs
+}
+
+// decodeUCS2 解码 UTF-16BE（支持代理对），奇数长度时忽略最后一个字节
+func decodeUCS2(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// encodeUCS2 编码为 UTF-16BE
+func encodeUCS2(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
+
+// decodeRelativeValidity 解析相对有效期（3GPP TS 23.040 9.2.3.12.1）
+func decodeRelativeValidity(v byte) time.Duration {
+	switch {
+	case v <= 143:
+		return time.Duration(int(v)+1) * 5 * time.Minute
+	case v <= 167:
+		return 12*time.Hour + time.Duration(int(v)-143)*30*time.Minute
+	case v <= 196:
+		return time.Duration(int(v)-166) * 24 * time.Hour
+	default:
+		return time.Duration(int(v)-192) * 7 * 24 * time.Hour
+	}
+}
+
+// encodeRelativeValidity 将有效期转换为相对格式（向上取整到可表示的值）
+func encodeRelativeValidity(d time.Duration) byte {
+	ceilDiv := func(a, b time.Duration) int {
+		return int((a + b - 1) / b)
+	}
+	switch {
+	case d <= 12*time.Hour:
+		v := ceilDiv(d, 5*time.Minute) - 1
+		if v < 0 {
+			v = 0
+		}
+		return byte(v)
+	case d <= 24*time.Hour:
+		return byte(143 + ceilDiv(d-12*time.Hour, 30*time.Minute))
+	case d <= 30*24*time.Hour:
+		return byte(166 + ceilDiv(d, 24*time.Hour))
+	default:
+		v := 192 + ceilDiv(d, 7*24*time.Hour)
+		if v > 255 {
+			v = 255
+		}
+		return byte(v)
+	}
+}
+
+// decodeEnhancedValidity 解析增强格式有效期（3GPP TS 23.040 9.2.3.12.3）
+// 不支持的格式返回 0
+func decodeEnhancedValidity(vp []byte) time.Duration {
+	switch vp[0] & 0x07 {
+	case 0x01:
+		return decodeRelativeValidity(vp[1])
+	case 0x02:
+		return time.Duration(vp[1]) * time.Second
+	case 0x03:
+		return time.Duration(semiOctetInt(vp[1]))*time.Hour +
+			time.Duration(semiOctetInt(vp[2]))*time.Minute +
+			time.Duration(semiOctetInt(vp[3]))*time.Second
+	default:
+		return 0
+	}
+}
+
+// semiOctetInt 解析一个交换半字节的十进制字节（如 0x21 表示 12）
+func semiOctetInt(b byte) int {
+	return int(b&0x0F)*10 + int(b>>4)
+}
+
+// decodeTimestamp 解析 7 字节的 TP-SCTS/TP-DT（3GPP TS 23.040 9.2.3.11）
+func decodeTimestamp(b []byte) time.Time {
+	year := semiOctetInt(b[0])
+	if year >= 90 {
+		year += 1900
+	} else {
+		year += 2000
+	}
+
+	// 时区以 15 分钟为单位，bit 3 为符号位
+	tz := int(b[6]&0x07)*10 + int(b[6]>>4)
+	if b[6]&0x08 != 0 {
+		tz = -tz
+	}
+	loc := time.FixedZone("", tz*15*60)
+
+	return time.Date(year, time.Month(semiOctetInt(b[1])), semiOctetInt(b[2]),
+		semiOctetInt(b[3]), semiOctetInt(b[4]), semiOctetInt(b[5]), 0, loc)
+}
+
+// encodeTimestamp 编码 7 字节的 TP-SCTS/TP-DT
+func encodeTimestamp(t time.Time) []byte {
+	enc := func(v int) byte {
+		return byte(v%10)<<4 | byte(v/10%10)
+	}
+	_, offset := t.Zone()
+	quarters := offset / (15 * 60)
+	neg := quarters < 0
+	if neg {
+		quarters = -quarters
+	}
+	tz := enc(quarters)
+	if neg {
+		tz |= 0x08
+	}
+	return []byte{
+		enc(t.Year() % 100), enc(int(t.Month())), enc(t.Day()),
+		enc(t.Hour()), enc(t.Minute()), enc(t.Second()), tz,
+	}
+}
+
+// semiOctetDigits 半字节号码字符（0xF 为填充）
+const semiOctetDigits = "0123456789*#abc"
+
+// decodeSemiOctets 解析交换半字节编码的号码，最多 digits 位（digits < 0 表示到填充位为止）
+func decodeSemiOctets(b []byte, digits int) string {
+	var sb strings.Builder
+	for i := 0; i < len(b)*2; i++ {
+		if digits >= 0 && i >= digits {
+			break
+		}
+		nibble := b[i/2] & 0x0F
+		if i%2 == 1 {
+			nibble = b[i/2] >> 4
+		}
+		if nibble == 0x0F {
+			break
+		}
+		sb.WriteByte(semiOctetDigits[nibble])
+	}
+	return sb.String()
+}
+
+// encodeSemiOctets 编码交换半字节号码，奇数位时以 0xF 填充
+func encodeSemiOctets(number string) ([]byte, bool) {
+	b := make([]byte, (len(number)+1)/2)
+	for i := 0; i < len(number); i++ {
+		idx := strings.IndexByte(semiOctetDigits, number[i])
+		if idx < 0 {
+			return nil, false
+		}
+		if i%2 == 0 {
+			b[i/2] = 0xF0 | byte(idx)
+		} else {
+			b[i/2] = b[i/2]&0x0F | byte(idx)<<4
+		}
+	}
+	return b, true
+}
+
+// toa 生成号码类型字节
+func (a Address) toa() byte {
+	return 0x80 | (a.TON&0x07)<<4 | a.NPI&0x0F
+}
+
+// encodeAddress 编码 TP-OA/TP-DA/TP-RA（长度为有效半字节数）
+// 未指定号码类型时，"+" 开头按国际号码处理，包含非数字字符按字母数字地址处理
+func encodeAddress(a Address) ([]byte, error) {
+	number := a.Number
+	if strings.HasPrefix(number, "+") {
+		number = number[1:]
+		a.TON, a.NPI = TONInternational, NPIISDN
+	} else if a.TON == 0 && a.NPI == 0 {
+		a.NPI = NPIISDN
+	}
+
+	if a.TON != TONAlphanumeric && strings.Trim(number, "0123456789*#") == "" {
+		raw, _ := encodeSemiOctets(number)
+		return append([]byte{byte(len(number)), a.toa()}, raw...), nil
+	}
+
+	septets, ok := encodeGSM7(number)
+	if !ok {
+		return nil, fmt.Errorf("%w: address %q cannot be encoded", ErrInvalidPDU, a.Number)
+	}
+	a.TON, a.NPI = TONAlphanumeric, 0
+	raw := packSeptets(septets, 0)
+	return append([]byte{byte((len(septets)*7 + 3) / 4), a.toa()}, raw...), nil
+}
+
+// encodeSMSCAddress 编码短信中心地址（长度为字节数），为空时输出 00
+func encodeSMSCAddress(a Address) ([]byte, error) {
+	if a.Number == "" {
+		return []byte{0x00}, nil
+	}
+	number := a.Number
+	if strings.HasPrefix(number, "+") {
+		number = number[1:]
+		a.TON, a.NPI = TONInternational, NPIISDN
+	} else if a.TON == 0 && a.NPI == 0 {
+		a.NPI = NPIISDN
+	}
+	raw, ok := encodeSemiOctets(number)
+	if !ok {
+		return nil, fmt.Errorf("%w: SMSC address %q cannot be encoded", ErrInvalidPDU, a.Number)
+	}
+	return append([]byte{byte(1 + len(raw)), a.toa()}, raw...), nil
+}
+
+// pduReader 按顺序读取 PDU 字段，越界时返回错误
+type pduReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *pduReader) remaining() int {
+	return len(r.b) - r.pos
+}
+
+func (r *pduReader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, fmt.Errorf("%w: too short", ErrInvalidPDU)
+	}
+	v := r.b[r.pos]
+	r.pos++
+	return v, nil
+}
+
+func (r *pduReader) bytes(n int) ([]byte, error) {
+	if r.pos+n > len(r.b) {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidPDU)
+	}
+	v := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return v, nil
+}
+
+// timestamp 读取 7 字节时间戳
+func (r *pduReader) timestamp() (time.Time, error) {
+	b, err := r.bytes(7)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return decodeTimestamp(b), nil
+}
+
+// address 读取 TP-OA/TP-DA/TP-RA
+func (r *pduReader) address() (Address, error) {
+	digits, err := r.byte()
+	if err != nil {
+		return Address{}, err
+	}
+	toa, err := r.byte()
+	if err != nil {
+		return Address{}, err
+	}
+	raw, err := r.bytes((int(digits) + 1) / 2)
+	if err != nil {
+		return Address{}, err
+	}
+
+	a := Address{TON: (toa >> 4) & 0x07, NPI: toa & 0x0F}
+	if a.TON == TONAlphanumeric {
+		a.Number = decodeGSM7(unpackSeptets(raw, int(digits)*4/7))
+		return a, nil
+	}
+	a.Number = decodeSemiOctets(raw, int(digits))
+	if a.TON == TONInternational && a.Number != "" {
+		a.Number = "+" + a.Number
+	}
+	return a, nil
+}
+
+// smscAddress 读取短信中心地址（长度为字节数，0 表示未包含）
+func (r *pduReader) smscAddress() (Address, error) {
+	l, err := r.byte()
+	if err != nil {
+		return Address{}, err
+	}
+	if l == 0 {
+		return Address{}, nil
+	}
+	b, err := r.bytes(int(l))
+	if err != nil {
+		return Address{}, err
+	}
+
+	a := Address{TON: (b[0] >> 4) & 0x07, NPI: b[0] & 0x0F}
+	a.Number = decodeSemiOctets(b[1:], -1)
+	if a.TON == TONInternational && a.Number != "" {
+		a.Number = "+" + a.Number
+	}
+	return a, nil
+}
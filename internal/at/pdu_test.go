@@ -0,0 +1,540 @@
+package at
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDecode(t *testing.T, pduHex string) *PDU {
+	t.Helper()
+	p, err := DecodePDU(pduHex)
+	if err != nil {
+		t.Fatalf("DecodePDU(%s): %v", pduHex, err)
+	}
+	return p
+}
+
+func checkTime(t *testing.T, name string, got time.Time, want string, offset int) {
+	t.Helper()
+	w, err := time.Parse("2006-01-02 15:04:05", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Format("2006-01-02 15:04:05") != w.Format("2006-01-02 15:04:05") {
+		t.Errorf("%s = %s, want %s", name, got.Format("2006-01-02 15:04:05"), want)
+	}
+	if _, off := got.Zone(); off != offset {
+		t.Errorf("%s zone offset = %d, want %d", name, off, offset)
+	}
+}
+
+func TestDecodeDeliverGSM7(t *testing.T) {
+	p := mustDecode(t, "07917283010010F5040BC87238880900F10000993092516195800AE8329BFD4697D9EC37")
+
+	if p.Type != MessageDeliver {
+		t.Fatalf("Type = %v, want SMS-DELIVER", p.Type)
+	}
+	if p.SMSC.Number != "+27381000015" {
+		t.Errorf("SMSC = %q", p.SMSC.Number)
+	}
+	if p.Address.Number != "27838890001" || p.Address.TON != 4 || p.Address.NPI != 8 {
+		t.Errorf("Address = %+v", p.Address)
+	}
+	if p.MoreMessages {
+		t.Error("MoreMessages = true, want false")
+	}
+	if p.Encoding != EncodingGSM7 || p.Class != ClassNone {
+		t.Errorf("Encoding = %v, Class = %v", p.Encoding, p.Class)
+	}
+	checkTime(t, "Timestamp", p.Timestamp, "1999-03-29 15:16:59", 2*3600)
+	if p.Text != "hellohello" {
+		t.Errorf("Text = %q", p.Text)
+	}
+	if p.Concat() != nil {
+		t.Errorf("Concat = %+v, want nil", p.Concat())
+	}
+}
+
+func TestDecodeDeliverUCS2(t *testing.T) {
+	p := mustDecode(t, "0891683108200105F0040D91683119325476F8000842506021436523044F60597D")
+
+	if p.SMSC.Number != "+8613800210500" {
+		t.Errorf("SMSC = %q", p.SMSC.Number)
+	}
+	if p.Address.Number != "+8613912345678" {
+		t.Errorf("Address = %q", p.Address.Number)
+	}
+	if p.Encoding != EncodingUCS2 {
+		t.Errorf("Encoding = %v, want UCS-2", p.Encoding)
+	}
+	checkTime(t, "Timestamp", p.Timestamp, "2024-05-06 12:34:56", 8*3600)
+	if p.Text != "你好" {
+		t.Errorf("Text = %q", p.Text)
+	}
+}
+
+func TestDecodeUCS2SurrogatePair(t *testing.T) {
+	p := mustDecode(t, "00040B911326880736F400082110214152000004D83DDE00")
+	if p.Text != "😀" {
+		t.Errorf("Text = %q, want emoji", p.Text)
+	}
+}
+
+func TestDecodeGSM7Extension(t *testing.T) {
+	p := mustDecode(t, "00040B911326880736F4000021102141520000029B32")
+	if p.Text != "€" {
+		t.Errorf("Text = %q, want €", p.Text)
+	}
+
+	// 扩展表以外的转义序列显示默认字母表中的字符
+	if got := decodeGSM7([]byte{gsm7Escape, 0x41}); got != "A" {
+		t.Errorf("unknown escape = %q, want A", got)
+	}
+}
+
+func TestDecodeConcat8Bit(t *testing.T) {
+	p := mustDecode(t, "00440B911326880736F400002110214152000008050003CC020182")
+
+	c := p.Concat()
+	if c == nil || *c != (ConcatInfo{Ref: 0xCC, Total: 2, Seq: 1}) {
+		t.Fatalf("Concat = %+v", c)
+	}
+	// UDH 之后有 1 个填充位
+	if p.Text != "A" {
+		t.Errorf("Text = %q, want A", p.Text)
+	}
+}
+
+func TestDecodeConcat16BitUCS2(t *testing.T) {
+	p := mustDecode(t, "00440B911326880736F40008211021415200000906080412340302004E")
+
+	c := p.Concat()
+	if c == nil || *c != (ConcatInfo{Ref: 0x1234, Total: 3, Seq: 2}) {
+		t.Fatalf("Concat = %+v", c)
+	}
+	if p.Text != "N" {
+		t.Errorf("Text = %q, want N", p.Text)
+	}
+}
+
+func TestDecodeAlphanumericSender(t *testing.T) {
+	p := mustDecode(t, "00040BD0C7F7FBCC2E030000211021415200000AE8329BFD4697D9EC37")
+	if p.Address.Number != "Google" || p.Address.TON != TONAlphanumeric {
+		t.Errorf("Address = %+v, want alphanumeric Google", p.Address)
+	}
+	if p.Text != "hellohello" {
+		t.Errorf("Text = %q", p.Text)
+	}
+}
+
+func TestDecode8BitWithClass(t *testing.T) {
+	p := mustDecode(t, "00040B911326880736F400F52110214152000004DEADBEEF")
+	if p.Encoding != Encoding8Bit || p.Class != Class1 {
+		t.Errorf("Encoding = %v, Class = %v, want 8-bit class 1", p.Encoding, p.Class)
+	}
+	if !bytes.Equal(p.Data, []byte{0xDE, 0xAD, 0xBE, 0xEF}) {
+		t.Errorf("Data = %X", p.Data)
+	}
+	if p.Text != "" {
+		t.Errorf("Text = %q, want empty", p.Text)
+	}
+}
+
+func TestDecodeNegativeTimezone(t *testing.T) {
+	p := mustDecode(t, "00040B911326880736F400002110214152000A0141")
+	checkTime(t, "Timestamp", p.Timestamp, "2012-01-12 14:25:00", -5*3600)
+	if p.Text != "A" {
+		t.Errorf("Text = %q", p.Text)
+	}
+}
+
+func TestDecodeFlashClass0(t *testing.T) {
+	p := mustDecode(t, "00040B911326880736F40010211021415200000141")
+	if p.Class != Class0 || p.Encoding != EncodingGSM7 {
+		t.Errorf("Class = %v, Encoding = %v", p.Class, p.Encoding)
+	}
+}
+
+func TestDecodeSubmit(t *testing.T) {
+	p := mustDecode(t, "0011000B916407281553F80000AA0AE8329BFD4697D9EC37")
+
+	if p.Type != MessageSubmit {
+		t.Fatalf("Type = %v, want SMS-SUBMIT", p.Type)
+	}
+	if p.SMSC.Number != "" {
+		t.Errorf("SMSC = %q, want empty", p.SMSC.Number)
+	}
+	if p.Address.Number != "+46708251358" {
+		t.Errorf("Address = %q", p.Address.Number)
+	}
+	if p.ValidityPeriod != 4*24*time.Hour {
+		t.Errorf("ValidityPeriod = %v", p.ValidityPeriod)
+	}
+	if p.Text != "hellohello" {
+		t.Errorf("Text = %q", p.Text)
+	}
+}
+
+func TestDecodeStatusReport(t *testing.T) {
+	p := mustDecode(t, "00062A0B911326880736F4211021415200002110214152040000")
+
+	if p.Type != MessageStatusReport {
+		t.Fatalf("Type = %v, want SMS-STATUS-REPORT", p.Type)
+	}
+	if p.MessageRef != 42 {
+		t.Errorf("MessageRef = %d", p.MessageRef)
+	}
+	if p.Address.Number != "+31628870634" {
+		t.Errorf("Address = %q", p.Address.Number)
+	}
+	checkTime(t, "Timestamp", p.Timestamp, "2012-01-12 14:25:00", 0)
+	checkTime(t, "DischargeTime", p.DischargeTime, "2012-01-12 14:25:40", 0)
+	if p.Status != 0 {
+		t.Errorf("Status = %d", p.Status)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := map[string]string{
+		"bad hex":           "ZZ",
+		"empty":             "",
+		"truncated SMSC":    "0791",
+		"reserved MTI":      "0003",
+		"truncated address": "00040B91132688",
+		"truncated UD":      "00040B911326880736F400002110214152000005C1",
+		"UDH too long":      "00440B911326880736F400002110214152000002FF00",
+	}
+	for name, pduHex := range cases {
+		if _, err := DecodePDU(pduHex); !errors.Is(err, ErrInvalidPDU) {
+			t.Errorf("%s: err = %v, want ErrInvalidPDU", name, err)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, pduHex := range []string{
+		"07917283010010F5040BC87238880900F10000993092516195800AE8329BFD4697D9EC37",
+		"0891683108200105F0040D91683119325476F8000842506021436523044F60597D",
+		"00040B911326880736F400082110214152000004D83DDE00",
+		"00040B911326880736F4000021102141520000029B32",
+		"00440B911326880736F400002110214152000008050003CC020182",
+		"00440B911326880736F40008211021415200000906080412340302004E",
+		"00040BD0C7F7FBCC2E030000211021415200000AE8329BFD4697D9EC37",
+		"00040B911326880736F400F52110214152000004DEADBEEF",
+		"00040B911326880736F400002110214152000A0141",
+		"0011000B916407281553F80000AA0AE8329BFD4697D9EC37",
+		"00062A0B911326880736F4211021415200002110214152040000",
+	} {
+		p := mustDecode(t, pduHex)
+		got, length, err := p.Encode()
+		if err != nil {
+			t.Errorf("Encode(%s): %v", pduHex, err)
+			continue
+		}
+		if got != pduHex {
+			t.Errorf("round trip:\n got %s\nwant %s", got, pduHex)
+		}
+		smscLen, _ := strconv.ParseUint(pduHex[:2], 16, 8)
+		if want := len(pduHex)/2 - 1 - int(smscLen); length != want {
+			t.Errorf("TPDU length = %d, want %d", length, want)
+		}
+	}
+}
+
+func TestEncodeSubmitSingle(t *testing.T) {
+	pdus, err := EncodeSubmit(SubmitOptions{
+		Number:         "+46708251358",
+		Text:           "hellohello",
+		ValidityPeriod: 4 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pdus) != 1 {
+		t.Fatalf("got %d parts, want 1", len(pdus))
+	}
+	if pdus[0].Hex != "0011000B916407281553F80000AA0AE8329BFD4697D9EC37" {
+		t.Errorf("Hex = %s", pdus[0].Hex)
+	}
+	if pdus[0].Length != 23 {
+		t.Errorf("Length = %d, want 23", pdus[0].Length)
+	}
+}
+
+func TestEncodeSubmitOptions(t *testing.T) {
+	pdus, err := EncodeSubmit(SubmitOptions{
+		SMSC:         "+8613800210500",
+		Number:       "10086",
+		Text:         "你好",
+		StatusReport: true,
+		MessageRef:   5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := mustDecode(t, pdus[0].Hex)
+	if p.SMSC.Number != "+8613800210500" || p.Address.Number != "10086" {
+		t.Errorf("SMSC = %q, Address = %q", p.SMSC.Number, p.Address.Number)
+	}
+	if p.Encoding != EncodingUCS2 || p.DCS != 0x08 {
+		t.Errorf("Encoding = %v, DCS = %02X, want UCS-2", p.Encoding, p.DCS)
+	}
+	if !p.StatusReport || p.MessageRef != 5 {
+		t.Errorf("StatusReport = %v, MessageRef = %d", p.StatusReport, p.MessageRef)
+	}
+	if p.Text != "你好" {
+		t.Errorf("Text = %q", p.Text)
+	}
+}
+
+// decodeParts 解码所有分段，检查分段头并返回拼接后的文本
+func decodeParts(t *testing.T, pdus []EncodedPDU, ref int) ([]*PDU, string) {
+	t.Helper()
+	var parts []*PDU
+	var sb strings.Builder
+	for i, e := range pdus {
+		p := mustDecode(t, e.Hex)
+		c := p.Concat()
+		if c == nil || *c != (ConcatInfo{Ref: ref, Total: len(pdus), Seq: i + 1}) {
+			t.Fatalf("part %d Concat = %+v", i+1, c)
+		}
+		if e.Length > 1+1+12+1+1+1+maxUserDataOctets {
+			t.Errorf("part %d length %d too long", i+1, e.Length)
+		}
+		parts = append(parts, p)
+		sb.WriteString(p.Text)
+	}
+	return parts, sb.String()
+}
+
+func TestEncodeSubmitMultipartGSM7(t *testing.T) {
+	text := strings.Repeat("abcdefghij", 20)
+	pdus, err := EncodeSubmit(SubmitOptions{Number: "+31628870634", Text: text, ConcatRef: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pdus) != 2 {
+		t.Fatalf("got %d parts, want 2", len(pdus))
+	}
+	parts, joined := decodeParts(t, pdus, 7)
+	if len([]rune(parts[0].Text)) != 153 {
+		t.Errorf("first part has %d chars, want 153", len([]rune(parts[0].Text)))
+	}
+	if joined != text {
+		t.Errorf("joined text mismatch: %q", joined)
+	}
+}
+
+func TestEncodeSubmitMultipartEscapeBoundary(t *testing.T) {
+	// 第 153 个 septet 是 € 的转义字符，不能拆到两段中
+	text := strings.Repeat("a", 152) + "€" + strings.Repeat("b", 20)
+	pdus, err := EncodeSubmit(SubmitOptions{Number: "123", Text: text, ConcatRef: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, joined := decodeParts(t, pdus, 1)
+	if parts[0].Text != strings.Repeat("a", 152) {
+		t.Errorf("first part = %q", parts[0].Text)
+	}
+	if !strings.HasPrefix(parts[1].Text, "€") {
+		t.Errorf("second part = %q, want € prefix", parts[1].Text)
+	}
+	if joined != text {
+		t.Errorf("joined text mismatch: %q", joined)
+	}
+}
+
+func TestEncodeSubmitMultipartUCS2(t *testing.T) {
+	text := strings.Repeat("中", 100)
+
+	pdus, err := EncodeSubmit(SubmitOptions{Number: "10086", Text: text, ConcatRef: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, joined := decodeParts(t, pdus, 9)
+	if len(parts) != 2 || len([]rune(parts[0].Text)) != 67 {
+		t.Errorf("got %d parts, first has %d chars; want 2 parts of 67+33", len(parts), len([]rune(parts[0].Text)))
+	}
+	if joined != text {
+		t.Errorf("joined text mismatch")
+	}
+
+	// 16-bit 参考号的 UDH 多占 1 字节，每段 66 个字符
+	pdus, err = EncodeSubmit(SubmitOptions{Number: "10086", Text: text, ConcatRef: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, joined = decodeParts(t, pdus, 300)
+	if len([]rune(parts[0].Text)) != 66 {
+		t.Errorf("first part has %d chars, want 66", len([]rune(parts[0].Text)))
+	}
+	if joined != text {
+		t.Errorf("joined text mismatch")
+	}
+}
+
+func TestEncodeSubmitSurrogateBoundary(t *testing.T) {
+	// 第 67 个 UTF-16 码元是代理对的高位，不能拆到两段中
+	text := strings.Repeat("中", 66) + "😀" + strings.Repeat("文", 10)
+	pdus, err := EncodeSubmit(SubmitOptions{Number: "10086", Text: text, ConcatRef: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, joined := decodeParts(t, pdus, 2)
+	if parts[0].Text != strings.Repeat("中", 66) {
+		t.Errorf("first part = %q", parts[0].Text)
+	}
+	if joined != text {
+		t.Errorf("joined text mismatch: %q", joined)
+	}
+}
+
+func TestEncodeSubmit8Bit(t *testing.T) {
+	data := bytes.Repeat([]byte{0xAB}, 200)
+	pdus, err := EncodeSubmit(SubmitOptions{Number: "10086", Data: data, ConcatRef: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pdus) != 2 {
+		t.Fatalf("got %d parts, want 2", len(pdus))
+	}
+	var got []byte
+	for _, e := range pdus {
+		p := mustDecode(t, e.Hex)
+		if p.Encoding != Encoding8Bit {
+			t.Errorf("Encoding = %v, want 8-bit", p.Encoding)
+		}
+		got = append(got, p.Data...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("joined data mismatch")
+	}
+}
+
+func TestEncodeAutoConcatRef(t *testing.T) {
+	text := strings.Repeat("x", 161)
+	a, err := EncodeSubmit(SubmitOptions{Number: "1", Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncodeSubmit(SubmitOptions{Number: "1", Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := mustDecode(t, a[0].Hex).Concat()
+	rb := mustDecode(t, b[0].Hex).Concat()
+	if ra == nil || rb == nil || ra.Ref == rb.Ref {
+		t.Errorf("auto concat refs = %+v, %+v; want distinct", ra, rb)
+	}
+}
+
+func TestMarshalRejectsInvalidText(t *testing.T) {
+	p := &PDU{Type: MessageSubmit, Address: Address{Number: "1"}, Encoding: EncodingGSM7, Text: "你好"}
+	if _, _, err := p.Encode(); !errors.Is(err, ErrInvalidPDU) {
+		t.Errorf("err = %v, want ErrInvalidPDU", err)
+	}
+
+	p = &PDU{Type: MessageSubmit, Address: Address{Number: "1"}, Encoding: EncodingGSM7, Text: strings.Repeat("a", 161)}
+	if _, _, err := p.Encode(); !errors.Is(err, ErrInvalidPDU) {
+		t.Errorf("err = %v, want ErrInvalidPDU for 161 septets", err)
+	}
+}
+
+func TestRelativeValidity(t *testing.T) {
+	cases := []struct {
+		v byte
+		d time.Duration
+	}{
+		{0, 5 * time.Minute},
+		{143, 12 * time.Hour},
+		{144, 12*time.Hour + 30*time.Minute},
+		{167, 24 * time.Hour},
+		{168, 2 * 24 * time.Hour},
+		{196, 30 * 24 * time.Hour},
+		{197, 5 * 7 * 24 * time.Hour},
+		{255, 63 * 7 * 24 * time.Hour},
+	}
+	for _, c := range cases {
+		if got := decodeRelativeValidity(c.v); got != c.d {
+			t.Errorf("decodeRelativeValidity(%d) = %v, want %v", c.v, got, c.d)
+		}
+		if got := encodeRelativeValidity(c.d); got != c.v {
+			t.Errorf("encodeRelativeValidity(%v) = %d, want %d", c.d, got, c.v)
+		}
+	}
+	// 不能精确表示的值向上取整
+	if got := encodeRelativeValidity(7 * time.Minute); got != 1 {
+		t.Errorf("encodeRelativeValidity(7m) = %d, want 1", got)
+	}
+}
+
+func TestSeptetPacking(t *testing.T) {
+	for n := 0; n <= 20; n++ {
+		septets := make([]byte, n)
+		for i := range septets {
+			septets[i] = byte(i*13+5) & 0x7F
+		}
+		// 在不同长度的 UDH 之后打包，解包后跳过 UDH 占用的 septet
+		for hdrLen := 0; hdrLen <= 8; hdrLen++ {
+			fill, hdrSeptets := udhSeptets(hdrLen)
+			ud := append(bytes.Repeat([]byte{0xFF}, hdrLen), packSeptets(septets, fill)...)
+			got := unpackSeptets(ud, hdrSeptets+n)[hdrSeptets:]
+			if !bytes.Equal(got, septets) {
+				t.Errorf("n=%d hdrLen=%d: got %v, want %v", n, hdrLen, got, septets)
+			}
+		}
+	}
+}
+
+func TestIsGSM7(t *testing.T) {
+	if !IsGSM7("Hello @£$ {}[]~€|^\\") {
+		t.Error("IsGSM7 = false for GSM characters")
+	}
+	if IsGSM7("你好") || IsGSM7("😀") {
+		t.Error("IsGSM7 = true for non-GSM characters")
+	}
+}
+
+func TestParseCMGL(t *testing.T) {
+	output := "AT+CMGL=4\r\n" +
+		"+CMGL: 1,1,,24\r\n" +
+		"07917283010010F5040BC87238880900F10000993092516195800AE8329BFD4697D9EC37\r\n" +
+		"+CMGL: 2,0,,21\r\n" +
+		"0891683108200105F0040D91683119325476F8000842506021436523044F60597D\r\n" +
+		"+CMGL: 3,1,,5\r\n" +
+		"0003\r\n" +
+		"+CMGL: 4,3,\"alpha\",23\r\n" +
+		"0011000B916407281553F80000AA0AE8329BFD4697D9EC37\r\n" +
+		"\r\nOK\r\n"
+
+	records := ParseCMGL(output)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3 (undecodable PDU skipped)", len(records))
+	}
+
+	want := []struct {
+		index  int
+		status SMSStatus
+		text   string
+	}{
+		{1, StatusRecRead, "hellohello"},
+		{2, StatusRecUnread, "你好"},
+		{4, StatusStoSent, "hellohello"},
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Index != w.index || r.Status != w.status || r.PDU.Text != w.text {
+			t.Errorf("record %d = {%d %v %q}, want {%d %v %q}", i, r.Index, r.Status, r.PDU.Text, w.index, w.status, w.text)
+		}
+	}
+	if records[2].PDU.Type != MessageSubmit {
+		t.Errorf("record 4 Type = %v, want SMS-SUBMIT", records[2].PDU.Type)
+	}
+	if records[0].Status.String() != "REC READ" {
+		t.Errorf("Status.String() = %q", records[0].Status.String())
+	}
+}
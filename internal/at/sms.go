@@ -0,0 +1,89 @@
+package at
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SMSStatus SIM 卡中短信的存储状态（PDU 模式 <stat>）
+type SMSStatus int
+
+const (
+	StatusRecUnread SMSStatus = 0 // 未读
+	StatusRecRead   SMSStatus = 1 // 已读
+	StatusStoUnsent SMSStatus = 2 // 已存储未发送
+	StatusStoSent   SMSStatus = 3 // 已存储已发送
+)
+
+// String 返回与文本模式一致的状态名称
+func (s SMSStatus) String() string {
+	switch s {
+	case StatusRecUnread:
+		return "REC UNREAD"
+	case StatusRecRead:
+		return "REC READ"
+	case StatusStoUnsent:
+		return "STO UNSENT"
+	case StatusStoSent:
+		return "STO SENT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// SMSRecord SIM 卡中的一条短信（PDU 模式 AT+CMGL 的一项）
+type SMSRecord struct {
+	Index  int       // 短信索引
+	Status SMSStatus // 存储状态
+	Raw    string    // 原始十六进制 PDU
+	PDU    *PDU      // 解码结果
+}
+
+// cmglHeaderRegex 匹配 PDU 模式的 +CMGL 行：+CMGL: <index>,<stat>,[<alpha>],<length>
+var cmglHeaderRegex = regexp.MustCompile(`\+CMGL:\s*(\d+),\s*(\d+),[^,]*,\s*(\d+)`)
+
+// hexLineRegex 匹配十六进制 PDU 行
+var hexLineRegex = regexp.MustCompile(`^[0-9A-Fa-f]+$`)
+
+// ParseCMGL 解析 PDU 模式（AT+CMGF=0）下 AT+CMGL=4 的输出
+// 格式示例：
+// +CMGL: 1,1,,24
+// 07917283010010F5040BC87238880900F10000993092516195800AE8329BFD4697D9EC37
+// 无法解码的 PDU 会记录日志并跳过
+func ParseCMGL(output string) []SMSRecord {
+	records := []SMSRecord{}
+
+	lines := strings.Split(output, "\n")
+	for i := 0; i < len(lines); i++ {
+		matches := cmglHeaderRegex.FindStringSubmatch(lines[i])
+		if matches == nil || i+1 >= len(lines) {
+			continue
+		}
+
+		raw := strings.TrimSpace(lines[i+1])
+		if !hexLineRegex.MatchString(raw) {
+			continue
+		}
+		i++
+
+		index, _ := strconv.Atoi(matches[1])
+		stat, _ := strconv.Atoi(matches[2])
+
+		pdu, err := DecodePDU(raw)
+		if err != nil {
+			log.Printf("[AT] Failed to decode PDU at index %d: %v", index, err)
+			continue
+		}
+
+		records = append(records, SMSRecord{
+			Index:  index,
+			Status: SMSStatus(stat),
+			Raw:    raw,
+			PDU:    pdu,
+		})
+	}
+
+	return records
+}
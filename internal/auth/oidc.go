@@ -5,11 +5,15 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
@@ -92,13 +96,29 @@ func GetOIDCConfig() (*OIDCConfig, error) {
 				TokenURL: tokenURI,
 			},
 			RedirectURL: fullRedirectURI,
-			Scopes:      []string{"openid", "profile", "email"},
+			Scopes:      oidcScopes(),
 		},
 	}
 
 	return config, nil
 }
 
+// oidcScopes 请求的 scope：openid profile email，加上 LAZYCAT_AUTH_OIDC_SCOPES 中的额外 scope（空格或逗号分隔）
+// 没有设置 LAZYCAT_AUTH_OIDC_SCOPES 但设置了 LAZYCAT_AUTH_OIDC_GROUPS_CLAIM 时额外请求 groups，让 userinfo 返回群组用于群组邀请
+func oidcScopes() []string {
+	scopes := []string{"openid", "profile", "email"}
+	extra := os.Getenv("LAZYCAT_AUTH_OIDC_SCOPES")
+	if extra == "" && os.Getenv("LAZYCAT_AUTH_OIDC_GROUPS_CLAIM") != "" {
+		extra = "groups"
+	}
+	for _, scope := range strings.FieldsFunc(extra, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
 // generateState 生成随机 state
 func generateState() (string, error) {
 	b := make([]byte, 32)
@@ -144,7 +164,7 @@ func Login(c *gin.Context) {
 	}
 
 	// 将 state 存储在 session cookie 中
-	c.SetCookie("oidc_state", state, 600, "/", "", false, true)
+	setCookie(c, "oidc_state", state, 600)
 
 	// 重定向到 OIDC 提供商
 	url := config.AuthCodeURL(state)
@@ -169,7 +189,7 @@ func Callback(c *gin.Context) {
 	}
 
 	// 清除 state cookie
-	c.SetCookie("oidc_state", "", -1, "/", "", false, true)
+	setCookie(c, "oidc_state", "", -1)
 
 	// 获取授权码
 	code := c.Query("code")
@@ -213,116 +233,87 @@ func Callback(c *gin.Context) {
 	}
 
 	// 提取用户信息
-	// OIDC 标准字段：sub (subject), email, name
-	sub, _ := userInfo["sub"].(string)
-	email, _ := userInfo["email"].(string)
-	name, _ := userInfo["name"].(string)
-
-	if sub == "" {
+	// OIDC 标准字段：sub (subject), email, name，以及可选的群组声明
+	identity := identityFromUserInfo(userInfo)
+	if identity.Subject == "" {
 		log.Printf("UserInfo missing 'sub' claim")
 		c.Redirect(http.StatusFound, "/auth/login?error=invalid_userinfo")
 		return
 	}
 
-	// 检查是否已存在管理员
-	var adminCount int64
-	database.DB.Model(&database.AdminUser{}).Count(&adminCount)
-
-	// 查找当前用户
-	var existingAdmin database.AdminUser
-	err = database.DB.Where("subject = ?", sub).First(&existingAdmin).Error
-
-	if err == nil {
-		// 用户已存在，是管理员，允许登录
-		log.Printf("Admin user logged in: %s (%s)", existingAdmin.Email, existingAdmin.Name)
-	} else if adminCount == 0 {
-		// 还没有管理员，创建第一个管理员
-		newAdmin := database.AdminUser{
-			Email:   email,
-			Name:    name,
-			Subject: sub,
-		}
-		if err := database.DB.Create(&newAdmin).Error; err != nil {
-			log.Printf("Failed to create admin user: %v", err)
-			c.Redirect(http.StatusFound, "/auth/login?error=db_error")
-			return
-		}
-		log.Printf("First admin user created: %s (%s)", email, name)
-	} else {
-		// 已有管理员，但当前用户不是管理员，拒绝登录
-		log.Printf("Unauthorized login attempt by non-admin user: %s (%s)", email, name)
-
-		// 获取现有管理员信息用于显示错误
-		var firstAdmin database.AdminUser
-		database.DB.First(&firstAdmin)
-		errorMsg := fmt.Sprintf("只允许管理员（%s - %s）操作", firstAdmin.Name, firstAdmin.Email)
-
-		c.Redirect(http.StatusFound, "/auth/login?error=unauthorized&message="+errorMsg)
+	// 已有用户直接登录；第一个登录的用户成为管理员；其他用户需要管理员邀请
+	user, err := ResolveUser(identity)
+	if errors.Is(err, ErrNotInvited) {
+		log.Printf("Unauthorized login attempt by uninvited user: %s (%s)", identity.Email, identity.Name)
+		c.Redirect(http.StatusFound, "/auth/login?error=unauthorized&message="+url.QueryEscape("账号还没有被邀请，请联系管理员"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to resolve user: %v", err)
+		c.Redirect(http.StatusFound, "/auth/login?error=db_error")
 		return
 	}
+	log.Printf("User logged in: %s (%s), role %s", identity.Email, user.Name, user.Role)
 
-	// 创建会话
-	sessionToken, err := generateState()
+	// 创建会话（保存到数据库，cookie 中只有随机令牌）
+	sessionToken, session, err := NewSession(user.ID, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
+		log.Printf("Failed to create session: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
-
-	// 设置会话 cookie（1 天过期）
-	c.SetCookie("session", sessionToken, 24*3600, "/", "", false, true)
+	setSessionCookie(c, sessionToken, session.ExpiresAt)
 
 	// 重定向到前端
 	c.Redirect(http.StatusFound, "/")
 }
 
-// Logout 处理登出请求
+// Logout 处理登出请求，在服务端撤销会话并清除 cookie
 func Logout(c *gin.Context) {
-	// 清除会话 cookie
-	c.SetCookie("session", "", -1, "/", "", false, true)
+	if token, err := c.Cookie(sessionCookie); err == nil && token != "" {
+		if err := database.DB.Where("token_hash = ?", hashToken(token)).Delete(&database.Session{}).Error; err != nil {
+			log.Printf("[Auth] Failed to revoke session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+	}
+	setCookie(c, sessionCookie, "", -1)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
 
 // Middleware 认证中间件
 func Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 检查会话 cookie
-		session, err := c.Cookie("session")
-		if err != nil || session == "" {
+		// 检查会话 cookie 对应的会话是否有效
+		if _, err := authenticate(c); err != nil {
+			if !errors.Is(err, ErrSessionNotFound) {
+				log.Printf("[Auth] Failed to check session: %v", err)
+			}
 			// 未登录，重定向到登录页
 			c.Redirect(http.StatusFound, "/auth/login")
 			c.Abort()
 			return
 		}
 
-		// TODO: 验证会话有效性（可以存储在 Redis 或数据库中）
-		// 这里简化实现，只检查 cookie 是否存在
-
 		c.Next()
 	}
 }
 
 // CheckAuth 检查认证状态（用于 API）
+// 本地请求同样需要认证（本机的其他进程和 Web 终端不能绕过），Asterisk 回调使用单独的内部接口
 func CheckAuth(c *gin.Context) {
-	// 检查是否为本地请求（用于开发和测试）
-	// ClientIP() 使用 RemoteAddr，无法被 HTTP 头伪造
-	clientIP := c.ClientIP()
-	if clientIP == "127.0.0.1" || clientIP == "::1" {
-		// 本地请求跳过认证
-		log.Printf("[Auth] Skipping authentication for local request from %s", clientIP)
-		c.Next()
-		return
-	}
-
-	// 检查 session cookie
-	session, err := c.Cookie("session")
-	if err != nil || session == "" {
+	// 检查 session cookie 对应的会话是否有效（存在、未过期、未撤销），并顺延过期时间
+	if _, err := authenticate(c); err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			log.Printf("[Auth] Failed to check session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			c.Abort()
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		c.Abort()
 		return
 	}
 
-	// TODO: 验证会话有效性（可以存储在 Redis 或数据库中）
-	// 这里简化实现，只检查 cookie 是否存在
-
 	c.Next()
 }
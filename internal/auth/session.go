@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// sessionCookie 会话 cookie 名
+	sessionCookie = "session"
+	// sessionIdleTimeout 会话空闲超时，每次访问时顺延
+	sessionIdleTimeout = 24 * time.Hour
+	// sessionMaxLifetime 会话最长有效期，超过后即使一直在使用也需要重新登录
+	sessionMaxLifetime = 30 * 24 * time.Hour
+	// sessionTouchInterval 两次访问间隔小于这个时间时不更新最后访问时间，避免每个请求都写数据库
+	sessionTouchInterval = time.Minute
+)
+
+// sessionContextKey 当前请求的会话在 gin.Context 中的键
+const sessionContextKey = "auth.session"
+
+// ErrSessionNotFound 会话不存在、已过期或已撤销
+var ErrSessionNotFound = errors.New("session not found")
+
+// hashToken 计算会话令牌的哈希（数据库中只保存哈希）
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSession 为管理员创建会话，返回 cookie 中保存的令牌
+func NewSession(adminUserID uint, ip, userAgent string) (string, *database.Session, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	now := time.Now()
+	session := &database.Session{
+		TokenHash:   hashToken(token),
+		AdminUserID: adminUserID,
+		IP:          ip,
+		UserAgent:   userAgent,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(sessionIdleTimeout),
+	}
+	if err := database.DB.Create(session).Error; err != nil {
+		return "", nil, err
+	}
+
+	// 顺便清理已过期的会话
+	if err := database.DB.Where("expires_at <= ?", now).Delete(&database.Session{}).Error; err != nil {
+		log.Printf("[Auth] Failed to purge expired sessions: %v", err)
+	}
+	return token, session, nil
+}
+
+// LookupSession 查找令牌对应的有效会话
+func LookupSession(token string) (*database.Session, error) {
+	if token == "" {
+		return nil, ErrSessionNotFound
+	}
+	var session database.Session
+	err := database.DB.Preload("AdminUser").
+		Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 管理员已被删除
+	if session.AdminUser.ID == 0 {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+// touchSession 记录会话访问并顺延过期时间（滑动过期），返回是否顺延
+func touchSession(session *database.Session, now time.Time) (bool, error) {
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return false, nil
+	}
+	expiresAt := now.Add(sessionIdleTimeout)
+	if limit := session.CreatedAt.Add(sessionMaxLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	err := database.DB.Model(session).Updates(map[string]interface{}{
+		"last_seen_at": now,
+		"expires_at":   expiresAt,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	session.LastSeenAt = now
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// authenticate 校验请求的会话 cookie，成功时把会话保存到 gin.Context 中
+func authenticate(c *gin.Context) (*database.Session, error) {
+	token, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	session, err := LookupSession(token)
+	if err != nil {
+		return nil, err
+	}
+
+	touched, err := touchSession(session, time.Now())
+	if err != nil {
+		log.Printf("[Auth] Failed to update session %d: %v", session.ID, err)
+	} else if touched {
+		setSessionCookie(c, token, session.ExpiresAt)
+	}
+	c.Set(sessionContextKey, session)
+	return session, nil
+}
+
+// CurrentSession 获取当前请求的会话（经过 CheckAuth 或 Middleware 之后可用）
+func CurrentSession(c *gin.Context) *database.Session {
+	if v, ok := c.Get(sessionContextKey); ok {
+		if session, ok := v.(*database.Session); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+// isSecureRequest 请求是否通过 HTTPS 到达（直接 TLS 或反向代理设置的 X-Forwarded-Proto）
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// setCookie 设置 HttpOnly、SameSite=Lax 的 cookie，HTTPS 请求时加上 Secure
+func setCookie(c *gin.Context, name, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, "/", "", isSecureRequest(c), true)
+}
+
+// setSessionCookie 设置会话 cookie，cookie 与会话同时过期
+func setSessionCookie(c *gin.Context, token string, expiresAt time.Time) {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+	setCookie(c, sessionCookie, token, maxAge)
+}
+
+// sessionResponse 会话列表项
+type sessionResponse struct {
+	database.Session
+	Current bool `json:"current"` // 是否是发起请求的会话
+}
+
+// ListSessions 列出当前管理员的所有有效会话
+func ListSessions(c *gin.Context) {
+	current := CurrentSession(c)
+	if current == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var sessions []database.Session
+	if err := database.DB.Where("admin_user_id = ? AND expires_at > ?", current.AdminUserID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := make([]sessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = sessionResponse{Session: s, Current: s.ID == current.ID}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSession 撤销当前管理员的某个会话（撤销当前会话等同于登出）
+func RevokeSession(c *gin.Context) {
+	current := CurrentSession(c)
+	if current == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND admin_user_id = ?", id, current.AdminUserID).Delete(&database.Session{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if uint(id) == current.ID {
+		setCookie(c, sessionCookie, "", -1)
+	}
+	log.Printf("[Auth] Session %d revoked by admin user %d", id, current.AdminUserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions 撤销当前管理员除当前会话以外的所有会话
+func RevokeOtherSessions(c *gin.Context) {
+	current := CurrentSession(c)
+	if current == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := database.DB.Where("admin_user_id = ? AND id <> ?", current.AdminUserID, current.ID).Delete(&database.Session{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	log.Printf("[Auth] %d other sessions revoked by admin user %d", result.RowsAffected, current.AdminUserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": result.RowsAffected})
+}
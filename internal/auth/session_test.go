@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests 使用临时数据库运行测试
+func runTests(m *testing.M) int {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "auth-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("DB_PATH", filepath.Join(dir, "data.db"))
+	if err := database.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+// newAdmin 创建管理员
+func newAdmin(t *testing.T, subject string) database.AdminUser {
+	t.Helper()
+	admin := database.AdminUser{Name: subject, Subject: subject}
+	if err := database.DB.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+// newSession 为管理员创建会话
+func newSession(t *testing.T, admin database.AdminUser) (string, *database.Session) {
+	t.Helper()
+	token, session, err := NewSession(admin.ID, "192.0.2.1", "test-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, session
+}
+
+// newAuthEngine 创建需要认证的测试路由
+func newAuthEngine() *gin.Engine {
+	engine := gin.New()
+	engine.POST("/auth/logout", Logout)
+	api := engine.Group("/api", CheckAuth)
+	api.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	api.GET("/sessions", ListSessions)
+	api.DELETE("/sessions", RevokeOtherSessions)
+	api.DELETE("/sessions/:id", RevokeSession)
+	return engine
+}
+
+// do 带会话 cookie 发送请求（token 为空时不带 cookie）
+func do(engine *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestCheckAuthRequiresStoredSession(t *testing.T) {
+	engine := newAuthEngine()
+	token, session := newSession(t, newAdmin(t, "check"))
+
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"forged-cookie", http.StatusUnauthorized},
+		{token, http.StatusOK},
+	} {
+		if w := do(engine, http.MethodGet, "/api/ping", tc.token); w.Code != tc.want {
+			t.Fatalf("token %q: status = %d, want %d", tc.token, w.Code, tc.want)
+		}
+	}
+
+	var stored database.Session
+	database.DB.First(&stored, session.ID)
+	if stored.TokenHash == token || stored.TokenHash != hashToken(token) {
+		t.Fatal("session token is not stored hashed")
+	}
+
+	// 过期的会话
+	database.DB.Model(&stored).Update("expires_at", time.Now().Add(-time.Second))
+	if w := do(engine, http.MethodGet, "/api/ping", token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired session: status = %d, want 401", w.Code)
+	}
+}
+
+func TestSessionSlidingExpiration(t *testing.T) {
+	engine := newAuthEngine()
+	token, session := newSession(t, newAdmin(t, "sliding"))
+
+	// 最近访问过的会话不更新，避免每个请求都写数据库
+	w := do(engine, http.MethodGet, "/api/ping", token)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("status = %d, cookies = %v", w.Code, w.Result().Cookies())
+	}
+
+	// 空闲一段时间后访问：顺延过期时间并刷新 cookie
+	lastSeen := time.Now().Add(-time.Hour)
+	database.DB.Model(session).Updates(map[string]interface{}{"last_seen_at": lastSeen, "expires_at": lastSeen.Add(sessionIdleTimeout)})
+	w = do(engine, http.MethodGet, "/api/ping", token)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("status = %d, cookies = %v", w.Code, w.Result().Cookies())
+	}
+	var stored database.Session
+	database.DB.First(&stored, session.ID)
+	if !stored.LastSeenAt.After(lastSeen) || time.Until(stored.ExpiresAt) < sessionIdleTimeout-time.Minute {
+		t.Fatalf("session not extended: last seen %v, expires %v", stored.LastSeenAt, stored.ExpiresAt)
+	}
+
+	// 不超过最长有效期
+	created := time.Now().Add(-sessionMaxLifetime + time.Hour)
+	stored.CreatedAt = created
+	if _, err := touchSession(&stored, time.Now().Add(time.Minute*2)); err != nil {
+		t.Fatal(err)
+	}
+	if !stored.ExpiresAt.Equal(created.Add(sessionMaxLifetime)) {
+		t.Fatalf("expires at %v, want capped at %v", stored.ExpiresAt, created.Add(sessionMaxLifetime))
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	engine := newAuthEngine()
+	token, _ := newSession(t, newAdmin(t, "logout"))
+
+	w := do(engine, http.MethodPost, "/auth/logout", token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: status = %d", w.Code)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("session cookie not cleared: %v", cookies)
+	}
+	// 登出前复制的 cookie 也不能再使用
+	if w := do(engine, http.MethodGet, "/api/ping", token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("after logout: status = %d, want 401", w.Code)
+	}
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	engine := newAuthEngine()
+	admin := newAdmin(t, "sessions")
+	token, current := newSession(t, admin)
+	otherToken, other := newSession(t, admin)
+	thirdToken, _ := newSession(t, admin)
+	strangerToken, stranger := newSession(t, newAdmin(t, "stranger"))
+
+	w := do(engine, http.MethodGet, "/api/sessions", token)
+	var list []struct {
+		ID        uint   `json:"id"`
+		IP        string `json:"ip"`
+		UserAgent string `json:"user_agent"`
+		Current   bool   `json:"current"`
+		TokenHash string `json:"token_hash"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("listed %d sessions, want 3", len(list))
+	}
+	for _, s := range list {
+		if s.Current != (s.ID == current.ID) || s.IP != "192.0.2.1" || s.UserAgent != "test-agent" || s.TokenHash != "" {
+			t.Fatalf("session = %+v", s)
+		}
+	}
+
+	// 不能撤销其他管理员的会话
+	if w := do(engine, http.MethodDelete, fmt.Sprintf("/api/sessions/%d", stranger.ID), token); w.Code != http.StatusNotFound {
+		t.Fatalf("revoke stranger session: status = %d, want 404", w.Code)
+	}
+	if w := do(engine, http.MethodDelete, fmt.Sprintf("/api/sessions/%d", other.ID), token); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status = %d", w.Code)
+	}
+	if w := do(engine, http.MethodGet, "/api/ping", otherToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked session: status = %d, want 401", w.Code)
+	}
+
+	// 撤销其他所有会话，当前会话和其他管理员的会话不受影响
+	if w := do(engine, http.MethodDelete, "/api/sessions", token); w.Code != http.StatusOK {
+		t.Fatalf("revoke others: status = %d", w.Code)
+	}
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{{thirdToken, http.StatusUnauthorized}, {token, http.StatusOK}, {strangerToken, http.StatusOK}} {
+		if w := do(engine, http.MethodGet, "/api/ping", tc.token); w.Code != tc.want {
+			t.Fatalf("status = %d, want %d", w.Code, tc.want)
+		}
+	}
+}
+
+func TestSessionCookieSecureFlag(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		setup  func(r *http.Request)
+		secure bool
+	}{
+		{"plain http", func(r *http.Request) {}, false},
+		{"reverse proxy tls", func(r *http.Request) { r.Header.Set("X-Forwarded-Proto", "https") }, true},
+		{"direct tls", func(r *http.Request) { r.TLS = &tls.ConnectionState{} }, true},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		tc.setup(c.Request)
+		setSessionCookie(c, "token", time.Now().Add(time.Hour))
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Secure != tc.secure || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+			t.Fatalf("%s: cookies = %+v", tc.name, cookies)
+		}
+	}
+}
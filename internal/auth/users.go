@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ErrNotInvited 用户既不是已有用户，也没有匹配的邀请
+var ErrNotInvited = errors.New("user not invited")
+
+// Identity OIDC userinfo 中用于匹配用户和邀请的信息
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool // userinfo 没有 email_verified 声明时视为已验证
+	Name          string
+	Groups        []string
+}
+
+// identityFromUserInfo 从 userinfo 中提取身份信息
+// 群组声明名可通过 LAZYCAT_AUTH_OIDC_GROUPS_CLAIM 修改（默认 groups），值可以是字符串数组或单个字符串
+func identityFromUserInfo(userInfo map[string]interface{}) Identity {
+	id := Identity{EmailVerified: true}
+	id.Subject, _ = userInfo["sub"].(string)
+	id.Email, _ = userInfo["email"].(string)
+	id.Name, _ = userInfo["name"].(string)
+	if verified, ok := userInfo["email_verified"].(bool); ok {
+		id.EmailVerified = verified
+	}
+
+	claim := os.Getenv("LAZYCAT_AUTH_OIDC_GROUPS_CLAIM")
+	if claim == "" {
+		claim = "groups"
+	}
+	switch groups := userInfo[claim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok && s != "" {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		if groups != "" {
+			id.Groups = []string{groups}
+		}
+	}
+	return id
+}
+
+// ResolveUser 查找登录的用户：已有用户直接登录，还没有用户时创建第一个管理员，
+// 否则按邀请（subject、邮箱、群组的顺序）创建用户；没有匹配的邀请时返回 ErrNotInvited
+func ResolveUser(id Identity) (*database.AdminUser, error) {
+	var user database.AdminUser
+	err := database.DB.Where("subject = ?", id.Subject).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var userCount int64
+		if err := tx.Model(&database.AdminUser{}).Count(&userCount).Error; err != nil {
+			return err
+		}
+		user = database.AdminUser{Name: id.Name, Subject: id.Subject}
+		if id.Email != "" {
+			user.Email = &id.Email
+		}
+		if userCount == 0 {
+			// 还没有用户，创建第一个管理员
+			user.Role = database.RoleAdmin
+			return tx.Create(&user).Error
+		}
+
+		invite, err := findInvite(tx, id)
+		if err != nil {
+			return err
+		}
+		user.Role = invite.Role
+		user.DongleIDs = invite.DongleIDs
+		user.AllDongles = invite.AllDongles
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// 邮箱和 subject 邀请只能使用一次
+		if invite.Kind != database.InviteByGroup {
+			if err := tx.Delete(invite).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("[Auth] User %s (%s) joined as %s via %s invite %d", id.Email, id.Subject, user.Role, invite.Kind, invite.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// findInvite 查找匹配的邀请
+func findInvite(tx *gorm.DB, id Identity) (*database.UserInvite, error) {
+	conditions := [][]interface{}{
+		{"kind = ? AND value = ?", database.InviteBySubject, id.Subject},
+	}
+	if id.Email != "" && id.EmailVerified {
+		conditions = append(conditions, []interface{}{"kind = ? AND LOWER(value) = ?", database.InviteByEmail, strings.ToLower(id.Email)})
+	}
+	if len(id.Groups) > 0 {
+		conditions = append(conditions, []interface{}{"kind = ? AND value IN ?", database.InviteByGroup, id.Groups})
+	}
+
+	for _, cond := range conditions {
+		var invite database.UserInvite
+		err := tx.Where(cond[0], cond[1:]...).Order("id").First(&invite).Error
+		if err == nil {
+			return &invite, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return nil, ErrNotInvited
+}
+
+// roleLevels 角色权限从低到高
+var roleLevels = map[string]int{
+	database.RoleViewer:   1,
+	database.RoleOperator: 2,
+	database.RoleAdmin:    3,
+}
+
+// ValidRole 是否是有效的角色
+func ValidRole(role string) bool {
+	return roleLevels[role] > 0
+}
+
+// HasRole 用户的角色是否不低于 role
+func HasRole(user *database.AdminUser, role string) bool {
+	return user != nil && roleLevels[user.Role] > 0 && roleLevels[user.Role] >= roleLevels[role]
+}
+
+// ParseDongleIDs 解析逗号分隔的 dongle 设备 ID 列表（去掉空白和重复项）
+func ParseDongleIDs(s string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// CurrentUser 获取当前请求的用户（经过 CheckAuth 或 Middleware 之后可用）
+func CurrentUser(c *gin.Context) *database.AdminUser {
+	if session := CurrentSession(c); session != nil {
+		return &session.AdminUser
+	}
+	return nil
+}
+
+// DongleScope 当前用户可以访问的 dongle 设备 ID，nil 表示不限制（管理员或 AllDongles）
+// 没有设置范围的操作员和只读用户不能访问任何 dongle（返回空的非 nil 切片）
+func DongleScope(c *gin.Context) []string {
+	user := CurrentUser(c)
+	if user == nil {
+		return []string{}
+	}
+	if user.Role == database.RoleAdmin || user.AllDongles {
+		return nil
+	}
+	ids := ParseDongleIDs(user.DongleIDs)
+	if ids == nil {
+		return []string{}
+	}
+	return ids
+}
+
+// CanAccessDongle 当前用户是否可以访问指定的 dongle
+func CanAccessDongle(c *gin.Context, deviceID string) bool {
+	scope := DongleScope(c)
+	if scope == nil {
+		return true
+	}
+	for _, id := range scope {
+		if id == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteUser 删除用户及其所有会话，不能删除最后一个管理员
+func DeleteUser(id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user database.AdminUser
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if user.Role == database.RoleAdmin {
+			if err := ensureOtherAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("admin_user_id = ?", id).Delete(&database.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+}
+
+// ErrLastAdmin 操作会导致没有管理员
+var ErrLastAdmin = errors.New("at least one admin is required")
+
+// ensureOtherAdmin 检查除 id 以外是否还有管理员
+func ensureOtherAdmin(tx *gorm.DB, id uint) error {
+	var admins int64
+	if err := tx.Model(&database.AdminUser{}).Where("role = ? AND id <> ?", database.RoleAdmin, id).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// UpdateUserAccess 修改用户的角色和 dongle 范围（allDongles 为 true 时可以访问所有 dongle），不能把最后一个管理员降级
+func UpdateUserAccess(id uint, role, dongleIDs string, allDongles bool) (*database.AdminUser, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	var user database.AdminUser
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if user.Role == database.RoleAdmin && role != database.RoleAdmin {
+			if err := ensureOtherAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		user.Role = role
+		user.DongleIDs = strings.Join(ParseDongleIDs(dongleIDs), ",")
+		user.AllDongles = allDongles
+		return tx.Model(&user).Select("role", "dongle_ids", "all_dongles").Updates(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
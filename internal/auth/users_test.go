@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdentityFromUserInfo(t *testing.T) {
+	id := identityFromUserInfo(map[string]interface{}{
+		"sub":            "u1",
+		"email":          "u1@example.com",
+		"email_verified": false,
+		"groups":         []interface{}{"ops", "", 42, "sms"},
+	})
+	if id.Subject != "u1" || id.Email != "u1@example.com" || id.EmailVerified || !reflect.DeepEqual(id.Groups, []string{"ops", "sms"}) {
+		t.Fatalf("identity = %+v", id)
+	}
+
+	t.Setenv("LAZYCAT_AUTH_OIDC_GROUPS_CLAIM", "roles")
+	id = identityFromUserInfo(map[string]interface{}{"sub": "u2", "roles": "ops"})
+	if !id.EmailVerified || !reflect.DeepEqual(id.Groups, []string{"ops"}) {
+		t.Fatalf("identity = %+v", id)
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	// 从空的用户表开始
+	if err := database.DB.Where("1 = 1").Delete(&database.AdminUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一个登录的用户成为管理员
+	first, err := ResolveUser(Identity{Subject: "first", Email: "first@example.com", EmailVerified: true})
+	if err != nil || first.Role != database.RoleAdmin {
+		t.Fatalf("first user = %+v, err = %v", first, err)
+	}
+	// 已有用户直接登录
+	again, err := ResolveUser(Identity{Subject: "first", Email: "first@example.com", EmailVerified: true})
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("existing user = %+v, err = %v", again, err)
+	}
+
+	// 没有邀请的用户不能登录
+	if _, err := ResolveUser(Identity{Subject: "stranger", Email: "stranger@example.com", EmailVerified: true}); !errors.Is(err, ErrNotInvited) {
+		t.Fatalf("uninvited: err = %v, want ErrNotInvited", err)
+	}
+
+	invites := []database.UserInvite{
+		{Kind: database.InviteByEmail, Value: "op@example.com", Role: database.RoleOperator, DongleIDs: "quectel0"},
+		{Kind: database.InviteBySubject, Value: "sub-viewer", Role: database.RoleViewer, AllDongles: true},
+		{Kind: database.InviteByGroup, Value: "sms-team", Role: database.RoleViewer, DongleIDs: "quectel1"},
+	}
+	if err := database.DB.Create(&invites).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 未验证的邮箱不匹配邮箱邀请
+	if _, err := ResolveUser(Identity{Subject: "op-unverified", Email: "op@example.com"}); !errors.Is(err, ErrNotInvited) {
+		t.Fatalf("unverified email: err = %v, want ErrNotInvited", err)
+	}
+
+	// 邮箱邀请（不区分大小写）只能使用一次
+	op, err := ResolveUser(Identity{Subject: "op", Email: "OP@example.com", EmailVerified: true})
+	if err != nil || op.Role != database.RoleOperator || op.DongleIDs != "quectel0" {
+		t.Fatalf("email invite: user = %+v, err = %v", op, err)
+	}
+	if err := database.DB.First(&database.UserInvite{}, invites[0].ID).Error; err == nil {
+		t.Fatal("email invite not consumed")
+	}
+
+	viewer, err := ResolveUser(Identity{Subject: "sub-viewer", Email: "viewer@example.com", EmailVerified: true})
+	if err != nil || viewer.Role != database.RoleViewer || !viewer.AllDongles {
+		t.Fatalf("subject invite: user = %+v, err = %v", viewer, err)
+	}
+
+	// 群组邀请一直有效
+	for _, subject := range []string{"member1", "member2"} {
+		member, err := ResolveUser(Identity{Subject: subject, Email: subject + "@example.com", Groups: []string{"other", "sms-team"}})
+		if err != nil || member.Role != database.RoleViewer || member.DongleIDs != "quectel1" {
+			t.Fatalf("group invite: user = %+v, err = %v", member, err)
+		}
+	}
+	if err := database.DB.First(&database.UserInvite{}, invites[2].ID).Error; err != nil {
+		t.Fatalf("group invite consumed: %v", err)
+	}
+}
+
+func TestResolveUserWithoutEmail(t *testing.T) {
+	// 已经有管理员，之后的用户需要邀请
+	if err := database.DB.Where("1 = 1").Delete(&database.AdminUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveUser(Identity{Subject: "owner"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// userinfo 中没有邮箱的两个用户通过 subject 邀请加入，邮箱都保存为 NULL
+	invites := []database.UserInvite{
+		{Kind: database.InviteBySubject, Value: "no-email-1", Role: database.RoleOperator},
+		{Kind: database.InviteBySubject, Value: "no-email-2", Role: database.RoleViewer},
+	}
+	if err := database.DB.Create(&invites).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, invite := range invites {
+		user, err := ResolveUser(Identity{Subject: invite.Value, EmailVerified: true})
+		if err != nil || user.Role != invite.Role || user.Email != nil {
+			t.Fatalf("subject invite %s: user = %+v, err = %v", invite.Value, user, err)
+		}
+	}
+	var count int64
+	if err := database.DB.Model(&database.AdminUser{}).Where("email IS NULL").Count(&count).Error; err != nil || count != 3 {
+		t.Fatalf("users without email = %d, err = %v", count, err)
+	}
+}
+
+func TestRolesAndDongleScope(t *testing.T) {
+	viewer := &database.AdminUser{Role: database.RoleViewer}
+	operator := &database.AdminUser{Role: database.RoleOperator}
+	admin := &database.AdminUser{Role: database.RoleAdmin}
+	for _, tc := range []struct {
+		user *database.AdminUser
+		role string
+		want bool
+	}{
+		{viewer, database.RoleViewer, true},
+		{viewer, database.RoleOperator, false},
+		{operator, database.RoleOperator, true},
+		{operator, database.RoleAdmin, false},
+		{admin, database.RoleAdmin, true},
+		{&database.AdminUser{Role: "root"}, database.RoleViewer, false},
+		{nil, database.RoleViewer, false},
+	} {
+		if got := HasRole(tc.user, tc.role); got != tc.want {
+			t.Fatalf("HasRole(%v, %s) = %v, want %v", tc.user, tc.role, got, tc.want)
+		}
+	}
+
+	if got := ParseDongleIDs(" quectel0, ,quectel1,quectel0"); !reflect.DeepEqual(got, []string{"quectel0", "quectel1"}) {
+		t.Fatalf("ParseDongleIDs = %v", got)
+	}
+
+	// 没有设置范围的操作员和只读用户不能访问任何 dongle
+	for _, tc := range []struct {
+		user      database.AdminUser
+		wantScope []string
+		canAccess bool
+	}{
+		{database.AdminUser{Role: database.RoleAdmin}, nil, true},
+		{database.AdminUser{Role: database.RoleViewer, AllDongles: true}, nil, true},
+		{database.AdminUser{Role: database.RoleOperator, DongleIDs: "quectel0"}, []string{"quectel0"}, true},
+		{database.AdminUser{Role: database.RoleOperator, DongleIDs: "quectel1"}, []string{"quectel1"}, false},
+		{database.AdminUser{Role: database.RoleViewer}, []string{}, false},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set(sessionContextKey, &database.Session{AdminUser: tc.user})
+		if got := DongleScope(c); !reflect.DeepEqual(got, tc.wantScope) {
+			t.Fatalf("DongleScope(%+v) = %#v, want %#v", tc.user, got, tc.wantScope)
+		}
+		if got := CanAccessDongle(c, "quectel0"); got != tc.canAccess {
+			t.Fatalf("CanAccessDongle(%+v) = %v, want %v", tc.user, got, tc.canAccess)
+		}
+	}
+}
+
+func TestLastAdminGuards(t *testing.T) {
+	if err := database.DB.Where("1 = 1").Delete(&database.AdminUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin := newAdmin(t, "only-admin")
+	token, _ := newSession(t, admin)
+
+	if _, err := UpdateUserAccess(admin.ID, database.RoleViewer, "", true); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("demote last admin: err = %v, want ErrLastAdmin", err)
+	}
+	if err := DeleteUser(admin.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("delete last admin: err = %v, want ErrLastAdmin", err)
+	}
+
+	// 有其他管理员时可以降级和删除，删除时撤销用户的会话
+	newAdmin(t, "second-admin")
+	user, err := UpdateUserAccess(admin.ID, database.RoleOperator, "quectel1, quectel0", false)
+	if err != nil || user.Role != database.RoleOperator || user.DongleIDs != "quectel1,quectel0" {
+		t.Fatalf("demote: user = %+v, err = %v", user, err)
+	}
+	if err := DeleteUser(admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupSession(token); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("session of deleted user: err = %v", err)
+	}
+}
+
+func TestOIDCScopes(t *testing.T) {
+	for _, tc := range []struct {
+		scopes, groupsClaim string
+		want                []string
+	}{
+		{"", "", []string{"openid", "profile", "email"}},
+		{"", "roles", []string{"openid", "profile", "email", "groups"}},
+		{"groups, offline_access email", "", []string{"openid", "profile", "email", "groups", "offline_access"}},
+		{"roles", "roles", []string{"openid", "profile", "email", "roles"}},
+	} {
+		t.Setenv("LAZYCAT_AUTH_OIDC_SCOPES", tc.scopes)
+		t.Setenv("LAZYCAT_AUTH_OIDC_GROUPS_CLAIM", tc.groupsClaim)
+		if got := oidcScopes(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("scopes %q, groups claim %q: got %v, want %v", tc.scopes, tc.groupsClaim, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package balance
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// defaultExpiryLayouts 未配置日期格式时依次尝试的常见格式
+var defaultExpiryLayouts = []string{
+	"2006-01-02",
+	"02.01.2006",
+	"02/01/2006",
+	"2006/01/02",
+	"02-01-2006",
+	"2006.01.02",
+	"2006年01月02日",
+	"2006年1月2日",
+}
+
+// ParseResponse 按配置的正则从运营商回复中提取余额和有效期
+// 配置了 BalanceRegex 但未匹配时返回错误；有效期为可选项
+func ParseResponse(p *database.BalanceCheckProfile, raw string) (*float64, *time.Time, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil, fmt.Errorf("empty response")
+	}
+
+	var balance *float64
+	if p.BalanceRegex != "" {
+		text, err := extract(p.BalanceRegex, raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("balance: %w", err)
+		}
+		v, err := parseAmount(text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("balance: %w", err)
+		}
+		balance = &v
+	}
+
+	var expiry *time.Time
+	if p.ExpiryRegex != "" {
+		text, err := extract(p.ExpiryRegex, raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("expiry: %w", err)
+		}
+		t, err := parseExpiry(text, p.ExpiryLayout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("expiry: %w", err)
+		}
+		expiry = &t
+	}
+
+	if balance == nil && expiry == nil {
+		return nil, nil, fmt.Errorf("no balance or expiry regex configured")
+	}
+	return balance, expiry, nil
+}
+
+// extract 返回正则的第一个分组（没有分组时返回整个匹配）
+func extract(pattern, raw string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+	m := re.FindStringSubmatch(raw)
+	if m == nil {
+		return "", fmt.Errorf("regex %q did not match response", pattern)
+	}
+	if len(m) > 1 {
+		return strings.TrimSpace(m[1]), nil
+	}
+	return strings.TrimSpace(m[0]), nil
+}
+
+// parseAmount 解析金额，兼容 "1,234.56" 和 "12,50" 两种写法
+func parseAmount(s string) (float64, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	if strings.Contains(s, ",") {
+		if strings.Contains(s, ".") {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.ReplaceAll(s, ",", ".")
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return v, nil
+}
+
+// parseExpiry 解析有效期日期（按本地时区）
+func parseExpiry(s, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.ParseInLocation(layout, s, time.Local)
+	}
+	for _, l := range defaultExpiryLayouts {
+		if t, err := time.ParseInLocation(l, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
@@ -0,0 +1,93 @@
+package balance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+		err  bool
+	}{
+		{"12.34", 12.34, false},
+		{"1,234.56", 1234.56, false},
+		{"12,50", 12.5, false},
+		{"1 234.5", 1234.5, false},
+		{"-3.20", -3.2, false},
+		{"abc", 0, true},
+		{"", 0, true},
+	} {
+		got, err := parseAmount(tc.in)
+		if (err != nil) != tc.err || (!tc.err && got != tc.want) {
+			t.Fatalf("parseAmount(%q) = %v, %v; want %v, err %v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	want := time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		in, layout string
+	}{
+		{"2026-12-31", ""},
+		{"31.12.2026", ""},
+		{"2026年12月31日", ""},
+		{"2026年12月31日", "2006年1月2日"},
+		{"12/31/2026", "01/02/2006"},
+	} {
+		got, err := parseExpiry(tc.in, tc.layout)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("parseExpiry(%q, %q) = %v, %v; want %v", tc.in, tc.layout, got, err, want)
+		}
+	}
+	if _, err := parseExpiry("next year", ""); err == nil {
+		t.Fatal("unrecognized date accepted")
+	}
+	if _, err := parseExpiry("2026-12-31", "02.01.2006"); err == nil {
+		t.Fatal("date not matching the configured layout accepted")
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	profile := &database.BalanceCheckProfile{
+		BalanceRegex: `余额为?\s*([\d.,]+)\s*元`,
+		ExpiryRegex:  `有效期至(\d{4}-\d{2}-\d{2})`,
+	}
+
+	balance, expiry, err := ParseResponse(profile, "尊敬的客户，您的余额为 1,234.50 元，有效期至2026-12-31。")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance == nil || *balance != 1234.5 {
+		t.Fatalf("balance = %v", balance)
+	}
+	if expiry == nil || expiry.Format("2006-01-02") != "2026-12-31" {
+		t.Fatalf("expiry = %v", expiry)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		profile *database.BalanceCheckProfile
+		raw     string
+	}{
+		{"empty response", profile, "  "},
+		{"balance not matched", profile, "系统繁忙，请稍后再试"},
+		{"expiry not matched", profile, "您的余额为 5 元"},
+		{"invalid regex", &database.BalanceCheckProfile{BalanceRegex: `(`}, "余额 5 元"},
+		{"nothing configured", &database.BalanceCheckProfile{}, "余额 5 元"},
+	} {
+		if _, _, err := ParseResponse(tc.profile, tc.raw); err == nil {
+			t.Fatalf("%s: no error", tc.name)
+		}
+	}
+
+	// 只配置有效期
+	balance, expiry, err = ParseResponse(&database.BalanceCheckProfile{ExpiryRegex: `到期日 (\S+)`}, "套餐到期日 31.12.2026")
+	if err != nil || balance != nil || expiry == nil {
+		t.Fatalf("expiry only: balance %v, expiry %v, err %v", balance, expiry, err)
+	}
+}
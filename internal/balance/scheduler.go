@@ -0,0 +1,404 @@
+package balance
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/events"
+	"github.com/ety001/lzc-mobile/internal/sms"
+	"github.com/ety001/lzc-mobile/internal/ussd"
+)
+
+// 查询方式
+const (
+	MethodUSSD = "ussd" // 发送 USSD 代码（如 *100#）
+	MethodSMS  = "sms"  // 向短号码发送短信并等待回复
+)
+
+const (
+	// schedulerInterval 调度器检查到期配置的间隔
+	schedulerInterval = time.Minute
+	// smsReplyTimeout 等待查询短信回复的超时时间
+	smsReplyTimeout = 3 * time.Minute
+	// failureAlertThreshold 连续失败多少次后告警
+	failureAlertThreshold = 3
+)
+
+// ErrCheckInProgress 该配置正在查询中
+var ErrCheckInProgress = errors.New("balance check already in progress")
+
+// AlertFunc 告警回调（source 为设备 ID）
+type AlertFunc func(source, message string)
+
+// Scheduler 余额查询调度器（单例）
+type Scheduler struct {
+	mu      sync.Mutex
+	alertFn AlertFunc
+	running map[uint]bool // 正在查询的配置 ID
+	started bool
+	stop    chan struct{} // 关闭时通知循环退出
+	done    chan struct{} // 循环退出后关闭
+}
+
+var (
+	globalScheduler *Scheduler
+	schedulerOnce   sync.Once
+)
+
+// GetScheduler 获取全局余额查询调度器
+func GetScheduler() *Scheduler {
+	schedulerOnce.Do(func() {
+		globalScheduler = &Scheduler{
+			running: make(map[uint]bool),
+		}
+	})
+	return globalScheduler
+}
+
+// SetAlertFn 设置告警回调
+func (s *Scheduler) SetAlertFn(fn AlertFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alertFn = fn
+}
+
+// Start 启动定时查询（重复调用无效）
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop(s.stop, s.done)
+	log.Println("[Balance] Scheduler started")
+}
+
+// Stop 停止定时查询，等待正在执行的这一轮检查返回
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = false
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+
+	close(stop)
+	<-done
+}
+
+// loop 定时检查到期的查询配置
+func (s *Scheduler) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDue()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runDue 执行所有到期的查询；未到期的配置只重新评估有效期告警
+func (s *Scheduler) runDue() {
+	var profiles []database.BalanceCheckProfile
+	if err := database.DB.Where("enabled = ?", true).Find(&profiles).Error; err != nil {
+		log.Printf("[Balance] Failed to load profiles: %v", err)
+		return
+	}
+
+	for i := range profiles {
+		p := &profiles[i]
+		interval := time.Duration(p.IntervalHours) * time.Hour
+		if interval < time.Hour {
+			interval = time.Hour
+		}
+
+		if p.LastCheckAt == nil || time.Since(*p.LastCheckAt) >= interval {
+			if _, err := s.Check(p.ID); err != nil {
+				log.Printf("[Balance] Check for profile %d (%s) failed: %v", p.ID, p.DongleID, err)
+			}
+			continue
+		}
+
+		// 查询间隔可能长于告警提前量，到期提醒按天评估
+		if s.evaluateAlerts(p) {
+			s.saveAlertState(p)
+		}
+	}
+}
+
+// Check 立即执行一次查询，保存历史记录并评估告警
+// 查询失败时也会返回保存的记录（Success 为 false）
+func (s *Scheduler) Check(profileID uint) (*database.BalanceRecord, error) {
+	var p database.BalanceCheckProfile
+	if err := database.DB.First(&p, profileID).Error; err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.running[p.ID] {
+		s.mu.Unlock()
+		return nil, ErrCheckInProgress
+	}
+	s.running[p.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, p.ID)
+		s.mu.Unlock()
+	}()
+
+	log.Printf("[Balance] Checking profile %d (%s, method=%s)", p.ID, p.DongleID, p.Method)
+
+	raw, err := query(&p)
+	record := database.BalanceRecord{
+		ProfileID:   p.ID,
+		DongleID:    p.DongleID,
+		RawResponse: raw,
+	}
+
+	var balance *float64
+	var expiry *time.Time
+	if err == nil {
+		balance, expiry, err = ParseResponse(&p, raw)
+	}
+
+	now := time.Now()
+	p.LastCheckAt = &now
+	if err != nil {
+		record.Error = err.Error()
+		p.LastError = err.Error()
+		p.ConsecutiveFailures++
+	} else {
+		record.Success = true
+		record.Balance = balance
+		record.Expiry = expiry
+		p.LastBalance = balance
+		if expiry != nil {
+			p.LastExpiry = expiry
+		}
+		p.LastError = ""
+		p.ConsecutiveFailures = 0
+		log.Printf("[Balance] Profile %d (%s): balance=%s, expiry=%s", p.ID, p.DongleID, formatBalance(balance), formatExpiry(expiry))
+	}
+
+	if createErr := database.DB.Create(&record).Error; createErr != nil {
+		log.Printf("[Balance] Failed to save record for profile %d: %v", p.ID, createErr)
+	}
+
+	s.evaluateAlerts(&p)
+
+	// 只更新查询结果和告警状态，避免覆盖查询期间通过 API 修改的配置
+	if updateErr := database.DB.Model(&database.BalanceCheckProfile{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"last_check_at":        p.LastCheckAt,
+		"last_balance":         p.LastBalance,
+		"last_expiry":          p.LastExpiry,
+		"last_error":           p.LastError,
+		"consecutive_failures": p.ConsecutiveFailures,
+		"low_balance_alerted":  p.LowBalanceAlerted,
+		"expiry_alerted":       p.ExpiryAlerted,
+		"failure_alerted":      p.FailureAlerted,
+	}).Error; updateErr != nil {
+		log.Printf("[Balance] Failed to update profile %d: %v", p.ID, updateErr)
+	}
+
+	return &record, err
+}
+
+// query 按配置的方式发送查询，返回运营商的原始回复
+func query(p *database.BalanceCheckProfile) (string, error) {
+	switch p.Method {
+	case MethodUSSD:
+		return queryUSSD(p)
+	case MethodSMS:
+		return querySMS(p)
+	default:
+		return "", fmt.Errorf("unknown balance check method: %s", p.Method)
+	}
+}
+
+// queryUSSD 通过 USSD 查询
+func queryUSSD(p *database.BalanceCheckProfile) (string, error) {
+	svc := ussd.GetService()
+	_, resp, err := svc.Send(p.DongleID, p.USSDCode, ussd.DefaultResponseTimeout)
+	if err != nil {
+		return "", fmt.Errorf("USSD %s failed: %w", p.USSDCode, err)
+	}
+	if resp.WaitingInput() {
+		// 运营商返回了菜单，结束会话以免占用设备
+		if err := svc.Cancel(p.DongleID); err != nil {
+			log.Printf("[Balance] Failed to close USSD menu on %s: %v", p.DongleID, err)
+		}
+	}
+	return resp.Message, nil
+}
+
+// querySMS 向短号码发送查询短信并等待回复
+func querySMS(p *database.BalanceCheckProfile) (string, error) {
+	from := p.ReplyFrom
+	if from == "" {
+		from = p.SMSNumber
+	}
+
+	replyCh := make(chan string, 1)
+	remove := sms.AddInboundHook(func(msg database.SMSMessage) {
+		if msg.DongleID != p.DongleID || !numberMatches(msg.PhoneNumber, from) {
+			return
+		}
+		select {
+		case replyCh <- msg.Content:
+		default:
+		}
+	})
+	defer remove()
+
+	if err := ami.GetManager().SendSMS(p.DongleID, p.SMSNumber, p.SMSText); err != nil {
+		return "", fmt.Errorf("failed to send query SMS to %s: %w", p.SMSNumber, err)
+	}
+
+	// 与手动发送的短信一样保存到数据库
+	outbound := database.SMSMessage{
+		DongleID:    p.DongleID,
+		PhoneNumber: p.SMSNumber,
+		Content:     p.SMSText,
+		Direction:   "outbound",
+	}
+	if err := database.DB.Create(&outbound).Error; err != nil {
+		log.Printf("[Balance] Error saving query SMS to database: %v", err)
+	} else {
+		events.Publish(events.TopicSMS, "sent", outbound)
+	}
+
+	select {
+	case reply := <-replyCh:
+		return reply, nil
+	case <-time.After(smsReplyTimeout):
+		return "", fmt.Errorf("no reply from %s within %v", from, smsReplyTimeout)
+	}
+}
+
+// minSuffixMatchLen 按后缀比较号码时，配置号码的最小长度（更短的号码必须完全相同）
+const minSuffixMatchLen = 5
+
+// numberMatches 比较回复短信的发送号码和配置的号码（忽略 "+" 前缀）
+// 只允许发送号码多出国家码等前缀（如 8610086 匹配 10086），反过来不行，避免 "86" 这样的短号码误匹配
+func numberMatches(number, expected string) bool {
+	number = strings.TrimPrefix(number, "+")
+	expected = strings.TrimPrefix(expected, "+")
+	if number == "" || expected == "" {
+		return false
+	}
+	if number == expected {
+		return true
+	}
+	return len(expected) >= minSuffixMatchLen && strings.HasSuffix(number, expected)
+}
+
+// evaluateAlerts 根据最近的查询结果发送告警，返回告警状态是否变化
+// 每种告警只在进入异常状态时发送一次，恢复后重置
+func (s *Scheduler) evaluateAlerts(p *database.BalanceCheckProfile) bool {
+	changed := false
+	label := p.Name
+	if label == "" {
+		label = fmt.Sprintf("profile %d", p.ID)
+	}
+
+	// 连续查询失败
+	if p.ConsecutiveFailures >= failureAlertThreshold {
+		if !p.FailureAlerted {
+			s.alert(p.DongleID, fmt.Sprintf("Balance check %q failed %d times in a row: %s", label, p.ConsecutiveFailures, p.LastError))
+			p.FailureAlerted = true
+			changed = true
+		}
+	} else if p.FailureAlerted {
+		p.FailureAlerted = false
+		changed = true
+	}
+
+	// 低余额
+	if p.Threshold > 0 && p.LastBalance != nil {
+		if *p.LastBalance < p.Threshold {
+			if !p.LowBalanceAlerted {
+				s.alert(p.DongleID, fmt.Sprintf("Low balance (%s): %s is below threshold %s", label, formatBalance(p.LastBalance), formatBalance(&p.Threshold)))
+				p.LowBalanceAlerted = true
+				changed = true
+			}
+		} else if p.LowBalanceAlerted {
+			p.LowBalanceAlerted = false
+			changed = true
+		}
+	}
+
+	// 套餐/号码即将到期
+	if p.LastExpiry != nil && p.ExpiryWarnDays > 0 {
+		left := time.Until(*p.LastExpiry)
+		if left < time.Duration(p.ExpiryWarnDays)*24*time.Hour {
+			if !p.ExpiryAlerted {
+				msg := fmt.Sprintf("Plan %q expires on %s (%d day(s) left), top up to keep the number", label, formatExpiry(p.LastExpiry), int(left.Hours()/24))
+				if left <= 0 {
+					msg = fmt.Sprintf("Plan %q expired on %s, top up immediately to keep the number", label, formatExpiry(p.LastExpiry))
+				}
+				s.alert(p.DongleID, msg)
+				p.ExpiryAlerted = true
+				changed = true
+			}
+		} else if p.ExpiryAlerted {
+			p.ExpiryAlerted = false
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// saveAlertState 保存告警状态
+func (s *Scheduler) saveAlertState(p *database.BalanceCheckProfile) {
+	if err := database.DB.Model(&database.BalanceCheckProfile{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"low_balance_alerted": p.LowBalanceAlerted,
+		"expiry_alerted":      p.ExpiryAlerted,
+		"failure_alerted":     p.FailureAlerted,
+	}).Error; err != nil {
+		log.Printf("[Balance] Failed to save alert state for profile %d: %v", p.ID, err)
+	}
+}
+
+// alert 发送告警
+func (s *Scheduler) alert(source, message string) {
+	s.mu.Lock()
+	fn := s.alertFn
+	s.mu.Unlock()
+
+	log.Printf("[Balance] Alert for %s: %s", source, message)
+	if fn != nil {
+		fn(source, message)
+	}
+}
+
+func formatBalance(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *v)
+}
+
+func formatExpiry(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
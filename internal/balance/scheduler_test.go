@@ -0,0 +1,26 @@
+package balance
+
+import "testing"
+
+func TestNumberMatches(t *testing.T) {
+	for _, tc := range []struct {
+		number, expected string
+		want             bool
+	}{
+		{"10086", "10086", true},
+		{"+10086", "10086", true},
+		{"8610086", "10086", true},   // 发送号码带国家码
+		{"+8610086", "+10086", true}, // 两边都带 "+"
+		{"6", "10086", false},        // 短号码不能反向匹配
+		{"86", "10086", false},
+		{"0086", "86", false}, // 配置的号码太短，必须完全相同
+		{"86", "86", true},
+		{"10010", "10086", false},
+		{"", "10086", false},
+		{"10086", "", false},
+	} {
+		if got := numberMatches(tc.number, tc.expected); got != tc.want {
+			t.Fatalf("numberMatches(%q, %q) = %v, want %v", tc.number, tc.expected, got, tc.want)
+		}
+	}
+}
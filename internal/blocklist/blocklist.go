@@ -0,0 +1,166 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"gorm.io/gorm"
+)
+
+// 检查类型
+const (
+	KindCall = "call"
+	KindSMS  = "sms"
+)
+
+// anonymousNumbers 网络下发的隐藏号码标识（小写）
+var anonymousNumbers = map[string]bool{
+	"":            true,
+	"anonymous":   true,
+	"restricted":  true,
+	"private":     true,
+	"unknown":     true,
+	"unavailable": true,
+	"withheld":    true,
+}
+
+// Normalize 去掉号码中的空格、横线和括号
+func Normalize(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(number))
+}
+
+// IsAnonymous 判断主叫号码是否为隐藏号码
+func IsAnonymous(number string) bool {
+	return anonymousNumbers[strings.ToLower(Normalize(number))]
+}
+
+// Validate 校验条目的匹配方式、模式和处理方式
+func Validate(b *database.BlockedNumber) error {
+	if b.List == "" {
+		b.List = database.BlockListBlock
+	}
+	if b.List != database.BlockListBlock && b.List != database.BlockListAllow {
+		return fmt.Errorf("invalid list %q, expected block or allow", b.List)
+	}
+
+	switch b.MatchType {
+	case database.BlockMatchExact, database.BlockMatchPrefix:
+		b.Pattern = Normalize(b.Pattern)
+		if b.Pattern == "" {
+			return errors.New("pattern is required")
+		}
+	case database.BlockMatchRegex:
+		if _, err := regexp.Compile(b.Pattern); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case database.BlockMatchAnonymous:
+		b.Pattern = ""
+	default:
+		return fmt.Errorf("invalid match_type %q, expected exact, prefix, regex or anonymous", b.MatchType)
+	}
+
+	if b.List == database.BlockListAllow {
+		b.Action = ""
+		b.VoicemailBox = ""
+		return nil
+	}
+	if b.Action == "" {
+		b.Action = database.BlockActionReject
+	}
+	switch b.Action {
+	case database.BlockActionReject, database.BlockActionBusy, database.BlockActionDrop:
+		b.VoicemailBox = ""
+	case database.BlockActionVoicemail:
+		if b.VoicemailBox == "" {
+			return errors.New("voicemail_box is required for voicemail action")
+		}
+	default:
+		return fmt.Errorf("invalid action %q, expected reject, busy, voicemail or drop", b.Action)
+	}
+	return nil
+}
+
+// Matches 判断号码是否命中条目
+func Matches(b *database.BlockedNumber, number string) bool {
+	if b.MatchType == database.BlockMatchAnonymous {
+		return IsAnonymous(number)
+	}
+	n := Normalize(number)
+	if IsAnonymous(n) {
+		return false
+	}
+	switch b.MatchType {
+	case database.BlockMatchExact:
+		return n == b.Pattern
+	case database.BlockMatchPrefix:
+		return strings.HasPrefix(n, b.Pattern)
+	case database.BlockMatchRegex:
+		re, err := regexp.Compile(b.Pattern)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(n)
+	}
+	return false
+}
+
+// Check 检查来电或短信号码，返回命中的黑名单条目（未命中或命中白名单时返回 nil）
+// 命中的条目（包括白名单）会累加命中次数
+func Check(kind, device, number string) (*database.BlockedNumber, error) {
+	query := database.DB.Where("enabled = ?", true).Where("dongle_id = ? OR dongle_id = ''", device)
+	switch kind {
+	case KindCall:
+		query = query.Where("calls = ?", true)
+	case KindSMS:
+		query = query.Where("sms = ?", true)
+	default:
+		return nil, fmt.Errorf("invalid kind %q", kind)
+	}
+
+	var entries []database.BlockedNumber
+	if err := query.Order("id ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	var matched *database.BlockedNumber
+	for _, list := range []string{database.BlockListAllow, database.BlockListBlock} {
+		for i := range entries {
+			if entries[i].List == list && Matches(&entries[i], number) {
+				matched = &entries[i]
+				break
+			}
+		}
+		if matched != nil {
+			break
+		}
+	}
+	if matched == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(matched).Updates(map[string]interface{}{
+		"hits":        gorm.Expr("hits + 1"),
+		"last_hit_at": now,
+	}).Error; err != nil {
+		log.Printf("[Blocklist] Failed to update hit counter for entry %d: %v", matched.ID, err)
+	}
+
+	if matched.List == database.BlockListAllow {
+		return nil, nil
+	}
+	log.Printf("[Blocklist] %s from %s on %s blocked by entry %d (%s %s, action=%s)",
+		kind, number, device, matched.ID, matched.MatchType, matched.Pattern, matched.Action)
+	return matched, nil
+}
@@ -0,0 +1,556 @@
+package calls
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/events"
+)
+
+// 活动通话状态
+const (
+	ActiveRinging = "ringing" // 振铃中（还没有通道接听）
+	ActiveUp      = "up"      // 已接听但还未桥接（如正在播放提示音、语音信箱）
+	ActiveTalking = "talking" // 双方已桥接，通话中
+)
+
+// 活动通话方向
+const (
+	DirectionInbound  = "inbound"  // 由 dongle 来电发起
+	DirectionOutbound = "outbound" // 由分机发起，经 dongle 外呼
+	DirectionInternal = "internal" // 分机之间或未经过 dongle
+)
+
+// 转接方式
+const (
+	TransferBlind    = "blind"    // 盲转：直接把对方转到目标
+	TransferAttended = "attended" // 咨询转接：分机先和目标通话，挂机后完成转接
+)
+
+// 监听方式（ChanSpy）
+const (
+	SpyListen  = "listen"  // 只听
+	SpyWhisper = "whisper" // 只对分机说话，对方听不到
+	SpyBarge   = "barge"   // 三方通话
+)
+
+const (
+	// TransferContext 转接目标所在的 dialplan 上下文（分机互拨和外呼路由）
+	TransferContext = "default"
+	// resyncGrace CoreShowChannels 校正时的宽限时间，避免误删列表开始后才创建的通道
+	resyncGrace = 2 * time.Second
+)
+
+var (
+	// ErrActiveCallNotFound 活动通话不存在（可能已挂断）
+	ErrActiveCallNotFound = errors.New("active call not found")
+	// ErrChannelNotFound 指定的通道不属于该通话
+	ErrChannelNotFound = errors.New("channel not found in call")
+	// ErrAlreadyInCall 监听者的分机已在该通话中
+	ErrAlreadyInCall = errors.New("extension is already in this call")
+)
+
+// ActiveChannel 活动通道
+type ActiveChannel struct {
+	UniqueID     string     `json:"unique_id"`
+	Name         string     `json:"name"`                // 如 PJSIP/100-00000001、Quectel/quectel0-0100000001
+	Extension    string     `json:"extension,omitempty"` // PJSIP 通道的分机
+	DongleID     string     `json:"dongle_id,omitempty"` // Quectel 通道的 dongle
+	State        string     `json:"state"`               // Asterisk 通道状态（Down、Ring、Ringing、Up...）
+	CallerIDNum  string     `json:"caller_id_num"`
+	CallerIDName string     `json:"caller_id_name,omitempty"`
+	Dialed       string     `json:"dialed,omitempty"` // 被 Dial 呼出时拨打的号码
+	BridgeID     string     `json:"bridge_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	BridgedAt    *time.Time `json:"bridged_at,omitempty"`
+
+	linkedID string
+	exten    string // 主叫通道在 dialplan 中的 exten
+	lastSeen time.Time
+}
+
+// ActiveCall 活动通话（同一 Linkedid 的所有通道）
+type ActiveCall struct {
+	ID         string          `json:"id"` // Linkedid（主叫通道的 UNIQUEID）
+	Direction  string          `json:"direction"`
+	Caller     string          `json:"caller"`
+	Callee     string          `json:"callee"`
+	DongleID   string          `json:"dongle_id,omitempty"`
+	Extensions []string        `json:"extensions"`
+	State      string          `json:"state"`
+	StartedAt  time.Time       `json:"started_at"`
+	AnsweredAt *time.Time      `json:"answered_at,omitempty"`
+	Duration   int             `json:"duration"`  // 从开始到现在的秒数
+	TalkTime   int             `json:"talk_time"` // 从桥接到现在的秒数
+	Channels   []ActiveChannel `json:"channels"`
+}
+
+// Monitor 活动通话监控（单例）
+// 根据 AMI 通道事件维护当前通道列表，并用状态轮询时的 CoreShowChannels 结果校正（补上遗漏的通道、清除丢失 Hangup 的通道）
+type Monitor struct {
+	mu         sync.Mutex
+	channels   map[string]*ActiveChannel // UNIQUEID -> 通道
+	listStarts map[string]time.Time      // CoreShowChannels ActionID -> 第一条结果的时间
+}
+
+var (
+	globalMonitor *Monitor
+	monitorOnce   sync.Once
+)
+
+// GetMonitor 获取全局活动通话监控
+func GetMonitor() *Monitor {
+	monitorOnce.Do(func() {
+		globalMonitor = &Monitor{
+			channels:   make(map[string]*ActiveChannel),
+			listStarts: make(map[string]time.Time),
+		}
+	})
+	return globalMonitor
+}
+
+// Register 注册到 AMI manager，接收通话事件
+func (m *Monitor) Register() {
+	ami.GetManager().Subscribe(m)
+}
+
+// OnStatusUpdate 实现 ami.StatusSubscriber（活动通话监控不关心状态更新）
+func (m *Monitor) OnStatusUpdate(info *ami.StatusInfo) {}
+
+// OnSMSReceived 实现 ami.StatusSubscriber（短信由 sms.Handler 处理）
+func (m *Monitor) OnSMSReceived(device, number, message, timestamp string) {}
+
+// OnChannelEvent 根据通道事件更新活动通道，并发布通话开始/变化/结束事件
+func (m *Monitor) OnChannelEvent(ev ami.ChannelEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch ev.Event {
+	case "Newchannel":
+		if ev.UniqueID == "" {
+			return
+		}
+		ch := m.channels[ev.UniqueID]
+		if ch == nil {
+			ch = newActiveChannel(ev, ev.Time)
+			started := len(m.groupLocked(ch.linkedID)) == 0
+			m.channels[ev.UniqueID] = ch
+			if started {
+				m.publishLocked(ch.linkedID, "call_started", nil)
+			} else {
+				m.publishLocked(ch.linkedID, "call_updated", nil)
+			}
+		}
+		ch.lastSeen = ev.Time
+	case "CoreShowChannel":
+		if ev.UniqueID == "" {
+			return
+		}
+		if _, ok := m.listStarts[ev.ActionID]; !ok {
+			m.listStarts[ev.ActionID] = ev.Time
+		}
+		ch := m.channels[ev.UniqueID]
+		if ch == nil {
+			// 监控启动前已存在（或遗漏了 Newchannel）的通道，按 Duration 推算创建时间
+			ch = newActiveChannel(ev, ev.Time.Add(-parseDuration(ev.Duration)))
+			started := len(m.groupLocked(ch.linkedID)) == 0
+			m.channels[ev.UniqueID] = ch
+			if started {
+				defer m.publishLocked(ch.linkedID, "call_started", nil)
+			}
+		}
+		ch.State = ev.ChannelStateDesc
+		ch.CallerIDNum = ev.CallerIDNum
+		ch.CallerIDName = ev.CallerIDName
+		if ev.BridgeUniqueID != "" && ch.BridgeID == "" {
+			ch.BridgeID = ev.BridgeUniqueID
+			bridgedAt := ev.Time
+			ch.BridgedAt = &bridgedAt
+		}
+		ch.lastSeen = ev.Time
+	case "CoreShowChannelsComplete":
+		start, ok := m.listStarts[ev.ActionID]
+		if !ok {
+			start = ev.Time
+		}
+		delete(m.listStarts, ev.ActionID)
+		cutoff := start.Add(-resyncGrace)
+		for id, ch := range m.channels {
+			if ch.lastSeen.Before(cutoff) {
+				m.removeLocked(id)
+			}
+		}
+	case "Newstate":
+		if ch := m.channels[ev.UniqueID]; ch != nil {
+			ch.State = ev.ChannelStateDesc
+			ch.CallerIDNum = ev.CallerIDNum
+			ch.CallerIDName = ev.CallerIDName
+			ch.lastSeen = ev.Time
+			m.publishLocked(ch.linkedID, "call_updated", nil)
+		}
+	case "DialBegin":
+		if ch := m.channels[ev.DestUniqueID]; ch != nil {
+			// 拨号串为 <资源>/<号码>，取号码部分
+			if i := strings.LastIndex(ev.DialString, "/"); i >= 0 {
+				ch.Dialed = ev.DialString[i+1:]
+			} else {
+				ch.Dialed = ev.DialString
+			}
+			m.publishLocked(ch.linkedID, "call_updated", nil)
+		}
+	case "BridgeEnter":
+		if ch := m.channels[ev.UniqueID]; ch != nil {
+			ch.BridgeID = ev.BridgeUniqueID
+			if ch.BridgedAt == nil {
+				bridgedAt := ev.Time
+				ch.BridgedAt = &bridgedAt
+			}
+			ch.lastSeen = ev.Time
+			m.publishLocked(ch.linkedID, "call_updated", nil)
+		}
+	case "BridgeLeave":
+		if ch := m.channels[ev.UniqueID]; ch != nil {
+			ch.BridgeID = ""
+			ch.lastSeen = ev.Time
+		}
+	case "Hangup":
+		m.removeLocked(ev.UniqueID)
+	}
+}
+
+// groupLocked 返回同一通话（Linkedid）的所有通道
+func (m *Monitor) groupLocked(linkedID string) []*ActiveChannel {
+	var channels []*ActiveChannel
+	for _, ch := range m.channels {
+		if ch.linkedID == linkedID {
+			channels = append(channels, ch)
+		}
+	}
+	return channels
+}
+
+// removeLocked 删除通道；通话的最后一个通道删除后发布 call_ended
+func (m *Monitor) removeLocked(uniqueID string) {
+	ch := m.channels[uniqueID]
+	if ch == nil {
+		return
+	}
+	delete(m.channels, uniqueID)
+	if len(m.groupLocked(ch.linkedID)) == 0 {
+		m.publishLocked(ch.linkedID, "call_ended", []*ActiveChannel{ch})
+	} else {
+		m.publishLocked(ch.linkedID, "call_updated", nil)
+	}
+}
+
+// publishLocked 发布通话事件；channels 为空时使用当前通道
+func (m *Monitor) publishLocked(linkedID, eventType string, channels []*ActiveChannel) {
+	if channels == nil {
+		channels = m.groupLocked(linkedID)
+	}
+	if len(channels) == 0 {
+		return
+	}
+	events.Publish(events.TopicCall, eventType, buildActiveCall(linkedID, channels, time.Now()))
+}
+
+// newActiveChannel 根据事件创建通道
+func newActiveChannel(ev ami.ChannelEvent, createdAt time.Time) *ActiveChannel {
+	ch := &ActiveChannel{
+		UniqueID:     ev.UniqueID,
+		Name:         ev.Channel,
+		State:        ev.ChannelStateDesc,
+		CallerIDNum:  ev.CallerIDNum,
+		CallerIDName: ev.CallerIDName,
+		CreatedAt:    createdAt,
+		linkedID:     ev.LinkedID,
+		exten:        ev.Exten,
+	}
+	if ch.linkedID == "" {
+		ch.linkedID = ev.UniqueID
+	}
+	tech, resource := parseChannelName(ev.Channel)
+	switch strings.ToLower(tech) {
+	case "pjsip":
+		ch.Extension = resource
+	case "quectel":
+		ch.DongleID = resource
+	}
+	return ch
+}
+
+// parseChannelName 解析通道名（<技术>/<资源>-<序号>），返回技术和资源
+func parseChannelName(name string) (tech, resource string) {
+	tech, rest, ok := strings.Cut(name, "/")
+	if !ok {
+		return "", ""
+	}
+	if i := strings.LastIndex(rest, "-"); i > 0 {
+		rest = rest[:i]
+	}
+	return tech, rest
+}
+
+// parseDuration 解析 CoreShowChannel 的 HH:MM:SS 时长
+func parseDuration(value string) time.Duration {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	var seconds int
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// List 列出当前所有活动通话（按开始时间排序）
+func (m *Monitor) List() []ActiveCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := make(map[string][]*ActiveChannel)
+	for _, ch := range m.channels {
+		groups[ch.linkedID] = append(groups[ch.linkedID], ch)
+	}
+
+	now := time.Now()
+	calls := make([]ActiveCall, 0, len(groups))
+	for id, channels := range groups {
+		calls = append(calls, buildActiveCall(id, channels, now))
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].StartedAt.Before(calls[j].StartedAt)
+	})
+	return calls
+}
+
+// Get 获取单个活动通话
+func (m *Monitor) Get(id string) (*ActiveCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	channels := m.groupLocked(id)
+	if len(channels) == 0 {
+		return nil, ErrActiveCallNotFound
+	}
+	call := buildActiveCall(id, channels, time.Now())
+	return &call, nil
+}
+
+// buildActiveCall 将同一 Linkedid 的通道汇总为通话
+func buildActiveCall(id string, channels []*ActiveChannel, now time.Time) ActiveCall {
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].UniqueID == id {
+			return true
+		}
+		if channels[j].UniqueID == id {
+			return false
+		}
+		return channels[i].CreatedAt.Before(channels[j].CreatedAt)
+	})
+
+	call := ActiveCall{
+		ID:         id,
+		State:      ActiveRinging,
+		StartedAt:  channels[0].CreatedAt,
+		Extensions: []string{},
+		Channels:   make([]ActiveChannel, 0, len(channels)),
+	}
+	for _, ch := range channels {
+		call.Channels = append(call.Channels, *ch)
+		if ch.CreatedAt.Before(call.StartedAt) {
+			call.StartedAt = ch.CreatedAt
+		}
+		if ch.Extension != "" {
+			call.Extensions = append(call.Extensions, ch.Extension)
+		}
+		if ch.DongleID != "" && call.DongleID == "" {
+			call.DongleID = ch.DongleID
+		}
+		if ch.State == "Up" && call.State == ActiveRinging {
+			call.State = ActiveUp
+		}
+		if ch.BridgedAt != nil && ch.BridgeID != "" {
+			call.State = ActiveTalking
+			if call.AnsweredAt == nil || ch.BridgedAt.Before(*call.AnsweredAt) {
+				bridgedAt := *ch.BridgedAt
+				call.AnsweredAt = &bridgedAt
+			}
+		}
+	}
+
+	// 主叫通道（UNIQUEID 等于 Linkedid）决定方向和主叫；主叫通道已挂断时用最早的通道
+	origin := channels[0]
+	switch {
+	case origin.DongleID != "":
+		call.Direction = DirectionInbound
+		call.Caller = origin.CallerIDNum
+		for _, ch := range channels[1:] {
+			if ch.Extension != "" {
+				call.Callee = ch.Extension
+				if ch.BridgeID != "" {
+					break
+				}
+			}
+		}
+	case call.DongleID != "":
+		call.Direction = DirectionOutbound
+		call.Caller = origin.Extension
+		for _, ch := range channels[1:] {
+			if ch.DongleID != "" {
+				call.Callee = ch.Dialed
+				break
+			}
+		}
+	default:
+		call.Direction = DirectionInternal
+		call.Caller = origin.CallerIDNum
+		if call.Caller == "" {
+			call.Caller = origin.Extension
+		}
+		for _, ch := range channels[1:] {
+			if ch.Extension != "" {
+				call.Callee = ch.Extension
+				break
+			}
+		}
+	}
+	if call.Callee == "" {
+		// 还没有拨出（如正在播放提示音），用主叫通道的 exten
+		call.Callee = origin.exten
+	}
+
+	call.Duration = int(now.Sub(call.StartedAt).Seconds())
+	if call.AnsweredAt != nil {
+		call.TalkTime = int(now.Sub(*call.AnsweredAt).Seconds())
+	}
+	return call
+}
+
+// Hangup 挂断通话；channel 为空时挂断通话的所有通道
+func (m *Monitor) Hangup(id, channel string) error {
+	call, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	var targets []string
+	for _, ch := range call.Channels {
+		if channel == "" || ch.Name == channel {
+			targets = append(targets, ch.Name)
+		}
+	}
+	if len(targets) == 0 {
+		return ErrChannelNotFound
+	}
+
+	var errs []error
+	for _, name := range targets {
+		if err := ami.GetManager().Hangup(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Transfer 转接通话到 target（分机或外部号码，在 default 上下文中拨打）
+// 盲转时把对方（channel 为空时为 dongle 通道，否则为主叫通道）转走，分机随之挂断；
+// 咨询转接时由分机通道（channel 为空时为第一个已桥接的分机通道）发起 Atxfer
+func (m *Monitor) Transfer(id, mode, target, channel string) error {
+	call, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	var chosen *ActiveChannel
+	switch mode {
+	case TransferBlind:
+		chosen = pickChannel(call, channel, func(ch *ActiveChannel) bool { return ch.DongleID != "" })
+		if chosen == nil && channel == "" {
+			chosen = &call.Channels[0]
+		}
+	case TransferAttended:
+		chosen = pickChannel(call, channel, func(ch *ActiveChannel) bool {
+			return ch.Extension != "" && ch.BridgeID != ""
+		})
+	default:
+		return fmt.Errorf("invalid transfer mode %q, expected blind or attended", mode)
+	}
+	if chosen == nil {
+		return ErrChannelNotFound
+	}
+
+	if mode == TransferAttended {
+		return ami.GetManager().Atxfer(chosen.Name, TransferContext, target)
+	}
+	return ami.GetManager().Redirect(chosen.Name, "", TransferContext, target)
+}
+
+// pickChannel 选择操作的通道：指定 channel 时按名称查找，否则取第一个满足条件的通道
+func pickChannel(call *ActiveCall, channel string, match func(ch *ActiveChannel) bool) *ActiveChannel {
+	for i := range call.Channels {
+		ch := &call.Channels[i]
+		if channel != "" {
+			if ch.Name == channel {
+				return ch
+			}
+			continue
+		}
+		if match(ch) {
+			return ch
+		}
+	}
+	return nil
+}
+
+// Spy 让 extension 监听通话（ChanSpy），mode 为 listen、whisper 或 barge
+// 默认监听通话中的分机通道（能同时听到双方），没有分机通道时监听主叫通道
+func (m *Monitor) Spy(id, extension, mode, channel string) error {
+	call, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	options := "qE"
+	switch mode {
+	case "", SpyListen:
+	case SpyWhisper:
+		options += "w"
+	case SpyBarge:
+		options += "B"
+	default:
+		return fmt.Errorf("invalid spy mode %q, expected listen, whisper or barge", mode)
+	}
+
+	target := pickChannel(call, channel, func(ch *ActiveChannel) bool { return ch.Extension != "" })
+	if target == nil && channel == "" {
+		target = &call.Channels[0]
+	}
+	if target == nil {
+		return ErrChannelNotFound
+	}
+	for _, ext := range call.Extensions {
+		if ext == extension {
+			return ErrAlreadyInCall
+		}
+	}
+
+	return ami.GetManager().Originate(ami.OriginateRequest{
+		Channel:  "PJSIP/" + extension,
+		App:      "ChanSpy",
+		AppData:  target.Name + "," + options,
+		CallerID: fmt.Sprintf("\"Spy %s\" <%s>", call.Caller, call.Caller),
+		Timeout:  30 * time.Second,
+	})
+}
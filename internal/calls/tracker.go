@@ -0,0 +1,361 @@
+package calls
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/events"
+)
+
+// 点击拨号的状态
+const (
+	StateOriginating       = "originating"        // 已提交 Originate，等待分机振铃
+	StateRingingExtension  = "ringing_extension"  // 分机振铃中
+	StateExtensionAnswered = "extension_answered" // 分机已接听，准备外呼
+	StateDialing           = "dialing"            // 正在通过 dongle 拨打外部号码
+	StateAnswered          = "answered"           // 对方已接听，通话中
+	StateCompleted         = "completed"          // 通话正常结束
+	StateFailed            = "failed"             // 分机未接听、对方忙/未接或呼叫失败
+)
+
+const (
+	// ClickToCallContext 分机接听后进入的 dialplan 上下文
+	ClickToCallContext = "click-to-call"
+	// DongleVariable 传递外呼 dongle 的通道变量
+	DongleVariable = "CLICK_DONGLE"
+	// endedRetention 已结束的呼叫保留多久（供客户端查询最终状态）
+	endedRetention = 10 * time.Minute
+	// subscriberBuffer 每个进度订阅者的缓冲大小
+	subscriberBuffer = 16
+)
+
+// ErrNotFound 呼叫不存在或已过期
+var ErrNotFound = errors.New("call not found")
+
+// Event 呼叫进度事件
+type Event struct {
+	State   string    `json:"state"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Call 一次点击拨号
+type Call struct {
+	ID         string     `json:"id"`
+	Extension  string     `json:"extension"`
+	DongleID   string     `json:"dongle_id"`
+	Number     string     `json:"number"`
+	State      string     `json:"state"`
+	Reason     string     `json:"reason,omitempty"` // 失败原因
+	Events     []Event    `json:"events"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+
+	dialChannel string // dongle 外呼通道
+	subscribers []chan Event
+}
+
+// Ended 呼叫是否已结束
+func (c *Call) Ended() bool {
+	return c.State == StateCompleted || c.State == StateFailed
+}
+
+// snapshot 复制呼叫信息（不含内部字段）
+func (c *Call) snapshot() *Call {
+	return &Call{
+		ID:         c.ID,
+		Extension:  c.Extension,
+		DongleID:   c.DongleID,
+		Number:     c.Number,
+		State:      c.State,
+		Reason:     c.Reason,
+		Events:     append([]Event(nil), c.Events...),
+		CreatedAt:  c.CreatedAt,
+		AnsweredAt: c.AnsweredAt,
+		EndedAt:    c.EndedAt,
+	}
+}
+
+// Tracker 点击拨号呼叫跟踪（单例）
+// 通过 Originate 的 ChannelId 指定分机通道的 UNIQUEID，后续 AMI 事件按 Uniqueid/Linkedid/ActionID 关联到呼叫
+type Tracker struct {
+	mu    sync.Mutex
+	calls map[string]*Call
+}
+
+var (
+	globalTracker *Tracker
+	trackerOnce   sync.Once
+)
+
+// GetTracker 获取全局呼叫跟踪器
+func GetTracker() *Tracker {
+	trackerOnce.Do(func() {
+		globalTracker = &Tracker{
+			calls: make(map[string]*Call),
+		}
+	})
+	return globalTracker
+}
+
+// Register 注册到 AMI manager，接收通话事件
+func (t *Tracker) Register() {
+	ami.GetManager().Subscribe(t)
+}
+
+// OnStatusUpdate 实现 ami.StatusSubscriber（呼叫跟踪不关心状态更新）
+func (t *Tracker) OnStatusUpdate(info *ami.StatusInfo) {}
+
+// OnSMSReceived 实现 ami.StatusSubscriber（短信由 sms.Handler 处理）
+func (t *Tracker) OnSMSReceived(device, number, message, timestamp string) {}
+
+// newCallID 生成呼叫 ID（同时作为分机通道的 UNIQUEID）
+func newCallID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "c2c-" + hex.EncodeToString(b), nil
+}
+
+// Originate 先呼叫分机，分机接听后通过 dongle 拨打外部号码
+func (t *Tracker) Originate(extension, dongleID, number string, ringTimeout time.Duration) (*Call, error) {
+	id, err := newCallID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	call := &Call{
+		ID:        id,
+		Extension: extension,
+		DongleID:  dongleID,
+		Number:    number,
+		State:     StateOriginating,
+		Events:    []Event{{State: StateOriginating, Time: now}},
+		CreatedAt: now,
+	}
+
+	// 先登记再发送，避免事件早于登记到达
+	t.mu.Lock()
+	t.pruneLocked()
+	t.calls[id] = call
+	t.mu.Unlock()
+
+	err = ami.GetManager().Originate(ami.OriginateRequest{
+		Channel:   "PJSIP/" + extension,
+		Context:   ClickToCallContext,
+		Exten:     number,
+		ChannelID: id,
+		// 分机来电显示为要拨打的号码
+		CallerID:  "\"" + number + "\" <" + number + ">",
+		Timeout:   ringTimeout,
+		Variables: map[string]string{DongleVariable: dongleID},
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.setStateLocked(call, StateFailed, err.Error())
+		return call.snapshot(), err
+	}
+	log.Printf("[Call] Click-to-call %s: extension %s -> %s via %s", id, extension, number, dongleID)
+	return call.snapshot(), nil
+}
+
+// Get 获取呼叫当前状态
+func (t *Tracker) Get(id string) (*Call, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call, ok := t.calls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return call.snapshot(), nil
+}
+
+// Subscribe 订阅呼叫进度，返回当前状态和事件通道；呼叫结束后通道关闭
+func (t *Tracker) Subscribe(id string) (*Call, <-chan Event, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call, ok := t.calls[id]
+	if !ok {
+		return nil, nil, nil, ErrNotFound
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	if call.Ended() {
+		close(ch)
+		return call.snapshot(), ch, func() {}, nil
+	}
+	call.subscribers = append(call.subscribers, ch)
+
+	cancel := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for i, sub := range call.subscribers {
+			if sub == ch {
+				call.subscribers = append(call.subscribers[:i], call.subscribers[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+	}
+	return call.snapshot(), ch, cancel, nil
+}
+
+// OnChannelEvent 处理 AMI 通话事件，更新对应呼叫的状态
+func (t *Tracker) OnChannelEvent(ev ami.ChannelEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	call := t.findLocked(ev)
+	if call == nil || call.Ended() {
+		return
+	}
+
+	// 分机通道：UNIQUEID 即呼叫 ID
+	isExtension := ev.UniqueID == call.ID
+
+	switch ev.Event {
+	case "Newstate":
+		if isExtension {
+			switch ev.ChannelStateDesc {
+			case "Ringing":
+				t.setStateLocked(call, StateRingingExtension, "")
+			case "Up":
+				t.setStateLocked(call, StateExtensionAnswered, "")
+			}
+		}
+	case "OriginateResponse":
+		// 失败时分机通道不会进入 dialplan（分机未接听、忙或不在线）
+		if ev.Response != "Success" {
+			t.setStateLocked(call, StateFailed, originateFailureReason(ev.Reason))
+		} else if call.State == StateOriginating || call.State == StateRingingExtension {
+			t.setStateLocked(call, StateExtensionAnswered, "")
+		}
+	case "DialBegin":
+		if isExtension {
+			call.dialChannel = ev.DestChannel
+			t.setStateLocked(call, StateDialing, "")
+		}
+	case "DialEnd":
+		if isExtension {
+			if ev.DialStatus == "ANSWER" {
+				now := time.Now()
+				call.AnsweredAt = &now
+				t.setStateLocked(call, StateAnswered, "")
+			} else {
+				t.setStateLocked(call, StateFailed, dialFailureReason(ev.DialStatus))
+			}
+		}
+	case "Hangup":
+		// 任一方挂机即视为结束（外呼通道挂机后分机通道随后也会挂机）
+		if !isExtension && ev.Channel != call.dialChannel {
+			return
+		}
+		if call.State == StateAnswered {
+			t.setStateLocked(call, StateCompleted, ev.CauseTxt)
+		} else {
+			reason := ev.CauseTxt
+			if reason == "" {
+				reason = "hangup"
+			}
+			t.setStateLocked(call, StateFailed, reason)
+		}
+	}
+}
+
+// findLocked 按 Uniqueid、Linkedid 或 ActionID（均为呼叫 ID）查找呼叫
+func (t *Tracker) findLocked(ev ami.ChannelEvent) *Call {
+	for _, id := range []string{ev.UniqueID, ev.LinkedID, ev.ActionID} {
+		if call, ok := t.calls[id]; ok && id != "" {
+			return call
+		}
+	}
+	return nil
+}
+
+// setStateLocked 更新状态并通知订阅者（状态未变化时忽略）
+func (t *Tracker) setStateLocked(call *Call, state, message string) {
+	if call.State == state {
+		return
+	}
+	call.State = state
+	if state == StateFailed {
+		call.Reason = message
+	}
+
+	event := Event{State: state, Message: message, Time: time.Now()}
+	call.Events = append(call.Events, event)
+	for _, ch := range call.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// 订阅者处理太慢时丢弃中间事件，最终状态可通过 Get 查询
+		}
+	}
+
+	if call.Ended() {
+		now := time.Now()
+		call.EndedAt = &now
+	}
+	events.Publish(events.TopicCall, "click_to_call", call.snapshot())
+
+	if call.Ended() {
+		for _, ch := range call.subscribers {
+			close(ch)
+		}
+		call.subscribers = nil
+		log.Printf("[Call] Click-to-call %s ended: %s %s", call.ID, state, message)
+	}
+}
+
+// pruneLocked 删除结束超过保留时间的呼叫
+func (t *Tracker) pruneLocked() {
+	cutoff := time.Now().Add(-endedRetention)
+	for id, call := range t.calls {
+		if call.EndedAt != nil && call.EndedAt.Before(cutoff) {
+			delete(t.calls, id)
+		}
+	}
+}
+
+// originateFailureReason 将 OriginateResponse 的 Reason 转为说明
+func originateFailureReason(reason string) string {
+	switch reason {
+	case "0":
+		return "extension unavailable"
+	case "1":
+		return "extension hung up"
+	case "3":
+		return "extension did not answer"
+	case "5":
+		return "extension busy"
+	case "8":
+		return "extension congested or offline"
+	}
+	return "originate failed (reason " + reason + ")"
+}
+
+// dialFailureReason 将 DialEnd 的 DialStatus 转为说明
+func dialFailureReason(status string) string {
+	switch status {
+	case "BUSY":
+		return "number busy"
+	case "NOANSWER":
+		return "number did not answer"
+	case "CANCEL":
+		return "cancelled by extension"
+	case "CONGESTION", "CHANUNAVAIL":
+		return "dongle unavailable or network congestion"
+	}
+	return strings.ToLower(status)
+}
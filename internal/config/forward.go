@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// CallForwardData 某个 dongle 的呼叫转移规则（渲染为 [call-forward] 中的一个 exten）
+type CallForwardData struct {
+	DongleID string
+	Rules    []ForwardRuleData
+}
+
+// ForwardRuleData 呼叫转移规则模板数据
+type ForwardRuleData struct {
+	ID            uint
+	Label         string // 执行转移的 exten（fwd-<ID>）
+	Mode          string
+	Statuses      []string // busy/noanswer 对应的 DIALSTATUS
+	Number        string
+	Via           string
+	Timeout       int
+	CallerIDMode  string
+	TimeCondLabel string // 时间条件子程序（为空表示始终生效）
+	ActiveWhen    string // TC_RESULT 为该值时规则生效
+}
+
+// forwardStatuses 转移类型对应的本地振铃结果
+var forwardStatuses = map[string][]string{
+	database.ForwardBusy:     {"BUSY", "CHANUNAVAIL", "CONGESTION"},
+	database.ForwardNoAnswer: {"NOANSWER"},
+}
+
+// loadCallForwards 加载启用的呼叫转移规则，按来电 dongle 分组
+// 来电或呼出 dongle 不存在、被禁用，或时间条件不存在的规则不生成
+func loadCallForwards(dongles []database.Dongle, timeConditions map[uint]string) ([]CallForwardData, error) {
+	var forwards []database.CallForward
+	if err := database.DB.Where("enabled = ?", true).Order("dongle_id ASC, id ASC").Find(&forwards).Error; err != nil {
+		return nil, fmt.Errorf("failed to load call forwards: %w", err)
+	}
+
+	enabled := make(map[string]bool, len(dongles))
+	for _, d := range dongles {
+		enabled[d.DeviceID] = !d.Disable
+	}
+
+	var result []CallForwardData
+	index := make(map[string]int)
+	for _, f := range forwards {
+		via := f.ViaDongleID
+		if via == "" {
+			via = f.DongleID
+		}
+		if !enabled[f.DongleID] || !enabled[via] {
+			continue
+		}
+
+		rule := ForwardRuleData{
+			ID:           f.ID,
+			Label:        fmt.Sprintf("fwd-%d", f.ID),
+			Mode:         f.Mode,
+			Statuses:     forwardStatuses[f.Mode],
+			Number:       f.Number,
+			Via:          via,
+			Timeout:      f.Timeout,
+			CallerIDMode: f.CallerIDMode,
+			ActiveWhen:   f.ActiveWhen,
+		}
+		if rule.Timeout <= 0 {
+			rule.Timeout = 60
+		}
+		if rule.ActiveWhen != "closed" {
+			rule.ActiveWhen = "open"
+		}
+		if f.Mode != database.ForwardUnconditional && len(rule.Statuses) == 0 {
+			continue
+		}
+		if f.TimeConditionID != nil {
+			label, ok := timeConditions[*f.TimeConditionID]
+			if !ok {
+				continue
+			}
+			rule.TimeCondLabel = label
+		}
+
+		i, ok := index[f.DongleID]
+		if !ok {
+			i = len(result)
+			index[f.DongleID] = i
+			result = append(result, CallForwardData{DongleID: f.DongleID})
+		}
+		result[i].Rules = append(result[i].Rules, rule)
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"gorm.io/gorm"
+)
+
+// InboundRouteData 来电路由模板数据
+type InboundRouteData struct {
+	DongleID     string
+	Strategy     string
+	RingTimeout  int
+	Members      []InboundMemberData   // 按配置顺序
+	Rotations    [][]InboundMemberData // 顺序振铃的起点轮换（sequential 只有一种，roundrobin/random 每个成员一种）
+	FinalType    string
+	FinalDial    string // 转分机/外部号码的 Dial 目标
+	FinalTarget  string // 语音信箱号
+	FinalTimeout int
+
+	TimeConditionLabel string // 工作时间条件子程序（为空表示不区分时间）
+	OffHoursType       string
+	OffHoursDial       string
+	OffHoursTarget     string
+}
+
+// InboundMemberData 来电路由成员模板数据
+type InboundMemberData struct {
+	Username string
+	Timeout  int
+}
+
+// loadInboundRoutes 加载启用的来电路由
+// 没有可用成员且最终去向为挂断的路由不生成（回退到 inbound 绑定）
+// timeConditions 为时间条件 ID 到子程序标签的映射，引用不存在的条件时视为全天工作时间
+func loadInboundRoutes(dongles []database.Dongle, timeConditions map[uint]string) ([]InboundRouteData, error) {
+	var routes []database.InboundRoute
+	if err := database.DB.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Preload("Members.Extension").Where("enabled = ?", true).Order("dongle_id ASC").Find(&routes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load inbound routes: %w", err)
+	}
+
+	enabled := make(map[string]bool, len(dongles))
+	for _, d := range dongles {
+		enabled[d.DeviceID] = !d.Disable
+	}
+
+	var result []InboundRouteData
+	for _, route := range routes {
+		// 设备不存在或已禁用
+		if !enabled[route.DongleID] {
+			continue
+		}
+
+		sort.SliceStable(route.Members, func(i, j int) bool { return route.Members[i].Position < route.Members[j].Position })
+		var members []InboundMemberData
+		for _, m := range route.Members {
+			if m.Extension.Username == "" {
+				continue
+			}
+			timeout := m.Timeout
+			if timeout <= 0 {
+				timeout = 20
+			}
+			members = append(members, InboundMemberData{Username: m.Extension.Username, Timeout: timeout})
+		}
+
+		data := InboundRouteData{
+			DongleID:     route.DongleID,
+			Strategy:     route.Strategy,
+			RingTimeout:  route.RingTimeout,
+			Members:      members,
+			FinalType:    route.FinalType,
+			FinalTarget:  route.FinalTarget,
+			FinalTimeout: route.FinalTimeout,
+		}
+		if data.RingTimeout <= 0 {
+			data.RingTimeout = 30
+		}
+		if data.FinalTimeout <= 0 {
+			data.FinalTimeout = 30
+		}
+
+		data.FinalType, data.FinalDial = resolveDestination(route.FinalType, route.FinalTarget, route.FinalDongleID, enabled)
+
+		if route.TimeConditionID != nil {
+			if label, ok := timeConditions[*route.TimeConditionID]; ok {
+				data.TimeConditionLabel = label
+				data.OffHoursTarget = route.OffHoursTarget
+				data.OffHoursType, data.OffHoursDial = resolveDestination(route.OffHoursType, route.OffHoursTarget, route.OffHoursDongleID, enabled)
+			}
+		}
+
+		if len(members) == 0 && data.FinalType == database.FinalDestHangup &&
+			(data.TimeConditionLabel == "" || data.OffHoursType == database.FinalDestHangup) {
+			continue
+		}
+
+		// 没有成员时直接转到最终去向
+		if len(members) == 0 {
+			data.Strategy = database.RingStrategyRingAll
+		}
+
+		switch data.Strategy {
+		case database.RingStrategyRoundRobin, database.RingStrategyRandom:
+			for start := range members {
+				rotation := append(append([]InboundMemberData{}, members[start:]...), members[:start]...)
+				data.Rotations = append(data.Rotations, rotation)
+			}
+		case database.RingStrategySequential:
+			data.Rotations = [][]InboundMemberData{members}
+		default:
+			data.Strategy = database.RingStrategyRingAll
+		}
+
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+// resolveDestination 解析最终去向，返回实际去向类型和 Dial 目标
+// 转外部号码使用的 dongle 不存在或被禁用时改为挂断
+func resolveDestination(kind, target, dongleID string, enabled map[string]bool) (string, string) {
+	switch kind {
+	case database.FinalDestExtension:
+		return kind, "PJSIP/" + target
+	case database.FinalDestExternal:
+		if !enabled[dongleID] {
+			return database.FinalDestHangup, ""
+		}
+		return kind, fmt.Sprintf("Quectel/%s/%s", dongleID, target)
+	case database.FinalDestVoicemail:
+		return kind, ""
+	default:
+		return database.FinalDestHangup, ""
+	}
+}
+
+// LastRotation 最后一个起点的下标（random 策略用于 RAND 上限）
+func (r InboundRouteData) LastRotation() int {
+	return len(r.Rotations) - 1
+}
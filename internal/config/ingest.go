@@ -0,0 +1,58 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// IngestHeader dialplan 回调内部接口时携带共享密钥的请求头
+const IngestHeader = "X-Ingest-Token"
+
+// IngestAddr 内部回调接口的监听地址，只监听本机回环地址（端口可通过 INGEST_PORT 修改，默认 8072）
+func IngestAddr() string {
+	port := os.Getenv("INGEST_PORT")
+	if port == "" {
+		port = "8072"
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// ingestSecret 缓存的共享密钥（生成后不再变化）
+var ingestSecret struct {
+	sync.Mutex
+	value string
+}
+
+// IngestSecret 获取 dialplan 回调内部接口的共享密钥
+// 还没有时（首次渲染配置）生成随机密钥并保存到数据库，webpanel 重启后 Asterisk 中已加载的拨号计划仍然有效
+func IngestSecret() (string, error) {
+	ingestSecret.Lock()
+	defer ingestSecret.Unlock()
+	if ingestSecret.value != "" {
+		return ingestSecret.value, nil
+	}
+
+	var globalConfig database.GlobalConfig
+	if err := database.DB.FirstOrCreate(&globalConfig, database.GlobalConfig{ID: 1}).Error; err != nil {
+		return "", fmt.Errorf("failed to load global config: %w", err)
+	}
+	if globalConfig.IngestSecret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate ingest secret: %w", err)
+		}
+		secret := hex.EncodeToString(b)
+		if err := database.DB.Model(&globalConfig).Update("ingest_secret", secret).Error; err != nil {
+			return "", fmt.Errorf("failed to save ingest secret: %w", err)
+		}
+		globalConfig.IngestSecret = secret
+	}
+	ingestSecret.value = globalConfig.IngestSecret
+	return ingestSecret.value, nil
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// OutboundPatternData 一个号码模式及其路由（模板按模式生成一个 exten）
+type OutboundPatternData struct {
+	Pattern string
+	Routes  []OutboundRouteData
+}
+
+// OutboundRouteData 外呼路由模板数据
+type OutboundRouteData struct {
+	ID            uint
+	Name          string
+	Label         string // dialplan 标签（route-<ID>）
+	NextLabel     string // 本路由失败或不在生效时间时跳转的标签
+	Strip         int
+	Prepend       string
+	TimeCondition string
+	TimeCondLabel string              // 时间条件子程序（优先于 TimeCondition）
+	Dials         []string            // 按顺序尝试的 Dial 目标（如 Quectel/quectel0、Quectel/g1）
+	Carriers      []CarrierBranchData // 同运营商优先的分支
+}
+
+// CarrierBranchData 被叫号码匹配某运营商前缀时的 Dial 顺序
+type CarrierBranchData struct {
+	Prefix    string
+	PrefixLen int
+	Label     string
+	Dials     []string
+}
+
+// outboundTarget 解析后的路由目标
+type outboundTarget struct {
+	dial    string
+	carrier string
+}
+
+// loadOutboundRoutes 加载启用的外呼路由，按号码模式分组
+// 禁用或不存在的 dongle 会被跳过，没有可用目标的路由不生成
+func loadOutboundRoutes(dongles []database.Dongle, timeConditions map[uint]string) ([]OutboundPatternData, error) {
+	var routes []database.OutboundRoute
+	if err := database.DB.Preload("Targets").Where("enabled = ?", true).Order("priority ASC, id ASC").Find(&routes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load outbound routes: %w", err)
+	}
+	if len(routes) == 0 {
+		return nil, nil
+	}
+
+	var prefixes []database.CarrierPrefix
+	if err := database.DB.Find(&prefixes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load carrier prefixes: %w", err)
+	}
+	// 长前缀优先匹配
+	sort.SliceStable(prefixes, func(i, j int) bool { return len(prefixes[i].Prefix) > len(prefixes[j].Prefix) })
+
+	dongleByID := make(map[string]database.Dongle, len(dongles))
+	for _, d := range dongles {
+		dongleByID[d.DeviceID] = d
+	}
+
+	var patterns []OutboundPatternData
+	index := make(map[string]int)
+
+	for _, route := range routes {
+		sort.SliceStable(route.Targets, func(i, j int) bool { return route.Targets[i].Position < route.Targets[j].Position })
+
+		var targets []outboundTarget
+		for _, t := range route.Targets {
+			switch {
+			case t.DongleID != "":
+				d, ok := dongleByID[t.DongleID]
+				if !ok || d.Disable {
+					continue
+				}
+				targets = append(targets, outboundTarget{dial: "Quectel/" + d.DeviceID, carrier: d.Carrier})
+			case t.Group != nil:
+				targets = append(targets, outboundTarget{dial: fmt.Sprintf("Quectel/g%d", *t.Group)})
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		data := OutboundRouteData{
+			ID:            route.ID,
+			Name:          dialplanSafe(route.Name),
+			Label:         fmt.Sprintf("route-%d", route.ID),
+			Strip:         route.Strip,
+			Prepend:       route.Prepend,
+			TimeCondition: route.TimeCondition,
+			Dials:         dialsOf(targets),
+		}
+		if route.TimeConditionID != nil {
+			data.TimeCondLabel = timeConditions[*route.TimeConditionID]
+		}
+		if route.PreferSameCarrier {
+			data.Carriers = carrierBranches(data.Label, targets, prefixes)
+		}
+
+		i, ok := index[route.Pattern]
+		if !ok {
+			i = len(patterns)
+			index[route.Pattern] = i
+			patterns = append(patterns, OutboundPatternData{Pattern: route.Pattern})
+		}
+		patterns[i].Routes = append(patterns[i].Routes, data)
+	}
+
+	// 每条路由失败后跳到同一模式的下一条路由，最后一条跳到 failed
+	for i := range patterns {
+		routes := patterns[i].Routes
+		for j := range routes {
+			if j+1 < len(routes) {
+				routes[j].NextLabel = routes[j+1].Label
+			} else {
+				routes[j].NextLabel = "failed"
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// carrierBranches 为每个运营商前缀生成分支：同运营商的 dongle 排在前面，其余保持原顺序
+// 原顺序已经是同运营商优先的前缀不生成分支
+func carrierBranches(label string, targets []outboundTarget, prefixes []database.CarrierPrefix) []CarrierBranchData {
+	var branches []CarrierBranchData
+	for _, p := range prefixes {
+		var same, other []outboundTarget
+		for _, t := range targets {
+			if t.carrier != "" && strings.EqualFold(t.carrier, p.Carrier) {
+				same = append(same, t)
+			} else {
+				other = append(other, t)
+			}
+		}
+		if len(same) == 0 {
+			continue
+		}
+		ordered := append(same, other...)
+		if equalDials(dialsOf(ordered), dialsOf(targets)) {
+			continue
+		}
+		branches = append(branches, CarrierBranchData{
+			Prefix:    p.Prefix,
+			PrefixLen: len(p.Prefix),
+			Label:     fmt.Sprintf("%s-c%d", label, p.ID),
+			Dials:     dialsOf(ordered),
+		})
+	}
+	return branches
+}
+
+// dialplanSafe 去掉会破坏 dialplan 参数解析的字符（用于 NoOp 中的名称）
+func dialplanSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '(', ')', '|', '$', '{', '}', '[', ']', '"', '\'', '\n', '\r':
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+func dialsOf(targets []outboundTarget) []string {
+	dials := make([]string, len(targets))
+	for i, t := range targets {
+		dials[i] = t.dial
+	}
+	return dials
+}
+
+func equalDials(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
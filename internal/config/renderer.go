@@ -8,29 +8,44 @@ import (
 	"text/template"
 
 	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/recording"
 )
 
+// AttendedTransferCode 咨询转接（features.conf atxfer）按键，AMI Atxfer 也依赖该设置
+const AttendedTransferCode = "*2"
+
 // ConfigData 配置模板数据
 type ConfigData struct {
-	SIPHost               string
-	SIPPort               int
-	RTPStartPort          int
-	RTPEndPort            int
-	AMIUsername           string
-	AMIPassword           string
-	Extensions            []ExtensionData
-	DongleBindings        []DongleBindingData
-	Dongles               []DongleData
+	SIPHost                 string
+	SIPPort                 int
+	RTPStartPort            int
+	RTPEndPort              int
+	AMIUsername             string
+	AMIPassword             string
+	Extensions              []ExtensionData
+	DongleBindings          []DongleBindingData
+	Dongles                 []DongleData
+	TimeConditions          []TimeConditionData        // 时间条件（工作时间和节假日）
+	OutboundPatterns        []OutboundPatternData      // 外呼路由（按号码模式分组）
+	InboundRoutes           []InboundRouteData         // 来电路由（振铃组/顺序振铃/跟随）
+	VoicemailBoxes          []ExtensionData            // 来电路由和黑名单用到的语音信箱（以分机号为信箱号）
+	CallForwards            []CallForwardData          // 来电转移到外部号码
+	RecordingToggleCode     string                     // 按需录音的通话中按键
+	RecordingDir            string                     // MixMonitor 录音目录
+	AttendedTransferCode    string                     // 咨询转接按键
+	IngestURL               string                     // webpanel 内部回调接口地址（dialplan 中的 curl 使用）
+	IngestSecret            string                     // 内部回调接口的共享密钥
 	InboundBindingsByDongle map[string][]ExtensionData // 按 dongle ID 分组的 inbound 绑定
 }
 
 // ExtensionData Extension 模板数据
 type ExtensionData struct {
-	Username string
-	Secret   string
-	CallerID string
-	Host     string
-	Context  string
+	Username        string
+	Secret          string
+	CallerID        string
+	Host            string
+	Context         string
+	RecordingPolicy string // 录音策略：always、ondemand 或 never
 }
 
 // DongleBindingData Dongle 绑定模板数据
@@ -43,14 +58,15 @@ type DongleBindingData struct {
 
 // DongleData Dongle 设备模板数据
 type DongleData struct {
-	DeviceID    string // quectel0, quectel1
-	Device      string // /dev/ttyUSB0
-	Audio       string // /dev/ttyUSB1
-	Data        string // /dev/ttyUSB2
-	Group       int    // 组号（默认 0）
-	Context     string // 来电上下文
-	DialPrefix  string // 外呼前缀
-	Disable     bool   // 是否禁用
+	DeviceID        string // quectel0, quectel1
+	Device          string // /dev/ttyUSB0
+	Audio           string // /dev/ttyUSB1
+	Data            string // /dev/ttyUSB2
+	Group           int    // 组号（默认 0）
+	Context         string // 来电上下文
+	DialPrefix      string // 外呼前缀
+	Disable         bool   // 是否禁用
+	RecordingPolicy string // 录音策略：always、ondemand 或 never
 }
 
 // Renderer 配置渲染器
@@ -67,6 +83,11 @@ func NewRenderer(templateDir, outputDir string) *Renderer {
 	}
 }
 
+// OutputDir 渲染后的配置文件目录
+func (r *Renderer) OutputDir() string {
+	return r.outputDir
+}
+
 // LoadConfigData 从数据库加载配置数据
 func (r *Renderer) LoadConfigData() (*ConfigData, error) {
 	data := &ConfigData{}
@@ -108,11 +129,12 @@ func (r *Renderer) LoadConfigData() (*ConfigData, error) {
 	data.Extensions = make([]ExtensionData, len(extensions))
 	for i, ext := range extensions {
 		data.Extensions[i] = ExtensionData{
-			Username: ext.Username,
-			Secret:   ext.Secret,
-			CallerID: ext.CallerID,
-			Host:     ext.Host,
-			Context:  ext.Context,
+			Username:        ext.Username,
+			Secret:          ext.Secret,
+			CallerID:        ext.CallerID,
+			Host:            ext.Host,
+			Context:         ext.Context,
+			RecordingPolicy: recordingPolicy(ext.RecordingPolicy),
 		}
 	}
 
@@ -145,14 +167,88 @@ func (r *Renderer) LoadConfigData() (*ConfigData, error) {
 	data.Dongles = make([]DongleData, len(dongles))
 	for i, dongle := range dongles {
 		data.Dongles[i] = DongleData{
-			DeviceID:    dongle.DeviceID,
-			Device:      dongle.Device,
-			Audio:       dongle.Audio,
-			Data:        dongle.Data,
-			Group:       dongle.Group,
-			Context:    dongle.Context,
-			DialPrefix: dongle.DialPrefix,
-			Disable:    dongle.Disable,
+			DeviceID:        dongle.DeviceID,
+			Device:          dongle.Device,
+			Audio:           dongle.Audio,
+			Data:            dongle.Data,
+			Group:           dongle.Group,
+			Context:         dongle.Context,
+			DialPrefix:      dongle.DialPrefix,
+			Disable:         dongle.Disable,
+			RecordingPolicy: recordingPolicy(dongle.RecordingPolicy),
+		}
+	}
+
+	// 加载录音配置
+	var globalConfig database.GlobalConfig
+	if err := database.DB.FirstOrCreate(&globalConfig, database.GlobalConfig{ID: 1}).Error; err != nil {
+		return nil, fmt.Errorf("failed to load global config: %w", err)
+	}
+	data.RecordingToggleCode = globalConfig.RecordingToggleCode
+	if data.RecordingToggleCode == "" {
+		data.RecordingToggleCode = "*1"
+	}
+	data.RecordingDir = recording.Dir()
+	data.AttendedTransferCode = AttendedTransferCode
+
+	// 内部回调接口地址和共享密钥
+	data.IngestURL = "http://" + IngestAddr()
+	secret, err := IngestSecret()
+	if err != nil {
+		return nil, err
+	}
+	data.IngestSecret = secret
+
+	// 加载时间条件
+	timeConditions, timeConditionLabels, err := loadTimeConditions()
+	if err != nil {
+		return nil, err
+	}
+	data.TimeConditions = timeConditions
+
+	// 加载外呼路由
+	outboundPatterns, err := loadOutboundRoutes(dongles, timeConditionLabels)
+	if err != nil {
+		return nil, err
+	}
+	data.OutboundPatterns = outboundPatterns
+
+	// 加载来电路由
+	inboundRoutes, err := loadInboundRoutes(dongles, timeConditionLabels)
+	if err != nil {
+		return nil, err
+	}
+	data.InboundRoutes = inboundRoutes
+
+	// 加载呼叫转移
+	callForwards, err := loadCallForwards(dongles, timeConditionLabels)
+	if err != nil {
+		return nil, err
+	}
+	data.CallForwards = callForwards
+
+	// 收集来电路由和黑名单用到的语音信箱
+	boxes := make(map[string]bool)
+	for _, route := range inboundRoutes {
+		if route.FinalType == database.FinalDestVoicemail {
+			boxes[route.FinalTarget] = true
+		}
+		if route.OffHoursType == database.FinalDestVoicemail {
+			boxes[route.OffHoursTarget] = true
+		}
+	}
+	var blockBoxes []string
+	if err := database.DB.Model(&database.BlockedNumber{}).
+		Where("enabled = ? AND calls = ? AND action = ?", true, true, database.BlockActionVoicemail).
+		Pluck("voicemail_box", &blockBoxes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load blocklist voicemail boxes: %w", err)
+	}
+	for _, box := range blockBoxes {
+		boxes[box] = true
+	}
+	for _, ext := range data.Extensions {
+		if boxes[ext.Username] {
+			data.VoicemailBoxes = append(data.VoicemailBoxes, ext)
 		}
 	}
 
@@ -170,6 +266,14 @@ func (r *Renderer) LoadConfigData() (*ConfigData, error) {
 	return data, nil
 }
 
+// recordingPolicy 返回录音策略，旧数据为空时视为 never
+func recordingPolicy(policy string) string {
+	if policy == "" {
+		return database.RecordingNever
+	}
+	return policy
+}
+
 // RenderTemplate 渲染模板文件
 func (r *Renderer) RenderTemplate(templateName, outputName string, data interface{}) error {
 	// 读取模板文件
@@ -250,6 +354,16 @@ func (r *Renderer) RenderAll() error {
 		return fmt.Errorf("failed to render quectel.conf: %w", err)
 	}
 
+	// 渲染 voicemail.conf（来电路由的语音信箱）
+	if err := r.RenderTemplate("voicemail.conf.tpl", "voicemail.conf", data); err != nil {
+		return fmt.Errorf("failed to render voicemail.conf: %w", err)
+	}
+
+	// 渲染 features.conf（按需录音的通话中按键）
+	if err := r.RenderTemplate("features.conf.tpl", "features.conf", data); err != nil {
+		return fmt.Errorf("failed to render features.conf: %w", err)
+	}
+
 	// 渲染 stasis.conf（Asterisk 20 需要正确的配置）
 	// 使用 taskpool 配置（Asterisk 20.17.0+ 使用 taskpool 而不是 threadpool）
 	// 不包含 [declined_message_types] 部分以避免文档错误
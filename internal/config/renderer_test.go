@@ -0,0 +1,498 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/timecond"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests 使用临时数据库运行测试（SIP/RTP 默认配置由 database.Seed 创建）
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "config-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("DB_PATH", filepath.Join(dir, "data.db"))
+	os.Setenv("ASTERISK_AMI_USERNAME", "admin")
+	os.Setenv("ASTERISK_AMI_PASSWORD", "secret")
+	if err := database.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := database.Seed(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+// resetRouting 清空渲染 dialplan 用到的表，每个测试从空配置开始
+func resetRouting(t *testing.T) {
+	t.Helper()
+	for _, model := range []interface{}{
+		&database.Extension{}, &database.Dongle{}, &database.DongleBinding{},
+		&database.OutboundRoute{}, &database.OutboundRouteTarget{}, &database.CarrierPrefix{},
+		&database.InboundRoute{}, &database.InboundRouteMember{},
+		&database.TimeCondition{}, &database.TimeConditionRule{}, &database.TimeConditionHoliday{},
+		&database.CallForward{},
+	} {
+		if err := database.DB.Where("1 = 1").Delete(model).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// create 写入测试数据
+func create(t *testing.T, values ...interface{}) {
+	t.Helper()
+	for _, v := range values {
+		if err := database.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// renderExtensions 按当前数据库渲染 extensions.conf 并返回内容
+func renderExtensions(t *testing.T) string {
+	t.Helper()
+	r := NewRenderer("../../configs/asterisk", t.TempDir())
+	data, err := r.LoadConfigData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenderTemplate("extensions.conf.tpl", "extensions.conf", data); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filepath.Join(r.OutputDir(), "extensions.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// assertInOrder 检查各行依次出现在输出中
+func assertInOrder(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	rest := out
+	for _, line := range lines {
+		i := strings.Index(rest, line)
+		if i < 0 {
+			t.Fatalf("missing (or out of order) line %q in:\n%s", line, out)
+		}
+		rest = rest[i+len(line):]
+	}
+}
+
+// assertAbsent 检查输出中不包含某段内容
+func assertAbsent(t *testing.T, out, s string) {
+	t.Helper()
+	if strings.Contains(out, s) {
+		t.Fatalf("unexpected %q in:\n%s", s, out)
+	}
+}
+
+func TestRenderOutboundRoutes(t *testing.T) {
+	resetRouting(t)
+	group := 1
+	create(t,
+		&database.Dongle{DeviceID: "qa", Carrier: "mobile", DialPrefix: "901"},
+		&database.Dongle{DeviceID: "qb", Carrier: "unicom", DialPrefix: "902"},
+		&database.Dongle{DeviceID: "qc", Carrier: "unicom", DialPrefix: "903", Disable: true},
+		&database.CarrierPrefix{Carrier: "unicom", Prefix: "130"},
+		&database.CarrierPrefix{Carrier: "mobile", Prefix: "139"},
+	)
+	primary := database.OutboundRoute{
+		Name: "Mobile", Pattern: "_1XXXXXXXXXX", Priority: 0, Strip: 1, Prepend: "+86",
+		PreferSameCarrier: true, Enabled: true,
+		Targets: []database.OutboundRouteTarget{
+			{Position: 0, DongleID: "qa"},
+			{Position: 1, DongleID: "qc"}, // 禁用的 dongle 被跳过
+			{Position: 2, DongleID: "qb"},
+		},
+	}
+	backup := database.OutboundRoute{
+		Name: "Backup", Pattern: "_1XXXXXXXXXX", Priority: 1, Enabled: true,
+		Targets: []database.OutboundRouteTarget{{Group: &group}},
+	}
+	create(t, &primary, &backup)
+	var unicom database.CarrierPrefix
+	if err := database.DB.Where("prefix = ?", "130").First(&unicom).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	out := renderExtensions(t)
+	p, b := fmt.Sprintf("route-%d", primary.ID), fmt.Sprintf("route-%d", backup.ID)
+	branch := fmt.Sprintf("%s-c%d", p, unicom.ID)
+	dial := func(target string) string {
+		return "Dial(" + target + "/${OUTNUM},,U(recording^outbound^^${CHANNEL(endpoint)}^${OUTNUM}^${UNIQUEID}))"
+	}
+	failover := `GotoIf($[$["${DIALSTATUS}" = "CHANUNAVAIL"] | $["${DIALSTATUS}" = "CONGESTION"]]?:done)`
+
+	// 按配置顺序依次尝试，设备不可用时换下一个，全部失败后进入下一条路由
+	assertInOrder(t, out,
+		"exten => _1XXXXXXXXXX,1,NoOp(Outbound call to ${EXTEN})",
+		"exten => _1XXXXXXXXXX,n("+p+"),NoOp(Trying outbound route Mobile)",
+		"exten => _1XXXXXXXXXX,n,Set(DIALNUM=${EXTEN:1})",
+		"exten => _1XXXXXXXXXX,n,Set(OUTNUM=+86${DIALNUM})",
+		`exten => _1XXXXXXXXXX,n,GotoIf($["${DIALNUM:0:3}" = "130"]?`+branch+")",
+		"exten => _1XXXXXXXXXX,n,"+dial("Quectel/qa"),
+		"exten => _1XXXXXXXXXX,n,"+failover,
+		"exten => _1XXXXXXXXXX,n,"+dial("Quectel/qb"),
+		"exten => _1XXXXXXXXXX,n,"+failover,
+		"exten => _1XXXXXXXXXX,n,Goto("+b+")",
+		// 被叫是联通号码时联通卡排在前面
+		"exten => _1XXXXXXXXXX,n("+branch+"),NoOp(Destination prefix 130 - same-carrier SIM first)",
+		"exten => _1XXXXXXXXXX,n,"+dial("Quectel/qb"),
+		"exten => _1XXXXXXXXXX,n,"+dial("Quectel/qa"),
+		"exten => _1XXXXXXXXXX,n,Goto("+b+")",
+		"exten => _1XXXXXXXXXX,n("+b+"),NoOp(Trying outbound route Backup)",
+		"exten => _1XXXXXXXXXX,n,"+dial("Quectel/g1"),
+		"exten => _1XXXXXXXXXX,n,Goto(failed)",
+		"exten => _1XXXXXXXXXX,n(failed),NoOp(All outbound routes failed: ${DIALSTATUS})",
+		"exten => _1XXXXXXXXXX,n(done),Hangup()",
+	)
+	assertAbsent(t, out, dial("Quectel/qc"))
+	// 移动号码的原顺序已经是移动卡优先，不生成分支
+	assertAbsent(t, out, `"${DIALNUM:0:3}" = "139"`)
+}
+
+func TestRenderInboundStrategies(t *testing.T) {
+	resetRouting(t)
+	exts := []database.Extension{{Username: "2001", Secret: "s"}, {Username: "2002", Secret: "s"}, {Username: "2003", Secret: "s"}}
+	for i := range exts {
+		create(t, &exts[i])
+	}
+	members := func(timeouts ...int) []database.InboundRouteMember {
+		var result []database.InboundRouteMember
+		for i, timeout := range timeouts {
+			result = append(result, database.InboundRouteMember{Position: i, ExtensionID: exts[i].ID, Timeout: timeout})
+		}
+		return result
+	}
+	create(t,
+		&database.Dongle{DeviceID: "i1", DialPrefix: "911"},
+		&database.Dongle{DeviceID: "i2", DialPrefix: "912"},
+		&database.Dongle{DeviceID: "i3", DialPrefix: "913"},
+		&database.Dongle{DeviceID: "i4", DialPrefix: "914"},
+		&database.Dongle{DeviceID: "i5", DialPrefix: "915", Disable: true},
+		&database.InboundRoute{DongleID: "i1", Strategy: database.RingStrategyRingAll, Members: members(20, 20),
+			FinalType: database.FinalDestVoicemail, FinalTarget: "2003", Enabled: true},
+		&database.InboundRoute{DongleID: "i2", Strategy: database.RingStrategySequential, Members: members(15, 25),
+			FinalType: database.FinalDestExtension, FinalTarget: "2003", Enabled: true},
+		&database.InboundRoute{DongleID: "i3", Strategy: database.RingStrategyRoundRobin, Members: members(20, 20, 20),
+			FinalType: database.FinalDestHangup, Enabled: true},
+		&database.InboundRoute{DongleID: "i4", Strategy: database.RingStrategyRandom, Members: members(20, 20),
+			FinalType: database.FinalDestHangup, Enabled: true},
+		&database.InboundRoute{DongleID: "i5", Strategy: database.RingStrategyRingAll, Members: members(20),
+			FinalType: database.FinalDestHangup, Enabled: true},
+	)
+
+	out := renderExtensions(t)
+	dial := func(dongle, target string, timeout int) string {
+		return fmt.Sprintf("exten => %s,n,Dial(%s,%d,U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))", dongle, target, timeout)
+	}
+	answered := func(dongle string) string {
+		return fmt.Sprintf(`exten => %s,n,GotoIf($["${DIALSTATUS}" = "ANSWER"]?done)`, dongle)
+	}
+
+	// ringall：所有成员同时振铃，无人接听转语音信箱
+	assertInOrder(t, out,
+		`exten => s,n,GotoIf($["${QUECTELNAME}" = "i1"]?inbound-routes,i1,1)`,
+		"exten => i1,1,NoOp(Inbound route for quectel i1: strategy=ringall, 2 member(s))",
+		dial("i1", "PJSIP/2001&PJSIP/2002", 30),
+		answered("i1"),
+		"exten => i1,n(final),NoOp(No answer on quectel i1, final destination: voicemail)",
+		"exten => i1,n,VoiceMail(2003@default,u)",
+		"exten => i1,n(done),Hangup()",
+	)
+
+	// sequential：按顺序逐个振铃，使用各成员的振铃时间
+	assertInOrder(t, out,
+		"exten => i2,1,NoOp(Inbound route for quectel i2: strategy=sequential, 2 member(s))",
+		"exten => i2,n(start-0),NoOp(Hunting from member 0)",
+		dial("i2", "PJSIP/2001", 15),
+		answered("i2"),
+		dial("i2", "PJSIP/2002", 25),
+		answered("i2"),
+		"exten => i2,n,Goto(final)",
+		"exten => i2,n(final),NoOp(No answer on quectel i2, final destination: extension)",
+		"exten => i2,n,Dial(PJSIP/2003,30)",
+	)
+	assertAbsent(t, out, "exten => i2,n(start-1)")
+
+	// roundrobin：每个起点一个轮换，起点保存在全局变量中
+	assertInOrder(t, out,
+		"exten => i3,1,NoOp(Inbound route for quectel i3: strategy=roundrobin, 3 member(s))",
+		`exten => i3,n,Set(HUNT_START=${IF($["${GLOBAL(RR_i3)}" = ""]?0:${GLOBAL(RR_i3)})})`,
+		"exten => i3,n,Set(GLOBAL(RR_i3)=$[(${HUNT_START} + 1) % 3])",
+		"exten => i3,n,Goto(start-${HUNT_START})",
+		"exten => i3,n(start-0),NoOp(Hunting from member 0)",
+		dial("i3", "PJSIP/2001", 20), dial("i3", "PJSIP/2002", 20), dial("i3", "PJSIP/2003", 20),
+		"exten => i3,n(start-1),NoOp(Hunting from member 1)",
+		dial("i3", "PJSIP/2002", 20), dial("i3", "PJSIP/2003", 20), dial("i3", "PJSIP/2001", 20),
+		"exten => i3,n(start-2),NoOp(Hunting from member 2)",
+		dial("i3", "PJSIP/2003", 20), dial("i3", "PJSIP/2001", 20), dial("i3", "PJSIP/2002", 20),
+		"exten => i3,n(final),NoOp(No answer on quectel i3, final destination: hangup)",
+	)
+
+	// random：随机选择起点
+	assertInOrder(t, out,
+		"exten => i4,1,NoOp(Inbound route for quectel i4: strategy=random, 2 member(s))",
+		"exten => i4,n,Set(HUNT_START=${RAND(0,1)})",
+		"exten => i4,n,Goto(start-${HUNT_START})",
+		"exten => i4,n(start-0),NoOp(Hunting from member 0)",
+		dial("i4", "PJSIP/2001", 20), dial("i4", "PJSIP/2002", 20),
+		"exten => i4,n(start-1),NoOp(Hunting from member 1)",
+		dial("i4", "PJSIP/2002", 20), dial("i4", "PJSIP/2001", 20),
+	)
+
+	// 禁用的 dongle 不生成来电路由
+	assertAbsent(t, out, "inbound-routes,i5,1")
+	assertAbsent(t, out, "exten => i5,1,")
+}
+
+func TestRenderTimeConditionRules(t *testing.T) {
+	resetRouting(t)
+	day := time.Date(2099, 1, 5, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		start, end string
+		want       string // 渲染的 GotoIfTime 时间参数
+	}{
+		{"09:00", "18:00", "09:00-17:59"}, // 当天
+		{"22:00", "06:00", "22:00-05:59"}, // 跨零点
+		{"18:00", "00:00", "18:00-23:59"}, // 到零点结束
+		{"08:00", "08:00", "*"},           // 开始等于结束表示全天
+	} {
+		cond := database.TimeCondition{
+			Name:     "rule " + tc.start + "-" + tc.end,
+			Timezone: "UTC",
+			Rules:    []database.TimeConditionRule{{Weekdays: "*", StartTime: tc.start, EndTime: tc.end}},
+		}
+		create(t, &cond)
+
+		out := renderExtensions(t)
+		label := fmt.Sprintf("tc-%d", cond.ID)
+		assertInOrder(t, out,
+			fmt.Sprintf("exten => %s,n,GotoIfTime(%s,*,*,*,UTC?open)", label, tc.want),
+			fmt.Sprintf("exten => %s,n(workday),NoOp(Make-up workday)", label),
+			fmt.Sprintf("exten => %s,n,GotoIfTime(%s,*,*,*,UTC?open)", label, tc.want),
+		)
+
+		// GotoIfTime 包含结束的那一分钟：渲染的最后一分钟仍在工作时间，下一分钟不在，与 Evaluate 一致
+		open := func(at time.Time) bool {
+			result, err := timecond.Evaluate(&cond, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return result.Open
+		}
+		if tc.want == "*" {
+			for _, at := range []time.Time{day, day.Add(8 * time.Hour), day.Add(23*time.Hour + 59*time.Minute)} {
+				if !open(at) {
+					t.Fatalf("%s: Evaluate(%s) closed for an all-day rule", cond.Name, at)
+				}
+			}
+			continue
+		}
+		start, _ := timecond.ParseClock(tc.start)
+		last, err := timecond.ParseClock(strings.SplitN(tc.want, "-", 2)[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last < start {
+			last += 24 * 60
+		}
+		first := day.Add(time.Duration(start) * time.Minute)
+		lastMinute := day.Add(time.Duration(last)*time.Minute + 59*time.Second)
+		if !open(first) || !open(lastMinute) || open(lastMinute.Add(time.Second)) || open(first.Add(-time.Second)) {
+			t.Fatalf("%s: rendered %s disagrees with Evaluate", cond.Name, tc.want)
+		}
+	}
+}
+
+// holidayCheck 匹配 [time-conditions] 中的例外日期判断
+var holidayCheck = regexp.MustCompile(`exten => (tc-\d+),n,GotoIf\(\$\[\$\{TC_TODAY\} >= (\d{8}) & \$\{TC_TODAY\} <= (\d{8})\]\?(\w+)\)`)
+
+func TestRenderTimeConditionHolidays(t *testing.T) {
+	resetRouting(t)
+	// 节假日先于调休上班日写入，渲染时调休上班日仍然排在前面
+	cond := database.TimeCondition{
+		Name:     "holidays",
+		Timezone: "UTC",
+		Rules:    []database.TimeConditionRule{{Weekdays: "mon-fri", StartTime: "09:00", EndTime: "18:00"}},
+		Holidays: []database.TimeConditionHoliday{
+			{Name: "National Day", StartDate: "2099-10-01", EndDate: "2099-10-07", Kind: database.HolidayClosed},
+			{Name: "Make-up inside", StartDate: "2099-10-05", EndDate: "2099-10-05", Kind: database.HolidayOpen},
+			{Name: "Make-up", StartDate: "2099-10-10", EndDate: "2099-10-10", Kind: database.HolidayOpen},
+			{Name: "Past", StartDate: "2000-01-01", EndDate: "2000-01-02", Kind: database.HolidayClosed},
+		},
+	}
+	create(t, &cond)
+
+	out := renderExtensions(t)
+	label := fmt.Sprintf("tc-%d", cond.ID)
+	assertInOrder(t, out,
+		fmt.Sprintf("exten => %s,n,GotoIf($[${TC_TODAY} >= 20991005 & ${TC_TODAY} <= 20991005]?workday)", label),
+		fmt.Sprintf("exten => %s,n,GotoIf($[${TC_TODAY} >= 20991010 & ${TC_TODAY} <= 20991010]?workday)", label),
+		fmt.Sprintf("exten => %s,n,GotoIf($[${TC_TODAY} >= 20991001 & ${TC_TODAY} <= 20991007]?done)", label),
+		fmt.Sprintf("exten => %s,n,GotoIfTime(09:00-17:59,mon-fri,*,*,UTC?open)", label),
+	)
+	// 已经结束的例外日期不再渲染
+	assertAbsent(t, out, "20000101")
+
+	// 按渲染顺序执行日期判断（第一个匹配的生效），结果应与 Evaluate 选中的例外日期一致
+	for _, date := range []string{"2099-10-03", "2099-10-05", "2099-10-10", "2099-10-20"} {
+		today := strings.ReplaceAll(date, "-", "")
+		jump := ""
+		for _, m := range holidayCheck.FindAllStringSubmatch(out, -1) {
+			if m[1] == label && today >= m[2] && today <= m[3] {
+				jump = m[4]
+				break
+			}
+		}
+
+		at, err := time.Parse(time.RFC3339, date+"T10:00:00Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := timecond.Evaluate(&cond, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ""
+		if result.Holiday != nil {
+			want = map[string]string{database.HolidayOpen: "workday", database.HolidayClosed: "done"}[result.Holiday.Kind]
+		}
+		if jump != want {
+			t.Fatalf("%s: dialplan jumps to %q, Evaluate picked %q (%s)", date, jump, want, result.Reason)
+		}
+	}
+}
+
+func TestRenderCallForwards(t *testing.T) {
+	resetRouting(t)
+	ext := database.Extension{Username: "2001", Secret: "s"}
+	create(t, &ext)
+	cond := database.TimeCondition{
+		Name:  "office",
+		Rules: []database.TimeConditionRule{{Weekdays: "mon-fri", StartTime: "09:00", EndTime: "18:00"}},
+	}
+	missing := uint(9999)
+	create(t,
+		&cond,
+		&database.Dongle{DeviceID: "f1", DialPrefix: "921"},
+		&database.Dongle{DeviceID: "f2", DialPrefix: "922"},
+		&database.Dongle{DeviceID: "f3", DialPrefix: "923", Disable: true},
+		&database.DongleBinding{DongleID: "f1", ExtensionID: ext.ID, Inbound: true},
+	)
+	unconditional := database.CallForward{DongleID: "f1", Mode: database.ForwardUnconditional, Number: "13800000000",
+		ViaDongleID: "f2", CallerIDMode: database.ForwardCallerIDHidden, TimeConditionID: &cond.ID, ActiveWhen: "closed", Enabled: true}
+	busy := database.CallForward{DongleID: "f1", Mode: database.ForwardBusy, Number: "13900000000",
+		CallerIDMode: database.ForwardCallerIDSMS, Enabled: true}
+	noAnswer := database.CallForward{DongleID: "f1", Mode: database.ForwardNoAnswer, Number: "13700000000",
+		Timeout: 30, Enabled: true}
+	create(t, &unconditional, &busy, &noAnswer,
+		// 呼出 dongle 被禁用、时间条件不存在的规则不生成
+		&database.CallForward{DongleID: "f2", Mode: database.ForwardUnconditional, Number: "13600000000", ViaDongleID: "f3", Enabled: true},
+		&database.CallForward{DongleID: "f2", Mode: database.ForwardBusy, Number: "13500000000", TimeConditionID: &missing, Enabled: true},
+	)
+
+	out := renderExtensions(t)
+	fwd := func(f database.CallForward) string { return fmt.Sprintf("fwd-%d", f.ID) }
+
+	// 来电先进入转移检查，本地振铃失败后按 FWD_<DIALSTATUS> 转出
+	assertInOrder(t, out,
+		"[incoming-mobile]",
+		`exten => s,n,GotoIf($["${QUECTELNAME}" = "f1"]?call-forward,f1,1)`,
+		"exten => s,n(routing),NoOp(Routing incoming call from quectel ${QUECTELNAME})",
+		"exten => s,n(binding-f1),NoOp(Routing quectel f1 - simultaneous ring to 1 extension(s))",
+		"exten => s,n,Dial(PJSIP/2001,30,U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))",
+		`exten => s,n,GotoIf($["${FWD_${DIALSTATUS}}" != ""]?call-forward,${FWD_${DIALSTATUS}},1)`,
+	)
+
+	assertInOrder(t, out,
+		"[call-forward]",
+		"exten => f1,1,NoOp(Checking call forwarding for quectel f1)",
+		fmt.Sprintf("exten => f1,n,NoOp(Forward rule %d: unconditional to 13800000000)", unconditional.ID),
+		fmt.Sprintf("exten => f1,n,Gosub(time-conditions,tc-%d,1)", cond.ID),
+		`exten => f1,n,GotoIf($["${TC_RESULT}" != "closed"]?skip-0)`,
+		fmt.Sprintf("exten => f1,n,Goto(%s,1)", fwd(unconditional)),
+		"exten => f1,n(skip-0),NoOp()",
+		fmt.Sprintf("exten => f1,n,NoOp(Forward rule %d: busy to 13900000000)", busy.ID),
+		fmt.Sprintf(`exten => f1,n,ExecIf($["${FWD_BUSY}" = ""]?Set(FWD_BUSY=%s))`, fwd(busy)),
+		fmt.Sprintf(`exten => f1,n,ExecIf($["${FWD_CHANUNAVAIL}" = ""]?Set(FWD_CHANUNAVAIL=%s))`, fwd(busy)),
+		fmt.Sprintf(`exten => f1,n,ExecIf($["${FWD_CONGESTION}" = ""]?Set(FWD_CONGESTION=%s))`, fwd(busy)),
+		"exten => f1,n(skip-1),NoOp()",
+		fmt.Sprintf(`exten => f1,n,ExecIf($["${FWD_NOANSWER}" = ""]?Set(FWD_NOANSWER=%s))`, fwd(noAnswer)),
+		"exten => f1,n(skip-2),NoOp()",
+		"exten => f1,n,Goto(${FWD_CONTEXT},s,routing)",
+		fmt.Sprintf("exten => %s,1,NoOp(Forwarding ${CALLERID(num)} from quectel ${QUECTELNAME} to 13800000000 via quectel f2)", fwd(unconditional)),
+		fmt.Sprintf("exten => %s,n,Set(CALLERID(num-pres)=prohib)", fwd(unconditional)),
+		fmt.Sprintf("exten => %s,n,Dial(Quectel/f2/13800000000,60)", fwd(unconditional)),
+		fmt.Sprintf(`exten => %s,n,QuectelSendSMS(f1,13900000000,Call from ${CALLERID(num)} to ${QUECTELNAME},1440,no,"fwd")`, fwd(busy)),
+		fmt.Sprintf("exten => %s,n,Dial(Quectel/f1/13900000000,60)", fwd(busy)),
+		fmt.Sprintf("exten => %s,n,Dial(Quectel/f1/13700000000,30)", fwd(noAnswer)),
+	)
+	assertAbsent(t, out, "call-forward,f2,1")
+	assertAbsent(t, out, "13600000000")
+	assertAbsent(t, out, "13500000000")
+}
+
+func TestRenderRecording(t *testing.T) {
+	resetRouting(t)
+	t.Setenv("RECORDINGS_DIR", "/data/recordings")
+	always := database.Extension{Username: "3001", Secret: "s", RecordingPolicy: database.RecordingAlways}
+	create(t, &always,
+		&database.Extension{Username: "3002", Secret: "s", RecordingPolicy: database.RecordingOnDemand},
+		&database.Dongle{DeviceID: "r1", DialPrefix: "931", RecordingPolicy: database.RecordingOnDemand},
+		&database.Dongle{DeviceID: "r2", DialPrefix: "932"},
+	)
+	create(t, &database.DongleBinding{DongleID: "r1", ExtensionID: always.ID, Inbound: true, Outbound: true})
+
+	out := renderExtensions(t)
+
+	// 录音目录和各分机、dongle 的录音策略写入全局变量
+	assertInOrder(t, out,
+		"REC_DIR=/data/recordings",
+		"REC_EXT_3001=always",
+		"REC_EXT_3002=ondemand",
+		"REC_DONGLE_r1=ondemand",
+		"REC_DONGLE_r2=never",
+	)
+
+	// 每个接通外部通话的 Dial 都通过 U() 在被叫接听后进入 [recording]
+	for _, line := range []string{
+		"exten => _931X.,n,Dial(Quectel/r1/${EXTEN:3},,U(recording^outbound^r1^${CHANNEL(endpoint)}^${EXTEN:3}^${UNIQUEID}))",
+		"exten => s,n,Dial(PJSIP/3001,30,U(recording^inbound^${QUECTELNAME}^^${CALLERID(num)}^${UNIQUEID}))",
+		"exten => 3001,n,Dial(Quectel/r1/${EXTEN:4},,U(recording^outbound^r1^${CHANNEL(endpoint)}^${EXTEN:4}^${UNIQUEID}))",
+		"exten => _[+0-9].,n,Dial(Quectel/${CLICK_DONGLE}/${EXTEN},,U(recording^outbound^${CLICK_DONGLE}^${CHANNEL(endpoint)}^${EXTEN}^${UNIQUEID}))",
+	} {
+		assertInOrder(t, out, line)
+	}
+
+	// always 直接开始 MixMonitor，ondemand 由按键切换，结束时回调 webpanel 登记录音
+	assertInOrder(t, out,
+		"[recording]",
+		"exten => s,1,Set(REC_DIRECTION=${ARG1})",
+		`exten => s,n,ExecIf($[$["${REC_DONGLE_${REC_DONGLE}}" = "always"] | $["${REC_EXT_${REC_EXT}}" = "always"]]?Set(REC_POLICY=always))`,
+		`exten => s,n,GotoIf($["${REC_POLICY}" = "never"]?done)`,
+		"/api/v1/recordings/receive?file=${REC_FILE}&unique_id=${ARG5}",
+		"exten => s,n,MixMonitor(${REC_DIR}/${REC_FILE},ab,${REC_POST})",
+		"exten => s,n,Set(DYNAMIC_FEATURES=recordtoggle)",
+		"exten => toggle,n,MixMonitor(${REC_DIR}/${REC_FILE},ab,${REC_POST})",
+		"exten => toggle,n(stop),StopMixMonitor()",
+	)
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/timecond"
+)
+
+// TimeConditionData 时间条件模板数据（渲染为 [time-conditions] 中的子程序）
+type TimeConditionData struct {
+	Label    string // 子程序的 exten（tc-<ID>）
+	Name     string
+	Timezone string
+	Rules    []TimeRuleData
+	Open     []DateRangeData // 调休上班日
+	Closed   []DateRangeData // 节假日
+}
+
+// TimeRuleData GotoIfTime 参数
+type TimeRuleData struct {
+	Times    string
+	Weekdays string
+}
+
+// DateRangeData 日期范围（YYYYMMDD，便于在 dialplan 中按数字比较）
+type DateRangeData struct {
+	Name  string
+	Start string
+	End   string
+}
+
+// loadTimeConditions 加载所有时间条件，返回模板数据和 ID 到标签的映射
+// 已经结束的例外日期不再渲染
+func loadTimeConditions() ([]TimeConditionData, map[uint]string, error) {
+	var conditions []database.TimeCondition
+	if err := database.DB.Preload("Rules").Preload("Holidays").Order("id ASC").Find(&conditions).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load time conditions: %w", err)
+	}
+
+	labels := make(map[uint]string, len(conditions))
+	var result []TimeConditionData
+	for _, c := range conditions {
+		loc, err := timecond.LoadLocation(c.Timezone)
+		if err != nil {
+			// 时区无效时 Asterisk 同样无法识别，改用系统时区
+			loc = time.Local
+			c.Timezone = ""
+		}
+		today := time.Now().In(loc).Format(timecond.DateLayout)
+
+		data := TimeConditionData{
+			Label:    fmt.Sprintf("tc-%d", c.ID),
+			Name:     dialplanSafe(c.Name),
+			Timezone: c.Timezone,
+		}
+		for _, r := range c.Rules {
+			if timecond.ValidateRule(&r) != nil {
+				continue
+			}
+			weekdays := strings.ToLower(r.Weekdays)
+			if weekdays == "" {
+				weekdays = "*"
+			}
+			data.Rules = append(data.Rules, TimeRuleData{Times: timecond.TimesSpec(r), Weekdays: weekdays})
+		}
+		for _, h := range c.Holidays {
+			if h.EndDate < today {
+				continue
+			}
+			d := DateRangeData{
+				Name:  dialplanSafe(h.Name),
+				Start: strings.ReplaceAll(h.StartDate, "-", ""),
+				End:   strings.ReplaceAll(h.EndDate, "-", ""),
+			}
+			if h.Kind == database.HolidayOpen {
+				data.Open = append(data.Open, d)
+			} else {
+				data.Closed = append(data.Closed, d)
+			}
+		}
+
+		labels[c.ID] = data.Label
+		result = append(result, data)
+	}
+	return result, labels, nil
+}
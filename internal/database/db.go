@@ -50,6 +50,11 @@ func Init() error {
 		// 不返回错误，因为可能索引已经不存在
 	}
 
+	// 迁移：admin_users.email 不再唯一（邮箱可以为空或重复）
+	if err := migrateAdminUsers(DB); err != nil {
+		log.Printf("Warning: Failed to migrate admin_users: %v", err)
+	}
+
 	log.Printf("Database initialized at %s", dbPath)
 	return nil
 }
@@ -86,6 +91,12 @@ func Seed() error {
 	return nil
 }
 
+// migrateAdminUsers 删除 admin_users.email 旧的唯一索引
+// 邮箱列的 NOT NULL 约束由 AutoMigrate 去掉；用户以 OIDC subject 区分，没有邮箱的用户保存为 NULL
+func migrateAdminUsers(db *gorm.DB) error {
+	return db.Exec("DROP INDEX IF EXISTS idx_admin_users_email").Error
+}
+
 // migrateDongleBindings 迁移 dongle_bindings 表，删除旧的唯一索引
 func migrateDongleBindings(db *gorm.DB) error {
 	// SQLite 中，唯一索引可能以以下方式存在：
@@ -68,40 +68,51 @@ type NotificationConfig struct {
 
 // GlobalConfig 全局配置
 type GlobalConfig struct {
-	ID                    uint      `gorm:"primaryKey" json:"id"`
-	HTTPProxy             string    `gorm:"type:varchar(500)" json:"http_proxy"`                         // HTTP 代理服务器地址（格式：http://host:port 或 https://host:port）
-	DongleHealthEnabled   bool      `gorm:"default:true" json:"dongle_health_enabled"`                   // Dongle 设备健康检查开关（默认开启）
-	CreatedAt             time.Time `json:"created_at"`
-	UpdatedAt             time.Time `json:"updated_at"`
+	ID                     uint      `gorm:"primaryKey" json:"id"`
+	HTTPProxy              string    `gorm:"type:varchar(500)" json:"http_proxy"`                      // HTTP 代理服务器地址（格式：http://host:port 或 https://host:port）
+	DongleHealthEnabled    bool      `gorm:"default:true" json:"dongle_health_enabled"`                // Dongle 设备健康检查开关（默认开启）
+	RecordingQuotaMB       int       `gorm:"default:2048" json:"recording_quota_mb"`                   // 录音存储上限（MB，0 表示不限制），超出时删除最早的录音
+	RecordingRetentionDays int       `gorm:"default:90" json:"recording_retention_days"`               // 录音保留天数（0 表示永久保留）
+	RecordingToggleCode    string    `gorm:"type:varchar(10);default:*1" json:"recording_toggle_code"` // 按需录音的通话中按键（开始/停止录音）
+	IngestSecret           string    `gorm:"type:varchar(64)" json:"-"`                                // dialplan 回调内部接口的共享密钥（首次渲染配置时生成）
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
 }
 
 // Extension SIP Extension 配置
 type Extension struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"type:varchar(100);not null;uniqueIndex" json:"username"` // SIP 用户名
-	Secret    string    `gorm:"type:varchar(255);not null" json:"secret"`               // SIP 密码
-	CallerID  string    `gorm:"type:varchar(255)" json:"callerid"`                      // 主叫号码显示
-	Host      string    `gorm:"type:varchar(255);default:dynamic" json:"host"`          // 主机地址，默认 dynamic
-	Context   string    `gorm:"type:varchar(100);default:default" json:"context"`       // 上下文
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	Username        string    `gorm:"type:varchar(100);not null;uniqueIndex" json:"username"` // SIP 用户名
+	Secret          string    `gorm:"type:varchar(255);not null" json:"secret"`               // SIP 密码
+	CallerID        string    `gorm:"type:varchar(255)" json:"callerid"`                      // 主叫号码显示
+	Host            string    `gorm:"type:varchar(255);default:dynamic" json:"host"`          // 主机地址，默认 dynamic
+	Context         string    `gorm:"type:varchar(100);default:default" json:"context"`       // 上下文
+	RecordingPolicy string    `gorm:"type:varchar(20);default:never" json:"recording_policy"` // 录音策略：always、ondemand 或 never
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // Dongle USB Dongle 设备配置
 type Dongle struct {
-	ID         uint   `gorm:"primaryKey" json:"id"`
-	DeviceID   string `gorm:"type:varchar(100);not null;uniqueIndex" json:"device_id"`   // quectel0, quectel1
-	Device     string `gorm:"type:varchar(255)" json:"device"`                           // /dev/ttyUSB0
-	Audio      string `gorm:"type:varchar(255)" json:"audio"`                            // /dev/ttyUSB1
-	Data       string `gorm:"type:varchar(255)" json:"data"`                             // /dev/ttyUSB2
-	Group      int    `gorm:"default:0" json:"group"`                                    // 组号（默认 0）
-	Context    string `gorm:"type:varchar(100);default:quectel-incoming" json:"context"` // 来电上下文
-	DialPrefix string `gorm:"type:varchar(10);default:999" json:"dial_prefix"`           // 外呼前缀
-	Disable    bool   `gorm:"default:false" json:"disable"`                              // 是否禁用
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	DeviceID        string `gorm:"type:varchar(100);not null;uniqueIndex" json:"device_id"`   // quectel0, quectel1
+	Device          string `gorm:"type:varchar(255)" json:"device"`                           // /dev/ttyUSB0
+	Audio           string `gorm:"type:varchar(255)" json:"audio"`                            // /dev/ttyUSB1
+	Data            string `gorm:"type:varchar(255)" json:"data"`                             // /dev/ttyUSB2
+	Group           int    `gorm:"default:0" json:"group"`                                    // 组号（默认 0）
+	Context         string `gorm:"type:varchar(100);default:quectel-incoming" json:"context"` // 来电上下文
+	DialPrefix      string `gorm:"type:varchar(10);default:999" json:"dial_prefix"`           // 外呼前缀
+	Disable         bool   `gorm:"default:false" json:"disable"`                              // 是否禁用
+	Carrier         string `gorm:"type:varchar(100)" json:"carrier"`                          // SIM 卡运营商（用于外呼同运营商优先）
+	RecordingPolicy string `gorm:"type:varchar(20);default:never" json:"recording_policy"`    // 录音策略：always、ondemand 或 never
+
+	// SIM/模块身份（每次设备（重新）连接时从 AMI 获取并持久化，用于检测换卡和 USB 端口错位）
+	IMEI              string     `gorm:"type:varchar(20)" json:"imei,omitempty"`
+	IMSI              string     `gorm:"type:varchar(20)" json:"imsi,omitempty"`
+	ICCID             string     `gorm:"type:varchar(22)" json:"iccid,omitempty"`
+	IdentityCheckedAt *time.Time `json:"identity_checked_at,omitempty"` // 最近一次身份检查时间
 
 	// 运行时状态（从 AMI 获取，不持久化）
-	IMEI           string `gorm:"-" json:"imei,omitempty"`
-	IMSI           string `gorm:"-" json:"imsi,omitempty"`
 	Operator       string `gorm:"-" json:"operator,omitempty"`
 	SignalStrength int    `gorm:"-" json:"signal_strength,omitempty"`
 	Status         string `gorm:"-" json:"status,omitempty"` // unknown, online, offline
@@ -110,6 +121,254 @@ type Dongle struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// 身份变更事件类型
+const (
+	IdentityEventFirstSeen   = "first_seen"   // 首次记录
+	IdentityEventSIMChanged  = "sim_changed"  // 卡槽中的 SIM 卡被更换
+	IdentityEventIMEIChanged = "imei_changed" // 设备对应的模块变了（USB 端口错位）
+	IdentityEventSIMMissing  = "sim_missing"  // SIM 卡被拔出或无法读取
+	IdentityEventSIMRestored = "sim_restored" // 原来的 SIM 卡重新插入
+)
+
+// DongleIdentityHistory Dongle 身份（IMEI/IMSI/ICCID）变更历史
+type DongleIdentityHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DongleID  string    `gorm:"type:varchar(100);not null;index" json:"dongle_id"` // Dongle 设备 ID（如 quectel0）
+	Event     string    `gorm:"type:varchar(20);not null" json:"event"`            // 事件类型
+	IMEI      string    `gorm:"type:varchar(20)" json:"imei"`                      // 当前 IMEI
+	IMSI      string    `gorm:"type:varchar(20)" json:"imsi"`                      // 当前 IMSI
+	ICCID     string    `gorm:"type:varchar(22)" json:"iccid"`                     // 当前 ICCID
+	PrevIMEI  string    `gorm:"type:varchar(20)" json:"prev_imei"`                 // 变更前 IMEI
+	PrevIMSI  string    `gorm:"type:varchar(20)" json:"prev_imsi"`                 // 变更前 IMSI
+	PrevICCID string    `gorm:"type:varchar(22)" json:"prev_iccid"`                // 变更前 ICCID
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutboundRoute 外呼路由：按号码模式选择 dongle，依次尝试直到有一个可用
+// 相同 Pattern 的多条路由按 Priority 从小到大依次尝试（可配合时间条件实现分时段路由）
+type OutboundRoute struct {
+	ID                uint                  `gorm:"primaryKey" json:"id"`
+	Name              string                `gorm:"type:varchar(100);not null" json:"name"`          // 路由名称
+	Pattern           string                `gorm:"type:varchar(100);not null;index" json:"pattern"` // Asterisk 号码模式（如 _1XXXXXXXXXX）
+	Priority          int                   `gorm:"default:0" json:"priority"`                       // 优先级（越小越先尝试）
+	Strip             int                   `gorm:"default:0" json:"strip"`                          // 去掉号码开头的位数
+	Prepend           string                `gorm:"type:varchar(20)" json:"prepend"`                 // 在号码前添加的前缀
+	TimeCondition     string                `gorm:"type:varchar(100)" json:"time_condition"`         // 生效时间（GotoIfTime 格式，如 09:00-18:00,mon-fri,*,*，为空表示全天）
+	TimeConditionID   *uint                 `gorm:"index" json:"time_condition_id"`                  // 生效时间条件（与 TimeCondition 二选一，支持时区和节假日）
+	PreferSameCarrier bool                  `gorm:"default:false" json:"prefer_same_carrier"`        // 优先使用与被叫号码同运营商的 SIM 卡
+	Enabled           bool                  `gorm:"default:true" json:"enabled"`                     // 是否启用
+	Targets           []OutboundRouteTarget `gorm:"foreignKey:RouteID" json:"targets"`               // 按顺序尝试的 dongle/组
+	CreatedAt         time.Time             `json:"created_at"`
+	UpdatedAt         time.Time             `json:"updated_at"`
+}
+
+// OutboundRouteTarget 外呼路由的一个目标（单个 dongle 或 dongle 组）
+type OutboundRouteTarget struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	RouteID  uint   `gorm:"not null;index" json:"route_id"`     // 所属路由
+	Position int    `gorm:"default:0" json:"position"`          // 尝试顺序
+	DongleID string `gorm:"type:varchar(100)" json:"dongle_id"` // Dongle 设备 ID（与 Group 二选一）
+	Group    *int   `json:"group,omitempty"`                    // Dongle 组号（使用组内第一个空闲设备）
+}
+
+// CarrierPrefix 号码前缀与运营商的对应关系（用于外呼同运营商优先）
+type CarrierPrefix struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Carrier   string    `gorm:"type:varchar(100);not null;index" json:"carrier"`     // 运营商名称（与 Dongle.Carrier 对应）
+	Prefix    string    `gorm:"type:varchar(20);not null;uniqueIndex" json:"prefix"` // 号码前缀（如 139）
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 来电振铃策略
+const (
+	RingStrategyRingAll    = "ringall"    // 所有成员同时振铃
+	RingStrategySequential = "sequential" // 按顺序逐个振铃
+	RingStrategyRoundRobin = "roundrobin" // 轮流从下一个成员开始顺序振铃
+	RingStrategyRandom     = "random"     // 随机从某个成员开始顺序振铃
+)
+
+// 无人接听时的最终去向
+const (
+	FinalDestHangup    = "hangup"    // 挂断
+	FinalDestExtension = "extension" // 转到另一个分机
+	FinalDestVoicemail = "voicemail" // 转到语音信箱
+	FinalDestExternal  = "external"  // 通过另一个 dongle 转到外部号码
+)
+
+// InboundRoute Dongle 来电路由（配置后替代该 dongle 的 inbound 绑定同时振铃）
+type InboundRoute struct {
+	ID               uint                 `gorm:"primaryKey" json:"id"`
+	DongleID         string               `gorm:"type:varchar(100);not null;uniqueIndex" json:"dongle_id"`    // Dongle 设备 ID（如 quectel0）
+	Strategy         string               `gorm:"type:varchar(20);not null;default:ringall" json:"strategy"`  // 振铃策略
+	RingTimeout      int                  `gorm:"default:30" json:"ring_timeout"`                             // ringall 的振铃时间（秒）
+	Members          []InboundRouteMember `gorm:"foreignKey:RouteID" json:"members"`                          // 振铃成员（按顺序）
+	FinalType        string               `gorm:"type:varchar(20);not null;default:hangup" json:"final_type"` // 无人接听时的去向
+	FinalTarget      string               `gorm:"type:varchar(100)" json:"final_target"`                      // 分机号、语音信箱号或外部号码
+	FinalDongleID    string               `gorm:"type:varchar(100)" json:"final_dongle_id"`                   // 转外部号码使用的 dongle
+	FinalTimeout     int                  `gorm:"default:30" json:"final_timeout"`                            // 转分机/外部号码的振铃时间（秒）
+	TimeConditionID  *uint                `gorm:"index" json:"time_condition_id"`                             // 工作时间条件（为空表示全天按成员振铃）
+	OffHoursType     string               `gorm:"type:varchar(20);default:hangup" json:"off_hours_type"`      // 非工作时间的去向（取值同 FinalType）
+	OffHoursTarget   string               `gorm:"type:varchar(100)" json:"off_hours_target"`                  // 非工作时间转到的分机号、语音信箱号或外部号码
+	OffHoursDongleID string               `gorm:"type:varchar(100)" json:"off_hours_dongle_id"`               // 非工作时间转外部号码使用的 dongle
+	Enabled          bool                 `gorm:"default:true" json:"enabled"`                                // 是否启用
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
+}
+
+// InboundRouteMember 来电路由的振铃成员
+type InboundRouteMember struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	RouteID     uint      `gorm:"not null;index" json:"route_id"`          // 所属来电路由
+	Position    int       `gorm:"default:0" json:"position"`               // 振铃顺序
+	ExtensionID uint      `gorm:"not null;index" json:"extension_id"`      // 关联的 Extension ID
+	Extension   Extension `gorm:"foreignKey:ExtensionID" json:"extension"` // 外键关联
+	Timeout     int       `gorm:"default:20" json:"timeout"`               // 顺序振铃时该成员的振铃时间（秒）
+}
+
+// 时间条件例外日期的类型
+const (
+	HolidayClosed = "closed" // 节假日，全天非工作时间
+	HolidayOpen   = "open"   // 调休上班，当天按工作时间段处理（忽略星期）
+)
+
+// TimeCondition 时间条件（每周工作时间 + 节假日例外），可被来电路由和外呼路由引用
+type TimeCondition struct {
+	ID        uint                   `gorm:"primaryKey" json:"id"`
+	Name      string                 `gorm:"type:varchar(100);not null;uniqueIndex" json:"name"` // 名称
+	Timezone  string                 `gorm:"type:varchar(64)" json:"timezone"`                   // IANA 时区（如 Asia/Shanghai），为空使用系统时区
+	Rules     []TimeConditionRule    `gorm:"foreignKey:ConditionID" json:"rules"`                // 每周工作时间（任一匹配即为工作时间）
+	Holidays  []TimeConditionHoliday `gorm:"foreignKey:ConditionID" json:"holidays"`             // 例外日期
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// TimeConditionRule 每周工作时间段
+type TimeConditionRule struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ConditionID uint   `gorm:"not null;index" json:"condition_id"`                  // 所属时间条件
+	Weekdays    string `gorm:"type:varchar(50);not null;default:*" json:"weekdays"` // 星期（GotoIfTime 格式，如 mon-fri、sat&sun、*）
+	StartTime   string `gorm:"type:varchar(5);not null" json:"start_time"`          // 开始时间 HH:MM
+	EndTime     string `gorm:"type:varchar(5);not null" json:"end_time"`            // 结束时间 HH:MM（不含），早于开始时间表示跨零点
+}
+
+// TimeConditionHoliday 例外日期（节假日或调休上班日）
+type TimeConditionHoliday struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ConditionID uint      `gorm:"not null;index" json:"condition_id"`                   // 所属时间条件
+	Name        string    `gorm:"type:varchar(255)" json:"name"`                        // 名称（如 国庆节）
+	StartDate   string    `gorm:"type:varchar(10);not null" json:"start_date"`          // 开始日期 YYYY-MM-DD
+	EndDate     string    `gorm:"type:varchar(10);not null" json:"end_date"`            // 结束日期 YYYY-MM-DD（含）
+	Kind        string    `gorm:"type:varchar(10);not null;default:closed" json:"kind"` // closed（休息）或 open（调休上班）
+	Source      string    `gorm:"type:varchar(20);default:manual" json:"source"`        // manual 或 ical
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 呼叫转移类型
+const (
+	ForwardUnconditional = "unconditional" // 无条件转移
+	ForwardBusy          = "busy"          // 分机忙或不可用时转移
+	ForwardNoAnswer      = "noanswer"      // 无人接听时转移
+)
+
+// 呼叫转移的主叫号码显示方式
+const (
+	ForwardCallerIDNetwork = "network" // 由网络决定（通常显示转发 SIM 卡的号码）
+	ForwardCallerIDHidden  = "hidden"  // 隐藏号码（CLIR）
+	ForwardCallerIDSMS     = "sms"     // 转接前先发短信告知原主叫号码
+)
+
+// CallForward Dongle 来电转移到外部号码
+type CallForward struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	DongleID        string    `gorm:"type:varchar(100);not null;index" json:"dongle_id"`      // 来电的 dongle
+	Mode            string    `gorm:"type:varchar(20);not null" json:"mode"`                  // 转移类型
+	Number          string    `gorm:"type:varchar(50);not null" json:"number"`                // 转移到的外部号码
+	ViaDongleID     string    `gorm:"type:varchar(100)" json:"via_dongle_id"`                 // 呼出使用的 dongle（为空表示同一个，需要模块支持多路通话）
+	Timeout         int       `gorm:"default:60" json:"timeout"`                              // 外部号码振铃时间（秒）
+	CallerIDMode    string    `gorm:"type:varchar(20);default:network" json:"caller_id_mode"` // 主叫号码显示方式
+	TimeConditionID *uint     `gorm:"index" json:"time_condition_id"`                         // 时间条件（为空表示始终生效）
+	ActiveWhen      string    `gorm:"type:varchar(10);default:open" json:"active_when"`       // open：工作时间生效；closed：非工作时间生效
+	Enabled         bool      `gorm:"default:true" json:"enabled"`                            // 是否启用
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// 黑白名单类型
+const (
+	BlockListBlock = "block" // 黑名单
+	BlockListAllow = "allow" // 白名单（优先于黑名单）
+)
+
+// 号码匹配方式
+const (
+	BlockMatchExact     = "exact"     // 完全匹配
+	BlockMatchPrefix    = "prefix"    // 前缀匹配
+	BlockMatchRegex     = "regex"     // 正则匹配
+	BlockMatchAnonymous = "anonymous" // 隐藏号码/无主叫号码
+)
+
+// 黑名单来电处理方式（短信命中黑名单时 drop 直接丢弃，其他方式保存但不推送）
+const (
+	BlockActionReject    = "reject"    // 拒接
+	BlockActionBusy      = "busy"      // 回忙音
+	BlockActionVoicemail = "voicemail" // 转语音信箱
+	BlockActionDrop      = "drop"      // 静默丢弃（不振铃任何分机，对方听到无人接听）
+)
+
+// BlockedNumber 来电/短信黑白名单
+type BlockedNumber struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	List         string     `gorm:"type:varchar(10);not null;default:block;index" json:"list"` // block 或 allow
+	MatchType    string     `gorm:"type:varchar(20);not null" json:"match_type"`               // 匹配方式
+	Pattern      string     `gorm:"type:varchar(255)" json:"pattern"`                          // 号码、前缀或正则（anonymous 时为空）
+	Action       string     `gorm:"type:varchar(20);default:reject" json:"action"`             // 来电处理方式（仅黑名单）
+	VoicemailBox string     `gorm:"type:varchar(100)" json:"voicemail_box"`                    // action 为 voicemail 时的信箱（分机号）
+	DongleID     string     `gorm:"type:varchar(100);index" json:"dongle_id"`                  // 只对某个 dongle 生效（为空表示全部）
+	Calls        bool       `gorm:"default:true" json:"calls"`                                 // 对来电生效
+	SMS          bool       `gorm:"default:true" json:"sms"`                                   // 对短信生效
+	Note         string     `gorm:"type:varchar(255)" json:"note"`                             // 备注
+	Enabled      bool       `gorm:"default:true" json:"enabled"`                               // 是否启用
+	Hits         int64      `gorm:"default:0" json:"hits"`                                     // 命中次数
+	LastHitAt    *time.Time `json:"last_hit_at"`                                               // 最近命中时间
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// CallRecord 通话记录
+type CallRecord struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	DongleID        string    `gorm:"type:varchar(100);not null;index" json:"dongle_id"`       // Dongle 设备 ID（如 quectel0）
+	Direction       string    `gorm:"type:varchar(10);default:inbound;index" json:"direction"` // 方向：inbound 或 outbound
+	Number          string    `gorm:"type:varchar(50);index" json:"number"`                    // 对方号码（隐藏号码为空）
+	Action          string    `gorm:"type:varchar(20)" json:"action"`                          // allow 或黑名单处理方式
+	BlockedNumberID *uint     `json:"blocked_number_id"`                                       // 命中的黑名单条目
+	UniqueID        string    `gorm:"type:varchar(64);index" json:"unique_id"`                 // Asterisk 通道 UNIQUEID（用于关联录音）
+	CreatedAt       time.Time `gorm:"index" json:"created_at"`
+}
+
+// 录音策略（分机和 dongle 任一方为 always 时自动录音，任一方为 ondemand 时可在通话中按键录音）
+const (
+	RecordingAlways   = "always"   // 自动录音
+	RecordingOnDemand = "ondemand" // 通话中按键开始/停止录音
+	RecordingNever    = "never"    // 不录音
+)
+
+// Recording 通话录音文件
+type Recording struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CallRecordID *uint     `gorm:"index" json:"call_record_id"`             // 关联的通话记录
+	UniqueID     string    `gorm:"type:varchar(64);index" json:"unique_id"` // 主叫通道 UNIQUEID
+	DongleID     string    `gorm:"type:varchar(100);index" json:"dongle_id"`
+	Extension    string    `gorm:"type:varchar(100);index" json:"extension"`
+	Direction    string    `gorm:"type:varchar(10);index" json:"direction"`                 // inbound 或 outbound
+	Number       string    `gorm:"type:varchar(50);index" json:"number"`                    // 对方号码
+	FileName     string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"file_name"` // 录音目录下的文件名
+	Size         int64     `json:"size"`                                                    // 文件大小（字节）
+	Duration     int       `json:"duration"`                                                // 录音时长（秒，按文件大小估算）
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
 // DongleBinding Dongle 来去电绑定关系
 // 注意：一个 dongle 可以绑定多个 extension（移除了 uniqueIndex）
 type DongleBinding struct {
@@ -133,19 +392,137 @@ type SMSMessage struct {
 	Direction    string     `gorm:"type:varchar(10);default:inbound;index" json:"direction"` // 方向：inbound（接收）或 outbound（发送）
 	SMSIndex     int        `gorm:"index" json:"sms_index"`                                  // SIM 卡短信索引
 	SMSTimestamp *time.Time `json:"sms_timestamp"`                                           // SIM 卡短信时间戳
+
+	// 长短信分段信息（PartsTotal 为 0 表示普通短信）
+	ConcatRef     int    `json:"concat_ref"`                            // 分段参考号
+	PartsTotal    int    `gorm:"default:0" json:"parts_total"`          // 总段数
+	PartsReceived int    `gorm:"default:0" json:"parts_received"`       // 实际收到的段数（小于总段数表示超时未收齐）
+	PartIndexes   string `gorm:"type:varchar(255)" json:"part_indexes"` // 各分段的 SIM 卡索引（逗号分隔）
+
+	Blocked      bool       `gorm:"default:false;index" json:"blocked"`                      // 命中黑名单（保存但不推送）
 	Pushed       bool       `gorm:"default:false;index" json:"pushed"`                       // 是否已推送
 	PushedAt     *time.Time `json:"pushed_at"`                                               // 推送时间
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
-// AdminUser 管理员用户
-type AdminUser struct {
+// USSDSession USSD 会话（一次 USSD 请求及其后续菜单交互）
+type USSDSession struct {
+	ID        uint          `gorm:"primaryKey" json:"id"`
+	DongleID  string        `gorm:"type:varchar(100);not null;index" json:"dongle_id"`    // Dongle 设备 ID（如 quectel0）
+	Code      string        `gorm:"type:varchar(100)" json:"code"`                        // 发起会话的 USSD 代码（如 *100#），网络主动发起时为空
+	Status    string        `gorm:"type:varchar(20);default:pending;index" json:"status"` // pending, waiting_input, completed, timeout, failed, cancelled
+	Messages  []USSDMessage `gorm:"foreignKey:SessionID" json:"messages,omitempty"`       // 会话中的请求和响应
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// USSDMessage USSD 会话中的一条请求或响应
+type USSDMessage struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Email     string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"email"`   // OIDC 返回的邮箱
-	Name      string    `gorm:"type:varchar(255)" json:"name"`                         // 用户名
-	Subject   string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"subject"` // OIDC subject (唯一标识)
+	SessionID uint      `gorm:"not null;index" json:"session_id"`           // 所属会话
+	Direction string    `gorm:"type:varchar(10);not null" json:"direction"` // outbound（发送的代码/菜单选项）或 inbound（网络响应）
+	Content   string    `gorm:"type:text" json:"content"`                   // 内容
+	Type      int       `gorm:"default:0" json:"type"`                      // 响应类型（+CUSD 的 <m>，仅 inbound）
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BalanceCheckProfile 余额/套餐查询配置（每个 dongle 可以有多个）
+type BalanceCheckProfile struct {
+	ID             uint    `gorm:"primaryKey" json:"id"`
+	DongleID       string  `gorm:"type:varchar(100);not null;index" json:"dongle_id"`    // Dongle 设备 ID（如 quectel0）
+	Name           string  `gorm:"type:varchar(100)" json:"name"`                        // 名称（如 话费余额、流量套餐）
+	Enabled        bool    `gorm:"default:true" json:"enabled"`                          // 是否启用定时查询
+	Method         string  `gorm:"type:varchar(10);not null;default:ussd" json:"method"` // 查询方式：ussd 或 sms
+	USSDCode       string  `gorm:"type:varchar(64)" json:"ussd_code"`                    // USSD 代码（如 *100#）
+	SMSNumber      string  `gorm:"type:varchar(50)" json:"sms_number"`                   // 查询短信发送到的短号码（如 10086）
+	SMSText        string  `gorm:"type:varchar(255)" json:"sms_text"`                    // 查询短信内容（如 YE）
+	ReplyFrom      string  `gorm:"type:varchar(50)" json:"reply_from"`                   // 回复短信的发送号码（为空时与 SMSNumber 相同）
+	BalanceRegex   string  `gorm:"type:varchar(500)" json:"balance_regex"`               // 提取余额的正则（第一个分组为金额）
+	ExpiryRegex    string  `gorm:"type:varchar(500)" json:"expiry_regex"`                // 提取有效期的正则（第一个分组为日期，可选）
+	ExpiryLayout   string  `gorm:"type:varchar(50)" json:"expiry_layout"`                // 有效期日期格式（Go 时间格式，为空时尝试常见格式）
+	Threshold      float64 `json:"threshold"`                                            // 低余额告警阈值（0 表示不告警）
+	ExpiryWarnDays int     `gorm:"default:7" json:"expiry_warn_days"`                    // 有效期到期前多少天告警
+	IntervalHours  int     `gorm:"default:168" json:"interval_hours"`                    // 查询间隔（小时，默认每周）
+
+	// 最近一次查询结果
+	LastCheckAt         *time.Time `json:"last_check_at"`
+	LastBalance         *float64   `json:"last_balance"`
+	LastExpiry          *time.Time `json:"last_expiry"`
+	LastError           string     `gorm:"type:text" json:"last_error"`
+	ConsecutiveFailures int        `gorm:"default:0" json:"consecutive_failures"`
+
+	// 告警状态（恢复后重置，避免重复告警）
+	LowBalanceAlerted bool `gorm:"default:false" json:"low_balance_alerted"`
+	ExpiryAlerted     bool `gorm:"default:false" json:"expiry_alerted"`
+	FailureAlerted    bool `gorm:"default:false" json:"failure_alerted"`
+
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BalanceRecord 余额查询历史
+type BalanceRecord struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ProfileID   uint       `gorm:"not null;index" json:"profile_id"`                  // 所属查询配置
+	DongleID    string     `gorm:"type:varchar(100);not null;index" json:"dongle_id"` // Dongle 设备 ID
+	Success     bool       `gorm:"default:false" json:"success"`                      // 是否成功解析出余额
+	Balance     *float64   `json:"balance"`                                           // 余额
+	Expiry      *time.Time `json:"expiry"`                                            // 有效期
+	RawResponse string     `gorm:"type:text" json:"raw_response"`                     // 原始 USSD/短信回复
+	Error       string     `gorm:"type:text" json:"error"`                            // 失败原因
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// 用户角色
+const (
+	RoleAdmin    = "admin"    // 管理员：所有操作
+	RoleOperator = "operator" // 操作员：查看数据、发送短信
+	RoleViewer   = "viewer"   // 只读
+)
+
+// AdminUser 登录用户（第一个登录的用户成为管理员，其他用户需要邀请）
+type AdminUser struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Email      *string   `gorm:"type:varchar(255)" json:"email"`                        // OIDC 返回的邮箱（可能没有，也可能重复，用户以 subject 区分）
+	Name       string    `gorm:"type:varchar(255)" json:"name"`                         // 用户名
+	Subject    string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"subject"` // OIDC subject (唯一标识)
+	Role       string    `gorm:"type:varchar(20);not null;default:admin" json:"role"`   // 角色：admin、operator、viewer（升级前的用户都是管理员）
+	DongleIDs  string    `gorm:"type:text" json:"dongle_ids"`                           // 可以访问的 dongle（逗号分隔的设备 ID，空表示没有），管理员不受限制
+	AllDongles bool      `gorm:"not null;default:false" json:"all_dongles"`             // 可以访问所有 dongle（包括以后添加的）
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// 邀请匹配方式
+const (
+	InviteByEmail   = "email"   // 邮箱（不区分大小写，首次登录后失效）
+	InviteBySubject = "subject" // OIDC subject（首次登录后失效）
+	InviteByGroup   = "group"   // userinfo 群组声明中的群组（一直有效，群组成员首次登录时创建用户）
+)
+
+// UserInvite 用户邀请，首次登录时按邮箱、OIDC subject 或群组匹配，以邀请中的角色和 dongle 范围创建用户
+type UserInvite struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Kind       string    `gorm:"type:varchar(20);not null" json:"kind"`   // email、subject 或 group
+	Value      string    `gorm:"type:varchar(255);not null" json:"value"` // 邮箱、subject 或群组名
+	Role       string    `gorm:"type:varchar(20);not null" json:"role"`
+	DongleIDs  string    `gorm:"type:text" json:"dongle_ids"` // 逗号分隔的设备 ID，空表示没有
+	AllDongles bool      `gorm:"not null;default:false" json:"all_dongles"`
+	CreatedBy  uint      `json:"created_by"` // 发出邀请的管理员
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Session 登录会话（cookie 中保存随机令牌，数据库只保存令牌的 SHA-256 哈希）
+type Session struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TokenHash   string    `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	AdminUserID uint      `gorm:"not null;index" json:"admin_user_id"`
+	AdminUser   AdminUser `gorm:"foreignKey:AdminUserID;constraint:OnDelete:CASCADE" json:"-"`
+	IP          string    `gorm:"type:varchar(64)" json:"ip"`          // 登录时的客户端 IP
+	UserAgent   string    `gorm:"type:varchar(500)" json:"user_agent"` // 登录时的浏览器 User-Agent
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"` // 空闲超时时间，每次访问时顺延（不超过最长有效期）
 }
 
 // AutoMigrate 自动迁移所有表
@@ -160,5 +537,24 @@ func AutoMigrate(db *gorm.DB) error {
 		&SMSMessage{},
 		&GlobalConfig{},
 		&AdminUser{},
+		&Session{},
+		&UserInvite{},
+		&USSDSession{},
+		&USSDMessage{},
+		&BalanceCheckProfile{},
+		&BalanceRecord{},
+		&DongleIdentityHistory{},
+		&OutboundRoute{},
+		&OutboundRouteTarget{},
+		&CarrierPrefix{},
+		&InboundRoute{},
+		&InboundRouteMember{},
+		&TimeCondition{},
+		&TimeConditionRule{},
+		&TimeConditionHoliday{},
+		&CallForward{},
+		&BlockedNumber{},
+		&CallRecord{},
+		&Recording{},
 	)
 }
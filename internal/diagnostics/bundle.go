@@ -0,0 +1,172 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sensitiveKeys 配置项名包含这些词时隐藏其值（AMI 密码、SIP 密码等）
+var sensitiveKeys = []string{"secret", "password", "passwd", "token"}
+
+// redacted 隐藏后的配置值
+const redacted = "********"
+
+// Bundle 诊断包（tar.gz），所有文件放在 root 目录下
+// 单项收集失败不会中断打包，失败原因在 Close 时写入 errors.txt
+type Bundle struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	root    string
+	now     time.Time
+	errs    []string
+	secrets [][]byte // 在所有文件中隐藏的敏感值
+}
+
+// NewBundle 创建写入 w 的诊断包
+func NewBundle(w io.Writer, root string) *Bundle {
+	gz := gzip.NewWriter(w)
+	return &Bundle{
+		gz:   gz,
+		tw:   tar.NewWriter(gz),
+		root: root,
+		now:  time.Now(),
+	}
+}
+
+// RedactValues 在之后添加的所有文件中隐藏这些值（如会出现在 Asterisk 日志中的回调密钥）
+func (b *Bundle) RedactValues(values ...string) {
+	for _, v := range values {
+		if v != "" {
+			b.secrets = append(b.secrets, []byte(v))
+		}
+	}
+}
+
+// AddFile 添加文件
+func (b *Bundle) AddFile(name string, data []byte) error {
+	for _, secret := range b.secrets {
+		data = bytes.ReplaceAll(data, secret, []byte(redacted))
+	}
+	hdr := &tar.Header{
+		Name:    path.Join(b.root, name),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: b.now,
+	}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(data)
+	return err
+}
+
+// AddJSON 添加 JSON 文件
+func (b *Bundle) AddJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.AddFile(name, append(data, '\n'))
+}
+
+// AddError 记录收集失败的项
+func (b *Bundle) AddError(name string, err error) {
+	b.errs = append(b.errs, fmt.Sprintf("%s: %v", name, err))
+}
+
+// AddConfigDir 添加目录下的 Asterisk 配置文件（*.conf），隐藏密码等敏感配置项
+func (b *Bundle) AddConfigDir(prefix, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			b.AddError(file, err)
+			continue
+		}
+		if err := b.AddFile(path.Join(prefix, filepath.Base(file)), RedactConfig(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddFileTail 添加文件的最后 max 字节（日志文件）
+func (b *Bundle) AddFileTail(name, file string, max int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > max {
+		if _, err := f.Seek(-max, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(f, max))
+	if err != nil {
+		return err
+	}
+	return b.AddFile(name, data)
+}
+
+// Close 写入 errors.txt（如果有失败的项）并结束打包
+func (b *Bundle) Close() error {
+	if len(b.errs) > 0 {
+		if err := b.AddFile("errors.txt", []byte(strings.Join(b.errs, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+// RedactConfig 隐藏 Asterisk 配置文件中的敏感配置项（key = value 或 key => value）
+func RedactConfig(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		text := string(line)
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		eq := strings.Index(text, "=")
+		if eq < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(text[:eq]))
+		for _, sensitive := range sensitiveKeys {
+			if strings.Contains(key, sensitive) {
+				sep := "="
+				if strings.HasPrefix(text[eq:], "=>") {
+					sep = "=>"
+				}
+				value := text[eq+len(sep):]
+				space := value[:len(value)-len(strings.TrimLeft(value, " \t"))]
+				lines[i] = []byte(text[:eq] + sep + space + redacted)
+				break
+			}
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -0,0 +1,46 @@
+package diagnostics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogBufferKeepsRecentLines(t *testing.T) {
+	b := NewLogBuffer(3)
+	for _, line := range []string{"one\n", "two\n", "three\nfour\n", "fi"} {
+		b.Write([]byte(line))
+	}
+	b.Write([]byte("ve\n"))
+
+	if got, want := strings.Join(b.Lines(), ","), "three,four,five"; got != want {
+		t.Fatalf("lines = %s, want %s", got, want)
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	conf := "[admin]\n" +
+		"secret = 123456\n" +
+		"; password = commented\n" +
+		"read = all\n" +
+		"[6001]\n" +
+		"type=auth\n" +
+		"password=abc\n" +
+		"auth_token => xyz\n" +
+		"[globals]\n" +
+		"INGEST_TOKEN=f00d\n"
+
+	got := string(RedactConfig([]byte(conf)))
+	want := "[admin]\n" +
+		"secret = ********\n" +
+		"; password = commented\n" +
+		"read = all\n" +
+		"[6001]\n" +
+		"type=auth\n" +
+		"password=********\n" +
+		"auth_token => ********\n" +
+		"[globals]\n" +
+		"INGEST_TOKEN=********\n"
+	if got != want {
+		t.Fatalf("redacted config:\n%s\nwant:\n%s", got, want)
+	}
+}
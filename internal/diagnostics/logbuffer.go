@@ -0,0 +1,71 @@
+// Package diagnostics 收集问题排查用的诊断信息（最近日志、Asterisk 命令输出、渲染后的配置文件和版本），打包为 tar.gz
+package diagnostics
+
+import (
+	"strings"
+	"sync"
+)
+
+// defaultLogLines 日志缓冲区保留的行数
+const defaultLogLines = 2000
+
+// LogBuffer 保留最近若干行日志的环形缓冲区（实现 io.Writer，作为 log 的额外输出）
+type LogBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int    // 下一行写入的位置
+	full    bool   // 缓冲区已写满一轮
+	partial string // 还没有换行的半行
+}
+
+var (
+	globalLogBuffer *LogBuffer
+	logBufferOnce   sync.Once
+)
+
+// GetLogBuffer 获取全局日志缓冲区
+func GetLogBuffer() *LogBuffer {
+	logBufferOnce.Do(func() {
+		globalLogBuffer = NewLogBuffer(defaultLogLines)
+	})
+	return globalLogBuffer
+}
+
+// NewLogBuffer 创建保留最近 size 行的日志缓冲区
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{lines: make([]string, size)}
+}
+
+// Write 追加日志（按行保存）
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	text := b.partial + string(p)
+	parts := strings.Split(text, "\n")
+	b.partial = parts[len(parts)-1]
+	for _, line := range parts[:len(parts)-1] {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % len(b.lines)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+	return len(p), nil
+}
+
+// Lines 按时间顺序返回保留的日志行
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lines []string
+	if b.full {
+		lines = append(lines, b.lines[b.next:]...)
+	}
+	lines = append(lines, b.lines[:b.next]...)
+	if b.partial != "" {
+		lines = append(lines, b.partial)
+	}
+	return lines
+}
@@ -0,0 +1,29 @@
+package diagnostics
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Versions webpanel 构建信息和运行环境
+func Versions() map[string]string {
+	versions := map[string]string{
+		"go":       runtime.Version(),
+		"platform": runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		versions["module"] = info.Main.Path + " " + info.Main.Version
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				versions[setting.Key] = setting.Value
+			}
+		}
+	}
+	if data, err := os.ReadFile("/proc/version"); err == nil {
+		versions["kernel"] = strings.TrimSpace(string(data))
+	}
+	return versions
+}
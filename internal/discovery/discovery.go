@@ -0,0 +1,148 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// Discover 扫描 USB 调制解调器，读取 IMEI 并标记已被 Dongle 记录认领的设备
+// data 端口被 chan_quectel 锁定时不打开串口，而是通过 AMI 查询使用该端口的 Dongle 的 IMEI
+func (s *Scanner) Discover() ([]Modem, error) {
+	modems, err := s.Scan()
+	if err != nil {
+		return nil, err
+	}
+
+	var dongles []database.Dongle
+	if err := database.DB.Find(&dongles).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range modems {
+		m := &modems[i]
+		if m.Data == "" {
+			m.Error = "AT port not found"
+			continue
+		}
+
+		imei, err := s.ReadIMEI(m.Data)
+		switch {
+		case err == nil:
+			m.IMEI = imei
+			m.IMEISource = "at"
+		case errors.Is(err, ErrPortLocked):
+			m.Locked = true
+			if d := dongleByPort(dongles, m.Data); d != nil {
+				if status := ami.GetManager().GetDongleStatus(d.DeviceID); status != nil && status.IMEI != "" {
+					m.IMEI = status.IMEI
+					m.IMEISource = "ami"
+				}
+			}
+			if m.IMEI == "" {
+				m.Error = err.Error()
+			}
+		default:
+			m.Error = err.Error()
+		}
+
+		if d := claimedBy(dongles, m); d != nil {
+			m.DongleID = d.DeviceID
+		}
+	}
+	return modems, nil
+}
+
+// Reconcile 将已绑定 IMEI 的 Dongle 记录的端口更新为该模块当前的端口
+// 返回端口发生变化的 Dongle 设备 ID，调用方负责重新渲染 quectel.conf 并 reload
+func (s *Scanner) Reconcile() ([]string, error) {
+	modems, err := s.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, m := range modems {
+		if m.IMEI == "" || m.Data == "" {
+			continue
+		}
+
+		var dongle database.Dongle
+		if err := database.DB.Where("imei = ?", m.IMEI).First(&dongle).Error; err != nil {
+			continue
+		}
+		if dongle.Data == m.Data && dongle.Audio == m.Audio && dongle.Device == m.Device {
+			continue
+		}
+
+		log.Printf("[Discovery] Dongle %s (IMEI %s) moved: data %s -> %s, audio %s -> %s",
+			dongle.DeviceID, m.IMEI, dongle.Data, m.Data, dongle.Audio, m.Audio)
+		if err := database.DB.Model(&database.Dongle{}).Where("id = ?", dongle.ID).Updates(map[string]interface{}{
+			"device": m.Device,
+			"audio":  m.Audio,
+			"data":   m.Data,
+		}).Error; err != nil {
+			log.Printf("[Discovery] Failed to update ports for %s: %v", dongle.DeviceID, err)
+			continue
+		}
+		changed = append(changed, dongle.DeviceID)
+	}
+	return changed, nil
+}
+
+// FindByIMEI 查找指定 IMEI 的模块
+func (s *Scanner) FindByIMEI(imei string) (*Modem, error) {
+	modems, err := s.Discover()
+	if err != nil {
+		return nil, err
+	}
+	for i := range modems {
+		if modems[i].IMEI == imei {
+			return &modems[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// DataPort 获取 dongle 的数据端口（AT 命令使用，如 "/dev/ttyUSB2"）
+// 端口在模块重新枚举后由 Reconcile 按 IMEI 更新
+func DataPort(dongleID string) (string, error) {
+	var dongle database.Dongle
+	if err := database.DB.Where("device_id = ?", dongleID).First(&dongle).Error; err != nil {
+		return "", fmt.Errorf("unknown dongle ID: %s", dongleID)
+	}
+	if dongle.Data == "" {
+		return "", fmt.Errorf("dongle %s has no data port configured", dongleID)
+	}
+	return dongle.Data, nil
+}
+
+// dongleByPort 查找配置为使用该 data 端口的 Dongle
+func dongleByPort(dongles []database.Dongle, data string) *database.Dongle {
+	for i := range dongles {
+		if dongles[i].Data == data {
+			return &dongles[i]
+		}
+	}
+	return nil
+}
+
+// claimedBy 查找认领该模块的 Dongle：优先按 IMEI 匹配，没有 IMEI 记录的 Dongle 按 data 端口匹配
+func claimedBy(dongles []database.Dongle, m *Modem) *database.Dongle {
+	if m.IMEI != "" {
+		for i := range dongles {
+			if dongles[i].IMEI == m.IMEI {
+				return &dongles[i]
+			}
+		}
+	}
+	for i := range dongles {
+		if dongles[i].IMEI == "" && dongles[i].Data == m.Data {
+			return &dongles[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/at"
+)
+
+// ErrPortLocked 串口被其他进程（通常是 Asterisk 的 chan_quectel）锁定
+var ErrPortLocked = errors.New("serial port is locked by another process")
+
+// imeiRegex 匹配 AT+GSN 响应中的 15 位 IMEI
+var imeiRegex = regexp.MustCompile(`\b(\d{15})\b`)
+
+// lockPath 返回串口的 UUCP 风格锁文件路径（如 /var/lock/LCK..ttyUSB2）
+func (s *Scanner) lockPath(port string) string {
+	return filepath.Join(s.LockDir, "LCK.."+filepath.Base(port))
+}
+
+// IsLocked 检查串口是否被存活的进程锁定（过期的锁文件视为未锁定）
+func (s *Scanner) IsLocked(port string) bool {
+	data, err := os.ReadFile(s.lockPath(port))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		// 无法解析的锁文件，保守处理为已锁定
+		return true
+	}
+	return processAlive(pid)
+}
+
+// processAlive 检查进程是否存在
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// ReadIMEI 通过 AT+GSN 读取模块 IMEI
+// 端口被锁定时返回 ErrPortLocked，不会打开串口；读取期间创建自己的锁文件，防止 chan_quectel 同时打开
+func (s *Scanner) ReadIMEI(port string) (string, error) {
+	if s.IsLocked(port) {
+		return "", ErrPortLocked
+	}
+
+	lock := s.lockPath(port)
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err == nil {
+		fmt.Fprintf(f, "%10d\n", os.Getpid())
+		f.Close()
+		defer os.Remove(lock)
+	}
+
+	resp, err := at.NewCommandExecutor(port).ExecuteCommand("AT+GSN", 3*time.Second)
+	if err != nil {
+		return "", err
+	}
+	m := imeiRegex.FindStringSubmatch(resp)
+	if m == nil {
+		return "", fmt.Errorf("no IMEI in response: %q", strings.TrimSpace(resp))
+	}
+	return m[1], nil
+}
@@ -0,0 +1,30 @@
+package discovery
+
+// modelInfo 已知 USB 调制解调器型号及其串口接口分配
+type modelInfo struct {
+	Vendor     string
+	Model      string
+	AudioIface int // chan_quectel audio 端口对应的 USB 接口号
+	DataIface  int // AT 命令（data）端口对应的 USB 接口号
+}
+
+// knownModems 按 "VID:PID" 索引的已知型号
+// Quectel 模块的接口分配：if00 DM、if01 NMEA/语音、if02 AT、if03 PPP
+// Huawei 语音棒（E1550/E173 等）：if00 PPP、if01 语音、if02 AT
+var knownModems = map[string]modelInfo{
+	"2c7c:0121": {Vendor: "Quectel", Model: "EC21", AudioIface: 1, DataIface: 2},
+	"2c7c:0125": {Vendor: "Quectel", Model: "EC25/EC20/EG25", AudioIface: 1, DataIface: 2},
+	"2c7c:0191": {Vendor: "Quectel", Model: "EG91", AudioIface: 1, DataIface: 2},
+	"2c7c:0195": {Vendor: "Quectel", Model: "EG95", AudioIface: 1, DataIface: 2},
+	"2c7c:0306": {Vendor: "Quectel", Model: "EP06/EG06/EM06", AudioIface: 1, DataIface: 2},
+	"12d1:1001": {Vendor: "Huawei", Model: "E1550/E169/E173", AudioIface: 1, DataIface: 2},
+	"12d1:140c": {Vendor: "Huawei", Model: "E173/E1752", AudioIface: 1, DataIface: 2},
+	"12d1:1436": {Vendor: "Huawei", Model: "E1750/E173", AudioIface: 1, DataIface: 2},
+	"12d1:1506": {Vendor: "Huawei", Model: "E3131/E367", AudioIface: 1, DataIface: 2},
+}
+
+// lookupModel 根据 VID/PID 查找已知型号
+func lookupModel(vendorID, productID string) (modelInfo, bool) {
+	info, ok := knownModems[vendorID+":"+productID]
+	return info, ok
+}
@@ -0,0 +1,165 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Port 调制解调器的一个 USB 串口
+type Port struct {
+	Name      string `json:"name"`            // 内核设备名（如 ttyUSB2）
+	Path      string `json:"path"`            // 设备节点（如 /dev/ttyUSB2）
+	Interface int    `json:"interface"`       // USB 接口号（bInterfaceNumber）
+	ByID      string `json:"by_id,omitempty"` // /dev/serial/by-id 下的稳定链接（可能不存在）
+}
+
+// Modem 扫描到的一个 USB 调制解调器（一个 USB 设备对应多个串口）
+type Modem struct {
+	USBPath   string `json:"usb_path"`   // sysfs 中的 USB 设备名（如 1-1.2，对应物理 USB 口）
+	VendorID  string `json:"vendor_id"`  // 如 2c7c
+	ProductID string `json:"product_id"` // 如 0125
+	Vendor    string `json:"vendor"`
+	Model     string `json:"model"`
+	Serial    string `json:"serial,omitempty"`
+	Ports     []Port `json:"ports"`
+
+	// chan_quectel 需要的端口（按型号的接口分配推算）
+	Device string `json:"device"` // 第一个串口
+	Audio  string `json:"audio"`
+	Data   string `json:"data"`
+
+	IMEI       string `json:"imei,omitempty"`
+	IMEISource string `json:"imei_source,omitempty"` // at：直接读取串口；ami：端口被 Asterisk 占用，通过 AMI 获取
+	Locked     bool   `json:"locked"`                // data 端口是否被其他进程锁定（通常是 chan_quectel）
+	DongleID   string `json:"dongle_id,omitempty"`   // 已绑定的 Dongle 设备 ID（为空表示未认领）
+	Error      string `json:"error,omitempty"`       // 读取 IMEI 失败的原因
+}
+
+// Scanner 通过 sysfs 扫描 USB 串口设备
+// 各个根目录可替换，便于在测试中使用伪造的 sysfs
+type Scanner struct {
+	SysfsRoot string // 默认 /sys
+	DevRoot   string // 默认 /dev
+	LockDir   string // 串口锁文件目录，默认 /var/lock
+}
+
+// NewScanner 创建使用系统默认路径的扫描器
+func NewScanner() *Scanner {
+	return &Scanner{
+		SysfsRoot: "/sys",
+		DevRoot:   "/dev",
+		LockDir:   "/var/lock",
+	}
+}
+
+// Scan 扫描 /sys/bus/usb-serial/devices，按 USB 设备分组并识别已知型号
+// 只返回串口，不读取 IMEI
+func (s *Scanner) Scan() ([]Modem, error) {
+	serialDir := filepath.Join(s.SysfsRoot, "bus", "usb-serial", "devices")
+	entries, err := os.ReadDir(serialDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Modem{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", serialDir, err)
+	}
+
+	byID := s.serialByID()
+	modems := make(map[string]*Modem)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		// ttyUSB2 -> /sys/devices/.../1-1.2/1-1.2:1.2/ttyUSB2
+		real, err := filepath.EvalSymlinks(filepath.Join(serialDir, name))
+		if err != nil {
+			continue
+		}
+		ifaceDir := filepath.Dir(real)
+		usbDir := filepath.Dir(ifaceDir)
+
+		vendorID := readAttr(usbDir, "idVendor")
+		productID := readAttr(usbDir, "idProduct")
+		info, ok := lookupModel(vendorID, productID)
+		if !ok {
+			continue
+		}
+
+		iface, err := strconv.ParseInt(readAttr(ifaceDir, "bInterfaceNumber"), 16, 32)
+		if err != nil {
+			continue
+		}
+
+		usbPath := filepath.Base(usbDir)
+		m, ok := modems[usbPath]
+		if !ok {
+			m = &Modem{
+				USBPath:   usbPath,
+				VendorID:  vendorID,
+				ProductID: productID,
+				Vendor:    info.Vendor,
+				Model:     info.Model,
+				Serial:    readAttr(usbDir, "serial"),
+			}
+			modems[usbPath] = m
+		}
+
+		m.Ports = append(m.Ports, Port{
+			Name:      name,
+			Path:      filepath.Join(s.DevRoot, name),
+			Interface: int(iface),
+			ByID:      byID[name],
+		})
+	}
+
+	result := make([]Modem, 0, len(modems))
+	for _, m := range modems {
+		sort.Slice(m.Ports, func(i, j int) bool { return m.Ports[i].Interface < m.Ports[j].Interface })
+		info, _ := lookupModel(m.VendorID, m.ProductID)
+		for _, p := range m.Ports {
+			if m.Device == "" {
+				m.Device = p.Path
+			}
+			switch p.Interface {
+			case info.AudioIface:
+				m.Audio = p.Path
+			case info.DataIface:
+				m.Data = p.Path
+			}
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].USBPath < result[j].USBPath })
+	return result, nil
+}
+
+// serialByID 读取 /dev/serial/by-id，返回内核设备名到稳定链接的映射
+func (s *Scanner) serialByID() map[string]string {
+	result := make(map[string]string)
+	dir := filepath.Join(s.DevRoot, "serial", "by-id")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return result
+	}
+	for _, entry := range entries {
+		link := filepath.Join(dir, entry.Name())
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		result[filepath.Base(target)] = link
+	}
+	return result
+}
+
+// readAttr 读取 sysfs 属性文件（去掉首尾空白），失败返回空字符串
+func readAttr(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,265 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/events"
+)
+
+// 热插拔事件类型
+const (
+	EventAdded   = "added"   // 模块插入
+	EventRemoved = "removed" // 模块拔出
+)
+
+const (
+	// defaultPollInterval sysfs 轮询间隔
+	defaultPollInterval = 3 * time.Second
+	// settleDelay 模块插入后等待其完成启动（AT 端口可用）的时间
+	settleDelay = 10 * time.Second
+	// maxEvents 保留的最近事件数量
+	maxEvents = 100
+)
+
+// Event 热插拔事件
+type Event struct {
+	Type     string    `json:"type"`
+	USBPath  string    `json:"usb_path"`
+	Modem    Modem     `json:"modem"`
+	DongleID string    `json:"dongle_id,omitempty"` // 受影响的 Dongle（未绑定时为空）
+	Time     time.Time `json:"time"`
+}
+
+// AlertFunc 告警回调（source 为设备 ID）
+type AlertFunc func(source, message string)
+
+// Watcher 轮询 sysfs，检测 USB 调制解调器的插拔
+// 只对受影响的设备执行 quectel restart，不重新加载整个 chan_quectel 模块
+type Watcher struct {
+	scanner  *Scanner
+	interval time.Duration
+
+	mu       sync.Mutex
+	known    map[string]Modem // USBPath -> 上一轮扫描到的模块
+	primed   bool             // 是否已完成首次扫描
+	events   []Event          // 最近的事件（新的在后）
+	alertFn  AlertFunc
+	renderFn func() error // 重新渲染 Asterisk 配置
+	started  bool
+	stop     chan struct{} // 关闭时通知循环退出
+	done     chan struct{} // 循环退出后关闭
+}
+
+var (
+	globalWatcher *Watcher
+	watcherOnce   sync.Once
+)
+
+// GetWatcher 获取全局热插拔 watcher
+func GetWatcher() *Watcher {
+	watcherOnce.Do(func() {
+		globalWatcher = NewWatcher(NewScanner(), defaultPollInterval)
+	})
+	return globalWatcher
+}
+
+// NewWatcher 创建 watcher
+func NewWatcher(scanner *Scanner, interval time.Duration) *Watcher {
+	return &Watcher{
+		scanner:  scanner,
+		interval: interval,
+		known:    make(map[string]Modem),
+	}
+}
+
+// SetAlertFn 设置插拔通知回调
+func (w *Watcher) SetAlertFn(fn AlertFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.alertFn = fn
+}
+
+// SetRenderFn 设置端口变化后重新渲染配置的回调
+func (w *Watcher) SetRenderFn(fn func() error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.renderFn = fn
+}
+
+// Start 启动轮询（重复调用无效）
+func (w *Watcher) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return
+	}
+	w.started = true
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.loop(w.stop, w.done)
+	log.Println("[Hotplug] Watcher started")
+}
+
+// Stop 停止轮询，等待当前这一轮扫描完成
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	if !w.started {
+		w.mu.Unlock()
+		return
+	}
+	w.started = false
+	stop, done := w.stop, w.done
+	w.mu.Unlock()
+
+	close(stop)
+	<-done
+}
+
+// loop 定期轮询并处理事件
+func (w *Watcher) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		events, err := w.Poll()
+		if err != nil {
+			log.Printf("[Hotplug] Scan failed: %v", err)
+		}
+		for _, ev := range events {
+			switch ev.Type {
+			case EventRemoved:
+				w.handleRemoved(ev)
+			case EventAdded:
+				// 等待模块启动完成后再读取 IMEI，不阻塞后续轮询
+				go func(ev Event) {
+					time.Sleep(settleDelay)
+					w.handleAdded(ev)
+				}(ev)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Poll 扫描一次并与上一轮结果比较，返回插拔事件
+// 首次调用只记录当前模块，不产生事件
+func (w *Watcher) Poll() ([]Event, error) {
+	modems, err := w.scanner.Scan()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]Modem, len(modems))
+	for _, m := range modems {
+		current[m.USBPath] = m
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var events []Event
+	if w.primed {
+		now := time.Now()
+		for path, m := range w.known {
+			if _, ok := current[path]; !ok {
+				events = append(events, Event{Type: EventRemoved, USBPath: path, Modem: m, Time: now})
+			}
+		}
+		for _, m := range modems {
+			if old, ok := w.known[m.USBPath]; !ok || old.Data != m.Data {
+				// 新插入，或同一 USB 口重新枚举出不同的串口
+				events = append(events, Event{Type: EventAdded, USBPath: m.USBPath, Modem: m, Time: now})
+			}
+		}
+	}
+	w.known = current
+	w.primed = true
+	return events, nil
+}
+
+// Events 返回最近的插拔事件（新的在前）
+func (w *Watcher) Events() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([]Event, len(w.events))
+	for i, ev := range w.events {
+		result[len(w.events)-1-i] = ev
+	}
+	return result
+}
+
+// record 保存事件并发送通知
+func (w *Watcher) record(ev Event, message string) {
+	w.mu.Lock()
+	w.events = append(w.events, ev)
+	if len(w.events) > maxEvents {
+		w.events = w.events[len(w.events)-maxEvents:]
+	}
+	alertFn := w.alertFn
+	w.mu.Unlock()
+
+	log.Printf("[Hotplug] %s", message)
+	events.Publish(events.TopicDongle, "hotplug_"+ev.Type, ev)
+	if alertFn != nil && ev.DongleID != "" {
+		alertFn(ev.DongleID, message)
+	}
+}
+
+// handleRemoved 模块拔出：标记 Dongle 离线并通知
+func (w *Watcher) handleRemoved(ev Event) {
+	var dongle database.Dongle
+	if err := database.DB.Where("data = ?", ev.Modem.Data).First(&dongle).Error; err == nil {
+		ev.DongleID = dongle.DeviceID
+		ami.GetManager().SetDevicePresent(dongle.DeviceID, false)
+		w.record(ev, fmt.Sprintf("Dongle %s unplugged (USB %s, %s %s)", dongle.DeviceID, ev.USBPath, ev.Modem.Vendor, ev.Modem.Model))
+		return
+	}
+	w.record(ev, fmt.Sprintf("Unclaimed modem unplugged (USB %s, %s %s)", ev.USBPath, ev.Modem.Vendor, ev.Modem.Model))
+}
+
+// handleAdded 模块插入：按 IMEI 校正端口，只重启受影响的设备
+func (w *Watcher) handleAdded(ev Event) {
+	changed, err := w.scanner.Reconcile()
+	if err != nil {
+		log.Printf("[Hotplug] Reconcile failed: %v", err)
+	}
+
+	var dongle database.Dongle
+	if err := database.DB.Where("data = ?", ev.Modem.Data).First(&dongle).Error; err != nil {
+		w.record(ev, fmt.Sprintf("New modem plugged in (USB %s, %s %s, data %s), not bound to any dongle",
+			ev.USBPath, ev.Modem.Vendor, ev.Modem.Model, ev.Modem.Data))
+		return
+	}
+	ev.DongleID = dongle.DeviceID
+
+	manager := ami.GetManager()
+	if len(changed) > 0 {
+		w.mu.Lock()
+		renderFn := w.renderFn
+		w.mu.Unlock()
+		if renderFn != nil {
+			if err := renderFn(); err != nil {
+				log.Printf("[Hotplug] Failed to render config: %v", err)
+			} else if err := manager.ReloadQuectel(); err != nil {
+				log.Printf("[Hotplug] Failed to reload quectel config: %v", err)
+			}
+		}
+	}
+
+	if err := manager.RestartDevice(dongle.DeviceID); err != nil {
+		log.Printf("[Hotplug] Failed to restart %s: %v", dongle.DeviceID, err)
+	}
+	manager.SetDevicePresent(dongle.DeviceID, true)
+
+	w.record(ev, fmt.Sprintf("Dongle %s plugged in (USB %s, data %s)", dongle.DeviceID, ev.USBPath, ev.Modem.Data))
+}
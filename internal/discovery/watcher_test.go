@@ -0,0 +1,195 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeSysfs 在临时目录中构造 sysfs/dev 目录结构
+type fakeSysfs struct {
+	t    *testing.T
+	root string
+}
+
+func newFakeSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"sys/bus/usb-serial/devices", "dev/serial/by-id", "lock"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &fakeSysfs{t: t, root: root}
+}
+
+func (f *fakeSysfs) scanner() *Scanner {
+	return &Scanner{
+		SysfsRoot: filepath.Join(f.root, "sys"),
+		DevRoot:   filepath.Join(f.root, "dev"),
+		LockDir:   filepath.Join(f.root, "lock"),
+	}
+}
+
+func (f *fakeSysfs) write(path, content string) {
+	f.t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// plug 添加一个 USB 设备，ttys 按接口号顺序对应 if00、if01...
+func (f *fakeSysfs) plug(usbPath, vid, pid string, ttys ...string) {
+	f.t.Helper()
+	usbDir := filepath.Join(f.root, "sys", "devices", "pci0000:00", "usb1", usbPath)
+	f.write(filepath.Join(usbDir, "idVendor"), vid)
+	f.write(filepath.Join(usbDir, "idProduct"), pid)
+	for i, tty := range ttys {
+		ifaceDir := filepath.Join(usbDir, fmt.Sprintf("%s:1.%d", usbPath, i))
+		f.write(filepath.Join(ifaceDir, "bInterfaceNumber"), fmt.Sprintf("%02x", i))
+		if err := os.MkdirAll(filepath.Join(ifaceDir, tty), 0755); err != nil {
+			f.t.Fatal(err)
+		}
+		link := filepath.Join(f.root, "sys", "bus", "usb-serial", "devices", tty)
+		if err := os.Symlink(filepath.Join(ifaceDir, tty), link); err != nil {
+			f.t.Fatal(err)
+		}
+		byID := filepath.Join(f.root, "dev", "serial", "by-id", fmt.Sprintf("usb-%s_%s-if%02d-port0", vid, usbPath, i))
+		if err := os.Symlink("../../"+tty, byID); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+// unplug 移除 USB 设备
+func (f *fakeSysfs) unplug(usbPath string, ttys ...string) {
+	f.t.Helper()
+	for _, tty := range ttys {
+		os.Remove(filepath.Join(f.root, "sys", "bus", "usb-serial", "devices", tty))
+	}
+	links, _ := filepath.Glob(filepath.Join(f.root, "dev", "serial", "by-id", "*_"+usbPath+"-*"))
+	for _, link := range links {
+		os.Remove(link)
+	}
+	if err := os.RemoveAll(filepath.Join(f.root, "sys", "devices", "pci0000:00", "usb1", usbPath)); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestScanGroupsPortsByModem(t *testing.T) {
+	fs := newFakeSysfs(t)
+	fs.plug("1-1.2", "2c7c", "0125", "ttyUSB0", "ttyUSB1", "ttyUSB2", "ttyUSB3")
+	fs.plug("1-1.3", "12d1", "1001", "ttyUSB4", "ttyUSB5", "ttyUSB6")
+	// 未知设备（USB 转串口线）应被忽略
+	fs.plug("1-1.4", "0403", "6001", "ttyUSB7")
+
+	modems, err := fs.scanner().Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modems) != 2 {
+		t.Fatalf("got %d modems, want 2: %+v", len(modems), modems)
+	}
+
+	dev := filepath.Join(fs.root, "dev")
+	q := modems[0]
+	if q.USBPath != "1-1.2" || q.Vendor != "Quectel" || len(q.Ports) != 4 {
+		t.Errorf("quectel modem = %+v", q)
+	}
+	if q.Device != filepath.Join(dev, "ttyUSB0") || q.Audio != filepath.Join(dev, "ttyUSB1") || q.Data != filepath.Join(dev, "ttyUSB2") {
+		t.Errorf("quectel ports: device=%s audio=%s data=%s", q.Device, q.Audio, q.Data)
+	}
+	if q.Ports[2].ByID == "" {
+		t.Error("by-id link not resolved for ttyUSB2")
+	}
+
+	h := modems[1]
+	if h.Vendor != "Huawei" || h.Audio != filepath.Join(dev, "ttyUSB5") || h.Data != filepath.Join(dev, "ttyUSB6") {
+		t.Errorf("huawei modem = %+v", h)
+	}
+}
+
+func TestScanMissingSysfs(t *testing.T) {
+	s := &Scanner{SysfsRoot: filepath.Join(t.TempDir(), "nope"), DevRoot: "/dev"}
+	modems, err := s.Scan()
+	if err != nil || len(modems) != 0 {
+		t.Fatalf("Scan() = %v, %v; want empty, nil", modems, err)
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	fs := newFakeSysfs(t)
+	fs.plug("1-1.2", "2c7c", "0125", "ttyUSB0", "ttyUSB1", "ttyUSB2", "ttyUSB3")
+	fs.plug("1-1.3", "2c7c", "0125", "ttyUSB4", "ttyUSB5", "ttyUSB6", "ttyUSB7")
+
+	w := NewWatcher(fs.scanner(), time.Second)
+
+	// 首次扫描只记录基线
+	events, err := w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("first poll produced events: %+v", events)
+	}
+
+	// 没有变化
+	if events, _ = w.Poll(); len(events) != 0 {
+		t.Fatalf("unchanged poll produced events: %+v", events)
+	}
+
+	// 拔出第二个模块
+	fs.unplug("1-1.3", "ttyUSB4", "ttyUSB5", "ttyUSB6", "ttyUSB7")
+	events, _ = w.Poll()
+	if len(events) != 1 || events[0].Type != EventRemoved || events[0].USBPath != "1-1.3" {
+		t.Fatalf("after unplug: %+v", events)
+	}
+	if events[0].Modem.Data != filepath.Join(fs.root, "dev", "ttyUSB6") {
+		t.Errorf("removed modem data = %s", events[0].Modem.Data)
+	}
+
+	// 插回另一个 USB 口，内核分配了新的串口编号
+	fs.plug("1-1.4", "2c7c", "0125", "ttyUSB8", "ttyUSB9", "ttyUSB10", "ttyUSB11")
+	events, _ = w.Poll()
+	if len(events) != 1 || events[0].Type != EventAdded || events[0].USBPath != "1-1.4" {
+		t.Fatalf("after plug: %+v", events)
+	}
+	if events[0].Modem.Data != filepath.Join(fs.root, "dev", "ttyUSB10") {
+		t.Errorf("added modem data = %s", events[0].Modem.Data)
+	}
+
+	// 同一 USB 口重新枚举出不同的串口，视为重新插入
+	fs.unplug("1-1.2", "ttyUSB0", "ttyUSB1", "ttyUSB2", "ttyUSB3")
+	fs.plug("1-1.2", "2c7c", "0125", "ttyUSB12", "ttyUSB13", "ttyUSB14", "ttyUSB15")
+	events, _ = w.Poll()
+	if len(events) != 1 || events[0].Type != EventAdded || events[0].USBPath != "1-1.2" {
+		t.Fatalf("after re-enumeration: %+v", events)
+	}
+}
+
+func TestIsLocked(t *testing.T) {
+	fs := newFakeSysfs(t)
+	s := fs.scanner()
+	port := filepath.Join(fs.root, "dev", "ttyUSB2")
+
+	if s.IsLocked(port) {
+		t.Fatal("port without lock file reported locked")
+	}
+
+	// 当前进程持有的锁
+	fs.write(filepath.Join(s.LockDir, "LCK..ttyUSB2"), fmt.Sprintf("%10d", os.Getpid()))
+	if !s.IsLocked(port) {
+		t.Error("port locked by live process reported unlocked")
+	}
+
+	// 过期锁（进程不存在）
+	fs.write(filepath.Join(s.LockDir, "LCK..ttyUSB2"), "  99999999")
+	if s.IsLocked(port) {
+		t.Error("stale lock reported locked")
+	}
+}
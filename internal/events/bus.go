@@ -0,0 +1,164 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 事件主题
+const (
+	TopicStatus       = "status"       // Asterisk 状态变化
+	TopicSMS          = "sms"          // 收到/发送短信
+	TopicCall         = "call"         // 点击拨号进度、活动通话开始/变化/结束
+	TopicDongle       = "dongle"       // dongle 状态变化、插拔
+	TopicNotification = "notification" // 通知发送结果
+)
+
+// Topics 所有主题（用于校验订阅参数）
+var Topics = []string{TopicStatus, TopicSMS, TopicCall, TopicDongle, TopicNotification}
+
+const (
+	// historySize 保留的最近事件数量（用于断线后按事件 ID 续传）
+	historySize = 500
+	// subscriberBuffer 每个订阅者的缓冲大小，写满说明客户端处理太慢，断开后由客户端续传
+	subscriberBuffer = 64
+)
+
+// Event 推送给前端的事件
+type Event struct {
+	ID    uint64    `json:"id"`
+	Topic string    `json:"topic"`
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data,omitempty"`
+}
+
+// Subscription 事件订阅
+type Subscription struct {
+	C <-chan Event
+
+	ch     chan Event
+	topics map[string]bool // 为空表示订阅所有主题
+	bus    *Bus
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.bus.remove(s)
+}
+
+// matches 订阅是否包含该主题
+func (s *Subscription) matches(topic string) bool {
+	return len(s.topics) == 0 || s.topics[topic]
+}
+
+// Bus 事件总线（单例）
+// 事件 ID 以进程启动时的毫秒时间戳为起点递增，重启后客户端携带的旧 ID 一定早于新事件，会被识别为需要重新同步
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event // 最近的事件（旧的在前）
+	subscribers map[*Subscription]struct{}
+}
+
+var (
+	globalBus *Bus
+	busOnce   sync.Once
+)
+
+// GetBus 获取全局事件总线
+func GetBus() *Bus {
+	busOnce.Do(func() {
+		globalBus = NewBus()
+	})
+	return globalBus
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{
+		nextID:      uint64(time.Now().UnixMilli()),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish 发布事件到全局事件总线
+func Publish(topic, eventType string, data any) {
+	GetBus().Publish(topic, eventType, data)
+}
+
+// Publish 发布事件（不阻塞，处理太慢的订阅者会被断开）
+func (b *Bus) Publish(topic, eventType string, data any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev := Event{
+		ID:    b.nextID,
+		Topic: topic,
+		Type:  eventType,
+		Time:  time.Now(),
+		Data:  data,
+	}
+	b.history = append(b.history, ev)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.matches(topic) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			log.Printf("[Events] Subscriber too slow, disconnecting (last event %d)", ev.ID)
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return ev
+}
+
+// Subscribe 订阅事件，topics 为空表示所有主题
+// afterID 不为 0 时返回之后的历史事件（backlog）；afterID 已不在历史中（过旧或来自重启前）时 missed 为 true，客户端应重新加载数据
+func (b *Bus) Subscribe(topics []string, afterID uint64) (sub *Subscription, backlog []Event, missed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, bus: b, topics: make(map[string]bool)}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if afterID == 0 {
+		return sub, nil, false
+	}
+	// 历史中最早事件之前的事件已丢弃；没有历史时，只有 ID 与当前一致才算连续
+	oldest := b.nextID + 1
+	if len(b.history) > 0 {
+		oldest = b.history[0].ID
+	}
+	if afterID+1 < oldest || afterID > b.nextID {
+		missed = true
+	}
+	for _, ev := range b.history {
+		if ev.ID > afterID && sub.matches(ev.Topic) {
+			backlog = append(backlog, ev)
+		}
+	}
+	return sub, backlog, missed
+}
+
+// remove 删除订阅者
+func (b *Bus) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
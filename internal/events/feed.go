@@ -0,0 +1,68 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+)
+
+// AMIFeed 将 AMI manager 的状态更新、连接状态变化和 dongle 状态变化发布到事件总线
+type AMIFeed struct {
+	mu   sync.Mutex
+	last *ami.StatusInfo // 上一次发布的状态，只在变化时发布
+}
+
+var (
+	globalFeed *AMIFeed
+	feedOnce   sync.Once
+)
+
+// GetAMIFeed 获取全局 AMI 事件源
+func GetAMIFeed() *AMIFeed {
+	feedOnce.Do(func() {
+		globalFeed = &AMIFeed{}
+	})
+	return globalFeed
+}
+
+// Register 注册到 AMI manager
+func (f *AMIFeed) Register() {
+	ami.GetManager().Subscribe(f)
+}
+
+// OnStatusUpdate 状态（运行状态、通道数、注册数）变化时发布 status 事件
+// 状态每 5 秒轮询一次，运行时间每次都会变化，不作为发布条件
+func (f *AMIFeed) OnStatusUpdate(info *ami.StatusInfo) {
+	if info == nil {
+		return
+	}
+	f.mu.Lock()
+	changed := f.last == nil || f.last.Status != info.Status ||
+		f.last.Channels != info.Channels || f.last.Registrations != info.Registrations
+	if changed {
+		snapshot := *info
+		f.last = &snapshot
+	}
+	f.mu.Unlock()
+
+	if changed {
+		Publish(TopicStatus, "updated", info)
+	}
+}
+
+// OnSMSReceived 实现 ami.StatusSubscriber（短信入库后由 sms.Handler 发布）
+func (f *AMIFeed) OnSMSReceived(device, number, message, timestamp string) {}
+
+// OnConnectionStateChanged AMI 连接状态（connecting、connected、disconnected）变化时发布 status 事件
+func (f *AMIFeed) OnConnectionStateChanged(change ami.ConnectionStateChange) {
+	Publish(TopicStatus, "connection", change)
+}
+
+// OnDongleStateChanged dongle 状态（Free、In use、Not connected...）变化时发布 dongle 事件
+func (f *AMIFeed) OnDongleStateChanged(device, previous, state string) {
+	Publish(TopicDongle, "state_changed", map[string]string{
+		"dongle_id": device,
+		"previous":  previous,
+		"state":     state,
+	})
+}
@@ -1,11 +1,15 @@
 import { useEffect, useState, useRef } from "react";
 import { toast } from "sonner";
-import { RefreshCw, Power, Loader2, Activity, Phone, Users, Clock } from "lucide-react";
+import { RefreshCw, Power, Loader2, Activity, Phone, Users, Clock, PhoneOff, PhoneForwarded, Headphones } from "lucide-react";
 import { systemAPI } from "@/services/system";
+import { callsAPI } from "@/services/calls";
+import { subscribeEvents } from "@/services/events";
 import { Button } from "@/components/ui/button";
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card";
 import { Badge } from "@/components/ui/badge";
 import { Skeleton } from "@/components/ui/skeleton";
+import { Input } from "@/components/ui/input";
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from "@/components/ui/table";
 import {
   AlertDialog,
   AlertDialogAction,
@@ -18,6 +22,27 @@ import {
   AlertDialogTrigger,
 } from "@/components/ui/alert-dialog";
 
+const activeStateLabels = {
+  ringing: "振铃中",
+  up: "已接听",
+  talking: "通话中",
+};
+
+const directionLabels = {
+  inbound: "来电",
+  outbound: "去电",
+  internal: "内部",
+};
+
+// 秒数格式化为 mm:ss 或 h:mm:ss
+const formatCallDuration = (seconds) => {
+  const h = Math.floor(seconds / 3600);
+  const m = Math.floor((seconds % 3600) / 60);
+  const s = seconds % 60;
+  const pad = (n) => String(n).padStart(2, "0");
+  return h > 0 ? `${h}:${pad(m)}:${pad(s)}` : `${pad(m)}:${pad(s)}`;
+};
+
 export default function Dashboard() {
   const [status, setStatus] = useState(null);
   const [loading, setLoading] = useState(true);
@@ -25,11 +50,34 @@ export default function Dashboard() {
   const [restarting, setRestarting] = useState(false);
   const [restartDialogOpen, setRestartDialogOpen] = useState(false);
   const restartCheckIntervalRef = useRef(null);
+  const [activeCalls, setActiveCalls] = useState([]);
+  const [transferTargets, setTransferTargets] = useState({});  // 通话 ID -> 转接目标
+  const [spyExtension, setSpyExtension] = useState(() => localStorage.getItem("callExtension") || "");  // 监听使用的分机
 
   useEffect(() => {
     fetchStatus();
-    const interval = setInterval(fetchStatus, 5000);
-    return () => clearInterval(interval);
+    fetchActiveCalls();
+    // 通话和状态变化通过事件流实时刷新，定时刷新用于更新通话时长
+    const unsubscribe = subscribeEvents(["status", "call"], {
+      status: () => fetchStatus(),
+      call: (event) => {
+        if (event.type !== "click_to_call") {
+          fetchActiveCalls();
+        }
+      },
+      reset: () => {
+        fetchStatus();
+        fetchActiveCalls();
+      },
+    });
+    const interval = setInterval(() => {
+      fetchStatus();
+      fetchActiveCalls();
+    }, 5000);
+    return () => {
+      clearInterval(interval);
+      unsubscribe();
+    };
   }, []);
 
   // 清理重启检查的 interval
@@ -63,6 +111,54 @@ export default function Dashboard() {
     }
   };
 
+  const fetchActiveCalls = async () => {
+    try {
+      const response = await callsAPI.listActive();
+      setActiveCalls(response.data?.data || []);
+    } catch (error) {
+      console.error("Failed to fetch active calls:", error);
+    }
+  };
+
+  const handleHangup = async (call) => {
+    try {
+      await callsAPI.hangup(call.id);
+      toast.success("已挂断");
+      fetchActiveCalls();
+    } catch (error) {
+      toast.error("挂断失败", { description: error.response?.data?.error || error.message });
+    }
+  };
+
+  const handleTransfer = async (call, mode) => {
+    const target = transferTargets[call.id];
+    if (!target) {
+      toast.error("请输入转接目标");
+      return;
+    }
+    try {
+      await callsAPI.transfer(call.id, { mode, target });
+      toast.success(mode === "attended" ? `正在咨询转接到 ${target}` : `已转接到 ${target}`);
+      fetchActiveCalls();
+    } catch (error) {
+      toast.error("转接失败", { description: error.response?.data?.error || error.message });
+    }
+  };
+
+  const handleSpy = async (call) => {
+    if (!spyExtension) {
+      toast.error("请输入监听使用的分机");
+      return;
+    }
+    localStorage.setItem("callExtension", spyExtension);
+    try {
+      await callsAPI.spy(call.id, { extension: spyExtension, mode: "listen" });
+      toast.success(`正在呼叫分机 ${spyExtension} 进行监听`);
+    } catch (error) {
+      toast.error("监听失败", { description: error.response?.data?.error || error.message });
+    }
+  };
+
   const handleReload = async () => {
     setReloading(true);
     try {
@@ -273,6 +369,84 @@ export default function Dashboard() {
           </CardContent>
         </Card>
       </div>
+
+      <Card>
+        <CardHeader className="flex flex-row items-center justify-between space-y-0">
+          <div className="space-y-1">
+            <CardTitle>当前通话</CardTitle>
+            <CardDescription>实时查看通话，可挂断、转接或从分机监听</CardDescription>
+          </div>
+          <Input
+            className="w-40"
+            placeholder="监听分机"
+            value={spyExtension}
+            onChange={(e) => setSpyExtension(e.target.value)}
+          />
+        </CardHeader>
+        <CardContent>
+          <Table>
+            <TableHeader>
+              <TableRow>
+                <TableHead>方向</TableHead>
+                <TableHead>主叫</TableHead>
+                <TableHead>被叫</TableHead>
+                <TableHead>Dongle</TableHead>
+                <TableHead>状态</TableHead>
+                <TableHead>时长</TableHead>
+                <TableHead className="text-right">操作</TableHead>
+              </TableRow>
+            </TableHeader>
+            <TableBody>
+              {activeCalls.length === 0 ? (
+                <TableRow>
+                  <TableCell colSpan={7} className="py-8 text-center text-muted-foreground">
+                    当前没有通话
+                  </TableCell>
+                </TableRow>
+              ) : (
+                activeCalls.map((call) => (
+                  <TableRow key={call.id}>
+                    <TableCell>
+                      <Badge variant="outline">{directionLabels[call.direction] || call.direction}</Badge>
+                    </TableCell>
+                    <TableCell className="font-mono text-sm">{call.caller || "-"}</TableCell>
+                    <TableCell className="font-mono text-sm">{call.callee || "-"}</TableCell>
+                    <TableCell className="font-mono text-sm">{call.dongle_id || "-"}</TableCell>
+                    <TableCell>
+                      <Badge variant={call.state === "talking" ? "default" : "secondary"}>
+                        {activeStateLabels[call.state] || call.state}
+                      </Badge>
+                    </TableCell>
+                    <TableCell className="font-mono text-sm">{formatCallDuration(call.duration)}</TableCell>
+                    <TableCell className="text-right">
+                      <div className="flex items-center justify-end gap-2">
+                        <Input
+                          className="h-8 w-28"
+                          placeholder="转接到"
+                          value={transferTargets[call.id] || ""}
+                          onChange={(e) => setTransferTargets((prev) => ({ ...prev, [call.id]: e.target.value }))}
+                        />
+                        <Button variant="outline" size="sm" title="盲转" onClick={() => handleTransfer(call, "blind")}>
+                          <PhoneForwarded className="h-4 w-4" />
+                        </Button>
+                        <Button variant="outline" size="sm" title="咨询转接" onClick={() => handleTransfer(call, "attended")}>
+                          咨询
+                        </Button>
+                        <Button variant="outline" size="sm" title="监听" onClick={() => handleSpy(call)}>
+                          <Headphones className="h-4 w-4" />
+                        </Button>
+                        <Button variant="destructive" size="sm" title="挂断" onClick={() => handleHangup(call)}>
+                          <PhoneOff className="h-4 w-4" />
+                        </Button>
+                      </div>
+                    </TableCell>
+                  </TableRow>
+                ))
+              )}
+            </TableBody>
+          </Table>
+        </CardContent>
+      </Card>
     </div>
   );
 }
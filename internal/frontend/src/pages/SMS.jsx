@@ -1,8 +1,11 @@
 import { useEffect, useState } from "react";
 import { toast } from "sonner";
-import { Trash2, ChevronLeft, ChevronRight, Filter, MessageSquarePlus, Eye, Check, X, Loader2, Trash } from "lucide-react";
+import { Trash2, ChevronLeft, ChevronRight, Filter, MessageSquarePlus, Eye, Check, X, Loader2, Trash, Phone } from "lucide-react";
 import { smsAPI } from "@/services/sms";
 import { dongleDeviceAPI } from "@/services/dongleDevices";
+import { extensionsAPI } from "@/services/extensions";
+import { callsAPI } from "@/services/calls";
+import { subscribeEvents } from "@/services/events";
 import { Button } from "@/components/ui/button";
 import { Badge } from "@/components/ui/badge";
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card";
@@ -17,6 +20,17 @@ import { Textarea } from "@/components/ui/textarea";
 import { Checkbox } from "@/components/ui/checkbox";
 import { Switch } from "@/components/ui/switch";
 
+// 点击拨号状态显示
+const callStateLabels = {
+  originating: "正在呼叫分机",
+  ringing_extension: "分机振铃中",
+  extension_answered: "分机已接听",
+  dialing: "正在拨号",
+  answered: "通话中",
+  completed: "通话结束",
+  failed: "呼叫失败",
+};
+
 export default function SMS() {
   const [messages, setMessages] = useState([]);
   const [loading, setLoading] = useState(true);
@@ -46,26 +60,38 @@ export default function SMS() {
   const [deletingSIM, setDeletingSIM] = useState(false);
   const [autoRefresh, setAutoRefresh] = useState(true);  // 自动刷新开关
   const [highlightedIds, setHighlightedIds] = useState([]);  // 需要高亮的短信ID
+  const [extensions, setExtensions] = useState([]);
+  const [callExtension, setCallExtension] = useState(() => localStorage.getItem("callExtension") || "");  // 点击拨号使用的分机（桌面电话）
+  const [callProgress, setCallProgress] = useState(null);  // 当前点击拨号的状态
 
   useEffect(() => {
     fetchDongles();
+    fetchExtensions();
   }, []);
 
   useEffect(() => {
     fetchMessages();
 
-    // 第一页且开启自动刷新时设置自动刷新（5秒间隔）
+    // 第一页且开启自动刷新时，收到/发送短信事件立即刷新，另外每 30 秒兜底刷新一次
     let intervalId = null;
+    let unsubscribe = null;
     if (page === 1 && autoRefresh) {
+      unsubscribe = subscribeEvents(["sms"], {
+        sms: () => fetchMessages(true),
+        reset: () => fetchMessages(true),
+      });
       intervalId = setInterval(() => {
         fetchMessages(true);  // 传入 true 表示自动刷新
-      }, 5000);
+      }, 30000);
     }
 
     return () => {
       if (intervalId) {
         clearInterval(intervalId);
       }
+      if (unsubscribe) {
+        unsubscribe();
+      }
     };
   }, [page, filters, autoRefresh]);
 
@@ -78,6 +104,15 @@ export default function SMS() {
     }
   };
 
+  const fetchExtensions = async () => {
+    try {
+      const response = await extensionsAPI.list();
+      setExtensions(response.data || []);
+    } catch (error) {
+      // 分机列表只用于点击拨号，失败时不提示
+    }
+  };
+
   const fetchMessages = async (isAuto = false) => {
     // 只在非自动刷新时设置 loading
     if (!isAuto) {
@@ -209,9 +244,44 @@ export default function SMS() {
 
   const handleViewDetail = (message) => {
     setDetailMessage(message);
+    setCallProgress(null);
     setDetailOpen(true);
   };
 
+  // 点击拨号：先振铃选择的分机，接听后通过短信所在的 dongle 拨打对方号码
+  const handleClickToCall = async (message) => {
+    if (!callExtension) {
+      toast.error("请先选择拨号使用的分机");
+      return;
+    }
+    localStorage.setItem("callExtension", callExtension);
+    try {
+      const response = await callsAPI.originate({
+        extension: callExtension,
+        dongle_id: message.dongle_id,
+        number: message.phone_number,
+      });
+      const call = response.data;
+      setCallProgress({ state: call.state });
+      toast.success(`正在呼叫分机 ${callExtension}，接听后将拨打 ${message.phone_number}`);
+
+      const source = new EventSource(callsAPI.eventsURL(call.id), { withCredentials: true });
+      source.addEventListener("state", (e) => {
+        const event = JSON.parse(e.data);
+        setCallProgress({ state: event.state, message: event.message });
+        if (event.state === "failed") {
+          toast.error("呼叫失败", { description: event.message });
+        }
+        if (event.state === "completed" || event.state === "failed") {
+          source.close();
+        }
+      });
+      source.onerror = () => source.close();
+    } catch (error) {
+      toast.error("呼叫失败", { description: error.response?.data?.error || error.message });
+    }
+  };
+
   const getPageNumbers = () => {
     const pages = [];
     const maxButtons = 7;
@@ -616,7 +686,34 @@ export default function SMS() {
 
               <div>
                 <Label className="text-muted-foreground">号码</Label>
-                <p className="font-mono text-sm mt-1">{detailMessage.phone_number}</p>
+                <div className="flex items-center gap-2 mt-1">
+                  <button
+                    type="button"
+                    className="font-mono text-sm text-primary hover:underline"
+                    title="点击从分机拨打此号码"
+                    onClick={() => handleClickToCall(detailMessage)}
+                  >
+                    <Phone className="h-3 w-3 inline mr-1" />
+                    {detailMessage.phone_number}
+                  </button>
+                  <Select value={callExtension} onValueChange={setCallExtension}>
+                    <SelectTrigger className="h-8 w-32">
+                      <SelectValue placeholder="选择分机" />
+                    </SelectTrigger>
+                    <SelectContent>
+                      {extensions.map((ext) => (
+                        <SelectItem key={ext.id} value={ext.username}>
+                          {ext.username}
+                        </SelectItem>
+                      ))}
+                    </SelectContent>
+                  </Select>
+                  {callProgress && (
+                    <Badge variant={callProgress.state === "failed" ? "destructive" : "secondary"}>
+                      {callStateLabels[callProgress.state] || callProgress.state}
+                    </Badge>
+                  )}
+                </div>
               </div>
 
               <div>
@@ -0,0 +1,13 @@
+import api from "./api";
+
+export const callsAPI = {
+  originate: (data) => api.post("/calls/originate", data),
+  get: (id) => api.get(`/calls/${id}`),
+  // SSE 进度推送地址（EventSource 不经过 axios，需要拼接完整地址）
+  eventsURL: (id) => `${api.defaults.baseURL}/calls/${id}/events`,
+  // 活动通话监控
+  listActive: () => api.get("/calls/active"),
+  hangup: (id, channel) => api.post(`/calls/active/${encodeURIComponent(id)}/hangup`, channel ? { channel } : undefined),
+  transfer: (id, data) => api.post(`/calls/active/${encodeURIComponent(id)}/transfer`, data),
+  spy: (id, data) => api.post(`/calls/active/${encodeURIComponent(id)}/spy`, data),
+};
@@ -0,0 +1,23 @@
+import api from "./api";
+
+// 实时事件流（SSE），topics 为要订阅的主题列表（status、sms、call、dongle、notification）
+// handlers 以主题为键，另可提供 reset（断线太久需要重新加载数据时触发）
+// 返回取消订阅函数；EventSource 断线后会自动重连并携带 Last-Event-ID 续传
+export const subscribeEvents = (topics, handlers) => {
+  const params = topics?.length ? `?topics=${topics.join(",")}` : "";
+  const source = new EventSource(`${api.defaults.baseURL}/events${params}`, { withCredentials: true });
+
+  Object.entries(handlers).forEach(([name, handler]) => {
+    source.addEventListener(name, (e) => {
+      let data = null;
+      try {
+        data = JSON.parse(e.data);
+      } catch (err) {
+        return;
+      }
+      handler(data);
+    });
+  });
+
+  return () => source.close();
+};
@@ -0,0 +1,7 @@
+import api from './api';
+
+export const sessionsAPI = {
+  list: () => api.get('/sessions'),
+  revoke: (id) => api.delete(`/sessions/${id}`),
+  revokeOthers: () => api.delete('/sessions'),
+};
@@ -2,6 +2,8 @@ import api from './api';
 
 export const systemAPI = {
   getStatus: () => api.get('/system/status'),
+  getAMIConnection: () => api.get('/system/ami'),
+  downloadDiagnostics: () => api.get('/system/diagnostics', { responseType: 'blob' }),
   reload: () => api.post('/system/reload'),
   restart: () => api.post('/system/restart'),
 };
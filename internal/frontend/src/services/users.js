@@ -0,0 +1,14 @@
+import api from './api';
+
+export const usersAPI = {
+  me: () => api.get('/me'),
+  list: () => api.get('/users'),
+  update: (id, data) => api.put(`/users/${id}`, data),
+  delete: (id) => api.delete(`/users/${id}`),
+};
+
+export const invitesAPI = {
+  list: () => api.get('/user-invites'),
+  create: (data) => api.post('/user-invites', data),
+  delete: (id) => api.delete(`/user-invites/${id}`),
+};
@@ -0,0 +1,243 @@
+// Package lifecycle 按顺序启动进程内的组件，记录就绪状态，收到退出信号时按相反顺序优雅停止
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// State 组件状态
+type State string
+
+const (
+	StatePending  State = "pending"  // 还没开始启动
+	StateStarting State = "starting" // 启动中（如等待 Asterisk 就绪）
+	StateRunning  State = "running"
+	StateFailed   State = "failed"  // 启动失败，依赖它的组件不再启动
+	StateSkipped  State = "skipped" // 依赖的组件没有启动成功，不启动
+	StateStopping State = "stopping"
+	StateStopped  State = "stopped"
+)
+
+// Component 一个需要启动和停止的组件
+// Start 在前面的组件启动完成后调用，ctx 在收到退出信号时取消；Stop 在停止阶段按启动的相反顺序调用
+// 两者都可以为空
+// DependsOn 为依赖的组件名称（必须在本组件之前添加），其中任一个没有启动成功时本组件不启动；
+// 不依赖其它组件的组件在前面的组件启动失败后仍然启动
+type Component struct {
+	Name      string
+	DependsOn []string
+	Start     func(ctx context.Context) error
+	Stop      func(ctx context.Context) error
+}
+
+// ComponentStatus 组件当前状态
+type ComponentStatus struct {
+	Name      string     `json:"name"`
+	State     State      `json:"state"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// Manager 组件生命周期管理器
+type Manager struct {
+	mu         sync.Mutex
+	components []Component
+	status     []ComponentStatus
+	startDone  chan struct{} // Start 返回后关闭
+	stopped    bool
+}
+
+// New 创建生命周期管理器
+func New() *Manager {
+	return &Manager{}
+}
+
+// Add 添加组件，组件按添加顺序启动（Start 之后再添加无效）
+func (m *Manager) Add(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.startDone != nil {
+		log.Printf("[Lifecycle] Component %s added after start, ignored", c.Name)
+		return
+	}
+	m.components = append(m.components, c)
+	m.status = append(m.status, ComponentStatus{Name: c.Name, State: StatePending})
+}
+
+// Start 按顺序启动所有组件，返回启动失败的组件的错误
+// 某个组件启动失败时跳过依赖它的组件，其余组件继续启动；ctx 取消时不再启动后续组件
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if m.startDone != nil {
+		m.mu.Unlock()
+		return errors.New("lifecycle already started")
+	}
+	m.startDone = make(chan struct{})
+	components := m.components
+	m.mu.Unlock()
+	defer close(m.startDone)
+
+	running := make(map[string]bool, len(components))
+	var errs []error
+	for i, c := range components {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if dep := missingDependency(c, running); dep != "" {
+			m.setState(i, StateSkipped, fmt.Errorf("dependency %s is not running", dep))
+			log.Printf("[Lifecycle] %s skipped: dependency %s is not running", c.Name, dep)
+			continue
+		}
+		m.setState(i, StateStarting, nil)
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				m.setState(i, StateFailed, err)
+				err = fmt.Errorf("start %s: %w", c.Name, err)
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Printf("[Lifecycle] %v", err)
+				errs = append(errs, err)
+				continue
+			}
+		}
+		m.setState(i, StateRunning, nil)
+		running[c.Name] = true
+		log.Printf("[Lifecycle] %s started", c.Name)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	log.Println("[Lifecycle] All components started")
+	return nil
+}
+
+// missingDependency 返回组件第一个没有启动成功的依赖（都已启动时返回空）
+func missingDependency(c Component, running map[string]bool) string {
+	for _, dep := range c.DependsOn {
+		if !running[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+// Stop 按启动的相反顺序停止已启动的组件（重复调用无效）
+// 先等待 Start 返回（调用方应先取消传给 Start 的 ctx）；某个组件在 ctx 结束前没有停止时不再等待它，继续停止下一个
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	startDone := m.startDone
+	components := m.components
+	m.mu.Unlock()
+
+	if startDone != nil {
+		select {
+		case <-startDone:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for startup to finish: %w", ctx.Err())
+		}
+	}
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		m.mu.Lock()
+		state := m.status[i].State
+		m.mu.Unlock()
+		if state != StateRunning {
+			continue
+		}
+
+		m.setState(i, StateStopping, nil)
+		err := stopComponent(ctx, c)
+		if err != nil {
+			log.Printf("[Lifecycle] Failed to stop %s: %v", c.Name, err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+		} else {
+			log.Printf("[Lifecycle] %s stopped", c.Name)
+		}
+		m.setState(i, StateStopped, err)
+	}
+	return errors.Join(errs...)
+}
+
+// expiredStopGrace ctx 已结束后仍会调用后续组件的 Stop（如关闭 AMI 连接），最多等待这么久
+const expiredStopGrace = 500 * time.Millisecond
+
+// stopComponent 调用组件的 Stop，ctx 结束时不再等待
+func stopComponent(ctx context.Context, c Component) error {
+	if c.Stop == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Stop(ctx)
+	}()
+
+	if ctx.Err() != nil {
+		timer := time.NewTimer(expiredStopGrace)
+		defer timer.Stop()
+		select {
+		case err := <-done:
+			return err
+		case <-timer.C:
+			return ctx.Err()
+		}
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setState 更新组件状态
+func (m *Manager) setState(i int, state State, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &m.status[i]
+	s.State = state
+	s.Error = ""
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if state == StateRunning {
+		now := time.Now()
+		s.StartedAt = &now
+	}
+}
+
+// Ready 所有组件都已启动且没有开始停止
+func (m *Manager) Ready() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return false
+	}
+	for _, s := range m.status {
+		if s.State != StateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// Status 获取所有组件的当前状态（按启动顺序）
+func (m *Manager) Status() []ComponentStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := make([]ComponentStatus, len(m.status))
+	copy(status, m.status)
+	return status
+}
@@ -0,0 +1,184 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder 记录组件启动和停止的顺序
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.calls, ",")
+}
+
+// component 创建记录调用顺序的组件
+func (r *recorder) component(name string, startErr error) Component {
+	return Component{
+		Name: name,
+		Start: func(context.Context) error {
+			r.record("start " + name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			r.record("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestStartAndStopOrder(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Add(rec.component("db", nil))
+	m.Add(rec.component("ami", nil))
+	m.Add(Component{Name: "no-op"})
+	m.Add(rec.component("sms", nil))
+
+	if m.Ready() {
+		t.Fatal("ready before start")
+	}
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Ready() {
+		t.Fatalf("not ready after start: %+v", m.Status())
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m.Ready() {
+		t.Fatal("ready after stop")
+	}
+
+	want := "start db,start ami,start sms,stop sms,stop ami,stop db"
+	if got := rec.String(); got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+	for _, s := range m.Status() {
+		if s.State != StateStopped {
+			t.Fatalf("%s state = %s, want stopped", s.Name, s.State)
+		}
+	}
+}
+
+func TestStartFailureSkipsDependents(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Add(rec.component("db", nil))
+	m.Add(rec.component("ami", errors.New("connection refused")))
+	sms := rec.component("sms", nil)
+	sms.DependsOn = []string{"ami"}
+	m.Add(sms)
+	subscribers := rec.component("subscribers", nil)
+	subscribers.DependsOn = []string{"db", "sms"}
+	m.Add(subscribers)
+	// 不依赖 AMI 的组件仍然启动
+	m.Add(rec.component("scheduler", nil))
+
+	err := m.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "start ami") {
+		t.Fatalf("err = %v", err)
+	}
+	status := m.Status()
+	if status[1].State != StateFailed || status[1].Error != "connection refused" {
+		t.Fatalf("ami status = %+v", status[1])
+	}
+	for i, want := range []string{"dependency ami is not running", "dependency sms is not running"} {
+		if s := status[2+i]; s.State != StateSkipped || s.Error != want {
+			t.Fatalf("%s status = %+v, want skipped (%s)", s.Name, s, want)
+		}
+	}
+	if status[0].State != StateRunning || status[4].State != StateRunning {
+		t.Fatalf("status = %+v", status)
+	}
+	if m.Ready() {
+		t.Fatal("ready after failed start")
+	}
+
+	// 只停止已启动的组件
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.String(), "start db,start ami,start scheduler,stop scheduler,stop db"; got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestStopWaitsForCancelledStart(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Add(rec.component("db", nil))
+	// 等待 Asterisk 启动的组件，收到退出信号时放弃
+	m.Add(Component{
+		Name: "ami",
+		Start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Stop: func(context.Context) error {
+			rec.record("stop ami")
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go m.Start(ctx)
+	time.Sleep(20 * time.Millisecond)
+	if s := m.Status()[1]; s.State != StateStarting {
+		t.Fatalf("ami state = %s, want starting", s.State)
+	}
+
+	cancel()
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.String(), "start db,stop db"; got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	rec := &recorder{}
+	block := make(chan struct{})
+	defer close(block)
+
+	m := New()
+	m.Add(rec.component("db", nil))
+	m.Add(Component{
+		Name: "stuck",
+		Stop: func(context.Context) error {
+			<-block
+			return nil
+		},
+	})
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stop stuck") {
+		t.Fatalf("err = %v", err)
+	}
+	// 超时的组件不影响后续组件停止
+	if got, want := rec.String(), "start db,stop db"; got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/events"
 )
 
 // Notifier 通知器接口
@@ -582,14 +583,10 @@ func (m *Manager) Send(message string) []error {
 	errorCh := make(chan error, len(m.notifiers))
 
 	// 并行发送
-	for _, notifier := range m.notifiers {
-		go func(n Notifier) {
-			if err := n.Send(message); err != nil {
-				errorCh <- err
-			} else {
-				errorCh <- nil
-			}
-		}(notifier)
+	for channel, notifier := range m.notifiers {
+		go func(channel database.NotificationChannel, n Notifier) {
+			errorCh <- publishResult(channel, n.Send(message))
+		}(channel, notifier)
 	}
 
 	// 收集错误
@@ -610,13 +607,9 @@ func (m *Manager) SendToChannels(channels []database.NotificationChannel, messag
 	// 并行发送到指定渠道
 	for _, channel := range channels {
 		if notifier, ok := m.notifiers[channel]; ok {
-			go func(n Notifier) {
-				if err := n.Send(message); err != nil {
-					errorCh <- err
-				} else {
-					errorCh <- nil
-				}
-			}(notifier)
+			go func(channel database.NotificationChannel, n Notifier) {
+				errorCh <- publishResult(channel, n.Send(message))
+			}(channel, notifier)
 		} else {
 			errorCh <- nil
 		}
@@ -631,3 +624,15 @@ func (m *Manager) SendToChannels(channels []database.NotificationChannel, messag
 
 	return errors
 }
+
+// publishResult 将单个渠道的发送结果发布到事件总线，返回原错误
+func publishResult(channel database.NotificationChannel, err error) error {
+	result := map[string]any{"channel": channel, "success": err == nil}
+	if err != nil {
+		result["error"] = err.Error()
+		events.Publish(events.TopicNotification, "failed", result)
+	} else {
+		events.Publish(events.TopicNotification, "sent", result)
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package recording
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// cleanupInterval 定时清理的间隔
+const cleanupInterval = time.Hour
+
+// Usage 录音存储使用情况
+type Usage struct {
+	Count         int64 `json:"count"`
+	Bytes         int64 `json:"bytes"`
+	QuotaBytes    int64 `json:"quota_bytes"`    // 0 表示不限制
+	RetentionDays int   `json:"retention_days"` // 0 表示永久保留
+}
+
+// CleanupResult 一次清理的结果
+type CleanupResult struct {
+	Expired    int   `json:"expired"`     // 超过保留天数删除的数量
+	OverQuota  int   `json:"over_quota"`  // 超出存储上限删除的数量
+	Missing    int   `json:"missing"`     // 文件已不存在、只删除记录的数量
+	FreedBytes int64 `json:"freed_bytes"` // 释放的空间
+}
+
+// Cleaner 录音保留期和存储上限清理（单例）
+type Cleaner struct {
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{} // 关闭时通知循环退出
+	done    chan struct{} // 循环退出后关闭
+}
+
+var (
+	globalCleaner *Cleaner
+	cleanerOnce   sync.Once
+)
+
+// GetCleaner 获取全局录音清理器
+func GetCleaner() *Cleaner {
+	cleanerOnce.Do(func() {
+		globalCleaner = &Cleaner{}
+	})
+	return globalCleaner
+}
+
+// Start 启动定时清理（重复调用无效）
+func (c *Cleaner) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.loop(c.stop, c.done)
+	log.Println("[Recording] Cleaner started")
+}
+
+// Stop 停止定时清理，等待正在执行的清理完成
+func (c *Cleaner) Stop() {
+	c.mu.Lock()
+	if !c.started {
+		c.mu.Unlock()
+		return
+	}
+	c.started = false
+	stop, done := c.stop, c.done
+	c.mu.Unlock()
+
+	close(stop)
+	<-done
+}
+
+// loop 定时执行清理
+func (c *Cleaner) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Cleanup(); err != nil {
+			log.Printf("[Recording] Cleanup failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// limits 读取全局配置中的存储上限和保留天数
+func limits() (quotaBytes int64, retentionDays int, err error) {
+	var cfg database.GlobalConfig
+	if err := database.DB.FirstOrCreate(&cfg, database.GlobalConfig{ID: 1}).Error; err != nil {
+		return 0, 0, err
+	}
+	if cfg.RecordingQuotaMB > 0 {
+		quotaBytes = int64(cfg.RecordingQuotaMB) * 1024 * 1024
+	}
+	return quotaBytes, cfg.RecordingRetentionDays, nil
+}
+
+// GetUsage 统计录音存储使用情况
+func GetUsage() (*Usage, error) {
+	quota, retention, err := limits()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{QuotaBytes: quota, RetentionDays: retention}
+	row := database.DB.Model(&database.Recording{}).Select("COUNT(*), COALESCE(SUM(size), 0)").Row()
+	if err := row.Scan(&usage.Count, &usage.Bytes); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Cleanup 删除超过保留天数的录音，再按时间从旧到新删除超出存储上限的录音
+func (c *Cleaner) Cleanup() (*CleanupResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	quota, retention, err := limits()
+	if err != nil {
+		return nil, err
+	}
+	result := &CleanupResult{}
+
+	var recordings []database.Recording
+	if err := database.DB.Order("created_at ASC, id ASC").Find(&recordings).Error; err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, rec := range recordings {
+		total += rec.Size
+	}
+
+	var cutoff time.Time
+	if retention > 0 {
+		cutoff = time.Now().AddDate(0, 0, -retention)
+	}
+
+	for i := range recordings {
+		rec := &recordings[i]
+
+		var counter *int
+		switch {
+		case retention > 0 && rec.CreatedAt.Before(cutoff):
+			counter = &result.Expired
+		case quota > 0 && total > quota:
+			counter = &result.OverQuota
+		default:
+			if path, err := Path(rec.FileName); err == nil {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					counter = &result.Missing
+				}
+			}
+		}
+		if counter == nil {
+			continue
+		}
+
+		if err := Delete(rec); err != nil {
+			log.Printf("[Recording] Failed to delete %s: %v", rec.FileName, err)
+			continue
+		}
+		*counter++
+		total -= rec.Size
+		if counter != &result.Missing {
+			result.FreedBytes += rec.Size
+		}
+	}
+
+	if result.Expired+result.OverQuota+result.Missing > 0 {
+		log.Printf("[Recording] Cleanup removed %d expired, %d over quota, %d missing (freed %d bytes)",
+			result.Expired, result.OverQuota, result.Missing, result.FreedBytes)
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultDir 默认录音目录（位于持久化的数据目录下）
+	defaultDir = "/var/lib/lzc-mobile/recordings"
+	// wavHeaderSize WAV 文件头大小，只有文件头的录音视为空录音
+	wavHeaderSize = 44
+	// bytesPerSecond MixMonitor wav 格式（8kHz 16bit 单声道）每秒字节数
+	bytesPerSecond = 16000
+)
+
+// ErrInvalidFileName 录音文件名不合法（包含路径或不是 wav 文件）
+var ErrInvalidFileName = errors.New("invalid recording file name")
+
+// Dir 返回录音目录（RECORDINGS_DIR 环境变量，默认在数据目录下）
+func Dir() string {
+	if dir := os.Getenv("RECORDINGS_DIR"); dir != "" {
+		return dir
+	}
+	return defaultDir
+}
+
+// Path 返回录音文件的完整路径，拒绝包含路径分隔符的文件名
+func Path(fileName string) (string, error) {
+	if fileName == "" || fileName != filepath.Base(fileName) || strings.HasPrefix(fileName, ".") ||
+		!strings.HasSuffix(fileName, ".wav") {
+		return "", ErrInvalidFileName
+	}
+	return filepath.Join(Dir(), fileName), nil
+}
+
+// Metadata MixMonitor 结束时上报的录音信息
+type Metadata struct {
+	FileName  string
+	UniqueID  string // 主叫通道 UNIQUEID
+	Direction string // inbound 或 outbound
+	DongleID  string
+	Extension string
+	Number    string
+}
+
+// Register 登记录音文件并关联通话记录
+// 同一文件多次上报（按需录音暂停后继续追加）时更新大小和时长；空录音直接删除，返回 nil
+func Register(meta Metadata) (*database.Recording, error) {
+	path, err := Path(meta.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 未桥接就挂断时 MixMonitor 不会写文件
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to stat recording: %w", err)
+	}
+	if info.Size() <= wavHeaderSize {
+		if err := os.Remove(path); err != nil {
+			log.Printf("[Recording] Failed to remove empty recording %s: %v", meta.FileName, err)
+		}
+		return nil, nil
+	}
+
+	var rec database.Recording
+	err = database.DB.Where("file_name = ?", meta.FileName).First(&rec).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	rec.FileName = meta.FileName
+	rec.UniqueID = meta.UniqueID
+	rec.Direction = meta.Direction
+	rec.DongleID = meta.DongleID
+	rec.Extension = meta.Extension
+	rec.Number = meta.Number
+	rec.Size = info.Size()
+	rec.Duration = int((info.Size() - wavHeaderSize) / bytesPerSecond)
+
+	if rec.CallRecordID == nil {
+		callRecordID, err := linkCallRecord(meta)
+		if err != nil {
+			log.Printf("[Recording] Failed to link call record for %s: %v", meta.FileName, err)
+		} else {
+			rec.CallRecordID = callRecordID
+		}
+	}
+
+	if err := database.DB.Save(&rec).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[Recording] Registered %s (%s via %s, extension %s, %d bytes)",
+		rec.FileName, rec.Direction, rec.DongleID, rec.Extension, rec.Size)
+	return &rec, nil
+}
+
+// linkCallRecord 按 UNIQUEID 查找通话记录，不存在时（如外呼）创建一条
+func linkCallRecord(meta Metadata) (*uint, error) {
+	if meta.UniqueID == "" {
+		return nil, nil
+	}
+
+	var record database.CallRecord
+	err := database.DB.Where("unique_id = ?", meta.UniqueID).First(&record).Error
+	if err == nil {
+		return &record.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	record = database.CallRecord{
+		DongleID:  meta.DongleID,
+		Direction: meta.Direction,
+		Number:    meta.Number,
+		UniqueID:  meta.UniqueID,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record.ID, nil
+}
+
+// Delete 删除录音文件和记录（文件已不存在时只删除记录）
+func Delete(rec *database.Recording) error {
+	path, err := Path(rec.FileName)
+	if err == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove recording file: %w", err)
+		}
+	}
+	return database.DB.Delete(rec).Error
+}
@@ -0,0 +1,51 @@
+package sms
+
+import (
+	"log"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/at"
+)
+
+// ConcatInfo 长短信分段信息（3GPP TS 23.040 9.2.3.24.1 / 9.2.3.24.8）
+type ConcatInfo struct {
+	Ref   int // 分段参考号，同一条长短信的所有分段相同
+	Total int // 总段数
+	Seq   int // 当前段序号（从 1 开始）
+}
+
+// valid 检查分段信息是否有效（只有总段数大于 1 才需要重组）
+func (c *ConcatInfo) valid() bool {
+	return c != nil && c.Total > 1 && c.Seq >= 1 && c.Seq <= c.Total
+}
+
+// concatFromPDU 从 PDU（十六进制，包含 SMSC 前缀）的 UDH 中解析分段信息
+// PDU 不包含分段信息时返回 nil
+func concatFromPDU(pduHex string) (*ConcatInfo, error) {
+	pdu, err := at.DecodePDU(pduHex)
+	if err != nil {
+		return nil, err
+	}
+	c := pdu.Concat()
+	if c == nil {
+		return nil, nil
+	}
+	return &ConcatInfo{Ref: c.Ref, Total: c.Total, Seq: c.Seq}, nil
+}
+
+// concatFromPart 从 AMI/API 传入的分段元数据中解析分段信息
+// 优先使用显式给出的分段字段，其次解析 PDU 中的 UDH
+func concatFromPart(part ami.SMSPart) *ConcatInfo {
+	if part.Total > 1 {
+		return &ConcatInfo{Ref: part.Ref, Total: part.Total, Seq: part.Seq}
+	}
+	if part.PDU == "" {
+		return nil
+	}
+	info, err := concatFromPDU(part.PDU)
+	if err != nil {
+		log.Printf("[SMS] Failed to parse PDU for concatenation info: %v", err)
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,73 @@
+package sms
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedupWindow 同一条短信可能先后从 AMI 事件、dialplan 回调（/sms/receive）和 SIM 卡恢复到达，
+// 在这段时间内重复到达的短信只处理一次
+const dedupWindow = 10 * time.Minute
+
+// recentSMS 最近收到的短信（去重键 -> 收到时间）
+type recentSMS struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newRecentSMS() *recentSMS {
+	return &recentSMS{seen: make(map[string]time.Time)}
+}
+
+// dedupKey 计算短信去重键（设备 + 号码 + SIM 卡时间戳 + 内容哈希），长短信分段再加上参考号和序号
+// AMI 事件中的换行会被替换为空格，计算哈希前统一处理，使两个入口的同一条短信得到相同的键
+func dedupKey(req smsRequest) string {
+	content := strings.NewReplacer("\r", " ", "\n", " ").Replace(req.message)
+	sum := sha256.Sum256([]byte(content))
+	key := fmt.Sprintf("%s|%s|%s|%x", req.device, req.number, trimSIMTimestamp(req.timestamp), sum[:8])
+	if req.concat.valid() {
+		key += fmt.Sprintf("|%d/%d/%d", req.concat.Ref, req.concat.Total, req.concat.Seq)
+	}
+	return key
+}
+
+// trimSIMTimestamp 去掉 SIM 卡时间戳的时区后缀（如 "+32"）
+func trimSIMTimestamp(timestamp string) string {
+	if len(timestamp) > len(simTimestampLayout) {
+		return timestamp[:len(simTimestampLayout)]
+	}
+	return timestamp
+}
+
+// check 检查短信是否在 dedupWindow 内已经收到过，没有收到过时记录下来
+func (r *recentSMS) check(req smsRequest, now time.Time) bool {
+	key := dedupKey(req)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at, ok := r.seen[key]; ok && now.Sub(at) < dedupWindow {
+		log.Printf("[SMS] Duplicate SMS from %s on device %s (timestamp %s), ignoring", req.number, req.device, req.timestamp)
+		return true
+	}
+	// 顺便清理过期的记录
+	for k, at := range r.seen {
+		if now.Sub(at) >= dedupWindow {
+			delete(r.seen, k)
+		}
+	}
+	r.seen[key] = now
+	return false
+}
+
+// forget 删除短信的去重记录（短信没有放入处理队列时调用）
+func (r *recentSMS) forget(req smsRequest) {
+	key := dedupKey(req)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.seen, key)
+}
@@ -1,13 +1,18 @@
 package sms
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/blocklist"
 	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/events"
 	"github.com/ety001/lzc-mobile/internal/notify"
 )
 
@@ -18,8 +23,18 @@ type smsRequest struct {
 	message   string
 	timestamp string
 	smsIndex  int // SIM 卡短信索引
+
+	// 长短信分段信息（nil 表示普通短信）
+	concat        *ConcatInfo
+	partsReceived int    // 合并后的请求：实际收到的分段数
+	partIndexes   []int  // 合并后的请求：各分段的 SIM 卡索引
+	flushKey      string // 非空表示这是分段超时刷新请求
+	resendID      uint   // 非 0 表示这是补发通知请求（已入库但未推送的短信 ID）
 }
 
+// simTimestampLayout SIM 卡短信时间戳格式（"YY/MM/DD HH:MM:SS"，不含时区后缀）
+const simTimestampLayout = "06/01/02 15:04:05"
+
 // Handler 短信处理器
 type Handler struct {
 	notifyManager *notify.Manager
@@ -27,7 +42,8 @@ type Handler struct {
 	mu            sync.RWMutex
 	smsQueue      chan smsRequest // 带缓冲的短信处理队列
 	wg            sync.WaitGroup  // 等待处理完成
-	processedSMS  map[string]bool // 已处理的短信索引 (device:index -> true)
+	recent        *recentSMS      // 最近收到的短信，用于多个入口之间去重
+	closed        bool            // Close 之后不再接收新短信（由 mu 保护）
 }
 
 // NewHandler 创建短信处理器
@@ -41,7 +57,7 @@ func NewHandler() *Handler {
 		notifyManager: nm,
 		startupTime:   time.Now(),
 		smsQueue:      make(chan smsRequest, 100), // 容量100，足够容纳SIM卡所有短信
-		processedSMS:  make(map[string]bool),
+		recent:        newRecentSMS(),
 	}
 
 	// 启动串行处理 goroutine
@@ -62,21 +78,52 @@ func (h *Handler) OnSMSReceived(device, number, message, timestamp string) {
 
 // OnSMSReceivedWithIndex 处理收到的短信（带索引）
 func (h *Handler) OnSMSReceivedWithIndex(device, number, message, timestamp string, smsIndex int) {
-	// 非阻塞地放入队列
-	req := smsRequest{
+	h.enqueue(smsRequest{
 		device:    device,
 		number:    number,
 		message:   message,
 		timestamp: timestamp,
 		smsIndex:  smsIndex,
+	})
+}
+
+// OnSMSPartReceived 处理收到的长短信分段（带 PDU 或分段元数据）
+// 分段会先缓冲，所有分段到齐（或超时）后合并为一条短信入库并推送一次
+func (h *Handler) OnSMSPartReceived(device, number, message, timestamp string, smsIndex int, part ami.SMSPart) {
+	h.enqueue(smsRequest{
+		device:    device,
+		number:    number,
+		message:   message,
+		timestamp: timestamp,
+		smsIndex:  smsIndex,
+		concat:    concatFromPart(part),
+	})
+}
+
+// enqueue 非阻塞地将短信放入处理队列
+// 同一条短信从多个入口（AMI 事件、dialplan 回调、SIM 卡恢复）到达时只放入一次
+func (h *Handler) enqueue(req smsRequest) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		log.Printf("SMS handler is shutting down, SMS from %s will remain on SIM card for processing after restart", req.number)
+		return
+	}
+	dedup := req.flushKey == "" && req.resendID == 0
+	if dedup && h.recent.check(req, time.Now()) {
+		return
 	}
 
 	select {
 	case h.smsQueue <- req:
-		log.Printf("SMS queued for processing (device=%s, index=%d, queue size: %d)", device, smsIndex, len(h.smsQueue))
+		log.Printf("SMS queued for processing (device=%s, index=%d, queue size: %d)", req.device, req.smsIndex, len(h.smsQueue))
 	default:
 		log.Printf("SMS queue full, SMS will remain on SIM card for later processing")
 		// 队列满时，短信仍在SIM卡中，可以稍后通过其他方式处理
+		// 删除去重记录，否则其他入口重新送达的同一条短信会被当作重复忽略
+		if dedup {
+			h.recent.forget(req)
+		}
 	}
 }
 
@@ -85,6 +132,14 @@ func (h *Handler) processSMSQueue() {
 	defer h.wg.Done()
 
 	for req := range h.smsQueue {
+		if req.flushKey != "" {
+			h.flushPartial(req.flushKey)
+			continue
+		}
+		if req.resendID != 0 {
+			h.resendNotification(req.resendID)
+			continue
+		}
 		log.Printf("Processing SMS from %s on device %s", req.number, req.device)
 		h.processSMS(req)
 		log.Printf("Finished processing SMS from %s", req.number)
@@ -92,7 +147,17 @@ func (h *Handler) processSMSQueue() {
 }
 
 // processSMS 处理单条短信（保存→推送→标记已处理）
+// 长短信分段先进入缓冲区，到齐后以合并后的请求再次进入本流程
 func (h *Handler) processSMS(req smsRequest) {
+	if req.concat.valid() && req.partsReceived == 0 {
+		merged := pendingParts.add(req, h.scheduleFlush)
+		if merged == nil {
+			return
+		}
+		log.Printf("[SMS] All %d parts of concatenated SMS from %s received, merging", merged.concat.Total, merged.number)
+		req = *merged
+	}
+
 	device := req.device
 	number := req.number
 	message := req.message
@@ -105,19 +170,30 @@ func (h *Handler) processSMS(req smsRequest) {
 	var smsTime time.Time
 	var err error
 	if timestamp != "" {
-		// SIM 卡时间戳格式: "YY/MM/DD HH:MM:SS"
-		smsTime, err = time.Parse("06/01/02 15:04:05", timestamp)
+		// SIM 卡时间戳格式: "YY/MM/DD HH:MM:SS"（两位年份解析为 20YY）
+		smsTime, err = time.Parse(simTimestampLayout, timestamp)
 		if err != nil {
 			log.Printf("Error parsing SMS timestamp '%s': %v, using current time", timestamp, err)
 			smsTime = time.Now()
-		} else {
-			// 转换为 2000 年代
-			smsTime = smsTime.AddDate(2000, 0, 0)
 		}
 	} else {
 		smsTime = time.Now()
 	}
 
+	// 黑名单检查：drop 直接丢弃，其他处理方式保存但不推送
+	blocked, err := blocklist.Check(blocklist.KindSMS, device, number)
+	if err != nil {
+		log.Printf("[SMS] Blocklist check failed for %s: %v", number, err)
+	}
+	if blocked != nil && blocked.Action == database.BlockActionDrop {
+		log.Printf("[SMS] Dropping SMS from %s on device %s (blocklist entry %d)", number, device, blocked.ID)
+		// 只删除这条短信，没有索引时不清空 SIM 卡（上面可能还有没处理的短信）
+		if !h.deleteSIMIndexes(req) {
+			log.Printf("[SMS] Dropped SMS from %s has no SIM index, keeping SIM messages on device %s", number, device)
+		}
+		return
+	}
+
 	log.Printf("New SMS detected, saving to database")
 
 	// 步骤2：保存到数据库（pushed=false，还没推送通知）
@@ -128,8 +204,15 @@ func (h *Handler) processSMS(req smsRequest) {
 		Direction:    "inbound",
 		SMSIndex:     smsIndex,
 		SMSTimestamp: &smsTime,
+		Blocked:      blocked != nil,
 		Pushed:       false, // 先标记为未推送
 	}
+	if req.concat != nil && req.partsReceived > 0 {
+		smsMessage.ConcatRef = req.concat.Ref
+		smsMessage.PartsTotal = req.concat.Total
+		smsMessage.PartsReceived = req.partsReceived
+		smsMessage.PartIndexes = joinIndexes(req.partIndexes)
+	}
 
 	if err := database.DB.Create(&smsMessage).Error; err != nil {
 		log.Printf("Error saving SMS message to database: %v", err)
@@ -137,26 +220,37 @@ func (h *Handler) processSMS(req smsRequest) {
 	}
 
 	log.Printf("SMS message saved to database with ID %d (index=%d, SIM timestamp: %s)", smsMessage.ID, smsIndex, smsTime.Format("2006-01-02 15:04:05"))
+	events.Publish(events.TopicSMS, "received", smsMessage)
+	if !smsMessage.Blocked {
+		runInboundHooks(smsMessage)
+	}
 
-	// 步骤2.5：入库成功后，清空 SIM 卡上的所有短信
+	// 步骤2.5：入库成功后，从 SIM 卡删除这条短信
 	// 这样可以避免冷启动时重复处理 SIM 卡上的短信
-	log.Printf("Deleting all SMS from SIM card on device %s to prevent duplicate processing", device)
-	amiManager := ami.GetManager()
-	client := amiManager.GetClient()
-	if client != nil {
-		if err := client.DeleteAllSMS(device); err != nil {
-			log.Printf("Warning: Failed to delete all SMS from device %s: %v", device, err)
-			// 不返回错误，继续处理通知
-		} else {
-			log.Printf("Successfully deleted all SMS from device %s", device)
-		}
-	} else {
-		log.Printf("Warning: AMI client not available, cannot delete SMS from device %s", device)
+	h.deleteSIMMessages(req)
+
+	if smsMessage.Blocked {
+		log.Printf("[SMS] SMS ID %d from %s matched blocklist entry %d, skipping notifications", smsMessage.ID, number, blocked.ID)
+		return
 	}
 
+	h.pushNotification(&smsMessage)
+}
+
+// pushNotification 推送短信通知到所有启用的渠道，并标记为已推送
+// 标记之前进程被停止的短信在重启后由 resendPending 补发
+func (h *Handler) pushNotification(smsMessage *database.SMSMessage) {
+	number := smsMessage.PhoneNumber
+	device := smsMessage.DongleID
+	message := smsMessage.Content
+
 	// 步骤3：发送通知
 	log.Printf("Sending notifications for SMS ID %d", smsMessage.ID)
 	notificationMessage := fmt.Sprintf("SMS from %s (device: %s):\n%s", number, device, message)
+	if smsMessage.PartsTotal > 0 && smsMessage.PartsReceived < smsMessage.PartsTotal {
+		notificationMessage = fmt.Sprintf("SMS from %s (device: %s, incomplete %d/%d parts):\n%s",
+			number, device, smsMessage.PartsReceived, smsMessage.PartsTotal, message)
+	}
 
 	// 获取所有启用的通知渠道
 	var enabledConfigs []database.NotificationConfig
@@ -171,7 +265,7 @@ func (h *Handler) processSMS(req smsRequest) {
 
 		// 发送通知到所有启用的渠道
 		if len(channels) > 0 {
-			errors := h.notifyManager.SendToChannels(channels, notificationMessage)
+			errors := h.notifier().SendToChannels(channels, notificationMessage)
 			if len(errors) > 0 {
 				log.Printf("Some notifications failed: %v", errors)
 			} else {
@@ -184,7 +278,7 @@ func (h *Handler) processSMS(req smsRequest) {
 
 	// 步骤4：更新数据库标记为已推送
 	now := time.Now()
-	if err := database.DB.Model(&smsMessage).Updates(map[string]interface{}{
+	if err := database.DB.Model(smsMessage).Updates(map[string]interface{}{
 		"pushed":    true,
 		"pushed_at": now,
 	}).Error; err != nil {
@@ -194,6 +288,62 @@ func (h *Handler) processSMS(req smsRequest) {
 	}
 }
 
+// simIndexes 请求对应的 SIM 卡短信索引（合并后的长短信为各分段的索引）
+func (req smsRequest) simIndexes() []int {
+	if req.partsReceived > 0 {
+		return req.partIndexes
+	}
+	if req.smsIndex > 0 {
+		return []int{req.smsIndex}
+	}
+	return nil
+}
+
+// deleteSIMIndexes 从 SIM 卡删除这条短信的索引（合并后的长短信删除各分段），没有索引时返回 false
+func (h *Handler) deleteSIMIndexes(req smsRequest) bool {
+	indexes := req.simIndexes()
+	if len(indexes) == 0 {
+		return false
+	}
+	client := ami.GetManager().GetClient()
+	if client == nil {
+		log.Printf("Warning: AMI client not available, cannot delete SMS from device %s", req.device)
+		return true
+	}
+	for _, idx := range indexes {
+		if err := client.DeleteSMS(req.device, idx); err != nil {
+			log.Printf("Warning: Failed to delete SMS %d from device %s: %v", idx, req.device, err)
+		}
+	}
+	return true
+}
+
+// deleteSIMMessages 从 SIM 卡删除已处理的短信（只删除这条短信的索引）
+// 没有索引时（旧版本事件）清空 SIM 卡，但设备还有分段在缓冲区等待时不清空：
+// 这些分段要留在 SIM 卡上，进程在分段到齐前停止时重启后由 recoverSIMMessages 重新处理
+func (h *Handler) deleteSIMMessages(req smsRequest) {
+	if h.deleteSIMIndexes(req) {
+		return
+	}
+
+	device := req.device
+	client := ami.GetManager().GetClient()
+	if client == nil {
+		log.Printf("Warning: AMI client not available, cannot delete SMS from device %s", device)
+		return
+	}
+	if pendingParts.hasDevice(device) {
+		log.Printf("SMS from %s has no SIM index and device %s has buffered parts, keeping SIM messages", req.number, device)
+		return
+	}
+	log.Printf("Deleting all SMS from SIM card on device %s to prevent duplicate processing", device)
+	if err := client.DeleteAllSMS(device); err != nil {
+		log.Printf("Warning: Failed to delete all SMS from device %s: %v", device, err)
+		return
+	}
+	log.Printf("Successfully deleted all SMS from device %s", device)
+}
+
 // OnStatusUpdate 状态更新（实现 StatusSubscriber 接口）
 func (h *Handler) OnStatusUpdate(info *ami.StatusInfo) {
 	// 短信处理器不需要处理状态更新
@@ -209,8 +359,36 @@ func (h *Handler) Register() {
 	go h.initProcessedSMS()
 }
 
-// initProcessedSMS 初始化已处理的短信列表
-// 查询 SIM 卡上的短信，检查当前状态
+// Close 停止接收新短信，等待队列中的短信处理完（入库和推送通知），ctx 结束时返回错误
+// 来不及处理的短信仍在 SIM 卡上，重启后由 recoverSIMMessages 重新处理
+func (h *Handler) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.smsQueue)
+	h.mu.Unlock()
+
+	ami.GetManager().Unsubscribe(h)
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("SMS handler drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("SMS queue not drained (%d pending): %w", len(h.smsQueue), ctx.Err())
+	}
+}
+
+// initProcessedSMS 启动时恢复中断的处理
+// 补发已入库但未推送的通知，并重新处理 SIM 卡上还没入库的短信
 func (h *Handler) initProcessedSMS() {
 	// 等待 AMI 连接就绪
 	amiManager := ami.GetManager()
@@ -229,56 +407,36 @@ func (h *Handler) initProcessedSMS() {
 		}
 	}
 
+	h.resendPending()
+
 	if client == nil {
 		log.Printf("Warning: AMI client not available, cannot check SIM card SMS")
 		return
 	}
 
-	// 查询 SIM 卡上的短信，检查当前状态
-	h.checkSIMCardSMS(client)
+	// 重新处理 SIM 卡上还没入库的短信
+	h.recoverSIMMessages(client)
 }
 
-// checkSIMCardSMS 检查 SIM 卡上的短信状态
-func (h *Handler) checkSIMCardSMS(client *ami.Client) {
-	// 获取所有 dongle 设备
-	var dongles []database.Dongle
-	if err := database.DB.Where("disable = ?", false).Find(&dongles).Error; err != nil {
-		log.Printf("Error querying dongles: %v", err)
+// ReloadConfigs 重新加载通知配置（通知配置修改后调用）
+// 加载到新的通知管理器后再替换，不影响正在推送的通知
+func (h *Handler) ReloadConfigs() {
+	nm := notify.NewManager()
+	if err := nm.LoadConfigs(); err != nil {
+		log.Printf("Error reloading notification configs: %v", err)
 		return
 	}
-
-	for _, dongle := range dongles {
-		log.Printf("Checking SMS on device %s...", dongle.DeviceID)
-
-		// 查询 SIM 卡上的短信
-		smsList, err := client.ListSMS(dongle.DeviceID)
-		if err != nil {
-			log.Printf("Error listing SMS from device %s: %v", dongle.DeviceID, err)
-			continue
-		}
-
-		if len(smsList) == 0 {
-			log.Printf("No SMS found on device %s", dongle.DeviceID)
-			continue
-		}
-
-		log.Printf("Found %d SMS on device %s", len(smsList), dongle.DeviceID)
-
-		// 记录每条短信的信息
-		for _, sms := range smsList {
-			log.Printf("SMS on device %s: index=%d, sender=%s, timestamp=%s, content=%q",
-				dongle.DeviceID, sms.Index, sms.Sender, sms.Timestamp, sms.Content)
-		}
-	}
+	h.mu.Lock()
+	h.notifyManager = nm
+	h.mu.Unlock()
+	log.Println("Notification configs reloaded")
 }
 
-// ReloadConfigs 重新加载通知配置
-func (h *Handler) ReloadConfigs() {
-	if err := h.notifyManager.LoadConfigs(); err != nil {
-		log.Printf("Error reloading notification configs: %v", err)
-	} else {
-		log.Println("Notification configs reloaded")
-	}
+// notifier 获取当前的通知管理器
+func (h *Handler) notifier() *notify.Manager {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.notifyManager
 }
 
 // SendAlert 通过已配置的通知渠道发送告警消息（供 dongle 健康检查等模块调用）
@@ -286,7 +444,16 @@ func (h *Handler) SendAlert(source, message string) {
 	alertMessage := fmt.Sprintf("[LZC Mobile Alert] %s: %s", source, message)
 	log.Printf("Sending alert: %s", alertMessage)
 
-	if errs := h.notifyManager.Send(alertMessage); len(errs) > 0 {
+	if errs := h.notifier().Send(alertMessage); len(errs) > 0 {
 		log.Printf("Some alert notifications failed: %v", errs)
 	}
 }
+
+// joinIndexes 将分段的 SIM 卡索引拼接为逗号分隔的字符串
+func joinIndexes(indexes []int) string {
+	parts := make([]string, len(indexes))
+	for i, idx := range indexes {
+		parts[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(parts, ",")
+}
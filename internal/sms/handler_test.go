@@ -0,0 +1,324 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/amitest"
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// amiServer 所有测试共享的模拟 AMI 服务器（Handler 通过全局 AMI 管理器删除 SIM 卡短信）
+var amiServer *amitest.Server
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests 启动模拟 AMI 服务器和临时数据库后运行测试
+func runTests(m *testing.M) int {
+	srv, err := amitest.NewServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer srv.Close()
+	srv.Setenv()
+	amiServer = srv
+
+	dir, err := os.MkdirTemp("", "sms-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("DB_PATH", filepath.Join(dir, "data.db"))
+	if err := database.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := ami.GetManager().Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer ami.GetManager().Close()
+
+	return m.Run()
+}
+
+// waitForSMS 等待号码对应的入站短信处理完成（已推送或被黑名单拦截）
+func waitForSMS(t *testing.T, number string) database.SMSMessage {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		var msg database.SMSMessage
+		err := database.DB.Where("phone_number = ? AND direction = ? AND (pushed = ? OR blocked = ?)", number, "inbound", true, true).
+			First(&msg).Error
+		if err == nil {
+			return msg
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("SMS from %s was not processed", number)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// countSMS 号码对应的入站短信条数
+func countSMS(t *testing.T, number string) int64 {
+	t.Helper()
+	var count int64
+	if err := database.DB.Model(&database.SMSMessage{}).Where("phone_number = ?", number).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestHandlerStoresPushesAndClearsSIM(t *testing.T) {
+	h := NewHandler()
+
+	hooked := make(chan database.SMSMessage, 1)
+	remove := AddInboundHook(func(msg database.SMSMessage) {
+		if msg.PhoneNumber == "10010" {
+			hooked <- msg
+		}
+	})
+	defer remove()
+
+	h.OnSMSReceivedWithIndex("quectel0", "10010", "您的余额为 12.34 元", "24/05/01 10:00:00", 1)
+
+	msg := waitForSMS(t, "10010")
+	if msg.DongleID != "quectel0" || msg.Content != "您的余额为 12.34 元" || msg.SMSIndex != 1 {
+		t.Fatalf("stored SMS = %+v", msg)
+	}
+	if msg.SMSTimestamp == nil || msg.SMSTimestamp.Format("2006-01-02 15:04:05") != "2024-05-01 10:00:00" {
+		t.Fatalf("SMS timestamp = %v", msg.SMSTimestamp)
+	}
+	if msg.PushedAt == nil {
+		t.Fatal("pushed_at not set")
+	}
+
+	select {
+	case got := <-hooked:
+		if got.ID != msg.ID {
+			t.Fatalf("hook got SMS %d, want %d", got.ID, msg.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inbound hook was not called")
+	}
+
+	// 入库后从 SIM 卡删除，避免重启后重复处理
+	if !amiServer.WaitForCommand("quectel cmd quectel0 AT+CMGD=1,0", time.Second) {
+		t.Fatalf("SIM messages were not deleted, commands = %v", amiServer.Commands())
+	}
+}
+
+func TestHandlerReassemblesMultipartSMS(t *testing.T) {
+	h := NewHandler()
+
+	// 分段乱序到达
+	h.OnSMSPartReceived("quectel0", "10086", "world", "24/05/01 10:00:05", 8, ami.SMSPart{Ref: 7, Total: 2, Seq: 2})
+	h.OnSMSPartReceived("quectel0", "10086", "hello ", "24/05/01 10:00:04", 7, ami.SMSPart{Ref: 7, Total: 2, Seq: 1})
+
+	msg := waitForSMS(t, "10086")
+	if msg.Content != "hello world" {
+		t.Fatalf("content = %q, want %q", msg.Content, "hello world")
+	}
+	if msg.ConcatRef != 7 || msg.PartsTotal != 2 || msg.PartsReceived != 2 || msg.PartIndexes != "7,8" {
+		t.Fatalf("concat info = ref %d, %d/%d parts, indexes %q", msg.ConcatRef, msg.PartsReceived, msg.PartsTotal, msg.PartIndexes)
+	}
+	if n := countSMS(t, "10086"); n != 1 {
+		t.Fatalf("stored %d messages, want 1", n)
+	}
+}
+
+func TestHandlerKeepsBufferedPartsOnSIM(t *testing.T) {
+	h := NewHandler()
+
+	// 长短信的第一段在缓冲区等待时收到其他短信
+	h.OnSMSPartReceived("quectel7", "10087", "first ", "24/05/01 11:00:00", 11, ami.SMSPart{Ref: 4, Total: 2, Seq: 1})
+	h.OnSMSReceivedWithIndex("quectel7", "10088", "unrelated", "24/05/01 11:00:01", 12)
+	h.OnSMSReceived("quectel7", "10089", "no index", "")
+	waitForSMS(t, "10088")
+	waitForSMS(t, "10089")
+
+	if !amiServer.WaitForCommand("quectel cmd quectel7 AT+CMGD=12,0", time.Second) {
+		t.Fatalf("stored SMS was not deleted, commands = %v", amiServer.Commands())
+	}
+	for _, cmd := range amiServer.Commands() {
+		if cmd == "quectel cmd quectel7 AT+CMGD=1,4" || cmd == "quectel cmd quectel7 AT+CMGD=11,0" {
+			t.Fatalf("buffered part deleted from SIM: %q", cmd)
+		}
+	}
+
+	// 分段到齐后删除各分段
+	h.OnSMSPartReceived("quectel7", "10087", "second", "24/05/01 11:00:02", 13, ami.SMSPart{Ref: 4, Total: 2, Seq: 2})
+	waitForSMS(t, "10087")
+	for _, cmd := range []string{"quectel cmd quectel7 AT+CMGD=11,0", "quectel cmd quectel7 AT+CMGD=13,0"} {
+		if !amiServer.WaitForCommand(cmd, time.Second) {
+			t.Fatalf("%q not sent, commands = %v", cmd, amiServer.Commands())
+		}
+	}
+}
+
+func TestHandlerMergesPartsAcrossHandlers(t *testing.T) {
+	// 分段缓冲区在 Handler 之间共享
+	NewHandler().OnSMSPartReceived("quectel0", "10000", "part one, ", "", 0, ami.SMSPart{Ref: 9, Total: 2, Seq: 1})
+	NewHandler().OnSMSPartReceived("quectel0", "10000", "part two", "", 0, ami.SMSPart{Ref: 9, Total: 2, Seq: 2})
+
+	msg := waitForSMS(t, "10000")
+	if msg.Content != "part one, part two" {
+		t.Fatalf("content = %q", msg.Content)
+	}
+}
+
+func TestRecentSMSDeduplicates(t *testing.T) {
+	r := newRecentSMS()
+	now := time.Now()
+	req := smsRequest{device: "quectel0", number: "10086", message: "a\r\nb", timestamp: "24/05/01 10:00:00+32"}
+
+	if r.check(req, now) {
+		t.Fatal("first SMS reported as duplicate")
+	}
+	// AMI 入口：换行替换为空格，时间戳不带时区
+	if !r.check(smsRequest{device: "quectel0", number: "10086", message: "a  b", timestamp: "24/05/01 10:00:00"}, now) {
+		t.Fatal("same SMS from another path not deduplicated")
+	}
+	// 不同分段、不同时间戳的短信不受影响
+	part := req
+	part.concat = &ConcatInfo{Ref: 1, Total: 2, Seq: 1}
+	if r.check(part, now) {
+		t.Fatal("part reported as duplicate of plain SMS")
+	}
+	later := req
+	later.timestamp = "24/05/01 10:00:01"
+	if r.check(later, now) {
+		t.Fatal("SMS with another timestamp reported as duplicate")
+	}
+	// 超过去重窗口后再次到达的短信重新处理
+	if r.check(req, now.Add(dedupWindow)) {
+		t.Fatal("SMS deduplicated after window expired")
+	}
+}
+
+func TestEnqueueFullQueueKeepsSMSDeliverable(t *testing.T) {
+	h := &Handler{smsQueue: make(chan smsRequest, 1), recent: newRecentSMS()}
+	h.smsQueue <- smsRequest{} // 队列已满
+	req := smsRequest{device: "quectel0", number: "10086", message: "queue full", timestamp: "24/05/01 10:00:00"}
+
+	h.enqueue(req)
+	<-h.smsQueue
+	if len(h.smsQueue) != 0 {
+		t.Fatal("SMS queued although the queue was full")
+	}
+
+	// 队列空出后，其他入口重新送达的同一条短信要能放入队列
+	h.enqueue(req)
+	if len(h.smsQueue) != 1 {
+		t.Fatal("redelivered SMS was dropped as duplicate")
+	}
+	<-h.smsQueue
+	h.enqueue(req)
+	if len(h.smsQueue) != 0 {
+		t.Fatal("queued SMS was not deduplicated")
+	}
+}
+
+func TestHandlerBlocklist(t *testing.T) {
+	entries := []database.BlockedNumber{
+		{List: database.BlockListBlock, MatchType: database.BlockMatchExact, Pattern: "95000", Action: database.BlockActionDrop, SMS: true, Enabled: true},
+		{List: database.BlockListBlock, MatchType: database.BlockMatchExact, Pattern: "95001", Action: database.BlockActionReject, SMS: true, Enabled: true},
+	}
+	for i := range entries {
+		if err := database.DB.Create(&entries[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewHandler()
+	h.OnSMSReceived("quectel0", "95000", "spam", "")
+	h.OnSMSReceived("quectel0", "95001", "more spam", "")
+	h.OnSMSReceived("quectel0", "95002", "not spam", "")
+
+	// 队列串行处理，最后一条处理完时前两条也已处理
+	waitForSMS(t, "95002")
+
+	if n := countSMS(t, "95000"); n != 0 {
+		t.Fatalf("dropped SMS was stored %d times", n)
+	}
+	blocked := waitForSMS(t, "95001")
+	if !blocked.Blocked || blocked.Pushed {
+		t.Fatalf("blocked SMS = blocked %v, pushed %v; want stored without notification", blocked.Blocked, blocked.Pushed)
+	}
+
+	var drop database.BlockedNumber
+	if err := database.DB.First(&drop, entries[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if drop.Hits != 1 || drop.LastHitAt == nil {
+		t.Fatalf("drop entry hits = %d, last hit %v", drop.Hits, drop.LastHitAt)
+	}
+}
+
+func TestHandlerDropDeletesOnlyDroppedSMS(t *testing.T) {
+	entry := database.BlockedNumber{List: database.BlockListBlock, MatchType: database.BlockMatchExact, Pattern: "95010", Action: database.BlockActionDrop, SMS: true, Enabled: true}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler()
+	h.OnSMSReceivedWithIndex("quectel8", "95010", "spam", "24/05/01 12:00:00", 5)
+	h.OnSMSReceived("quectel8", "95010", "spam without index", "24/05/01 12:00:01")
+	h.OnSMSReceivedWithIndex("quectel8", "95011", "not spam", "24/05/01 12:00:02", 6)
+	waitForSMS(t, "95011")
+
+	if !amiServer.WaitForCommand("quectel cmd quectel8 AT+CMGD=5,0", time.Second) {
+		t.Fatalf("dropped SMS was not deleted, commands = %v", amiServer.Commands())
+	}
+	for _, cmd := range amiServer.Commands() {
+		if cmd == "quectel cmd quectel8 AT+CMGD=1,4" {
+			t.Fatal("dropping an SMS without index cleared the SIM card")
+		}
+	}
+}
+
+func TestHandlerCloseDrainsQueue(t *testing.T) {
+	h := NewHandler()
+	for i := 0; i < 5; i++ {
+		h.OnSMSReceived("quectel0", fmt.Sprintf("9610%d", i), fmt.Sprintf("message %d", i), "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close 返回时队列中的短信都已入库并推送
+	for i := 0; i < 5; i++ {
+		var msg database.SMSMessage
+		if err := database.DB.Where("phone_number = ?", fmt.Sprintf("9610%d", i)).First(&msg).Error; err != nil {
+			t.Fatalf("SMS %d not stored before Close returned: %v", i, err)
+		}
+		if !msg.Pushed {
+			t.Fatalf("SMS %d not pushed before Close returned", i)
+		}
+	}
+
+	// 关闭后收到的短信留在 SIM 卡上，不再处理
+	h.OnSMSReceived("quectel0", "96200", "after close", "")
+	h.OnSMSPartReceived("quectel0", "96201", "part", "", 0, ami.SMSPart{Ref: 3, Total: 2, Seq: 1})
+	if err := h.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := countSMS(t, "96200"); n != 0 {
+		t.Fatalf("SMS received after Close was stored %d times", n)
+	}
+}
@@ -0,0 +1,47 @@
+package sms
+
+import (
+	"sync"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// InboundHook 入站短信入库后的回调（在处理队列的 goroutine 中同步调用，不应阻塞）
+type InboundHook func(msg database.SMSMessage)
+
+var (
+	hooksMu      sync.RWMutex
+	inboundHooks = make(map[int]InboundHook)
+	nextHookID   int
+)
+
+// AddInboundHook 注册入站短信回调，返回取消注册的函数
+// 用于余额查询等需要等待特定短信回复的功能
+func AddInboundHook(fn InboundHook) func() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	id := nextHookID
+	nextHookID++
+	inboundHooks[id] = fn
+
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		delete(inboundHooks, id)
+	}
+}
+
+// runInboundHooks 调用所有入站短信回调
+func runInboundHooks(msg database.SMSMessage) {
+	hooksMu.RLock()
+	hooks := make([]InboundHook, 0, len(inboundHooks))
+	for _, fn := range inboundHooks {
+		hooks = append(hooks, fn)
+	}
+	hooksMu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(msg)
+	}
+}
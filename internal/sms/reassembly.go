@@ -0,0 +1,166 @@
+package sms
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// concatTimeout 长短信分段等待超时时间
+// 超时后按已收到的分段合并入库，缺失的分段用 missingPartMarker 占位
+const concatTimeout = 5 * time.Minute
+
+// missingPartMarker 超时仍未收到的分段在合并内容中的占位符
+const missingPartMarker = "[...]"
+
+// flushRetryInterval 处理队列已满时，重新放入超时刷新请求的间隔
+const flushRetryInterval = 5 * time.Second
+
+// partialSMS 正在重组的长短信
+type partialSMS struct {
+	concat ConcatInfo
+	parts  map[int]smsRequest // seq -> 分段
+	timer  *time.Timer
+}
+
+// merge 按分段序号合并已收到的分段
+func (p *partialSMS) merge() smsRequest {
+	seqs := make([]int, 0, len(p.parts))
+	for seq := range p.parts {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	// 设备、号码、时间戳和 SIM 索引取序号最小的分段
+	merged := p.parts[seqs[0]]
+	merged.concat = &ConcatInfo{Ref: p.concat.Ref, Total: p.concat.Total}
+	merged.partsReceived = len(seqs)
+	merged.partIndexes = make([]int, 0, len(seqs))
+
+	var content strings.Builder
+	for seq := 1; seq <= p.concat.Total; seq++ {
+		part, ok := p.parts[seq]
+		if !ok {
+			content.WriteString(missingPartMarker)
+			continue
+		}
+		content.WriteString(part.message)
+		if part.smsIndex > 0 {
+			merged.partIndexes = append(merged.partIndexes, part.smsIndex)
+		}
+	}
+	merged.message = content.String()
+	return merged
+}
+
+// partStore 长短信分段缓冲区
+// 由所有 Handler 共享，使 API 和 AMI 两个入口收到的分段可以合并到一起
+type partStore struct {
+	mu      sync.Mutex
+	pending map[string]*partialSMS // concatKey -> 重组中的短信
+}
+
+// pendingParts 全局分段缓冲区
+var pendingParts = &partStore{pending: make(map[string]*partialSMS)}
+
+// concatKey 计算分段所属长短信的唯一标识（设备 + 号码 + 参考号 + 总段数）
+func concatKey(req smsRequest) string {
+	return fmt.Sprintf("%s|%s|%d|%d", req.device, req.number, req.concat.Ref, req.concat.Total)
+}
+
+// add 加入一个分段
+// 所有分段到齐时返回合并后的请求，否则返回 nil
+// 第一个分段到达时启动超时计时器，超时后调用 onTimeout(key)
+func (s *partStore) add(req smsRequest, onTimeout func(key string)) *smsRequest {
+	key := concatKey(req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, exists := s.pending[key]
+	if !exists {
+		p = &partialSMS{
+			concat: *req.concat,
+			parts:  make(map[int]smsRequest),
+		}
+		p.timer = time.AfterFunc(concatTimeout, func() { onTimeout(key) })
+		s.pending[key] = p
+	}
+
+	if _, dup := p.parts[req.concat.Seq]; dup {
+		log.Printf("[SMS] Duplicate part %d/%d for concatenated SMS %s, ignoring", req.concat.Seq, req.concat.Total, key)
+		return nil
+	}
+	p.parts[req.concat.Seq] = req
+
+	if len(p.parts) < p.concat.Total {
+		log.Printf("[SMS] Buffered part %d/%d of concatenated SMS %s (%d received)", req.concat.Seq, req.concat.Total, key, len(p.parts))
+		return nil
+	}
+
+	p.timer.Stop()
+	delete(s.pending, key)
+	merged := p.merge()
+	return &merged
+}
+
+// hasDevice 设备是否还有正在重组的长短信
+func (s *partStore) hasDevice(device string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.pending {
+		for _, part := range p.parts {
+			if part.device == device {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// take 取出并删除指定的重组中短信（超时刷新使用），不存在时返回 nil
+func (s *partStore) take(key string) *partialSMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, exists := s.pending[key]
+	if !exists {
+		return nil
+	}
+	delete(s.pending, key)
+	return p
+}
+
+// scheduleFlush 分段等待超时后，通过处理队列刷新该长短信（保证串行处理）
+// 队列已满时不阻塞（持有 h.mu 时阻塞会与 Close、ReloadConfigs 死锁），稍后重试
+// Handler 已关闭时不再刷新，分段仍在 SIM 卡上，重启后重新处理
+func (h *Handler) scheduleFlush(key string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.smsQueue <- smsRequest{flushKey: key}:
+	default:
+		log.Printf("[SMS] SMS queue full, retrying flush of concatenated SMS %s in %v", key, flushRetryInterval)
+		time.AfterFunc(flushRetryInterval, func() { h.scheduleFlush(key) })
+	}
+}
+
+// flushPartial 将超时未到齐的长短信按已收到的分段入库并推送
+func (h *Handler) flushPartial(key string) {
+	p := pendingParts.take(key)
+	if p == nil {
+		// 分段已在超时前到齐并处理
+		return
+	}
+
+	merged := p.merge()
+	log.Printf("[SMS] Concatenated SMS %s timed out with %d/%d parts, saving incomplete message", key, merged.partsReceived, p.concat.Total)
+	h.processSMS(merged)
+}
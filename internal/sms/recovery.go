@@ -0,0 +1,161 @@
+package sms
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"gorm.io/gorm"
+)
+
+// outboxMaxAge 重启后补发通知的最长时间，更早的未推送短信不再补发
+const outboxMaxAge = 24 * time.Hour
+
+// partMatchWindow 判断 SIM 卡上的分段是否已入库时，允许的时间戳偏差
+// 合并后的短信使用第一段的时间戳，其余分段的时间戳稍晚
+const partMatchWindow = 10 * time.Minute
+
+// pendingNotifications 通知发件箱：已入库但还没推送通知的入站短信（只包括补发时限内的短信）
+func pendingNotifications() *gorm.DB {
+	return database.DB.Model(&database.SMSMessage{}).
+		Where("direction = ? AND pushed = ? AND blocked = ? AND created_at > ?", "inbound", false, false, time.Now().Add(-outboxMaxAge))
+}
+
+// PendingNotifications 通知发件箱积压的短信数量和其中最早一条的入库时间（没有积压时 oldest 为 nil）
+func PendingNotifications() (count int64, oldest *time.Time, err error) {
+	if err := pendingNotifications().Count(&count).Error; err != nil {
+		return 0, nil, err
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+	var first database.SMSMessage
+	if err := pendingNotifications().Order("created_at").First(&first).Error; err != nil {
+		return 0, nil, err
+	}
+	return count, &first.CreatedAt, nil
+}
+
+// resendPending 补发已入库但还没推送通知的短信（推送过程中进程被停止）
+// 通过处理队列补发，与新短信串行处理
+func (h *Handler) resendPending() {
+	var ids []uint
+	err := pendingNotifications().Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("Error querying pending SMS notifications: %v", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	log.Printf("Resending notifications for %d pending SMS", len(ids))
+	for _, id := range ids {
+		h.enqueue(smsRequest{resendID: id})
+	}
+}
+
+// resendNotification 补发单条短信的通知
+func (h *Handler) resendNotification(id uint) {
+	var smsMessage database.SMSMessage
+	if err := database.DB.First(&smsMessage, id).Error; err != nil {
+		log.Printf("Error loading pending SMS %d: %v", id, err)
+		return
+	}
+	if smsMessage.Pushed || smsMessage.Blocked {
+		return
+	}
+	h.pushNotification(&smsMessage)
+}
+
+// recoverSIMMessages 重新处理 SIM 卡上还没入库的入站短信
+// 短信入库后才从 SIM 卡删除，进程在处理过程中被停止（如 docker restart）时短信仍在 SIM 卡上
+func (h *Handler) recoverSIMMessages(client *ami.Client) {
+	// 获取所有 dongle 设备
+	var dongles []database.Dongle
+	if err := database.DB.Where("disable = ?", false).Find(&dongles).Error; err != nil {
+		log.Printf("Error querying dongles: %v", err)
+		return
+	}
+
+	for _, dongle := range dongles {
+		log.Printf("Checking SMS on device %s...", dongle.DeviceID)
+
+		// 查询 SIM 卡上的短信
+		smsList, err := client.ListSMS(dongle.DeviceID)
+		if err != nil {
+			log.Printf("Error listing SMS from device %s: %v", dongle.DeviceID, err)
+			continue
+		}
+
+		if len(smsList) == 0 {
+			log.Printf("No SMS found on device %s", dongle.DeviceID)
+			continue
+		}
+
+		recovered := 0
+		for _, info := range smsList {
+			if !strings.HasPrefix(info.Status, "REC") {
+				continue
+			}
+			if h.recoverSIMMessage(dongle.DeviceID, info) {
+				recovered++
+			}
+		}
+		log.Printf("Found %d SMS on device %s, %d not yet stored", len(smsList), dongle.DeviceID, recovered)
+	}
+}
+
+// recoverSIMMessage 如果 SIM 卡上的短信还没入库，放入处理队列，返回是否放入
+func (h *Handler) recoverSIMMessage(device string, info ami.SMSInfo) bool {
+	timestamp := trimSIMTimestamp(info.Timestamp)
+
+	var part *ami.SMSPart
+	if info.PDU != nil {
+		if concat := info.PDU.Concat(); concat != nil && concat.Total > 1 {
+			part = &ami.SMSPart{Ref: concat.Ref, Total: concat.Total, Seq: concat.Seq}
+		}
+	}
+
+	if isStored(device, info, timestamp, part) {
+		return false
+	}
+
+	log.Printf("Recovering SMS from SIM card: device=%s, index=%d, sender=%s, timestamp=%s",
+		device, info.Index, info.Sender, timestamp)
+	if part != nil {
+		h.OnSMSPartReceived(device, info.Sender, info.Content, timestamp, info.Index, *part)
+	} else {
+		h.OnSMSReceivedWithIndex(device, info.Sender, info.Content, timestamp, info.Index)
+	}
+	return true
+}
+
+// isStored 检查 SIM 卡上的短信是否已入库
+// 普通短信按内容和时间戳匹配，长短信分段按分段参考号和时间范围匹配；查询出错时视为已入库，避免重复推送
+func isStored(device string, info ami.SMSInfo, timestamp string, part *ami.SMSPart) bool {
+	query := database.DB.Model(&database.SMSMessage{}).
+		Where("dongle_id = ? AND phone_number = ? AND direction = ?", device, info.Sender, "inbound")
+
+	smsTime, err := time.Parse(simTimestampLayout, timestamp)
+	if part != nil {
+		query = query.Where("concat_ref = ? AND parts_total = ?", part.Ref, part.Total)
+		if err == nil {
+			query = query.Where("sms_timestamp BETWEEN ? AND ?", smsTime.Add(-partMatchWindow), smsTime.Add(partMatchWindow))
+		}
+	} else {
+		query = query.Where("content = ?", info.Content)
+		if err == nil {
+			query = query.Where("sms_timestamp = ?", smsTime)
+		}
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		log.Printf("Error checking stored SMS: %v", err)
+		return true
+	}
+	return count > 0
+}
@@ -0,0 +1,84 @@
+package sms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+func TestResendPendingNotifications(t *testing.T) {
+	now := time.Now()
+	pending := []database.SMSMessage{
+		// 入库后、推送前进程被停止
+		{DongleID: "quectel0", PhoneNumber: "97000", Content: "pending", Direction: "inbound"},
+		// 超过补发时限
+		{DongleID: "quectel0", PhoneNumber: "97001", Content: "stale", Direction: "inbound", CreatedAt: now.Add(-2 * outboxMaxAge)},
+		// 被黑名单拦截的短信不推送
+		{DongleID: "quectel0", PhoneNumber: "97002", Content: "blocked", Direction: "inbound", Blocked: true},
+	}
+	for i := range pending {
+		if err := database.DB.Create(&pending[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewHandler()
+	h.resendPending()
+
+	msg := waitForSMS(t, "97000")
+	if !msg.Pushed || msg.PushedAt == nil {
+		t.Fatalf("pending SMS not pushed: %+v", msg)
+	}
+	for _, number := range []string{"97001", "97002"} {
+		var m database.SMSMessage
+		if err := database.DB.Where("phone_number = ?", number).First(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.Pushed {
+			t.Fatalf("SMS from %s should not be resent", number)
+		}
+	}
+}
+
+func TestRecoverSIMMessages(t *testing.T) {
+	dongle := database.Dongle{DeviceID: "quectel7"}
+	if err := database.DB.Create(&dongle).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer database.DB.Delete(&dongle)
+
+	// SIM 卡上有一条已入库的短信和一条进程停止前没来得及入库的短信
+	smsTime := time.Date(2024, 5, 6, 12, 34, 56, 0, time.UTC)
+	stored := database.SMSMessage{DongleID: "quectel7", PhoneNumber: "+8613912345678", Content: "已入库", Direction: "inbound", SMSTimestamp: &smsTime, Pushed: true}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	amiServer.SetCommand("quectel cmd quectel7 AT+CMGL=4", "AT+CMGL=4\n"+
+		"+CMGL: 2,0,,21\n"+
+		"0891683108200105F0040D91683119325476F8000842506021436523044F60597D\n"+
+		"\nOK")
+
+	h := NewHandler()
+	h.recoverSIMMessages(ami.GetManager().GetClient())
+
+	var msg database.SMSMessage
+	deadline := time.Now().Add(3 * time.Second)
+	for database.DB.Where("phone_number = ? AND content = ? AND pushed = ?", "+8613912345678", "你好", true).First(&msg).Error != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("SIM message was not recovered")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if msg.Content != "你好" || msg.SMSIndex != 2 || msg.SMSTimestamp == nil || !msg.SMSTimestamp.Equal(smsTime) {
+		t.Fatalf("recovered SMS = %+v", msg)
+	}
+
+	// 再次检查时不会重复处理
+	h.recoverSIMMessages(ami.GetManager().GetClient())
+	time.Sleep(100 * time.Millisecond)
+	if n := countSMS(t, "+8613912345678"); n != 2 {
+		t.Fatalf("stored %d messages, want 2", n)
+	}
+}
@@ -0,0 +1,145 @@
+package timecond
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// DefaultOpenKeywords 事件名称包含这些关键字时视为调休上班日（国内节假日日历的常见写法）
+var DefaultOpenKeywords = []string{"补班", "上班"}
+
+// ParseICal 从 iCalendar 中读取全部 VEVENT 作为例外日期
+// 只取每个事件本身的日期，不展开 RRULE；DTEND 按 RFC 5545 视为不含
+func ParseICal(r io.Reader, openKeywords []string) ([]database.TimeConditionHoliday, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays []database.TimeConditionHoliday
+	var inEvent bool
+	var summary, dtstart, dtend string
+	var endIsDate bool
+
+	for n, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		params := ""
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name, params = name[:i], name[i+1:]
+		}
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				inEvent = true
+				summary, dtstart, dtend, endIsDate = "", "", "", false
+			}
+		case "END":
+			if !strings.EqualFold(value, "VEVENT") || !inEvent {
+				continue
+			}
+			inEvent = false
+			if dtstart == "" {
+				return nil, fmt.Errorf("line %d: VEVENT without DTSTART", n+1)
+			}
+			h, err := eventHoliday(summary, dtstart, dtend, endIsDate, openKeywords)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			holidays = append(holidays, h)
+		case "SUMMARY":
+			if inEvent {
+				summary = unescapeText(value)
+			}
+		case "DTSTART":
+			if inEvent {
+				dtstart = value
+			}
+		case "DTEND":
+			if inEvent {
+				dtend = value
+				endIsDate = strings.Contains(strings.ToUpper(params), "VALUE=DATE") || len(value) == 8
+			}
+		}
+	}
+	return holidays, nil
+}
+
+// eventHoliday 将一个事件转换为例外日期
+func eventHoliday(summary, dtstart, dtend string, endIsDate bool, openKeywords []string) (database.TimeConditionHoliday, error) {
+	start, err := parseICalDate(dtstart)
+	if err != nil {
+		return database.TimeConditionHoliday{}, err
+	}
+	end := start
+	if dtend != "" {
+		if end, err = parseICalDate(dtend); err != nil {
+			return database.TimeConditionHoliday{}, err
+		}
+		// 全天事件的 DTEND 是结束后的第一天；带时间的事件在零点结束时同理
+		if endIsDate || strings.HasSuffix(strings.TrimSuffix(dtend, "Z"), "T000000") {
+			end = end.AddDate(0, 0, -1)
+		}
+		if end.Before(start) {
+			end = start
+		}
+	}
+
+	kind := database.HolidayClosed
+	for _, kw := range openKeywords {
+		if kw != "" && strings.Contains(summary, kw) {
+			kind = database.HolidayOpen
+			break
+		}
+	}
+	return database.TimeConditionHoliday{
+		Name:      summary,
+		StartDate: start.Format(DateLayout),
+		EndDate:   end.Format(DateLayout),
+		Kind:      kind,
+		Source:    "ical",
+	}, nil
+}
+
+// parseICalDate 解析 DATE（20261001）或 DATE-TIME（20261001T090000Z），只保留日期部分
+func parseICalDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return t, nil
+}
+
+// unfoldLines 读取内容行并合并折行（以空格或制表符开头的行属于上一行）
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// unescapeText 还原 TEXT 值中的转义字符
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
@@ -0,0 +1,60 @@
+package timecond
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+func TestParseICal(t *testing.T) {
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"SUMMARY:国庆节",
+		"DTSTART;VALUE=DATE:20261001",
+		"DTEND;VALUE=DATE:20261008",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:国庆节补班",
+		"DTSTART;VALUE=DATE:20261010",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Team\\, offsite",
+		" day",
+		"DTSTART:20261020T090000Z",
+		"DTEND:20261021T000000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	holidays, err := ParseICal(strings.NewReader(calendar), DefaultOpenKeywords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []database.TimeConditionHoliday{
+		{Name: "国庆节", StartDate: "2026-10-01", EndDate: "2026-10-07", Kind: database.HolidayClosed, Source: "ical"},
+		{Name: "国庆节补班", StartDate: "2026-10-10", EndDate: "2026-10-10", Kind: database.HolidayOpen, Source: "ical"},
+		{Name: "Team, offsiteday", StartDate: "2026-10-20", EndDate: "2026-10-20", Kind: database.HolidayClosed, Source: "ical"},
+	}
+	if len(holidays) != len(want) {
+		t.Fatalf("parsed %d holidays, want %d: %+v", len(holidays), len(want), holidays)
+	}
+	for i := range want {
+		if holidays[i] != want[i] {
+			t.Fatalf("holiday %d = %+v, want %+v", i, holidays[i], want[i])
+		}
+	}
+}
+
+func TestParseICalErrors(t *testing.T) {
+	for _, calendar := range []string{
+		"BEGIN:VEVENT\nSUMMARY:no start\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:2026\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20261301\nEND:VEVENT\n",
+	} {
+		if _, err := ParseICal(strings.NewReader(calendar), nil); err == nil {
+			t.Fatalf("calendar %q accepted", calendar)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package timecond
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// DateLayout 例外日期的格式
+const DateLayout = "2006-01-02"
+
+// weekdayNames GotoIfTime 使用的星期缩写（下标与 time.Weekday 一致）
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Result 时间条件的计算结果
+type Result struct {
+	Open     bool                           `json:"open"`
+	Reason   string                         `json:"reason"`
+	Local    string                         `json:"local_time"` // 条件时区下的时间
+	Holiday  *database.TimeConditionHoliday `json:"holiday,omitempty"`
+	Rule     *database.TimeConditionRule    `json:"rule,omitempty"`
+	Timezone string                         `json:"timezone"`
+}
+
+// ParseWeekdays 解析 GotoIfTime 格式的星期（*、mon、mon-fri、fri-mon、sat&sun）
+func ParseWeekdays(spec string) ([7]bool, error) {
+	var days [7]bool
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(spec, "&") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := weekdayIndex(from)
+		if err != nil {
+			return days, err
+		}
+		end := start
+		if isRange {
+			if end, err = weekdayIndex(to); err != nil {
+				return days, err
+			}
+		}
+		// 支持跨周的范围（如 fri-mon）
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func weekdayIndex(name string) (int, error) {
+	for i, n := range weekdayNames {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", name)
+}
+
+// ParseClock 解析 HH:MM，返回从零点开始的分钟数
+func ParseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok || len(h) != 2 || len(m) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// ValidateRule 校验工作时间段
+func ValidateRule(r *database.TimeConditionRule) error {
+	if _, err := ParseWeekdays(r.Weekdays); err != nil {
+		return err
+	}
+	if _, err := ParseClock(r.StartTime); err != nil {
+		return err
+	}
+	if _, err := ParseClock(r.EndTime); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateHoliday 校验例外日期
+func ValidateHoliday(h *database.TimeConditionHoliday) error {
+	start, err := time.Parse(DateLayout, h.StartDate)
+	if err != nil {
+		return fmt.Errorf("invalid start_date %q, expected YYYY-MM-DD", h.StartDate)
+	}
+	if h.EndDate == "" {
+		h.EndDate = h.StartDate
+	}
+	end, err := time.Parse(DateLayout, h.EndDate)
+	if err != nil {
+		return fmt.Errorf("invalid end_date %q, expected YYYY-MM-DD", h.EndDate)
+	}
+	if end.Before(start) {
+		return errors.New("end_date is before start_date")
+	}
+	if h.Kind == "" {
+		h.Kind = database.HolidayClosed
+	}
+	if h.Kind != database.HolidayClosed && h.Kind != database.HolidayOpen {
+		return fmt.Errorf("invalid kind %q, expected closed or open", h.Kind)
+	}
+	return nil
+}
+
+// LoadLocation 加载时区，为空时使用本地时区
+func LoadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// TimesSpec 工作时间段对应的 GotoIfTime 时间参数（开始等于结束表示全天）
+// 时间段的结束时间不含（09:00-18:00 在 18:00 下班），而 GotoIfTime 包含结束的那一分钟，
+// 所以渲染为结束时间的前一分钟（09:00-17:59），与 Evaluate 一致
+func TimesSpec(r database.TimeConditionRule) string {
+	if r.StartTime == r.EndTime {
+		return "*"
+	}
+	end, err := ParseClock(r.EndTime)
+	if err != nil {
+		return r.StartTime + "-" + r.EndTime
+	}
+	end = (end + minutesPerDay - 1) % minutesPerDay
+	return fmt.Sprintf("%s-%02d:%02d", r.StartTime, end/60, end%60)
+}
+
+// minutesPerDay 一天的分钟数
+const minutesPerDay = 24 * 60
+
+// Evaluate 计算时间条件在时刻 t 是否处于工作时间
+// 判断顺序与 dialplan 一致：调休上班日 > 节假日 > 每周工作时间
+func Evaluate(c *database.TimeCondition, t time.Time) (*Result, error) {
+	loc, err := LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	local := t.In(loc)
+	date := local.Format(DateLayout)
+	minute := local.Hour()*60 + local.Minute()
+
+	result := &Result{Local: local.Format(time.RFC3339), Timezone: loc.String()}
+
+	for _, kind := range []string{database.HolidayOpen, database.HolidayClosed} {
+		for i := range c.Holidays {
+			h := &c.Holidays[i]
+			if h.Kind != kind || date < h.StartDate || date > h.EndDate {
+				continue
+			}
+			result.Holiday = h
+			if kind == database.HolidayClosed {
+				result.Reason = "holiday: " + h.Name
+				return result, nil
+			}
+			// 调休上班：忽略星期，只看时间段
+			for j := range c.Rules {
+				if inTimeRange(c.Rules[j], minute) {
+					result.Open = true
+					result.Rule = &c.Rules[j]
+					result.Reason = "make-up workday: " + h.Name
+					return result, nil
+				}
+			}
+			result.Reason = "make-up workday, outside working hours: " + h.Name
+			return result, nil
+		}
+	}
+
+	for i := range c.Rules {
+		r := c.Rules[i]
+		days, err := ParseWeekdays(r.Weekdays)
+		if err != nil {
+			return nil, err
+		}
+		if days[local.Weekday()] && inTimeRange(r, minute) {
+			result.Open = true
+			result.Rule = &c.Rules[i]
+			result.Reason = fmt.Sprintf("working hours: %s %s-%s", r.Weekdays, r.StartTime, r.EndTime)
+			return result, nil
+		}
+	}
+	result.Reason = "outside working hours"
+	return result, nil
+}
+
+// inTimeRange 判断分钟数是否在时间段内（结束时间不含，支持跨零点）
+func inTimeRange(r database.TimeConditionRule, minute int) bool {
+	start, err1 := ParseClock(r.StartTime)
+	end, err2 := ParseClock(r.EndTime)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return minute >= start && minute < end
+	default:
+		return minute >= start || minute < end
+	}
+}
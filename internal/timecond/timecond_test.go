@@ -0,0 +1,122 @@
+package timecond
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+func TestParseWeekdays(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want string // 从周日开始，1 表示选中
+		err  bool
+	}{
+		{"*", "1111111", false},
+		{"", "1111111", false},
+		{"mon-fri", "0111110", false},
+		{"fri-mon", "1100011", false},
+		{"sat&sun", "1000001", false},
+		{"Wed", "0001000", false},
+		{"mon-xyz", "", true},
+	} {
+		days, err := ParseWeekdays(tc.spec)
+		if (err != nil) != tc.err {
+			t.Fatalf("ParseWeekdays(%q) err = %v", tc.spec, err)
+		}
+		if tc.err {
+			continue
+		}
+		got := ""
+		for _, d := range days {
+			if d {
+				got += "1"
+			} else {
+				got += "0"
+			}
+		}
+		if got != tc.want {
+			t.Fatalf("ParseWeekdays(%q) = %s, want %s", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestTimesSpec(t *testing.T) {
+	for _, tc := range []struct {
+		start, end string
+		want       string
+	}{
+		{"09:00", "18:00", "09:00-17:59"},
+		{"00:00", "00:00", "*"},
+		{"22:00", "06:00", "22:00-05:59"},
+		{"18:00", "00:00", "18:00-23:59"},
+		{"12:00", "12:01", "12:00-12:00"},
+	} {
+		if got := TimesSpec(database.TimeConditionRule{StartTime: tc.start, EndTime: tc.end}); got != tc.want {
+			t.Fatalf("TimesSpec(%s-%s) = %q, want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cond := &database.TimeCondition{
+		Timezone: "UTC",
+		Rules: []database.TimeConditionRule{
+			{Weekdays: "mon-fri", StartTime: "09:00", EndTime: "18:00"},
+			{Weekdays: "sat", StartTime: "22:00", EndTime: "02:00"},
+		},
+		Holidays: []database.TimeConditionHoliday{
+			{Name: "National Day", StartDate: "2026-10-01", EndDate: "2026-10-07", Kind: database.HolidayClosed},
+			{Name: "Make-up", StartDate: "2026-10-10", EndDate: "2026-10-10", Kind: database.HolidayOpen},
+		},
+	}
+
+	for _, tc := range []struct {
+		at   string
+		open bool
+	}{
+		{"2026-10-12T08:59:59Z", false}, // 周一上班前
+		{"2026-10-12T09:00:00Z", true},
+		{"2026-10-12T17:59:59Z", true},
+		{"2026-10-12T18:00:00Z", false}, // 结束时间不含，与 dialplan 的 09:00-17:59 一致
+		{"2026-10-11T12:00:00Z", false}, // 周日
+		{"2026-10-17T23:30:00Z", true},  // 周六跨零点的时间段
+		{"2026-10-17T21:59:00Z", false},
+		{"2026-10-05T10:00:00Z", false}, // 节假日（周一）
+		{"2026-10-10T10:00:00Z", true},  // 调休上班（周六），忽略星期
+		{"2026-10-10T18:00:00Z", false}, // 调休上班日的下班时间
+	} {
+		at, err := time.Parse(time.RFC3339, tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Evaluate(cond, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Open != tc.open {
+			t.Fatalf("Evaluate(%s) = open %v (%s), want %v", tc.at, result.Open, result.Reason, tc.open)
+		}
+	}
+
+	if _, err := Evaluate(&database.TimeCondition{Timezone: "Nowhere/City"}, time.Now()); err == nil {
+		t.Fatal("invalid timezone accepted")
+	}
+}
+
+func TestValidateHoliday(t *testing.T) {
+	h := database.TimeConditionHoliday{StartDate: "2026-10-01"}
+	if err := ValidateHoliday(&h); err != nil || h.EndDate != "2026-10-01" || h.Kind != database.HolidayClosed {
+		t.Fatalf("holiday = %+v, err = %v", h, err)
+	}
+	for _, h := range []database.TimeConditionHoliday{
+		{StartDate: "2026-10-07", EndDate: "2026-10-01"},
+		{StartDate: "2026/10/01"},
+		{StartDate: "2026-10-01", Kind: "maybe"},
+	} {
+		if err := ValidateHoliday(&h); err == nil {
+			t.Fatalf("holiday %+v accepted", h)
+		}
+	}
+}
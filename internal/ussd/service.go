@@ -0,0 +1,370 @@
+package ussd
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// 会话状态
+const (
+	StatusPending      = "pending"       // 已发送请求，等待网络响应
+	StatusWaitingInput = "waiting_input" // 网络返回菜单，等待用户回复
+	StatusCompleted    = "completed"     // 会话正常结束
+	StatusTimeout      = "timeout"       // 等待响应或菜单回复超时
+	StatusFailed       = "failed"        // 发送失败或网络不支持
+	StatusCancelled    = "cancelled"     // 用户取消
+)
+
+// USSD 响应类型（+CUSD 的 <m>，3GPP TS 27.007 7.15）
+const (
+	TypeUnknown         = -1 // 事件中未携带类型
+	TypeNoFurtherAction = 0  // 无需进一步操作
+	TypeFurtherAction   = 1  // 需要用户回复（菜单）
+	TypeTerminated      = 2  // 网络结束会话
+	TypeOtherClient     = 3  // 其他客户端已响应
+	TypeNotSupported    = 4  // 不支持的操作
+	TypeNetworkTimeout  = 5  // 网络超时
+)
+
+const (
+	// DefaultResponseTimeout 等待网络响应的默认超时时间
+	DefaultResponseTimeout = 30 * time.Second
+	// menuTimeout 菜单等待用户回复的时间，超过后运营商通常已结束会话
+	menuTimeout = 2 * time.Minute
+	// duplicateWindow AMI 事件和 dialplan 会投递同一条响应，窗口内相同内容视为重复
+	duplicateWindow = 3 * time.Second
+)
+
+var (
+	// ErrBusy 设备上已有等待响应的 USSD 请求
+	ErrBusy = errors.New("USSD request already in progress on this device")
+	// ErrTimeout 等待网络响应超时
+	ErrTimeout = errors.New("timeout waiting for USSD response")
+	// ErrCancelled 等待期间会话被取消
+	ErrCancelled = errors.New("USSD session cancelled")
+)
+
+// Response USSD 网络响应
+type Response struct {
+	Message string `json:"message"`
+	Type    int    `json:"type"`
+}
+
+// WaitingInput 网络是否在等待用户回复（多级菜单）
+func (r *Response) WaitingInput() bool {
+	return statusForType(r.Type) == StatusWaitingInput
+}
+
+// deviceState 单个设备的 USSD 会话状态
+type deviceState struct {
+	sessionID    uint           // 当前会话 ID（0 表示没有进行中的会话）
+	waiter       chan *Response // 等待响应的请求（nil 表示没有；收到 nil 表示会话被取消）
+	menuDeadline time.Time      // 菜单会话的过期时间
+
+	// 去重：最近一条响应
+	lastMessage   string
+	lastSessionID uint // 最近一条响应所属的会话（入库前为 0）
+	lastMessageID uint // 最近一条响应的消息 ID（入库前为 0）
+	lastType      int
+	lastAt        time.Time
+	lastSeq       uint64 // 最近一条响应的序号，入库后用来确认状态没有被更新的响应覆盖
+}
+
+// Service USSD 会话管理（单例）
+// 同一设备同时只能有一个等待响应的请求；网络返回菜单时，下一次请求作为菜单回复归入同一会话
+type Service struct {
+	mu      sync.Mutex
+	devices map[string]*deviceState
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局 USSD 服务实例
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = &Service{
+			devices: make(map[string]*deviceState),
+		}
+	})
+	return globalService
+}
+
+// Register 注册到 AMI manager，接收 QuectelNewUSSD 等事件
+func (s *Service) Register() {
+	ami.GetManager().Subscribe(s)
+}
+
+// OnStatusUpdate 实现 ami.StatusSubscriber（USSD 服务不关心状态更新）
+func (s *Service) OnStatusUpdate(info *ami.StatusInfo) {}
+
+// OnSMSReceived 实现 ami.StatusSubscriber（短信由 sms.Handler 处理）
+func (s *Service) OnSMSReceived(device, number, message, timestamp string) {}
+
+// OnUSSDReceived 处理 AMI 事件中的 USSD 响应
+func (s *Service) OnUSSDReceived(device, message string, ussdType int) {
+	s.Deliver(device, message, ussdType)
+}
+
+// state 获取设备状态（调用方需持有 s.mu）
+func (s *Service) state(device string) *deviceState {
+	st, ok := s.devices[device]
+	if !ok {
+		st = &deviceState{lastType: TypeUnknown}
+		s.devices[device] = st
+	}
+	return st
+}
+
+// Send 发送 USSD 代码并等待网络响应
+// 设备上有未过期的菜单会话时，code 作为菜单回复发送并归入该会话
+func (s *Service) Send(device, code string, timeout time.Duration) (*database.USSDSession, *Response, error) {
+	if timeout <= 0 {
+		timeout = DefaultResponseTimeout
+	}
+
+	// 在锁内占用设备并决定是否继续菜单会话，数据库读写在解锁后进行
+	s.mu.Lock()
+	st := s.state(device)
+	if st.waiter != nil {
+		s.mu.Unlock()
+		return nil, nil, ErrBusy
+	}
+	var continueID, expiredID uint
+	if st.sessionID != 0 {
+		if time.Now().Before(st.menuDeadline) {
+			continueID = st.sessionID
+		} else {
+			// 菜单已过期，运营商侧会话已经结束
+			expiredID = st.sessionID
+		}
+	}
+	waiter := make(chan *Response, 1)
+	st.waiter = waiter
+	st.sessionID = continueID
+	s.mu.Unlock()
+
+	if expiredID != 0 {
+		s.setStatus(expiredID, StatusTimeout)
+	}
+	var session database.USSDSession
+	if continueID != 0 && database.DB.First(&session, continueID).Error == nil {
+		s.setStatus(session.ID, StatusPending)
+	} else {
+		session = database.USSDSession{DongleID: device, Code: code, Status: StatusPending}
+		if err := database.DB.Create(&session).Error; err != nil {
+			s.release(st, waiter)
+			return nil, nil, err
+		}
+	}
+
+	s.mu.Lock()
+	if st.waiter == waiter {
+		st.sessionID = session.ID
+	}
+	s.mu.Unlock()
+
+	s.saveMessage(session.ID, "outbound", code, 0)
+
+	if err := ami.GetManager().SendUSSD(device, code); err != nil {
+		s.release(st, waiter)
+		s.setStatus(session.ID, StatusFailed)
+		return nil, nil, err
+	}
+
+	var resp *Response
+	var err error
+	select {
+	case resp = <-waiter:
+		if resp == nil {
+			// 请求入库期间被取消时 Cancel 还不知道会话 ID
+			s.setStatus(session.ID, StatusCancelled)
+			err = ErrCancelled
+		}
+	case <-time.After(timeout):
+		s.release(st, waiter)
+		s.setStatus(session.ID, StatusTimeout)
+		log.Printf("[USSD] Timeout waiting for response to %s on %s", code, device)
+		err = ErrTimeout
+	}
+
+	if loadErr := database.DB.Preload("Messages").First(&session, session.ID).Error; loadErr != nil {
+		log.Printf("[USSD] Failed to reload session %d: %v", session.ID, loadErr)
+	}
+	return &session, resp, err
+}
+
+// release 释放请求占用的设备（请求失败或超时），设备已被其他响应或取消释放时不做处理
+func (s *Service) release(st *deviceState, waiter chan *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st.waiter == waiter {
+		st.waiter = nil
+		st.sessionID = 0
+	}
+}
+
+// Deliver 处理收到的 USSD 响应（AMI 事件或 dialplan 回调）
+// 有等待中的请求时归入其会话，否则作为网络主动发起的会话保存
+// 会话状态在锁内计算，入库在解锁后进行，避免一个设备的数据库写入阻塞其他设备
+func (s *Service) Deliver(device, message string, ussdType int) {
+	now := time.Now()
+
+	s.mu.Lock()
+	st := s.state(device)
+
+	// 同一响应会从 AMI 事件和 dialplan 各投递一次
+	if message == st.lastMessage && now.Sub(st.lastAt) < duplicateWindow {
+		correct := ussdType != TypeUnknown && st.lastType == TypeUnknown
+		var sessionID, messageID uint
+		var status string
+		if correct {
+			// 第一次投递没有类型，用第二次投递的类型修正（第一次投递还没入库时由它入库后修正）
+			st.lastType = ussdType
+			sessionID, messageID = st.lastSessionID, st.lastMessageID
+			status = s.applyType(st, ussdType)
+		}
+		s.mu.Unlock()
+
+		if correct && messageID != 0 {
+			s.saveType(sessionID, messageID, ussdType, status)
+		}
+		log.Printf("[USSD] Duplicate response on %s ignored", device)
+		return
+	}
+
+	sessionID := st.sessionID
+	st.lastSeq++
+	seq := st.lastSeq
+	st.lastMessage = message
+	st.lastSessionID = sessionID
+	st.lastMessageID = 0
+	st.lastType = ussdType
+	st.lastAt = now
+	waiter := st.waiter
+	st.waiter = nil
+	status := s.applyType(st, ussdType)
+	s.mu.Unlock()
+
+	log.Printf("[USSD] Response on %s (type %d): %q", device, ussdType, message)
+
+	if sessionID == 0 {
+		session := database.USSDSession{DongleID: device, Status: status}
+		if err := database.DB.Create(&session).Error; err != nil {
+			log.Printf("[USSD] Failed to create session for unsolicited USSD on %s: %v", device, err)
+			return
+		}
+		sessionID = session.ID
+		log.Printf("[USSD] Network-initiated USSD on %s", device)
+	}
+	messageID := s.saveMessage(sessionID, "inbound", message, ussdType)
+
+	// 入库期间重复投递的响应可能已修正类型
+	s.mu.Lock()
+	finalType := ussdType
+	if st.lastSeq == seq {
+		st.lastSessionID = sessionID
+		st.lastMessageID = messageID
+		finalType = st.lastType
+		if st.sessionID == 0 && st.waiter == nil && statusForType(finalType) == StatusWaitingInput {
+			// 网络主动发起的菜单，之后的请求作为菜单回复
+			st.sessionID = sessionID
+		}
+	}
+	s.mu.Unlock()
+
+	s.saveType(sessionID, messageID, finalType, statusForType(finalType))
+
+	if waiter != nil {
+		waiter <- &Response{Message: message, Type: ussdType}
+	}
+}
+
+// applyType 根据响应类型更新设备状态，返回会话状态（调用方需持有 s.mu）
+func (s *Service) applyType(st *deviceState, ussdType int) string {
+	status := statusForType(ussdType)
+	if status == StatusWaitingInput {
+		st.menuDeadline = time.Now().Add(menuTimeout)
+	} else {
+		st.sessionID = 0
+	}
+	return status
+}
+
+// saveType 保存响应类型和对应的会话状态
+func (s *Service) saveType(sessionID, messageID uint, ussdType int, status string) {
+	if messageID != 0 {
+		if err := database.DB.Model(&database.USSDMessage{}).Where("id = ?", messageID).Update("type", ussdType).Error; err != nil {
+			log.Printf("[USSD] Failed to update type of message %d: %v", messageID, err)
+		}
+	}
+	if sessionID != 0 {
+		s.setStatus(sessionID, status)
+	}
+}
+
+// Cancel 结束设备上正在进行的 USSD 会话
+func (s *Service) Cancel(device string) error {
+	if err := ami.GetManager().CancelUSSD(device); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	st := s.state(device)
+	sessionID := st.sessionID
+	st.sessionID = 0
+	if st.waiter != nil {
+		st.waiter <- nil
+		st.waiter = nil
+	}
+	s.mu.Unlock()
+
+	if sessionID != 0 {
+		s.setStatus(sessionID, StatusCancelled)
+	}
+	return nil
+}
+
+// saveMessage 保存一条会话消息，返回消息 ID
+func (s *Service) saveMessage(sessionID uint, direction, content string, ussdType int) uint {
+	msg := database.USSDMessage{
+		SessionID: sessionID,
+		Direction: direction,
+		Content:   content,
+		Type:      ussdType,
+	}
+	if err := database.DB.Create(&msg).Error; err != nil {
+		log.Printf("[USSD] Failed to save %s message for session %d: %v", direction, sessionID, err)
+		return 0
+	}
+	return msg.ID
+}
+
+// setStatus 更新会话状态
+func (s *Service) setStatus(sessionID uint, status string) {
+	if err := database.DB.Model(&database.USSDSession{}).Where("id = ?", sessionID).Update("status", status).Error; err != nil {
+		log.Printf("[USSD] Failed to update session %d status to %s: %v", sessionID, status, err)
+	}
+}
+
+// statusForType 将响应类型映射为会话状态
+// 未知类型按菜单处理，保证多级菜单可以继续回复（菜单会话会按 menuTimeout 过期）
+func statusForType(ussdType int) string {
+	switch ussdType {
+	case TypeFurtherAction, TypeUnknown:
+		return StatusWaitingInput
+	case TypeNoFurtherAction, TypeTerminated, TypeOtherClient:
+		return StatusCompleted
+	case TypeNetworkTimeout:
+		return StatusTimeout
+	default:
+		return StatusFailed
+	}
+}
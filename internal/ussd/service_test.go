@@ -0,0 +1,336 @@
+package ussd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/amitest"
+	"github.com/ety001/lzc-mobile/internal/database"
+)
+
+// amiServer 所有测试共享的模拟 AMI 服务器（USSD 请求通过全局 AMI 管理器发送）
+var amiServer *amitest.Server
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests 启动模拟 AMI 服务器和临时数据库后运行测试
+func runTests(m *testing.M) int {
+	srv, err := amitest.NewServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer srv.Close()
+	srv.Setenv()
+	amiServer = srv
+
+	dir, err := os.MkdirTemp("", "ussd-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("DB_PATH", filepath.Join(dir, "data.db"))
+	if err := database.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := ami.GetManager().Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer ami.GetManager().Close()
+
+	return m.Run()
+}
+
+func newService() *Service {
+	return &Service{devices: make(map[string]*deviceState)}
+}
+
+// deviceSeq 设备名序号，保证重复运行测试时（-count）设备名和已记录的命令不重复
+var deviceSeq atomic.Int64
+
+// newDevice 生成本次测试使用的设备名
+func newDevice(name string) string {
+	return fmt.Sprintf("%s-%d", name, deviceSeq.Add(1))
+}
+
+// sendResult Send 的返回值
+type sendResult struct {
+	session *database.USSDSession
+	resp    *Response
+	err     error
+}
+
+// sendAsync 在后台发送 USSD 请求，等到请求已发给 Asterisk 后返回
+func sendAsync(t *testing.T, s *Service, device, code string, timeout time.Duration) <-chan sendResult {
+	t.Helper()
+	done := make(chan sendResult, 1)
+	go func() {
+		session, resp, err := s.Send(device, code, timeout)
+		done <- sendResult{session, resp, err}
+	}()
+	if !amiServer.WaitForCommand(fmt.Sprintf("quectel ussd %s %s", device, code), time.Second) {
+		t.Fatalf("USSD %s was not sent on %s, commands = %v", code, device, amiServer.Commands())
+	}
+	return done
+}
+
+// wait 等待后台请求返回
+func wait(t *testing.T, done <-chan sendResult) sendResult {
+	t.Helper()
+	select {
+	case r := <-done:
+		return r
+	case <-time.After(3 * time.Second):
+		t.Fatal("Send did not return")
+		return sendResult{}
+	}
+}
+
+// loadSession 从数据库读取会话和消息
+func loadSession(t *testing.T, id uint) database.USSDSession {
+	t.Helper()
+	var session database.USSDSession
+	if err := database.DB.Preload("Messages").First(&session, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestDeliverResponseTypes(t *testing.T) {
+	for i, tc := range []struct {
+		ussdType int
+		status   string
+		menu     bool
+	}{
+		{TypeNoFurtherAction, StatusCompleted, false},
+		{TypeFurtherAction, StatusWaitingInput, true},
+		{TypeTerminated, StatusCompleted, false},
+		{TypeNotSupported, StatusFailed, false},
+		{TypeUnknown, StatusWaitingInput, true},
+	} {
+		s := newService()
+		device := newDevice(fmt.Sprintf("types%d", i))
+		done := sendAsync(t, s, device, "*100#", time.Second)
+		s.Deliver(device, "Balance: 10.00", tc.ussdType)
+
+		r := wait(t, done)
+		if r.err != nil {
+			t.Fatalf("type %d: %v", tc.ussdType, r.err)
+		}
+		if r.resp.Message != "Balance: 10.00" || r.resp.Type != tc.ussdType || r.resp.WaitingInput() != tc.menu {
+			t.Fatalf("type %d: response = %+v", tc.ussdType, r.resp)
+		}
+		session := loadSession(t, r.session.ID)
+		if session.Status != tc.status || len(session.Messages) != 2 {
+			t.Fatalf("type %d: session status %s with %d messages, want %s with 2", tc.ussdType, session.Status, len(session.Messages), tc.status)
+		}
+		if in := session.Messages[1]; in.Direction != "inbound" || in.Type != tc.ussdType {
+			t.Fatalf("type %d: inbound message = %+v", tc.ussdType, in)
+		}
+		if (s.devices[device].sessionID != 0) != tc.menu {
+			t.Fatalf("type %d: menu session kept = %v, want %v", tc.ussdType, s.devices[device].sessionID != 0, tc.menu)
+		}
+	}
+}
+
+func TestMultiStepMenu(t *testing.T) {
+	s := newService()
+	device := newDevice("menu")
+
+	done := sendAsync(t, s, device, "*100#", time.Second)
+	s.Deliver(device, "1. Balance 2. Data", TypeFurtherAction)
+	first := wait(t, done)
+	if first.err != nil || !first.resp.WaitingInput() {
+		t.Fatalf("first step: resp %+v, err %v", first.resp, first.err)
+	}
+
+	// 菜单回复归入同一会话
+	done = sendAsync(t, s, device, "1", time.Second)
+	s.Deliver(device, "Balance: 5.00", TypeNoFurtherAction)
+	second := wait(t, done)
+	if second.err != nil {
+		t.Fatal(second.err)
+	}
+	if second.session.ID != first.session.ID {
+		t.Fatalf("menu reply created session %d, want %d", second.session.ID, first.session.ID)
+	}
+
+	session := loadSession(t, first.session.ID)
+	if session.Status != StatusCompleted || session.Code != "*100#" || len(session.Messages) != 4 {
+		t.Fatalf("session = %s, code %s, %d messages", session.Status, session.Code, len(session.Messages))
+	}
+
+	// 会话结束后的请求开始新会话
+	done = sendAsync(t, s, device, "*101#", time.Second)
+	s.Deliver(device, "Data: 1 GB", TypeNoFurtherAction)
+	if third := wait(t, done); third.err != nil || third.session.ID == first.session.ID {
+		t.Fatalf("new request reused completed session: %+v, err %v", third.session, third.err)
+	}
+}
+
+func TestExpiredMenuStartsNewSession(t *testing.T) {
+	s := newService()
+	device := newDevice("expired")
+
+	done := sendAsync(t, s, device, "*100#", time.Second)
+	s.Deliver(device, "1. Balance", TypeFurtherAction)
+	first := wait(t, done)
+	s.devices[device].menuDeadline = time.Now().Add(-time.Second)
+
+	done = sendAsync(t, s, device, "1", time.Second)
+	s.Deliver(device, "Unknown request", TypeNoFurtherAction)
+	second := wait(t, done)
+	if second.err != nil || second.session.ID == first.session.ID {
+		t.Fatalf("reply to expired menu: session %d, err %v", second.session.ID, second.err)
+	}
+	if session := loadSession(t, first.session.ID); session.Status != StatusTimeout {
+		t.Fatalf("expired menu session status = %s, want %s", session.Status, StatusTimeout)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	s := newService()
+	device := newDevice("timeout")
+
+	session, _, err := s.Send(device, "*100#", 50*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if got := loadSession(t, session.ID); got.Status != StatusTimeout {
+		t.Fatalf("status = %s, want %s", got.Status, StatusTimeout)
+	}
+
+	// 超时后设备被释放，迟到的响应作为新会话保存
+	if _, _, err := s.Send(device, "*101#", 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("second request: err = %v, want ErrTimeout", err)
+	}
+	s.Deliver(device, "late response", TypeNoFurtherAction)
+	var count int64
+	database.DB.Model(&database.USSDSession{}).Where("dongle_id = ?", device).Count(&count)
+	if count != 3 {
+		t.Fatalf("%d sessions on device, want 3", count)
+	}
+}
+
+func TestSendBusy(t *testing.T) {
+	s := newService()
+	device := newDevice("busy")
+	idle := newDevice("idle")
+
+	done := sendAsync(t, s, device, "*100#", time.Second)
+	if _, _, err := s.Send(device, "*101#", time.Second); !errors.Is(err, ErrBusy) {
+		t.Fatalf("err = %v, want ErrBusy", err)
+	}
+	// 其他设备不受影响
+	other := sendAsync(t, s, idle, "*100#", time.Second)
+	s.Deliver(idle, "ok", TypeNoFurtherAction)
+	if r := wait(t, other); r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	s.Deliver(device, "ok", TypeNoFurtherAction)
+	if r := wait(t, done); r.err != nil {
+		t.Fatal(r.err)
+	}
+}
+
+func TestDeliverDuplicate(t *testing.T) {
+	s := newService()
+	device := newDevice("dup")
+
+	done := sendAsync(t, s, device, "*100#", time.Second)
+	// AMI 事件没有类型，dialplan 回调带类型
+	s.Deliver(device, "Balance: 1.00", TypeUnknown)
+	s.Deliver(device, "Balance: 1.00", TypeNoFurtherAction)
+	r := wait(t, done)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	session := loadSession(t, r.session.ID)
+	if len(session.Messages) != 2 {
+		t.Fatalf("%d messages stored, want 2", len(session.Messages))
+	}
+	if session.Status != StatusCompleted || session.Messages[1].Type != TypeNoFurtherAction {
+		t.Fatalf("status %s, type %d; want type corrected by the second delivery", session.Status, session.Messages[1].Type)
+	}
+	if s.devices[device].sessionID != 0 {
+		t.Fatal("session kept as menu after type correction")
+	}
+
+	// 超过去重窗口后相同内容是新的响应
+	s.devices[device].lastAt = time.Now().Add(-duplicateWindow)
+	s.Deliver(device, "Balance: 1.00", TypeNoFurtherAction)
+	var count int64
+	sessions := database.DB.Model(&database.USSDSession{}).Select("id").Where("dongle_id = ?", device)
+	database.DB.Model(&database.USSDMessage{}).Where("content = ? AND session_id IN (?)", "Balance: 1.00", sessions).Count(&count)
+	if count != 2 {
+		t.Fatalf("%d inbound messages stored, want 2", count)
+	}
+}
+
+func TestUnsolicitedMenu(t *testing.T) {
+	s := newService()
+	device := newDevice("push")
+
+	s.Deliver(device, "Reply 1 to confirm", TypeFurtherAction)
+	id := s.devices[device].sessionID
+	if id == 0 {
+		t.Fatal("network-initiated menu not kept")
+	}
+	if session := loadSession(t, id); session.Status != StatusWaitingInput || len(session.Messages) != 1 {
+		t.Fatalf("session = %s with %d messages", session.Status, len(session.Messages))
+	}
+
+	done := sendAsync(t, s, device, "1", time.Second)
+	s.Deliver(device, "Confirmed", TypeNoFurtherAction)
+	if r := wait(t, done); r.err != nil || r.session.ID != id {
+		t.Fatalf("reply to network menu: session %v, err %v", r.session, r.err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := newService()
+	device := newDevice("cancel")
+
+	done := sendAsync(t, s, device, "*100#", time.Second)
+	if err := s.Cancel(device); err != nil {
+		t.Fatal(err)
+	}
+	r := wait(t, done)
+	if !errors.Is(r.err, ErrCancelled) {
+		t.Fatalf("err = %v, want ErrCancelled", r.err)
+	}
+	if session := loadSession(t, r.session.ID); session.Status != StatusCancelled {
+		t.Fatalf("status = %s, want %s", session.Status, StatusCancelled)
+	}
+	if !amiServer.WaitForCommand("quectel cmd "+device+" AT+CUSD=2", time.Second) {
+		t.Fatalf("AT+CUSD=2 not sent, commands = %v", amiServer.Commands())
+	}
+
+	// 取消菜单会话后的请求开始新会话
+	done = sendAsync(t, s, device, "*101#", time.Second)
+	s.Deliver(device, "1. Balance", TypeFurtherAction)
+	menu := wait(t, done)
+	if err := s.Cancel(device); err != nil {
+		t.Fatal(err)
+	}
+	if session := loadSession(t, menu.session.ID); session.Status != StatusCancelled {
+		t.Fatalf("menu status = %s, want %s", session.Status, StatusCancelled)
+	}
+	if s.devices[device].sessionID != 0 {
+		t.Fatal("cancelled menu session kept")
+	}
+}
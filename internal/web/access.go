@@ -0,0 +1,148 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ety001/lzc-mobile/internal/auth"
+	"github.com/ety001/lzc-mobile/internal/calls"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// accessRule 路由的访问规则
+type accessRule struct {
+	role string // 需要的最低角色
+	// dongle 解析请求访问的资源所属的 dongle 设备 ID，用于检查用户的 dongle 范围
+	// 资源不存在时返回 false，由处理函数返回 404
+	dongle func(c *gin.Context) (string, bool)
+}
+
+// accessRules API 路由的访问规则（键为 "方法 路由模板"）
+// 不在表中的路由只有管理员可以访问；分机、通知、系统设置等包含密钥或影响全局的接口都只对管理员开放
+var accessRules = map[string]accessRule{
+	// 所有用户
+	"GET /api/v1/me":              {role: database.RoleViewer},
+	"GET /api/v1/sessions":        {role: database.RoleViewer},
+	"DELETE /api/v1/sessions":     {role: database.RoleViewer},
+	"DELETE /api/v1/sessions/:id": {role: database.RoleViewer},
+
+	"GET /api/v1/dongle-devices":                      {role: database.RoleViewer},
+	"GET /api/v1/dongle-devices/:id":                  {role: database.RoleViewer, dongle: dongleOfDevice},
+	"GET /api/v1/dongle-devices/:id/ussd":             {role: database.RoleViewer, dongle: dongleOfDevice},
+	"GET /api/v1/dongle-devices/:id/identity-history": {role: database.RoleViewer, dongle: dongleOfDevice},
+	"GET /api/v1/system/status":                       {role: database.RoleViewer},
+	"GET /api/v1/system/ami":                          {role: database.RoleViewer},
+	"GET /api/v1/sms":                                 {role: database.RoleViewer},
+	"GET /api/v1/outbound-routes":                     {role: database.RoleViewer},
+	"GET /api/v1/outbound-routes/:id":                 {role: database.RoleViewer},
+	"GET /api/v1/inbound-routes":                      {role: database.RoleViewer},
+	"GET /api/v1/inbound-routes/:id":                  {role: database.RoleViewer},
+	"GET /api/v1/call-forwards":                       {role: database.RoleViewer},
+	"GET /api/v1/call-forwards/:id":                   {role: database.RoleViewer},
+	"GET /api/v1/time-conditions":                     {role: database.RoleViewer},
+	"GET /api/v1/time-conditions/:id":                 {role: database.RoleViewer},
+	"GET /api/v1/time-conditions/:id/evaluate":        {role: database.RoleViewer},
+	"GET /api/v1/blocklist":                           {role: database.RoleViewer},
+	"GET /api/v1/blocklist/:id":                       {role: database.RoleViewer},
+	"GET /api/v1/calls/active":                        {role: database.RoleViewer},
+	"GET /api/v1/calls/active/:id":                    {role: database.RoleViewer, dongle: dongleOfActiveCall},
+	"GET /api/v1/events":                              {role: database.RoleViewer},
+	"GET /api/v1/call-records":                        {role: database.RoleViewer},
+	"GET /api/v1/recordings":                          {role: database.RoleViewer},
+	"GET /api/v1/recordings/usage":                    {role: database.RoleViewer},
+	"GET /api/v1/recordings/:id":                      {role: database.RoleViewer, dongle: dongleOfRecording},
+	"GET /api/v1/recordings/:id/stream":               {role: database.RoleViewer, dongle: dongleOfRecording},
+	"GET /api/v1/carrier-prefixes":                    {role: database.RoleViewer},
+	"GET /api/v1/balance-profiles":                    {role: database.RoleViewer},
+	"GET /api/v1/balance-profiles/:id":                {role: database.RoleViewer, dongle: dongleOfBalanceProfile},
+	"GET /api/v1/balance-profiles/:id/history":        {role: database.RoleViewer, dongle: dongleOfBalanceProfile},
+
+	// 操作员：发送短信（/sms/send 的 dongle 在请求体中，由处理函数检查）
+	"POST /api/v1/sms/send":                     {role: database.RoleOperator},
+	"POST /api/v1/dongle-bindings/:id/send-sms": {role: database.RoleOperator, dongle: dongleOfBinding},
+}
+
+// authorize 按 accessRules 检查当前用户的角色和 dongle 范围（在 auth.CheckAuth 之后使用）
+func (r *Router) authorize(c *gin.Context) {
+	rule, ok := accessRules[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		rule = accessRule{role: database.RoleAdmin}
+	}
+	if !auth.HasRole(auth.CurrentUser(c), rule.role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		c.Abort()
+		return
+	}
+	if rule.dongle != nil && auth.DongleScope(c) != nil {
+		if deviceID, found := rule.dongle(c); found && !auth.CanAccessDongle(c, deviceID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+	}
+	c.Next()
+}
+
+// scopeByDongle 按当前用户的 dongle 范围过滤查询（column 为设备 ID 列）
+func scopeByDongle(c *gin.Context, query *gorm.DB, column string) *gorm.DB {
+	if scope := auth.DongleScope(c); scope != nil {
+		return query.Where(column+" IN ?", scope)
+	}
+	return query
+}
+
+// findByParam 按路径参数 id 加载记录
+func findByParam(c *gin.Context, dest interface{}) bool {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return false
+	}
+	return database.DB.First(dest, id).Error == nil
+}
+
+// dongleOfDevice Dongle 设备（路径参数为数据库 ID）
+func dongleOfDevice(c *gin.Context) (string, bool) {
+	var dongle database.Dongle
+	if !findByParam(c, &dongle) {
+		return "", false
+	}
+	return dongle.DeviceID, true
+}
+
+// dongleOfBinding Dongle 绑定
+func dongleOfBinding(c *gin.Context) (string, bool) {
+	var binding database.DongleBinding
+	if !findByParam(c, &binding) {
+		return "", false
+	}
+	return binding.DongleID, true
+}
+
+// dongleOfRecording 录音
+func dongleOfRecording(c *gin.Context) (string, bool) {
+	var rec database.Recording
+	if !findByParam(c, &rec) {
+		return "", false
+	}
+	return rec.DongleID, true
+}
+
+// dongleOfBalanceProfile 余额查询配置
+func dongleOfBalanceProfile(c *gin.Context) (string, bool) {
+	var profile database.BalanceCheckProfile
+	if !findByParam(c, &profile) {
+		return "", false
+	}
+	return profile.DongleID, true
+}
+
+// dongleOfActiveCall 活动通话
+func dongleOfActiveCall(c *gin.Context) (string, bool) {
+	call, err := calls.GetMonitor().Get(c.Param("id"))
+	if err != nil {
+		return "", false
+	}
+	return call.DongleID, true
+}
@@ -0,0 +1,271 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/ety001/lzc-mobile/internal/balance"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// BalanceProfileRequest 余额查询配置请求结构
+type BalanceProfileRequest struct {
+	DongleID       string  `json:"dongle_id" binding:"required"`
+	Name           string  `json:"name"`
+	Enabled        *bool   `json:"enabled"` // 为空时默认启用
+	Method         string  `json:"method"`  // ussd 或 sms（默认 ussd）
+	USSDCode       string  `json:"ussd_code"`
+	SMSNumber      string  `json:"sms_number"`
+	SMSText        string  `json:"sms_text"`
+	ReplyFrom      string  `json:"reply_from"`
+	BalanceRegex   string  `json:"balance_regex"`
+	ExpiryRegex    string  `json:"expiry_regex"`
+	ExpiryLayout   string  `json:"expiry_layout"`
+	Threshold      float64 `json:"threshold"`
+	ExpiryWarnDays int     `json:"expiry_warn_days"`
+	IntervalHours  int     `json:"interval_hours"`
+}
+
+// validate 校验请求并填充默认值
+func (req *BalanceProfileRequest) validate() error {
+	if req.Method == "" {
+		req.Method = balance.MethodUSSD
+	}
+	switch req.Method {
+	case balance.MethodUSSD:
+		if !ussdCodeRegex.MatchString(req.USSDCode) {
+			return errors.New("invalid or missing ussd_code")
+		}
+	case balance.MethodSMS:
+		if req.SMSNumber == "" || req.SMSText == "" {
+			return errors.New("sms_number and sms_text are required for the sms method")
+		}
+	default:
+		return errors.New("method must be ussd or sms")
+	}
+
+	if req.BalanceRegex == "" && req.ExpiryRegex == "" {
+		return errors.New("at least one of balance_regex or expiry_regex is required")
+	}
+	for _, pattern := range []string{req.BalanceRegex, req.ExpiryRegex} {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.New("invalid regex: " + err.Error())
+		}
+	}
+
+	if req.Threshold < 0 {
+		return errors.New("threshold must not be negative")
+	}
+	if req.ExpiryWarnDays <= 0 {
+		req.ExpiryWarnDays = 7
+	}
+	if req.IntervalHours <= 0 {
+		req.IntervalHours = 168
+	}
+	return nil
+}
+
+// apply 将请求写入配置
+func (req *BalanceProfileRequest) apply(p *database.BalanceCheckProfile) {
+	p.DongleID = req.DongleID
+	p.Name = req.Name
+	p.Enabled = req.Enabled == nil || *req.Enabled
+	p.Method = req.Method
+	p.USSDCode = req.USSDCode
+	p.SMSNumber = req.SMSNumber
+	p.SMSText = req.SMSText
+	p.ReplyFrom = req.ReplyFrom
+	p.BalanceRegex = req.BalanceRegex
+	p.ExpiryRegex = req.ExpiryRegex
+	p.ExpiryLayout = req.ExpiryLayout
+	p.Threshold = req.Threshold
+	p.ExpiryWarnDays = req.ExpiryWarnDays
+	p.IntervalHours = req.IntervalHours
+}
+
+// findBalanceProfileByParam 根据路径参数 :id 查找余额查询配置，失败时写入错误响应
+func findBalanceProfileByParam(c *gin.Context) (*database.BalanceCheckProfile, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+
+	var profile database.BalanceCheckProfile
+	if err := database.DB.First(&profile, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Balance profile not found"})
+		return nil, false
+	}
+	return &profile, true
+}
+
+// listBalanceProfiles 列出余额查询配置（可按 dongle_id 过滤）
+func (r *Router) listBalanceProfiles(c *gin.Context) {
+	query := scopeByDongle(c, database.DB.Model(&database.BalanceCheckProfile{}), "dongle_id")
+	if dongleID := c.Query("dongle_id"); dongleID != "" {
+		query = query.Where("dongle_id = ?", dongleID)
+	}
+
+	var profiles []database.BalanceCheckProfile
+	if err := query.Order("id ASC").Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+// createBalanceProfile 创建余额查询配置
+func (r *Router) createBalanceProfile(c *gin.Context) {
+	var req BalanceProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var profile database.BalanceCheckProfile
+	req.apply(&profile)
+
+	// Select("*") 保证 enabled=false 能写入（否则会被 default:true 覆盖）
+	if err := database.DB.Select("*").Create(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, profile)
+}
+
+// getBalanceProfile 获取单个余额查询配置
+func (r *Router) getBalanceProfile(c *gin.Context) {
+	profile, ok := findBalanceProfileByParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// updateBalanceProfile 更新余额查询配置
+func (r *Router) updateBalanceProfile(c *gin.Context) {
+	profile, ok := findBalanceProfileByParam(c)
+	if !ok {
+		return
+	}
+
+	var req BalanceProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.apply(profile)
+	// 配置变化后重新评估告警
+	profile.LowBalanceAlerted = false
+	profile.ExpiryAlerted = false
+
+	if err := database.DB.Save(profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// deleteBalanceProfile 删除余额查询配置及其历史记录
+func (r *Router) deleteBalanceProfile(c *gin.Context) {
+	profile, ok := findBalanceProfileByParam(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("profile_id = ?", profile.ID).Delete(&database.BalanceRecord{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Delete(profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Balance profile deleted"})
+}
+
+// checkBalanceNow 立即执行一次查询（同步等待结果）
+func (r *Router) checkBalanceNow(c *gin.Context) {
+	profile, ok := findBalanceProfileByParam(c)
+	if !ok {
+		return
+	}
+
+	record, err := balance.GetScheduler().Check(profile.ID)
+	if errors.Is(err, balance.ErrCheckInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if record == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"record": record}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// listBalanceHistory 获取余额查询历史（分页）
+func (r *Router) listBalanceHistory(c *gin.Context) {
+	profile, ok := findBalanceProfileByParam(c)
+	if !ok {
+		return
+	}
+
+	page := 1
+	pageSize := 20
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if sizeStr := c.Query("page_size"); sizeStr != "" {
+		if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 && s <= 100 {
+			pageSize = s
+		}
+	}
+
+	query := database.DB.Model(&database.BalanceRecord{}).Where("profile_id = ?", profile.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var records []database.BalanceRecord
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        records,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (int(total) + pageSize - 1) / pageSize,
+	})
+}
@@ -0,0 +1,404 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ety001/lzc-mobile/internal/blocklist"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// BlockedNumberRequest 黑白名单条目请求结构
+type BlockedNumberRequest struct {
+	List         string `json:"list"` // block（默认）或 allow
+	MatchType    string `json:"match_type" binding:"required"`
+	Pattern      string `json:"pattern"`
+	Action       string `json:"action"` // reject（默认）、busy、voicemail 或 drop
+	VoicemailBox string `json:"voicemail_box"`
+	DongleID     string `json:"dongle_id"`
+	Calls        *bool  `json:"calls"` // 为空时默认对来电生效
+	SMS          *bool  `json:"sms"`   // 为空时默认对短信生效
+	Note         string `json:"note"`
+	Enabled      *bool  `json:"enabled"` // 为空时默认启用
+}
+
+// BlockFromRecordRequest 从通话或短信记录拉黑的请求结构（可为空）
+type BlockFromRecordRequest struct {
+	Action       string `json:"action"`
+	VoicemailBox string `json:"voicemail_box"`
+	DongleID     string `json:"dongle_id"` // 为空表示对全部 dongle 生效
+	Note         string `json:"note"`
+}
+
+// apply 将请求写入条目并校验
+func (req *BlockedNumberRequest) apply(b *database.BlockedNumber) error {
+	b.List = req.List
+	b.MatchType = req.MatchType
+	b.Pattern = req.Pattern
+	b.Action = req.Action
+	b.VoicemailBox = req.VoicemailBox
+	b.DongleID = req.DongleID
+	b.Calls = req.Calls == nil || *req.Calls
+	b.SMS = req.SMS == nil || *req.SMS
+	b.Note = req.Note
+	b.Enabled = req.Enabled == nil || *req.Enabled
+	if !b.Calls && !b.SMS {
+		return fmt.Errorf("entry must apply to calls, sms or both")
+	}
+	return validateBlockedNumber(b)
+}
+
+// validateBlockedNumber 校验条目，并检查 dongle 和语音信箱是否存在
+func validateBlockedNumber(b *database.BlockedNumber) error {
+	if err := blocklist.Validate(b); err != nil {
+		return err
+	}
+	if b.DongleID != "" {
+		var dongle database.Dongle
+		if err := database.DB.Where("device_id = ?", b.DongleID).First(&dongle).Error; err != nil {
+			return fmt.Errorf("dongle %s not found", b.DongleID)
+		}
+	}
+	if b.VoicemailBox != "" {
+		var ext database.Extension
+		if err := database.DB.Where("username = ?", b.VoicemailBox).First(&ext).Error; err != nil {
+			return fmt.Errorf("voicemail_box: extension %s not found", b.VoicemailBox)
+		}
+	}
+	return nil
+}
+
+// createBlockedNumber 写入条目并重新渲染配置（语音信箱需要写入 voicemail.conf）
+func (r *Router) createBlockedNumber(b *database.BlockedNumber) error {
+	// Select("*") 保证 calls/sms/enabled=false 能写入（否则会被 default:true 覆盖）
+	if err := database.DB.Select("*").Create(b).Error; err != nil {
+		return err
+	}
+	if err := r.reloadConfig(); err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+	return nil
+}
+
+// listBlockedNumbers 列出黑白名单条目（可按 list、dongle_id 过滤）
+func (r *Router) listBlockedNumbers(c *gin.Context) {
+	query := database.DB.Model(&database.BlockedNumber{})
+	if list := c.Query("list"); list != "" {
+		query = query.Where("list = ?", list)
+	}
+	if dongleID := c.Query("dongle_id"); dongleID != "" {
+		query = query.Where("dongle_id = ?", dongleID)
+	}
+
+	var entries []database.BlockedNumber
+	if err := query.Order("list ASC, id ASC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// getBlockedNumber 获取单个黑白名单条目
+func (r *Router) getBlockedNumber(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var entry database.BlockedNumber
+	if err := database.DB.First(&entry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blocklist entry not found"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// createBlockedNumberHandler 创建黑白名单条目
+func (r *Router) createBlockedNumberHandler(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req BlockedNumberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entry database.BlockedNumber
+	if err := req.apply(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.createBlockedNumber(&entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// updateBlockedNumber 更新黑白名单条目（命中计数保留）
+func (r *Router) updateBlockedNumber(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var entry database.BlockedNumber
+	if err := database.DB.First(&entry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blocklist entry not found"})
+		return
+	}
+
+	var req BlockedNumberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// deleteBlockedNumber 删除黑白名单条目
+func (r *Router) deleteBlockedNumber(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	result := database.DB.Delete(&database.BlockedNumber{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blocklist entry not found"})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Blocklist entry deleted"})
+}
+
+// checkBlocklist 来电黑名单查询（从 Asterisk 拨号计划通过 CURL 调用）
+// 返回纯文本：allow、reject、busy、drop 或 voicemail:<信箱>
+// 查询失败时返回 allow，避免误拦正常来电
+func (r *Router) checkBlocklist(c *gin.Context) {
+	kind := c.DefaultQuery("kind", blocklist.KindCall)
+	device := c.Query("device")
+	number := c.Query("number")
+
+	entry, err := blocklist.Check(kind, device, number)
+	if err != nil {
+		log.Printf("[Blocklist] Check failed for %s %s on %s: %v", kind, number, device, err)
+		c.String(http.StatusOK, "allow")
+		return
+	}
+
+	result := "allow"
+	if entry != nil {
+		result = entry.Action
+		if entry.Action == database.BlockActionVoicemail {
+			result = "voicemail:" + entry.VoicemailBox
+		}
+	}
+
+	if kind == blocklist.KindCall {
+		record := database.CallRecord{
+			DongleID:  device,
+			Direction: "inbound",
+			Number:    number,
+			Action:    "allow",
+			UniqueID:  c.Query("unique_id"),
+		}
+		if blocklist.IsAnonymous(number) {
+			record.Number = ""
+		}
+		if entry != nil {
+			record.Action = entry.Action
+			record.BlockedNumberID = &entry.ID
+		}
+		if err := database.DB.Create(&record).Error; err != nil {
+			log.Printf("[Blocklist] Failed to save call record: %v", err)
+		}
+	}
+
+	c.String(http.StatusOK, result)
+}
+
+// listCallRecords 分页列出通话记录（可按 dongle_id、direction、blocked 过滤）
+func (r *Router) listCallRecords(c *gin.Context) {
+	page := 1
+	pageSize := 20
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if sizeStr := c.Query("page_size"); sizeStr != "" {
+		if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 && s <= 100 {
+			pageSize = s
+		}
+	}
+
+	query := scopeByDongle(c, database.DB.Model(&database.CallRecord{}), "dongle_id")
+	if dongleID := c.Query("dongle_id"); dongleID != "" {
+		query = query.Where("dongle_id = ?", dongleID)
+	}
+	if direction := c.Query("direction"); direction != "" {
+		query = query.Where("direction = ?", direction)
+	}
+	switch c.Query("blocked") {
+	case "true":
+		query = query.Where("blocked_number_id IS NOT NULL")
+	case "false":
+		query = query.Where("blocked_number_id IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var records []database.CallRecord
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        records,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (int(total) + pageSize - 1) / pageSize,
+	})
+}
+
+// blockFromCallRecord 将通话记录中的号码加入黑名单（仅对来电生效）
+func (r *Router) blockFromCallRecord(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var record database.CallRecord
+	if err := database.DB.First(&record, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call record not found"})
+		return
+	}
+
+	entry := database.BlockedNumber{
+		MatchType: database.BlockMatchExact,
+		Pattern:   record.Number,
+		Calls:     true,
+		SMS:       false,
+		Enabled:   true,
+	}
+	// 隐藏号码的来电只能按 anonymous 拉黑
+	if record.Number == "" {
+		entry.MatchType = database.BlockMatchAnonymous
+	}
+	r.blockFromRecord(c, &entry, fmt.Sprintf("Blocked from call record %d", record.ID))
+}
+
+// blockFromSMSMessage 将短信号码加入黑名单（对来电和短信都生效）
+func (r *Router) blockFromSMSMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var msg database.SMSMessage
+	if err := database.DB.First(&msg, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SMS message not found"})
+		return
+	}
+	if msg.Direction != "inbound" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only inbound messages can be blocked"})
+		return
+	}
+
+	entry := database.BlockedNumber{
+		MatchType: database.BlockMatchExact,
+		Pattern:   msg.PhoneNumber,
+		Calls:     true,
+		SMS:       true,
+		Enabled:   true,
+	}
+	r.blockFromRecord(c, &entry, fmt.Sprintf("Blocked from SMS %d", msg.ID))
+}
+
+// blockFromRecord 按请求体补全条目并创建；同一号码已有黑名单条目时直接返回该条目
+func (r *Router) blockFromRecord(c *gin.Context, entry *database.BlockedNumber, defaultNote string) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req BlockFromRecordRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	entry.List = database.BlockListBlock
+	entry.Action = req.Action
+	entry.VoicemailBox = req.VoicemailBox
+	entry.DongleID = req.DongleID
+	entry.Note = req.Note
+	if entry.Note == "" {
+		entry.Note = defaultNote
+	}
+	if err := validateBlockedNumber(entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing database.BlockedNumber
+	err := database.DB.Where("list = ? AND match_type = ? AND pattern = ? AND dongle_id = ?",
+		entry.List, entry.MatchType, entry.Pattern, entry.DongleID).First(&existing).Error
+	if err == nil {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+
+	if err := r.createBlockedNumber(entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
@@ -0,0 +1,283 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/auth"
+	"github.com/ety001/lzc-mobile/internal/calls"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultRingTimeout 点击拨号时分机的默认振铃时间
+	defaultRingTimeout = 30 * time.Second
+	// callEventsKeepAlive SSE 心跳间隔（避免代理断开空闲连接）
+	callEventsKeepAlive = 15 * time.Second
+)
+
+// callNumberRegex 点击拨号的外部号码（与 click-to-call 上下文的 _[+0-9]. 一致）
+var callNumberRegex = regexp.MustCompile(`^\+?[0-9]{2,20}$`)
+
+// OriginateCallRequest 点击拨号请求结构
+type OriginateCallRequest struct {
+	Extension string `json:"extension" binding:"required"` // 先振铃的分机
+	DongleID  string `json:"dongle_id"`                    // 为空时使用分机的去电绑定
+	Number    string `json:"number" binding:"required"`    // 要拨打的外部号码
+	Timeout   int    `json:"timeout"`                      // 分机振铃秒数（默认 30）
+}
+
+// resolveCallDongle 确定点击拨号使用的 dongle：指定时校验，未指定时使用分机的去电绑定
+func resolveCallDongle(ext *database.Extension, dongleID string) (string, error) {
+	if dongleID == "" {
+		var binding database.DongleBinding
+		if err := database.DB.Where("extension_id = ? AND outbound = ?", ext.ID, true).
+			Order("id ASC").First(&binding).Error; err != nil {
+			return "", fmt.Errorf("extension %s has no outbound dongle binding, dongle_id is required", ext.Username)
+		}
+		dongleID = binding.DongleID
+	}
+
+	var dongle database.Dongle
+	if err := database.DB.Where("device_id = ?", dongleID).First(&dongle).Error; err != nil {
+		return "", fmt.Errorf("dongle %s not found", dongleID)
+	}
+	if dongle.Disable {
+		return "", fmt.Errorf("dongle %s is disabled", dongleID)
+	}
+	if ami.GetManager().IsDeviceUnplugged(dongleID) {
+		return "", fmt.Errorf("dongle %s is unplugged", dongleID)
+	}
+	return dongleID, nil
+}
+
+// originateCall 点击拨号：先呼叫分机，分机接听后通过 dongle 拨打外部号码
+// 返回呼叫 ID，进度通过 GET /calls/:id 或 GET /calls/:id/events（SSE）获取
+func (r *Router) originateCall(c *gin.Context) {
+	var req OriginateCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !callNumberRegex.MatchString(req.Number) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid number"})
+		return
+	}
+
+	var ext database.Extension
+	if err := database.DB.Where("username = ?", req.Extension).First(&ext).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("extension %s not found", req.Extension)})
+		return
+	}
+	dongleID, err := resolveCallDongle(&ext, req.DongleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeout := defaultRingTimeout
+	if req.Timeout > 0 && req.Timeout <= 120 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+
+	call, err := calls.GetTracker().Originate(ext.Username, dongleID, req.Number, timeout)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to originate call: " + err.Error(), "call": call})
+		return
+	}
+	c.JSON(http.StatusAccepted, call)
+}
+
+// getCall 获取点击拨号的当前状态
+func (r *Router) getCall(c *gin.Context) {
+	call, err := calls.GetTracker().Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call not found"})
+		return
+	}
+	c.JSON(http.StatusOK, call)
+}
+
+// streamCallEvents 以 SSE 推送点击拨号进度
+// 先推送一次当前状态（call 事件），之后每次状态变化推送 state 事件，呼叫结束后关闭连接
+func (r *Router) streamCallEvents(c *gin.Context) {
+	call, events, cancel, err := calls.GetTracker().Subscribe(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, calls.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Call not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("call", call)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(callEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("state", event)
+			return !(event.State == calls.StateCompleted || event.State == calls.StateFailed)
+		case <-keepAlive.C:
+			// SSE 注释行作为心跳
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// transferTargetRegex 转接目标（分机或外部号码，在 default 上下文中拨打）
+var transferTargetRegex = regexp.MustCompile(`^[0-9A-Za-z+*#]{1,32}$`)
+
+// CallChannelRequest 指定操作通道的请求（channel 为空时自动选择）
+type CallChannelRequest struct {
+	Channel string `json:"channel"`
+}
+
+// TransferCallRequest 转接请求结构
+type TransferCallRequest struct {
+	Mode    string `json:"mode"` // blind（默认）或 attended
+	Target  string `json:"target" binding:"required"`
+	Channel string `json:"channel"`
+}
+
+// SpyCallRequest 监听请求结构
+type SpyCallRequest struct {
+	Extension string `json:"extension" binding:"required"` // 监听者的分机
+	Mode      string `json:"mode"`                         // listen（默认）、whisper 或 barge
+	Channel   string `json:"channel"`
+}
+
+// activeCallError 将活动通话操作的错误写入响应
+func activeCallError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, calls.ErrActiveCallNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active call not found"})
+	case errors.Is(err, calls.ErrChannelNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, calls.ErrAlreadyInCall):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+// listActiveCalls 列出当前活动通话（主叫、被叫、dongle、时长等）
+func (r *Router) listActiveCalls(c *gin.Context) {
+	active := calls.GetMonitor().List()
+	if scope := auth.DongleScope(c); scope != nil {
+		visible := make([]calls.ActiveCall, 0, len(active))
+		for _, call := range active {
+			if auth.CanAccessDongle(c, call.DongleID) {
+				visible = append(visible, call)
+			}
+		}
+		active = visible
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  active,
+		"total": len(active),
+	})
+}
+
+// getActiveCall 获取单个活动通话
+func (r *Router) getActiveCall(c *gin.Context) {
+	call, err := calls.GetMonitor().Get(c.Param("id"))
+	if err != nil {
+		activeCallError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, call)
+}
+
+// hangupActiveCall 挂断活动通话（指定 channel 时只挂断该通道）
+func (r *Router) hangupActiveCall(c *gin.Context) {
+	var req CallChannelRequest
+	// 请求体可选
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := calls.GetMonitor().Hangup(c.Param("id"), req.Channel); err != nil {
+		activeCallError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Call hung up"})
+}
+
+// transferActiveCall 转接活动通话（盲转使用 AMI Redirect，咨询转接使用 AMI Atxfer）
+func (r *Router) transferActiveCall(c *gin.Context) {
+	var req TransferCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = calls.TransferBlind
+	}
+	if req.Mode != calls.TransferBlind && req.Mode != calls.TransferAttended {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be blind or attended"})
+		return
+	}
+	if !transferTargetRegex.MatchString(req.Target) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer target"})
+		return
+	}
+
+	if err := calls.GetMonitor().Transfer(c.Param("id"), req.Mode, req.Target, req.Channel); err != nil {
+		activeCallError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Call transferred"})
+}
+
+// spyActiveCall 从指定分机监听活动通话（ChanSpy）
+func (r *Router) spyActiveCall(c *gin.Context) {
+	var req SpyCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch req.Mode {
+	case "", calls.SpyListen, calls.SpyWhisper, calls.SpyBarge:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be listen, whisper or barge"})
+		return
+	}
+
+	var ext database.Extension
+	if err := database.DB.Where("username = ?", req.Extension).First(&ext).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("extension %s not found", req.Extension)})
+		return
+	}
+
+	if err := calls.GetMonitor().Spy(c.Param("id"), ext.Username, req.Mode, req.Channel); err != nil {
+		activeCallError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Ringing extension " + ext.Username + " to listen in"})
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/config"
+	"github.com/ety001/lzc-mobile/internal/diagnostics"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// diagnosticsCommandTimeout 单条 Asterisk 命令的超时时间
+	diagnosticsCommandTimeout = 5 * time.Second
+	// asteriskLogTail 每个 Asterisk 日志文件最多打包的大小
+	asteriskLogTail = 1 << 20
+)
+
+// diagnosticsCommands 诊断包中包含的 Asterisk CLI 命令输出
+var diagnosticsCommands = []struct {
+	file    string
+	command string
+}{
+	{"asterisk/quectel-show-devices.txt", "quectel show devices"},
+	{"asterisk/pjsip-show-endpoints.txt", "pjsip show endpoints"},
+	{"asterisk/pjsip-show-registrations.txt", "pjsip show registrations"},
+	{"asterisk/core-show-channels.txt", "core show channels"},
+	{"asterisk/module-show-quectel.txt", "module show like quectel"},
+}
+
+// privateLogFiles 不打包的 Asterisk 日志文件（包含短信和 USSD 内容）
+var privateLogFiles = map[string]bool{
+	"sms.txt":  true,
+	"ussd.txt": true,
+}
+
+// downloadDiagnostics 下载诊断包（tar.gz）：健康检查结果、版本、Asterisk 命令输出、
+// 渲染后的配置文件（隐藏密码）和最近的日志。单项收集失败时记录在包内的 errors.txt 中
+func (r *Router) downloadDiagnostics(c *gin.Context) {
+	ctx := c.Request.Context()
+	root := "lzc-mobile-diagnostics-" + time.Now().Format("20060102-150405")
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tar.gz"`, root))
+	c.Status(http.StatusOK)
+
+	bundle := diagnostics.NewBundle(c.Writer, root)
+	// 回调密钥会随 dialplan 命令出现在 Asterisk 日志中
+	if secret, err := config.IngestSecret(); err == nil {
+		bundle.RedactValues(secret)
+	}
+	add := func(name string, err error) {
+		if err != nil {
+			bundle.AddError(name, err)
+		}
+	}
+
+	add("health.json", bundle.AddJSON("health.json", r.checkHealth(ctx)))
+
+	versions := diagnostics.Versions()
+	if output, err := asteriskCommand(ctx, "core show version"); err != nil {
+		bundle.AddError("asterisk version", err)
+	} else {
+		versions["asterisk"] = strings.TrimSpace(output)
+	}
+	add("versions.json", bundle.AddJSON("versions.json", versions))
+
+	for _, cmd := range diagnosticsCommands {
+		output, err := asteriskCommand(ctx, cmd.command)
+		if err != nil {
+			bundle.AddError(cmd.file, err)
+			continue
+		}
+		add(cmd.file, bundle.AddFile(cmd.file, []byte(output)))
+	}
+
+	if r.renderer != nil {
+		add("config", bundle.AddConfigDir("config", r.renderer.OutputDir()))
+	}
+
+	logs := strings.Join(diagnostics.GetLogBuffer().Lines(), "\n") + "\n"
+	add("logs/webpanel.log", bundle.AddFile("logs/webpanel.log", []byte(logs)))
+	r.addAsteriskLogs(bundle)
+
+	if err := bundle.Close(); err != nil {
+		log.Printf("Failed to write diagnostics bundle: %v", err)
+	}
+}
+
+// asteriskCommand 执行 Asterisk CLI 命令（带超时）
+func asteriskCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsCommandTimeout)
+	defer cancel()
+	return ami.GetManager().Command(ctx, command)
+}
+
+// addAsteriskLogs 打包 Asterisk 日志目录下的日志文件（只保留末尾部分）
+func (r *Router) addAsteriskLogs(bundle *diagnostics.Bundle) {
+	logDir := os.Getenv("ASTERISK_LOG_DIR")
+	if logDir == "" {
+		logDir = "/var/log/asterisk"
+	}
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		bundle.AddError("asterisk logs", err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || privateLogFiles[entry.Name()] {
+			continue
+		}
+		name := "logs/asterisk/" + entry.Name()
+		if err := bundle.AddFileTail(name, filepath.Join(logDir, entry.Name()), asteriskLogTail); err != nil {
+			bundle.AddError(name, err)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/ety001/lzc-mobile/internal/ami"
 	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/discovery"
+	"github.com/ety001/lzc-mobile/internal/events"
 	"github.com/gin-gonic/gin"
 )
 
@@ -156,6 +158,8 @@ func (r *Router) sendSMS(c *gin.Context) {
 	if err := database.DB.Create(&smsMessage).Error; err != nil {
 		// 记录错误但不影响响应
 		log.Printf("Error saving sent SMS to database: %v", err)
+	} else {
+		events.Publish(events.TopicSMS, "sent", smsMessage)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "SMS sent successfully"})
@@ -171,16 +175,27 @@ type DongleRequest struct {
 	Context    string `json:"context"`
 	DialPrefix string `json:"dial_prefix"`
 	Disable    bool   `json:"disable"`
+	IMEI       string `json:"imei"`    // 可选：按 IMEI 绑定已发现的模块，端口为空时自动填充
+	Carrier    string `json:"carrier"` // SIM 卡运营商（用于外呼同运营商优先）
+	// 录音策略：always、ondemand 或 never（创建时为空表示 never，更新时为空表示不修改）
+	RecordingPolicy string `json:"recording_policy"`
 }
 
 // listDongles 列出所有 Dongle 设备
 func (r *Router) listDongles(c *gin.Context) {
 	var dongles []database.Dongle
-	if err := database.DB.Find(&dongles).Error; err != nil {
+	if err := scopeByDongle(c, database.DB, "device_id").Find(&dongles).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 热插拔 watcher 记录的插拔状态
+	for i := range dongles {
+		if ami.GetManager().IsDeviceUnplugged(dongles[i].DeviceID) {
+			dongles[i].Status = "unplugged"
+		}
+	}
+
 	// 通过 AMI 获取实时状态（TODO: 实现 AMI 获取设备状态的方法）
 	// amiManager := ami.GetManager()
 	// for i := range dongles {
@@ -196,6 +211,33 @@ func (r *Router) listDongles(c *gin.Context) {
 	c.JSON(http.StatusOK, dongles)
 }
 
+// discoverDongles 扫描 USB 调制解调器
+// 默认只返回未被 Dongle 记录认领的模块，all=true 时返回全部
+func (r *Router) discoverDongles(c *gin.Context) {
+	modems, err := discovery.NewScanner().Discover()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("all") != "true" {
+		unclaimed := make([]discovery.Modem, 0, len(modems))
+		for _, m := range modems {
+			if m.DongleID == "" {
+				unclaimed = append(unclaimed, m)
+			}
+		}
+		modems = unclaimed
+	}
+
+	c.JSON(http.StatusOK, modems)
+}
+
+// listHotplugEvents 获取最近的模块插拔事件
+func (r *Router) listHotplugEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, discovery.GetWatcher().Events())
+}
+
 // createDongle 创建 Dongle 设备
 func (r *Router) createDongle(c *gin.Context) {
 	deviceMutex.Lock()
@@ -208,6 +250,28 @@ func (r *Router) createDongle(c *gin.Context) {
 	}
 
 	// 设置默认值
+	// 指定 IMEI 时从发现结果中填充端口，无需猜测 ttyUSB 编号
+	if req.IMEI != "" && (req.Device == "" || req.Audio == "" || req.Data == "") {
+		modem, err := discovery.NewScanner().FindByIMEI(req.IMEI)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discover modems: " + err.Error()})
+			return
+		}
+		if modem == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No modem found with IMEI " + req.IMEI})
+			return
+		}
+		if req.Device == "" {
+			req.Device = modem.Device
+		}
+		if req.Audio == "" {
+			req.Audio = modem.Audio
+		}
+		if req.Data == "" {
+			req.Data = modem.Data
+		}
+	}
+
 	if req.Device == "" {
 		req.Device = "/dev/ttyUSB0"
 	}
@@ -226,6 +290,11 @@ func (r *Router) createDongle(c *gin.Context) {
 	if req.DialPrefix == "" {
 		req.DialPrefix = "999"
 	}
+	recordingPolicy, err := validateRecordingPolicy(req.RecordingPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	dongle := database.Dongle{
 		DeviceID:   req.DeviceID,
@@ -236,6 +305,10 @@ func (r *Router) createDongle(c *gin.Context) {
 		Context:    req.Context,
 		DialPrefix: req.DialPrefix,
 		Disable:    req.Disable,
+		IMEI:       req.IMEI,
+		Carrier:    req.Carrier,
+
+		RecordingPolicy: recordingPolicy,
 	}
 
 	if err := database.DB.Create(&dongle).Error; err != nil {
@@ -266,19 +339,35 @@ func (r *Router) getDongle(c *gin.Context) {
 		return
 	}
 
-	// TODO: 通过 AMI 获取 SIM 信息
-	// amiManager := ami.GetManager()
-	// if status := amiManager.GetDongleStatus(dongle.DeviceID); status != nil {
-	// 	dongle.IMEI = status.IMEI
-	// 	dongle.IMSI = status.IMSI
-	// 	dongle.Operator = status.Operator
-	// 	dongle.SignalStrength = status.SignalStrength
-	// 	dongle.Status = status.Status
-	// }
+	// 通过 AMI 获取实时状态（IMEI/IMSI/ICCID 已由身份检查持久化，这里只补充运行时字段）
+	if ami.GetManager().IsDeviceUnplugged(dongle.DeviceID) {
+		dongle.Status = "unplugged"
+	} else if status := ami.GetManager().GetDongleStatus(dongle.DeviceID); status != nil {
+		dongle.Operator = status.Operator
+		dongle.SignalStrength = status.SignalStrength
+		dongle.Status = status.Status
+	} else {
+		dongle.Status = "unknown"
+	}
 
 	c.JSON(http.StatusOK, dongle)
 }
 
+// listDongleIdentityHistory 获取 Dongle 的 SIM/IMEI 变更历史
+func (r *Router) listDongleIdentityHistory(c *gin.Context) {
+	dongle, ok := findDongleByParam(c)
+	if !ok {
+		return
+	}
+
+	var history []database.DongleIdentityHistory
+	if err := database.DB.Where("dongle_id = ?", dongle.DeviceID).Order("created_at DESC").Limit(100).Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
 // updateDongle 更新 Dongle 设备
 func (r *Router) updateDongle(c *gin.Context) {
 	deviceMutex.Lock()
@@ -310,8 +399,25 @@ func (r *Router) updateDongle(c *gin.Context) {
 	dongle.Context = req.Context
 	dongle.DialPrefix = req.DialPrefix
 	dongle.Disable = req.Disable
-
-	if err := database.DB.Save(&dongle).Error; err != nil {
+	dongle.Carrier = req.Carrier
+	if req.RecordingPolicy != "" {
+		policy, err := validateRecordingPolicy(req.RecordingPolicy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dongle.RecordingPolicy = policy
+	}
+
+	// 只写入可编辑的字段，IMEI/IMSI/ICCID 由身份检查后台任务维护，不能被这里读到的旧值覆盖
+	if err := database.DB.Model(&dongle).
+		Select("device", "audio", "data", "group", "context", "dial_prefix", "disable", "carrier", "recording_policy").
+		Updates(&dongle).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 重新读取，返回最新的身份信息
+	if err := database.DB.First(&dongle, dongle.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,267 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/auth"
+	"github.com/ety001/lzc-mobile/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// eventsKeepAlive SSE 心跳 / WebSocket ping 间隔
+	eventsKeepAlive = 30 * time.Second
+	// eventsWriteTimeout WebSocket 单次写超时
+	eventsWriteTimeout = 10 * time.Second
+)
+
+// resetEvent 续传失败（事件 ID 过旧或服务已重启）时推送，客户端应重新加载数据
+var resetEvent = events.Event{Topic: "system", Type: "reset"}
+
+// parseEventTopics 解析 topics 参数（逗号分隔），为空表示所有主题
+func parseEventTopics(raw string) ([]string, error) {
+	var topics []string
+	for _, topic := range strings.Split(raw, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		valid := false
+		for _, t := range events.Topics {
+			if t == topic {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown topic %q, must be one of %s", topic, strings.Join(events.Topics, ", "))
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+
+// eventVisible 事件是否在用户的 dongle 范围内（scope 为 nil 表示不限制）
+// 带 dongle_id 的事件（短信、通话、插拔）只推送给可以访问该 dongle 的用户，其他事件推送给所有用户
+func eventVisible(scope []string, ev events.Event) bool {
+	if scope == nil || ev.Data == nil {
+		return true
+	}
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return false
+	}
+	var v struct {
+		DongleID string `json:"dongle_id"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil || v.DongleID == "" {
+		// 不是对象或没有 dongle_id 的事件不属于某个 dongle
+		return true
+	}
+	for _, id := range scope {
+		if id == v.DongleID {
+			return true
+		}
+	}
+	return false
+}
+
+// streamEvents 实时事件流（短信、通话、dongle、状态、通知）
+// 默认使用 SSE；WebSocket 升级请求则通过 WebSocket 推送 JSON 事件
+// 参数：topics=sms,call 过滤主题；last_event_id（或 SSE 的 Last-Event-ID 头）从指定事件之后续传
+func (r *Router) streamEvents(c *gin.Context) {
+	topics, err := parseEventTopics(c.Query("topics"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lastID := c.Query("last_event_id")
+	if lastID == "" {
+		lastID = c.GetHeader("Last-Event-ID")
+	}
+	var afterID uint64
+	if lastID != "" {
+		afterID, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_event_id"})
+			return
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		r.streamEventsWebSocket(c, topics, afterID)
+		return
+	}
+	r.streamEventsSSE(c, topics, afterID)
+}
+
+// streamEventsSSE 以 SSE 推送事件（事件名为主题，id 为事件 ID，浏览器重连时自动携带 Last-Event-ID）
+func (r *Router) streamEventsSSE(c *gin.Context, topics []string, afterID uint64) {
+	sub, backlog, missed := events.GetBus().Subscribe(topics, afterID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	scope := auth.DongleScope(c)
+	write := func(ev events.Event) bool {
+		if !eventVisible(scope, ev) {
+			return true
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("[Events] Failed to marshal event %d: %v", ev.ID, err)
+			return true
+		}
+		name := ev.Topic
+		if ev.Type == resetEvent.Type && ev.Topic == resetEvent.Topic {
+			name = resetEvent.Type
+		}
+		if ev.ID > 0 {
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, name, data)
+		} else {
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		}
+		if err != nil {
+			return false
+		}
+		w.Flush()
+		return true
+	}
+
+	// 断线重连间隔
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if missed {
+		reset := resetEvent
+		reset.Time = time.Now()
+		if !write(reset) {
+			return
+		}
+	}
+	for _, ev := range backlog {
+		if !write(ev) {
+			return
+		}
+	}
+	w.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				// 客户端处理太慢被断开，浏览器会带 Last-Event-ID 自动重连续传
+				return
+			}
+			if !write(ev) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// streamEventsWebSocket 以 WebSocket 推送 JSON 事件（客户端发送的消息被忽略）
+func (r *Router) streamEventsWebSocket(c *gin.Context, topics []string, afterID uint64) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[Events] WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sub, backlog, missed := events.GetBus().Subscribe(topics, afterID)
+	defer sub.Close()
+
+	// 读取客户端消息以处理 pong/close，连接断开时结束推送
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(2 * eventsKeepAlive))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * eventsKeepAlive))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	scope := auth.DongleScope(c)
+	write := func(ev events.Event) bool {
+		if !eventVisible(scope, ev) {
+			return true
+		}
+		conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		if err := conn.WriteJSON(ev); err != nil {
+			log.Printf("[Events] WebSocket write error: %v", err)
+			return false
+		}
+		return true
+	}
+
+	if missed {
+		reset := resetEvent
+		reset.Time = time.Now()
+		if !write(reset) {
+			return
+		}
+	}
+	for _, ev := range backlog {
+		if !write(ev) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(eventsKeepAlive)
+	defer ping.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				// 客户端处理太慢被断开，客户端应携带 last_event_id 重连续传
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow"),
+					time.Now().Add(eventsWriteTimeout))
+				return
+			}
+			if !write(ev) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-c.Request.Context().Done():
+			// 服务器关闭
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(eventsWriteTimeout))
+			return
+		}
+	}
+}
@@ -16,6 +16,8 @@ type ExtensionRequest struct {
 	CallerID string `json:"callerid"`
 	Host     string `json:"host"`
 	Context  string `json:"context"`
+	// 录音策略：always、ondemand 或 never（创建时为空表示 never，更新时为空表示不修改）
+	RecordingPolicy string `json:"recording_policy"`
 }
 
 // listExtensions 列出所有 Extensions
@@ -60,13 +62,19 @@ func (r *Router) createExtension(c *gin.Context) {
 	if req.Context == "" {
 		req.Context = "default"
 	}
+	recordingPolicy, err := validateRecordingPolicy(req.RecordingPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	extension := database.Extension{
-		Username: req.Username,
-		Secret:   req.Secret,
-		CallerID: req.CallerID,
-		Host:     req.Host,
-		Context:  req.Context,
+		Username:        req.Username,
+		Secret:          req.Secret,
+		CallerID:        req.CallerID,
+		Host:            req.Host,
+		Context:         req.Context,
+		RecordingPolicy: recordingPolicy,
 	}
 
 	if err := database.DB.Create(&extension).Error; err != nil {
@@ -113,6 +121,14 @@ func (r *Router) updateExtension(c *gin.Context) {
 	if req.Context != "" {
 		extension.Context = req.Context
 	}
+	if req.RecordingPolicy != "" {
+		policy, err := validateRecordingPolicy(req.RecordingPolicy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		extension.RecordingPolicy = policy
+	}
 
 	if err := database.DB.Save(&extension).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -0,0 +1,229 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// forwardNumberRegex 转移目标号码（允许国际号码 + 开头）
+var forwardNumberRegex = regexp.MustCompile(`^\+?[0-9]{3,20}$`)
+
+// CallForwardRequest 呼叫转移请求结构
+type CallForwardRequest struct {
+	DongleID        string `json:"dongle_id" binding:"required"`
+	Mode            string `json:"mode" binding:"required"` // unconditional、busy 或 noanswer
+	Number          string `json:"number" binding:"required"`
+	ViaDongleID     string `json:"via_dongle_id"` // 为空表示使用来电的 dongle
+	Timeout         int    `json:"timeout"`
+	CallerIDMode    string `json:"caller_id_mode"` // network（默认）、hidden 或 sms
+	TimeConditionID *uint  `json:"time_condition_id"`
+	ActiveWhen      string `json:"active_when"` // open（默认）或 closed
+	Enabled         *bool  `json:"enabled"`     // 为空时默认启用
+}
+
+// validate 校验呼叫转移请求并填充默认值
+func (req *CallForwardRequest) validate() error {
+	switch req.Mode {
+	case database.ForwardUnconditional, database.ForwardBusy, database.ForwardNoAnswer:
+	default:
+		return fmt.Errorf("invalid mode %q, expected unconditional, busy or noanswer", req.Mode)
+	}
+	if !forwardNumberRegex.MatchString(req.Number) {
+		return errors.New("invalid number")
+	}
+
+	var dongle database.Dongle
+	if err := database.DB.Where("device_id = ?", req.DongleID).First(&dongle).Error; err != nil {
+		return fmt.Errorf("dongle %s not found", req.DongleID)
+	}
+	if req.ViaDongleID == req.DongleID {
+		req.ViaDongleID = ""
+	}
+	if req.ViaDongleID != "" {
+		var via database.Dongle
+		if err := database.DB.Where("device_id = ?", req.ViaDongleID).First(&via).Error; err != nil {
+			return fmt.Errorf("via dongle %s not found", req.ViaDongleID)
+		}
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = 60
+	}
+	if req.Timeout < 5 || req.Timeout > 300 {
+		return errors.New("timeout must be between 5 and 300 seconds")
+	}
+
+	if req.CallerIDMode == "" {
+		req.CallerIDMode = database.ForwardCallerIDNetwork
+	}
+	switch req.CallerIDMode {
+	case database.ForwardCallerIDNetwork, database.ForwardCallerIDHidden, database.ForwardCallerIDSMS:
+	default:
+		return fmt.Errorf("invalid caller_id_mode %q, expected network, hidden or sms", req.CallerIDMode)
+	}
+
+	if req.ActiveWhen == "" {
+		req.ActiveWhen = "open"
+	}
+	if req.ActiveWhen != "open" && req.ActiveWhen != "closed" {
+		return fmt.Errorf("invalid active_when %q, expected open or closed", req.ActiveWhen)
+	}
+	if req.TimeConditionID != nil {
+		var cond database.TimeCondition
+		if err := database.DB.First(&cond, *req.TimeConditionID).Error; err != nil {
+			return fmt.Errorf("time condition %d not found", *req.TimeConditionID)
+		}
+	}
+	return nil
+}
+
+// apply 将请求写入转移规则
+func (req *CallForwardRequest) apply(f *database.CallForward) {
+	f.DongleID = req.DongleID
+	f.Mode = req.Mode
+	f.Number = req.Number
+	f.ViaDongleID = req.ViaDongleID
+	f.Timeout = req.Timeout
+	f.CallerIDMode = req.CallerIDMode
+	f.TimeConditionID = req.TimeConditionID
+	f.ActiveWhen = req.ActiveWhen
+	f.Enabled = req.Enabled == nil || *req.Enabled
+}
+
+// listCallForwards 列出呼叫转移规则（可按 dongle_id 过滤）
+func (r *Router) listCallForwards(c *gin.Context) {
+	query := database.DB.Model(&database.CallForward{})
+	if dongleID := c.Query("dongle_id"); dongleID != "" {
+		query = query.Where("dongle_id = ?", dongleID)
+	}
+
+	var forwards []database.CallForward
+	if err := query.Order("dongle_id ASC, id ASC").Find(&forwards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, forwards)
+}
+
+// getCallForward 获取单个呼叫转移规则
+func (r *Router) getCallForward(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var forward database.CallForward
+	if err := database.DB.First(&forward, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call forward not found"})
+		return
+	}
+	c.JSON(http.StatusOK, forward)
+}
+
+// createCallForward 创建呼叫转移规则
+func (r *Router) createCallForward(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req CallForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var forward database.CallForward
+	req.apply(&forward)
+	// Select("*") 保证 enabled=false 能写入（否则会被 default:true 覆盖）
+	if err := database.DB.Select("*").Create(&forward).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, forward)
+}
+
+// updateCallForward 更新呼叫转移规则
+func (r *Router) updateCallForward(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var forward database.CallForward
+	if err := database.DB.First(&forward, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call forward not found"})
+		return
+	}
+
+	var req CallForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.apply(&forward)
+	if err := database.DB.Save(&forward).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, forward)
+}
+
+// deleteCallForward 删除呼叫转移规则
+func (r *Router) deleteCallForward(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	result := database.DB.Delete(&database.CallForward{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call forward not found"})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Call forward deleted"})
+}
@@ -0,0 +1,216 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/lifecycle"
+	"github.com/ety001/lzc-mobile/internal/sms"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// healthCheckTimeout 单次健康检查（数据库和 AMI 查询）的超时时间
+	healthCheckTimeout = 3 * time.Second
+	// fullyBootedTimeout 确认 Asterisk 已完全启动的超时时间
+	fullyBootedTimeout = time.Second
+	// outboxStallAfter 通知发件箱中最早的短信超过这个时间还没推送时判定为积压
+	outboxStallAfter = 10 * time.Minute
+)
+
+// 检查结果
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// healthCheck 单项检查结果
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Detail any    `json:"detail,omitempty"`
+}
+
+// healthReport 健康检查报告
+type healthReport struct {
+	Status string                 `json:"status"`
+	Time   time.Time              `json:"time"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// ok 所有检查是否通过
+func (h *healthReport) ok(names ...string) bool {
+	if len(names) == 0 {
+		for name := range h.Checks {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if check, exists := h.Checks[name]; exists && check.Status != checkOK {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLifecycle 设置组件生命周期管理器（就绪检查报告各组件的启动状态）
+func (r *Router) SetLifecycle(lc *lifecycle.Manager) {
+	r.lifecycle = lc
+}
+
+// healthz 存活检查（不需要认证，供 Docker healthcheck 使用）
+// 返回所有检查项的详情，但只有进程本身不可用（数据库不可用或组件启动失败）时返回 503，
+// Asterisk 还在启动或 dongle 忙碌不会导致容器被判定为不健康
+func (r *Router) healthz(c *gin.Context) {
+	report := r.checkHealth(c.Request.Context())
+	if !report.ok("database") || r.startupFailed() {
+		report.Status = checkFail
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// readyz 就绪检查（不需要认证）：所有组件已启动、AMI 已登录、Asterisk 已完全启动、
+// 至少一个 dongle 空闲且通知没有积压时返回 200，否则返回 503
+func (r *Router) readyz(c *gin.Context) {
+	report := r.checkHealth(c.Request.Context())
+	if !report.ok() {
+		report.Status = checkFail
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// startupFailed 是否有组件启动失败
+func (r *Router) startupFailed() bool {
+	if r.lifecycle == nil {
+		return false
+	}
+	for _, s := range r.lifecycle.Status() {
+		if s.State == lifecycle.StateFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHealth 执行所有健康检查
+func (r *Router) checkHealth(ctx context.Context) *healthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := &healthReport{
+		Status: checkOK,
+		Time:   time.Now(),
+		Checks: make(map[string]healthCheck),
+	}
+	report.Checks["database"] = checkDatabase(ctx)
+	if r.lifecycle != nil {
+		report.Checks["startup"] = checkStartup(r.lifecycle)
+	}
+
+	amiCheck := checkAMI()
+	report.Checks["ami"] = amiCheck
+	if amiCheck.Status == checkOK {
+		report.Checks["asterisk"] = checkAsterisk(ctx)
+		report.Checks["dongles"] = checkDongles(ctx)
+	} else {
+		notConnected := healthCheck{Status: checkFail, Error: "AMI not connected"}
+		report.Checks["asterisk"] = notConnected
+		report.Checks["dongles"] = notConnected
+	}
+	report.Checks["notification_outbox"] = checkOutbox()
+	return report
+}
+
+// checkDatabase 数据库连接
+func checkDatabase(ctx context.Context) healthCheck {
+	if database.DB == nil {
+		return healthCheck{Status: checkFail, Error: "database not initialized"}
+	}
+	sqlDB, err := database.DB.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		return healthCheck{Status: checkFail, Error: err.Error()}
+	}
+	return healthCheck{Status: checkOK}
+}
+
+// checkStartup 组件启动状态
+func checkStartup(lc *lifecycle.Manager) healthCheck {
+	check := healthCheck{Status: checkOK, Detail: lc.Status()}
+	if !lc.Ready() {
+		check.Status = checkFail
+		check.Error = "not all components are running"
+	}
+	return check
+}
+
+// checkAMI AMI 是否已登录
+func checkAMI() healthCheck {
+	stats := ami.GetManager().ConnectionStats()
+	check := healthCheck{Status: checkOK, Detail: stats}
+	if stats.State != ami.ConnStateConnected {
+		check.Status = checkFail
+		check.Error = fmt.Sprintf("AMI %s", stats.State)
+	}
+	return check
+}
+
+// checkAsterisk Asterisk 是否已完全启动（FullyBooted）
+func checkAsterisk(ctx context.Context) healthCheck {
+	// Asterisk 还在启动时 core waitfullybooted 会一直等待，不占用其它检查的时间
+	ctx, cancel := context.WithTimeout(ctx, fullyBootedTimeout)
+	defer cancel()
+	booted, err := ami.GetManager().FullyBooted(ctx)
+	if err != nil {
+		return healthCheck{Status: checkFail, Error: err.Error()}
+	}
+	if !booted {
+		return healthCheck{Status: checkFail, Error: "Asterisk not fully booted"}
+	}
+	return healthCheck{Status: checkOK}
+}
+
+// checkDongles 至少一个 dongle 设备空闲（Free）
+func checkDongles(ctx context.Context) healthCheck {
+	states, err := ami.GetManager().DongleStates(ctx)
+	if err != nil {
+		return healthCheck{Status: checkFail, Error: err.Error()}
+	}
+	check := healthCheck{Status: checkFail, Error: "no dongle is free", Detail: states}
+	for _, state := range states {
+		if state == "Free" {
+			check.Status = checkOK
+			check.Error = ""
+			break
+		}
+	}
+	return check
+}
+
+// checkOutbox 通知发件箱积压（已入库但还没推送通知的短信）
+func checkOutbox() healthCheck {
+	count, oldest, err := sms.PendingNotifications()
+	if err != nil {
+		return healthCheck{Status: checkFail, Error: err.Error()}
+	}
+	detail := gin.H{"pending": count}
+	check := healthCheck{Status: checkOK, Detail: detail}
+	if oldest != nil {
+		detail["oldest"] = oldest
+		if age := time.Since(*oldest); age > outboxStallAfter {
+			check.Status = checkFail
+			check.Error = fmt.Sprintf("%d notifications pending, oldest %v ago", count, age.Round(time.Second))
+		}
+	}
+	return check
+}
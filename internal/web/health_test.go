@@ -0,0 +1,124 @@
+package web
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ety001/lzc-mobile/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// healthResponse 健康检查响应
+type healthResponse struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"checks"`
+}
+
+func getHealth(t *testing.T, engine *gin.Engine, path string) (int, healthResponse) {
+	t.Helper()
+	w := doJSON(t, engine, http.MethodGet, path, nil)
+	var resp healthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v (body %s)", path, err, w.Body.String())
+	}
+	return w.Code, resp
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	engine := newTestEngine()
+
+	code, resp := getHealth(t, engine, "/readyz")
+	if code != http.StatusOK || resp.Status != "ok" {
+		t.Fatalf("readyz = %d %+v", code, resp)
+	}
+	for _, name := range []string{"database", "ami", "asterisk", "dongles", "notification_outbox"} {
+		if resp.Checks[name].Status != "ok" {
+			t.Fatalf("check %s = %+v", name, resp.Checks[name])
+		}
+	}
+
+	// 所有 dongle 都在通话中：不就绪，但进程仍然存活
+	amiServer.SetCommand("quectel show devices",
+		"ID           Group State      RSSI Mode Submode Provider Name  Model      Firmware          IMEI             IMSI             Number\n"+
+			"quectel0     0     In use     23   0    0       CHINA MOBILE   EC20F      EC20CEFAGR06A05M4G 861234567890123 460001234567890  Unknown")
+	defer amiServer.LoadFixtures(os.DirFS("../amitest"), "fixtures/*.txt")
+
+	code, resp = getHealth(t, engine, "/readyz")
+	if code != http.StatusServiceUnavailable || resp.Checks["dongles"].Status != "fail" {
+		t.Fatalf("readyz with busy dongle = %d %+v", code, resp)
+	}
+	code, resp = getHealth(t, engine, "/healthz")
+	if code != http.StatusOK || resp.Status != "ok" {
+		t.Fatalf("healthz with busy dongle = %d %+v", code, resp)
+	}
+}
+
+func TestDownloadDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	manager := "[general]\nenabled = yes\n\n[admin]\nsecret = s3cret\nread = all\n"
+	if err := os.WriteFile(filepath.Join(dir, "manager.conf"), []byte(manager), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 回调密钥出现在 Asterisk 日志中的 dialplan 命令里
+	secret, err := config.IngestSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logDir := t.TempDir()
+	t.Setenv("ASTERISK_LOG_DIR", logDir)
+	full := "Executing [sms@incoming-mobile:4] System(curl -H \"X-Ingest-Token: " + secret + "\")\n"
+	if err := os.WriteFile(filepath.Join(logDir, "full"), []byte(full), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := gin.New()
+	NewRouter(config.NewRenderer("", dir), smsHandler).SetupRoutes(engine)
+
+	w := doJSON(t, engine, http.MethodGet, "/api/v1/system/diagnostics", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".tar.gz") {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[hdr.Name[strings.Index(hdr.Name, "/")+1:]] = string(data)
+	}
+
+	for _, name := range []string{"health.json", "versions.json", "asterisk/quectel-show-devices.txt", "asterisk/pjsip-show-endpoints.txt", "logs/webpanel.log", "config/manager.conf"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("bundle missing %s, has %v", name, files)
+		}
+	}
+	if !strings.Contains(files["asterisk/quectel-show-devices.txt"], "quectel0") {
+		t.Fatalf("quectel show devices = %q", files["asterisk/quectel-show-devices.txt"])
+	}
+	if strings.Contains(files["config/manager.conf"], "s3cret") || !strings.Contains(files["config/manager.conf"], "read = all") {
+		t.Fatalf("manager.conf not redacted: %q", files["config/manager.conf"])
+	}
+	if log := files["logs/asterisk/full"]; log == "" || strings.Contains(log, secret) {
+		t.Fatalf("asterisk log not redacted: %q", log)
+	}
+}
@@ -0,0 +1,366 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ringStrategies 支持的振铃策略
+var ringStrategies = map[string]bool{
+	database.RingStrategyRingAll:    true,
+	database.RingStrategySequential: true,
+	database.RingStrategyRoundRobin: true,
+	database.RingStrategyRandom:     true,
+}
+
+// InboundRouteMemberRequest 来电路由成员（按数组顺序振铃）
+type InboundRouteMemberRequest struct {
+	ExtensionID uint `json:"extension_id" binding:"required"`
+	Timeout     int  `json:"timeout"` // 为空时默认 20 秒
+}
+
+// InboundRouteRequest 来电路由请求结构
+type InboundRouteRequest struct {
+	DongleID      string                      `json:"dongle_id" binding:"required"`
+	Strategy      string                      `json:"strategy"` // 为空时默认 ringall
+	RingTimeout   int                         `json:"ring_timeout"`
+	Members       []InboundRouteMemberRequest `json:"members"`
+	FinalType     string                      `json:"final_type"` // 为空时默认 hangup
+	FinalTarget   string                      `json:"final_target"`
+	FinalDongleID string                      `json:"final_dongle_id"`
+	FinalTimeout  int                         `json:"final_timeout"`
+	Enabled       *bool                       `json:"enabled"` // 为空时默认启用
+
+	TimeConditionID  *uint  `json:"time_condition_id"` // 工作时间条件，非工作时间转到 off_hours_*
+	OffHoursType     string `json:"off_hours_type"`
+	OffHoursTarget   string `json:"off_hours_target"`
+	OffHoursDongleID string `json:"off_hours_dongle_id"`
+}
+
+// validate 校验来电路由请求并填充默认值
+func (req *InboundRouteRequest) validate() error {
+	if req.Strategy == "" {
+		req.Strategy = database.RingStrategyRingAll
+	}
+	if !ringStrategies[req.Strategy] {
+		return fmt.Errorf("invalid strategy %q, expected ringall, sequential, roundrobin or random", req.Strategy)
+	}
+	if req.RingTimeout == 0 {
+		req.RingTimeout = 30
+	}
+	if req.FinalTimeout == 0 {
+		req.FinalTimeout = 30
+	}
+	if req.RingTimeout < 5 || req.RingTimeout > 300 || req.FinalTimeout < 5 || req.FinalTimeout > 300 {
+		return errors.New("timeouts must be between 5 and 300 seconds")
+	}
+
+	var dongle database.Dongle
+	if err := database.DB.Where("device_id = ?", req.DongleID).First(&dongle).Error; err != nil {
+		return fmt.Errorf("dongle %s not found", req.DongleID)
+	}
+
+	seen := make(map[uint]bool, len(req.Members))
+	for i := range req.Members {
+		m := &req.Members[i]
+		if seen[m.ExtensionID] {
+			return fmt.Errorf("member %d: extension %d listed twice", i, m.ExtensionID)
+		}
+		seen[m.ExtensionID] = true
+		if m.Timeout == 0 {
+			m.Timeout = 20
+		}
+		if m.Timeout < 5 || m.Timeout > 300 {
+			return fmt.Errorf("member %d: timeout must be between 5 and 300 seconds", i)
+		}
+		var ext database.Extension
+		if err := database.DB.First(&ext, m.ExtensionID).Error; err != nil {
+			return fmt.Errorf("member %d: extension %d not found", i, m.ExtensionID)
+		}
+	}
+
+	if err := validateDestination("final", &req.FinalType, &req.FinalTarget, &req.FinalDongleID); err != nil {
+		return err
+	}
+
+	if req.TimeConditionID != nil {
+		var cond database.TimeCondition
+		if err := database.DB.First(&cond, *req.TimeConditionID).Error; err != nil {
+			return fmt.Errorf("time condition %d not found", *req.TimeConditionID)
+		}
+		if err := validateDestination("off_hours", &req.OffHoursType, &req.OffHoursTarget, &req.OffHoursDongleID); err != nil {
+			return err
+		}
+	} else {
+		req.OffHoursType = database.FinalDestHangup
+		req.OffHoursTarget = ""
+		req.OffHoursDongleID = ""
+	}
+
+	if len(req.Members) == 0 && req.FinalType == database.FinalDestHangup && req.OffHoursType == database.FinalDestHangup {
+		return errors.New("at least one member or a final destination is required")
+	}
+	return nil
+}
+
+// validateDestination 校验去向（prefix 为字段名前缀，如 final、off_hours），并清理无关字段
+func validateDestination(prefix string, kind, target, dongleID *string) error {
+	if *kind == "" {
+		*kind = database.FinalDestHangup
+	}
+	switch *kind {
+	case database.FinalDestHangup:
+		*target = ""
+		*dongleID = ""
+	case database.FinalDestExtension, database.FinalDestVoicemail:
+		var ext database.Extension
+		if err := database.DB.Where("username = ?", *target).First(&ext).Error; err != nil {
+			return fmt.Errorf("%s_target: extension %q not found", prefix, *target)
+		}
+		*dongleID = ""
+	case database.FinalDestExternal:
+		if *target == "" || !digitsRegex.MatchString(*target) {
+			return fmt.Errorf("%s_target must be a phone number", prefix)
+		}
+		var dongle database.Dongle
+		if err := database.DB.Where("device_id = ?", *dongleID).First(&dongle).Error; err != nil {
+			return fmt.Errorf("%s_dongle_id: dongle %q not found", prefix, *dongleID)
+		}
+	default:
+		return fmt.Errorf("invalid %s_type %q, expected hangup, extension, voicemail or external", prefix, *kind)
+	}
+	return nil
+}
+
+// apply 将请求写入路由（不含成员）
+func (req *InboundRouteRequest) apply(route *database.InboundRoute) {
+	route.DongleID = req.DongleID
+	route.Strategy = req.Strategy
+	route.RingTimeout = req.RingTimeout
+	route.FinalType = req.FinalType
+	route.FinalTarget = req.FinalTarget
+	route.FinalDongleID = req.FinalDongleID
+	route.FinalTimeout = req.FinalTimeout
+	route.Enabled = req.Enabled == nil || *req.Enabled
+	route.TimeConditionID = req.TimeConditionID
+	route.OffHoursType = req.OffHoursType
+	route.OffHoursTarget = req.OffHoursTarget
+	route.OffHoursDongleID = req.OffHoursDongleID
+}
+
+// members 生成路由成员记录
+func (req *InboundRouteRequest) members(routeID uint) []database.InboundRouteMember {
+	members := make([]database.InboundRouteMember, len(req.Members))
+	for i, m := range req.Members {
+		members[i] = database.InboundRouteMember{
+			RouteID:     routeID,
+			Position:    i,
+			ExtensionID: m.ExtensionID,
+			Timeout:     m.Timeout,
+		}
+	}
+	return members
+}
+
+// loadInboundRoute 按 ID 加载来电路由（含成员和分机）
+func loadInboundRoute(id uint64) (*database.InboundRoute, error) {
+	var route database.InboundRoute
+	err := database.DB.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Preload("Members.Extension").First(&route, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// listInboundRoutes 列出所有来电路由（含成员）
+func (r *Router) listInboundRoutes(c *gin.Context) {
+	var routes []database.InboundRoute
+	if err := database.DB.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Preload("Members.Extension").Order("dongle_id ASC").Find(&routes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, routes)
+}
+
+// getInboundRoute 获取单个来电路由
+func (r *Router) getInboundRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	route, err := loadInboundRoute(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound route not found"})
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
+
+// createInboundRoute 创建来电路由（每个 dongle 只能有一个）
+func (r *Router) createInboundRoute(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req InboundRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&database.InboundRoute{}).Where("dongle_id = ?", req.DongleID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Inbound route for this dongle already exists"})
+		return
+	}
+
+	var route database.InboundRoute
+	req.apply(&route)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Select("*") 保证 enabled=false 能写入（否则会被 default:true 覆盖）
+		if err := tx.Select("*").Omit("Members").Create(&route).Error; err != nil {
+			return err
+		}
+		if len(req.Members) == 0 {
+			return nil
+		}
+		members := req.members(route.ID)
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	created, err := loadInboundRoute(uint64(route.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// updateInboundRoute 更新来电路由（成员整体替换）
+func (r *Router) updateInboundRoute(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var route database.InboundRoute
+	if err := database.DB.First(&route, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound route not found"})
+		return
+	}
+
+	var req InboundRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DongleID != route.DongleID {
+		var count int64
+		database.DB.Model(&database.InboundRoute{}).Where("dongle_id = ? AND id != ?", req.DongleID, route.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Inbound route for this dongle already exists"})
+			return
+		}
+	}
+
+	req.apply(&route)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members").Save(&route).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("route_id = ?", route.ID).Delete(&database.InboundRouteMember{}).Error; err != nil {
+			return err
+		}
+		if len(req.Members) == 0 {
+			return nil
+		}
+		members := req.members(route.ID)
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	updated, err := loadInboundRoute(uint64(route.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteInboundRoute 删除来电路由（该 dongle 回退到 inbound 绑定同时振铃）
+func (r *Router) deleteInboundRoute(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var route database.InboundRoute
+	if err := database.DB.First(&route, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound route not found"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("route_id = ?", route.ID).Delete(&database.InboundRouteMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&route).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Inbound route deleted"})
+}
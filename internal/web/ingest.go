@@ -0,0 +1,44 @@
+package web
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/ety001/lzc-mobile/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// SetupIngestRoutes 设置内部回调接口的路由（Asterisk dialplan 调用，只在本机回环地址上监听）
+// 请求需要在 X-Ingest-Token 请求头中携带渲染配置时生成的共享密钥
+func (r *Router) SetupIngestRoutes(engine *gin.Engine) {
+	ingest := engine.Group("/api/v1")
+	ingest.Use(checkIngestToken)
+	{
+		// SMS 接收
+		ingest.POST("/sms/receive", r.receiveSMS)
+		// USSD 响应接收
+		ingest.POST("/ussd/receive", r.receiveUSSD)
+		// 来电黑名单查询
+		ingest.GET("/blocklist/check", r.checkBlocklist)
+		// 录音登记（MixMonitor 结束时调用）
+		ingest.POST("/recordings/receive", r.receiveRecording)
+	}
+}
+
+// checkIngestToken 校验内部回调请求携带的共享密钥
+func checkIngestToken(c *gin.Context) {
+	secret, err := config.IngestSecret()
+	if err != nil {
+		log.Printf("[Ingest] Failed to load ingest secret: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Ingest secret not available"})
+		return
+	}
+	token := c.GetHeader(config.IngestHeader)
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		log.Printf("[Ingest] Rejected %s %s from %s: invalid token", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	c.Next()
+}
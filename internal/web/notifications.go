@@ -2,7 +2,6 @@ package web
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -85,11 +84,9 @@ func (r *Router) updateNotificationConfig(c *gin.Context) {
 		}
 	}
 
-	// 重新加载通知配置（通过创建新的通知管理器并加载配置）
-	notifyManager := notify.NewManager()
-	if err := notifyManager.LoadConfigs(); err != nil {
-		// 即使重新加载失败，也返回成功（配置已保存）
-		log.Printf("Warning: Failed to reload notification configs: %v", err)
+	// 重新加载短信处理器的通知配置（即使重新加载失败，也返回成功，配置已保存）
+	if r.smsHandler != nil {
+		r.smsHandler.ReloadConfigs()
 	}
 
 	c.JSON(http.StatusOK, config)
@@ -0,0 +1,384 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// routeMutex 外呼路由和运营商前缀的操作锁
+var routeMutex sync.Mutex
+
+var (
+	// outboundPatternRegex Asterisk 号码模式（_ 开头的模式，或纯号码）
+	outboundPatternRegex = regexp.MustCompile(`^(_[0-9XZN.!\[\]\-+*#]+|[0-9+*#]+)$`)
+	// timeConditionRegex GotoIfTime 格式：<时间>,<星期>,<日期>,<月份>
+	timeConditionRegex = regexp.MustCompile(`^[0-9:*\-&]+,[a-z*\-&]+,[0-9*\-&]+,[a-z*\-&]+$`)
+	// digitsRegex 前缀只允许拨号字符
+	digitsRegex = regexp.MustCompile(`^[0-9+*#]{0,20}$`)
+)
+
+// catchAllPatterns 与 [default] 中通用 PJSIP 路由冲突的模式
+var catchAllPatterns = map[string]bool{"_X.": true, "_.": true, "_!": true, "_X!": true}
+
+// OutboundRouteTargetRequest 外呼路由目标（dongle_id 与 group 二选一）
+type OutboundRouteTargetRequest struct {
+	DongleID string `json:"dongle_id"`
+	Group    *int   `json:"group"`
+}
+
+// OutboundRouteRequest 外呼路由请求结构
+type OutboundRouteRequest struct {
+	Name              string                       `json:"name" binding:"required"`
+	Pattern           string                       `json:"pattern" binding:"required"`
+	Priority          int                          `json:"priority"`
+	Strip             int                          `json:"strip"`
+	Prepend           string                       `json:"prepend"`
+	TimeCondition     string                       `json:"time_condition"`
+	TimeConditionID   *uint                        `json:"time_condition_id"` // 与 time_condition 二选一
+	PreferSameCarrier bool                         `json:"prefer_same_carrier"`
+	Enabled           *bool                        `json:"enabled"` // 为空时默认启用
+	Targets           []OutboundRouteTargetRequest `json:"targets" binding:"required"`
+}
+
+// validate 校验外呼路由请求
+func (req *OutboundRouteRequest) validate() error {
+	if !outboundPatternRegex.MatchString(req.Pattern) {
+		return errors.New("invalid pattern")
+	}
+	if catchAllPatterns[req.Pattern] {
+		return errors.New("pattern conflicts with the catch-all extension route, use a more specific pattern")
+	}
+	var dongles []database.Dongle
+	if err := database.DB.Find(&dongles).Error; err != nil {
+		return err
+	}
+	for _, d := range dongles {
+		if req.Pattern == "_"+d.DialPrefix+"X." {
+			return fmt.Errorf("pattern conflicts with the dial prefix of %s", d.DeviceID)
+		}
+	}
+
+	if req.Strip < 0 || req.Strip > 20 {
+		return errors.New("strip must be between 0 and 20")
+	}
+	if !digitsRegex.MatchString(req.Prepend) {
+		return errors.New("invalid prepend digits")
+	}
+	if req.TimeCondition != "" && !timeConditionRegex.MatchString(req.TimeCondition) {
+		return errors.New("invalid time_condition, expected <times>,<weekdays>,<mdays>,<months> (e.g. 09:00-18:00,mon-fri,*,*)")
+	}
+	if req.TimeConditionID != nil {
+		if req.TimeCondition != "" {
+			return errors.New("time_condition and time_condition_id are mutually exclusive")
+		}
+		var cond database.TimeCondition
+		if err := database.DB.First(&cond, *req.TimeConditionID).Error; err != nil {
+			return fmt.Errorf("time condition %d not found", *req.TimeConditionID)
+		}
+	}
+
+	if len(req.Targets) == 0 {
+		return errors.New("at least one target is required")
+	}
+	known := make(map[string]bool, len(dongles))
+	for _, d := range dongles {
+		known[d.DeviceID] = true
+	}
+	for i, t := range req.Targets {
+		switch {
+		case t.DongleID != "" && t.Group != nil:
+			return fmt.Errorf("target %d: dongle_id and group are mutually exclusive", i)
+		case t.DongleID != "":
+			if !known[t.DongleID] {
+				return fmt.Errorf("target %d: dongle %s not found", i, t.DongleID)
+			}
+		case t.Group != nil:
+			if *t.Group < 0 {
+				return fmt.Errorf("target %d: invalid group", i)
+			}
+		default:
+			return fmt.Errorf("target %d: dongle_id or group is required", i)
+		}
+	}
+	return nil
+}
+
+// apply 将请求写入路由（不含目标）
+func (req *OutboundRouteRequest) apply(route *database.OutboundRoute) {
+	route.Name = req.Name
+	route.Pattern = req.Pattern
+	route.Priority = req.Priority
+	route.Strip = req.Strip
+	route.Prepend = req.Prepend
+	route.TimeCondition = req.TimeCondition
+	route.TimeConditionID = req.TimeConditionID
+	route.PreferSameCarrier = req.PreferSameCarrier
+	route.Enabled = req.Enabled == nil || *req.Enabled
+}
+
+// targets 生成路由目标记录
+func (req *OutboundRouteRequest) targets(routeID uint) []database.OutboundRouteTarget {
+	targets := make([]database.OutboundRouteTarget, len(req.Targets))
+	for i, t := range req.Targets {
+		targets[i] = database.OutboundRouteTarget{
+			RouteID:  routeID,
+			Position: i,
+			DongleID: t.DongleID,
+			Group:    t.Group,
+		}
+	}
+	return targets
+}
+
+// listOutboundRoutes 列出所有外呼路由（含目标）
+func (r *Router) listOutboundRoutes(c *gin.Context) {
+	var routes []database.OutboundRoute
+	if err := database.DB.Preload("Targets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Order("pattern ASC, priority ASC, id ASC").Find(&routes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, routes)
+}
+
+// getOutboundRoute 获取单个外呼路由
+func (r *Router) getOutboundRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var route database.OutboundRoute
+	if err := database.DB.Preload("Targets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).First(&route, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outbound route not found"})
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
+
+// createOutboundRoute 创建外呼路由
+func (r *Router) createOutboundRoute(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req OutboundRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var route database.OutboundRoute
+	req.apply(&route)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Select("*") 保证 enabled=false 能写入（否则会被 default:true 覆盖）
+		if err := tx.Select("*").Omit("Targets").Create(&route).Error; err != nil {
+			return err
+		}
+		route.Targets = req.targets(route.ID)
+		return tx.Create(&route.Targets).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, route)
+}
+
+// updateOutboundRoute 更新外呼路由（目标整体替换）
+func (r *Router) updateOutboundRoute(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var route database.OutboundRoute
+	if err := database.DB.First(&route, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outbound route not found"})
+		return
+	}
+
+	var req OutboundRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.apply(&route)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Targets").Save(&route).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("route_id = ?", route.ID).Delete(&database.OutboundRouteTarget{}).Error; err != nil {
+			return err
+		}
+		route.Targets = req.targets(route.ID)
+		return tx.Create(&route.Targets).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
+// deleteOutboundRoute 删除外呼路由
+func (r *Router) deleteOutboundRoute(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var route database.OutboundRoute
+	if err := database.DB.First(&route, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outbound route not found"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("route_id = ?", route.ID).Delete(&database.OutboundRouteTarget{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&route).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Outbound route deleted"})
+}
+
+// CarrierPrefixRequest 运营商号码前缀请求结构（批量添加，已存在的前缀会改为新的运营商）
+type CarrierPrefixRequest struct {
+	Carrier  string   `json:"carrier" binding:"required"`
+	Prefixes []string `json:"prefixes" binding:"required"`
+}
+
+// listCarrierPrefixes 列出运营商号码前缀（可按 carrier 过滤）
+func (r *Router) listCarrierPrefixes(c *gin.Context) {
+	query := database.DB.Model(&database.CarrierPrefix{})
+	if carrier := c.Query("carrier"); carrier != "" {
+		query = query.Where("carrier = ?", carrier)
+	}
+
+	var prefixes []database.CarrierPrefix
+	if err := query.Order("carrier ASC, prefix ASC").Find(&prefixes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prefixes)
+}
+
+// createCarrierPrefixes 批量添加运营商号码前缀
+func (r *Router) createCarrierPrefixes(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req CarrierPrefixRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, p := range req.Prefixes {
+		if p == "" || !digitsRegex.MatchString(p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix: " + p})
+			return
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, p := range req.Prefixes {
+			var prefix database.CarrierPrefix
+			if err := tx.Where("prefix = ?", p).First(&prefix).Error; err == nil {
+				if err := tx.Model(&prefix).Update("carrier", req.Carrier).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Create(&database.CarrierPrefix{Carrier: req.Carrier, Prefix: p}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": fmt.Sprintf("%d prefix(es) saved", len(req.Prefixes))})
+}
+
+// deleteCarrierPrefix 删除运营商号码前缀
+func (r *Router) deleteCarrierPrefix(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := database.DB.Delete(&database.CarrierPrefix{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Carrier prefix deleted"})
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/recording"
+	"github.com/gin-gonic/gin"
+)
+
+// validateRecordingPolicy 校验录音策略，空值表示 never
+func validateRecordingPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return database.RecordingNever, nil
+	case database.RecordingAlways, database.RecordingOnDemand, database.RecordingNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid recording_policy %q, expected always, ondemand or never", policy)
+}
+
+// receiveRecording MixMonitor 结束时登记录音（从 Asterisk 内部调用）
+func (r *Router) receiveRecording(c *gin.Context) {
+	meta := recording.Metadata{
+		FileName:  c.Query("file"),
+		UniqueID:  c.Query("unique_id"),
+		Direction: c.Query("direction"),
+		DongleID:  c.Query("dongle"),
+		Extension: c.Query("extension"),
+		Number:    c.Query("number"),
+	}
+
+	rec, err := recording.Register(meta)
+	if err != nil {
+		log.Printf("[Recording] Failed to register %s: %v", meta.FileName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rec == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Empty recording ignored"})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// listRecordings 分页列出录音（可按 dongle_id、extension、direction、number、call_record_id 过滤）
+func (r *Router) listRecordings(c *gin.Context) {
+	page := 1
+	pageSize := 20
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if sizeStr := c.Query("page_size"); sizeStr != "" {
+		if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 && s <= 100 {
+			pageSize = s
+		}
+	}
+
+	query := scopeByDongle(c, database.DB.Model(&database.Recording{}), "dongle_id")
+	if dongleID := c.Query("dongle_id"); dongleID != "" {
+		query = query.Where("dongle_id = ?", dongleID)
+	}
+	if extension := c.Query("extension"); extension != "" {
+		query = query.Where("extension = ?", extension)
+	}
+	if direction := c.Query("direction"); direction != "" {
+		query = query.Where("direction = ?", direction)
+	}
+	if number := c.Query("number"); number != "" {
+		query = query.Where("number LIKE ?", "%"+number+"%")
+	}
+	if callRecordID := c.Query("call_record_id"); callRecordID != "" {
+		query = query.Where("call_record_id = ?", callRecordID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var recordings []database.Recording
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        recordings,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (int(total) + pageSize - 1) / pageSize,
+	})
+}
+
+// loadRecording 按路径参数 id 加载录音，失败时已写入响应
+func loadRecording(c *gin.Context) (*database.Recording, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+
+	var rec database.Recording
+	if err := database.DB.First(&rec, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		return nil, false
+	}
+	return &rec, true
+}
+
+// getRecording 获取单个录音信息
+func (r *Router) getRecording(c *gin.Context) {
+	rec, ok := loadRecording(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// streamRecording 播放或下载录音（支持 HTTP Range，download=true 时作为附件下载）
+func (r *Router) streamRecording(c *gin.Context) {
+	rec, ok := loadRecording(c)
+	if !ok {
+		return
+	}
+
+	path, err := recording.Path(rec.FileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recording file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "audio/wav")
+	if c.Query("download") == "true" {
+		c.Header("Content-Disposition", "attachment; filename=\""+rec.FileName+"\"")
+	}
+	// ServeContent 处理 Range、If-Modified-Since 等请求头
+	http.ServeContent(c.Writer, c.Request, rec.FileName, info.ModTime(), file)
+}
+
+// deleteRecording 删除录音文件和记录
+func (r *Router) deleteRecording(c *gin.Context) {
+	rec, ok := loadRecording(c)
+	if !ok {
+		return
+	}
+
+	if err := recording.Delete(rec); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recording deleted"})
+}
+
+// getRecordingUsage 获取录音存储使用情况
+func (r *Router) getRecordingUsage(c *gin.Context) {
+	usage, err := recording.GetUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// cleanupRecordings 立即按保留天数和存储上限清理录音
+func (r *Router) cleanupRecordings(c *gin.Context) {
+	result, err := recording.GetCleaner().Cleanup()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
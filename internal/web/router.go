@@ -3,19 +3,24 @@ package web
 import (
 	"github.com/ety001/lzc-mobile/internal/auth"
 	"github.com/ety001/lzc-mobile/internal/config"
+	"github.com/ety001/lzc-mobile/internal/lifecycle"
+	"github.com/ety001/lzc-mobile/internal/sms"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 )
 
 // Router 路由配置
 type Router struct {
-	renderer *config.Renderer
+	renderer   *config.Renderer
+	smsHandler *sms.Handler       // 进程内唯一的短信处理器，与 AMI 事件入口共用
+	lifecycle  *lifecycle.Manager // 可为空（测试中不启动后台组件）
 }
 
 // NewRouter 创建新的路由
-func NewRouter(renderer *config.Renderer) *Router {
+func NewRouter(renderer *config.Renderer, smsHandler *sms.Handler) *Router {
 	return &Router{
-		renderer: renderer,
+		renderer:   renderer,
+		smsHandler: smsHandler,
 	}
 }
 
@@ -28,6 +33,10 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 	// 使用相对路径 ./dist，因为主程序已经将工作目录设置为 /app
 	engine.Use(static.Serve("/", static.LocalFile("./dist", true)))
 
+	// 存活和就绪检查（不需要认证，供 Docker healthcheck 和监控使用）
+	engine.GET("/healthz", r.healthz)
+	engine.GET("/readyz", r.readyz)
+
 	// 认证路由（不需要认证）
 	authGroup := engine.Group("/auth")
 	{
@@ -36,12 +45,36 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 		authGroup.POST("/logout", auth.Logout)
 	}
 
-	// API 路由（需要认证，但本地请求会自动跳过认证）
+	// API 路由（需要认证，按 accessRules 检查角色和 dongle 范围；Asterisk 调用的回调接口在 SetupIngestRoutes 中单独监听）
 	api := engine.Group("/api/v1")
-	api.Use(auth.CheckAuth)
+	api.Use(auth.CheckAuth, r.authorize)
 	{
-		// SMS 接收（从 Asterisk 内部调用，本地请求会自动跳过认证）
-		api.POST("/sms/receive", r.receiveSMS)
+		// 当前用户（角色和 dongle 范围）
+		api.GET("/me", r.getCurrentUser)
+
+		// 当前用户的登录会话（查看和撤销）
+		sessions := api.Group("/sessions")
+		{
+			sessions.GET("", auth.ListSessions)
+			sessions.DELETE("", auth.RevokeOtherSessions) // 撤销除当前会话以外的所有会话
+			sessions.DELETE("/:id", auth.RevokeSession)
+		}
+
+		// 用户管理（修改角色和 dongle 范围、删除用户）
+		users := api.Group("/users")
+		{
+			users.GET("", r.listUsers)
+			users.PUT("/:id", r.updateUser)
+			users.DELETE("/:id", r.deleteUser)
+		}
+
+		// 用户邀请（按邮箱、OIDC subject 或群组）
+		invites := api.Group("/user-invites")
+		{
+			invites.GET("", r.listUserInvites)
+			invites.POST("", r.createUserInvite)
+			invites.DELETE("/:id", r.deleteUserInvite)
+		}
 
 		// Extension 管理
 		extensions := api.Group("/extensions")
@@ -58,9 +91,15 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 		{
 			dongleDevices.GET("", r.listDongles)
 			dongleDevices.POST("", r.createDongle)
+			dongleDevices.GET("/discover", r.discoverDongles)
+			dongleDevices.GET("/hotplug-events", r.listHotplugEvents)
 			dongleDevices.GET("/:id", r.getDongle)
 			dongleDevices.PUT("/:id", r.updateDongle)
 			dongleDevices.DELETE("/:id", r.deleteDongle)
+			dongleDevices.POST("/:id/ussd", r.sendUSSD)
+			dongleDevices.GET("/:id/ussd", r.listUSSDSessions)
+			dongleDevices.DELETE("/:id/ussd", r.cancelUSSD)
+			dongleDevices.GET("/:id/identity-history", r.listDongleIdentityHistory)
 		}
 
 		// Dongle 绑定管理
@@ -84,6 +123,8 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 		system := api.Group("/system")
 		{
 			system.GET("/status", r.getSystemStatus)
+			system.GET("/ami", r.getAMIConnection)            // AMI 连接状态和重连统计
+			system.GET("/diagnostics", r.downloadDiagnostics) // 诊断包（tar.gz）
 			system.POST("/reload", r.reloadAsterisk)
 			system.POST("/restart", r.restartAsterisk)
 		}
@@ -103,6 +144,115 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 			sms.DELETE("/:id", r.deleteSMSMessage)
 			sms.DELETE("", r.deleteSMSMessages)                // 批量删除
 			sms.POST("/delete-all-sim", r.deleteAllSMSFromSIM) // 删除 SIM 卡所有短信
+			sms.POST("/:id/block", r.blockFromSMSMessage)      // 拉黑短信号码
+		}
+
+		// 外呼路由
+		outboundRoutes := api.Group("/outbound-routes")
+		{
+			outboundRoutes.GET("", r.listOutboundRoutes)
+			outboundRoutes.POST("", r.createOutboundRoute)
+			outboundRoutes.GET("/:id", r.getOutboundRoute)
+			outboundRoutes.PUT("/:id", r.updateOutboundRoute)
+			outboundRoutes.DELETE("/:id", r.deleteOutboundRoute)
+		}
+
+		// 来电路由（振铃组、顺序振铃、跟随）
+		inboundRoutes := api.Group("/inbound-routes")
+		{
+			inboundRoutes.GET("", r.listInboundRoutes)
+			inboundRoutes.POST("", r.createInboundRoute)
+			inboundRoutes.GET("/:id", r.getInboundRoute)
+			inboundRoutes.PUT("/:id", r.updateInboundRoute)
+			inboundRoutes.DELETE("/:id", r.deleteInboundRoute)
+		}
+
+		// 呼叫转移（来电转到外部号码）
+		callForwards := api.Group("/call-forwards")
+		{
+			callForwards.GET("", r.listCallForwards)
+			callForwards.POST("", r.createCallForward)
+			callForwards.GET("/:id", r.getCallForward)
+			callForwards.PUT("/:id", r.updateCallForward)
+			callForwards.DELETE("/:id", r.deleteCallForward)
+		}
+
+		// 时间条件（工作时间、节假日）
+		timeConditions := api.Group("/time-conditions")
+		{
+			timeConditions.GET("", r.listTimeConditions)
+			timeConditions.POST("", r.createTimeCondition)
+			timeConditions.GET("/:id", r.getTimeCondition)
+			timeConditions.PUT("/:id", r.updateTimeCondition)
+			timeConditions.DELETE("/:id", r.deleteTimeCondition)
+			timeConditions.GET("/:id/evaluate", r.evaluateTimeCondition)
+			timeConditions.POST("/:id/holidays", r.createTimeConditionHoliday)
+			timeConditions.POST("/:id/holidays/import", r.importTimeConditionHolidays)
+			timeConditions.DELETE("/:id/holidays/:holidayId", r.deleteTimeConditionHoliday)
+		}
+
+		// 来电/短信黑白名单
+		blocked := api.Group("/blocklist")
+		{
+			blocked.GET("", r.listBlockedNumbers)
+			blocked.POST("", r.createBlockedNumberHandler)
+			blocked.GET("/:id", r.getBlockedNumber)
+			blocked.PUT("/:id", r.updateBlockedNumber)
+			blocked.DELETE("/:id", r.deleteBlockedNumber)
+		}
+
+		// 点击拨号（先呼叫分机，再通过 dongle 拨打外部号码）和活动通话监控
+		callsGroup := api.Group("/calls")
+		{
+			callsGroup.GET("/active", r.listActiveCalls)
+			callsGroup.GET("/active/:id", r.getActiveCall)
+			callsGroup.POST("/active/:id/hangup", r.hangupActiveCall)
+			callsGroup.POST("/active/:id/transfer", r.transferActiveCall) // 盲转/咨询转接
+			callsGroup.POST("/active/:id/spy", r.spyActiveCall)           // 监听/耳语/强插
+			callsGroup.POST("/originate", r.originateCall)
+			callsGroup.GET("/:id", r.getCall)
+			callsGroup.GET("/:id/events", r.streamCallEvents) // SSE 进度推送
+		}
+
+		// 实时事件流（SSE / WebSocket），支持 topics 过滤和按事件 ID 续传
+		api.GET("/events", r.streamEvents)
+
+		// 通话记录
+		callRecords := api.Group("/call-records")
+		{
+			callRecords.GET("", r.listCallRecords)
+			callRecords.POST("/:id/block", r.blockFromCallRecord)
+		}
+
+		// 通话录音
+		recordings := api.Group("/recordings")
+		{
+			recordings.GET("", r.listRecordings)
+			recordings.GET("/usage", r.getRecordingUsage)
+			recordings.POST("/cleanup", r.cleanupRecordings)
+			recordings.GET("/:id", r.getRecording)
+			recordings.GET("/:id/stream", r.streamRecording)
+			recordings.DELETE("/:id", r.deleteRecording)
+		}
+
+		// 运营商号码前缀（外呼同运营商优先）
+		carrierPrefixes := api.Group("/carrier-prefixes")
+		{
+			carrierPrefixes.GET("", r.listCarrierPrefixes)
+			carrierPrefixes.POST("", r.createCarrierPrefixes)
+			carrierPrefixes.DELETE("/:id", r.deleteCarrierPrefix)
+		}
+
+		// 余额查询
+		balanceProfiles := api.Group("/balance-profiles")
+		{
+			balanceProfiles.GET("", r.listBalanceProfiles)
+			balanceProfiles.POST("", r.createBalanceProfile)
+			balanceProfiles.GET("/:id", r.getBalanceProfile)
+			balanceProfiles.PUT("/:id", r.updateBalanceProfile)
+			balanceProfiles.DELETE("/:id", r.deleteBalanceProfile)
+			balanceProfiles.POST("/:id/check", r.checkBalanceNow)
+			balanceProfiles.GET("/:id/history", r.listBalanceHistory)
 		}
 
 		// WebSocket 终端
@@ -1,12 +1,30 @@
 package web
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
 
+	"github.com/ety001/lzc-mobile/internal/config"
 	"github.com/ety001/lzc-mobile/internal/database"
 	"github.com/gin-gonic/gin"
 )
 
+// toggleCodeRegex 按需录音按键（DTMF）
+var toggleCodeRegex = regexp.MustCompile(`^[0-9*#]{1,4}$`)
+
+// validateToggleCode 校验按需录音按键（不能与咨询转接按键冲突）
+func validateToggleCode(code string) error {
+	if !toggleCodeRegex.MatchString(code) {
+		return errors.New("recording_toggle_code must be 1-4 DTMF digits (0-9, *, #)")
+	}
+	if code == config.AttendedTransferCode {
+		return fmt.Errorf("recording_toggle_code conflicts with the attended transfer code %s", config.AttendedTransferCode)
+	}
+	return nil
+}
+
 // getGlobalConfig 获取全局配置
 func (r *Router) getGlobalConfig(c *gin.Context) {
 	var config database.GlobalConfig
@@ -34,12 +52,35 @@ func (r *Router) updateGlobalConfig(c *gin.Context) {
 	}
 
 	// 更新配置
+	toggleChanged := false
 	config.HTTPProxy = req.HTTPProxy
 	config.DongleHealthEnabled = req.DongleHealthEnabled
+	config.RecordingQuotaMB = req.RecordingQuotaMB
+	config.RecordingRetentionDays = req.RecordingRetentionDays
+	if req.RecordingToggleCode != "" && req.RecordingToggleCode != config.RecordingToggleCode {
+		if err := validateToggleCode(req.RecordingToggleCode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config.RecordingToggleCode = req.RecordingToggleCode
+		toggleChanged = true
+	}
+	if config.RecordingQuotaMB < 0 || config.RecordingRetentionDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recording_quota_mb and recording_retention_days must not be negative"})
+		return
+	}
 	if err := database.DB.Save(&config).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 按需录音按键写在 features.conf 中，修改后需要重新渲染
+	if toggleChanged {
+		if err := r.reloadConfig(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, config)
 }
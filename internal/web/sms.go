@@ -7,8 +7,9 @@ import (
 	"strconv"
 
 	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/auth"
 	"github.com/ety001/lzc-mobile/internal/database"
-	"github.com/ety001/lzc-mobile/internal/sms"
+	"github.com/ety001/lzc-mobile/internal/events"
 	"github.com/gin-gonic/gin"
 )
 
@@ -32,7 +33,7 @@ func (r *Router) listSMSMessages(c *gin.Context) {
 	}
 
 	// 构建查询
-	query := database.DB.Model(&database.SMSMessage{})
+	query := scopeByDongle(c, database.DB.Model(&database.SMSMessage{}), "dongle_id")
 
 	// 过滤条件
 	if dongleID != "" {
@@ -41,6 +42,10 @@ func (r *Router) listSMSMessages(c *gin.Context) {
 	if direction != "" {
 		query = query.Where("direction = ?", direction)
 	}
+	// blocked=true 只看被黑名单拦截的短信，blocked=false 排除拦截的短信
+	if blocked := c.Query("blocked"); blocked != "" {
+		query = query.Where("blocked = ?", blocked == "true")
+	}
 
 	// 获取总数
 	var total int64
@@ -122,6 +127,11 @@ func (r *Router) sendSMSDirect(c *gin.Context) {
 		return
 	}
 
+	if !auth.CanAccessDongle(c, req.DongleID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return
+	}
+
 	// 通过 AMI 发送短信
 	amiManager := ami.GetManager()
 	if err := amiManager.SendSMS(req.DongleID, req.Number, req.Message); err != nil {
@@ -141,6 +151,8 @@ func (r *Router) sendSMSDirect(c *gin.Context) {
 	if err := database.DB.Create(&smsMessage).Error; err != nil {
 		// 记录错误但不影响响应
 		log.Printf("Error saving sent SMS to database: %v", err)
+	} else {
+		events.Publish(events.TopicSMS, "sent", smsMessage)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "SMS sent successfully"})
@@ -182,9 +194,15 @@ type ReceiveSMSRequest struct {
 	Message   string `json:"message" binding:"required"`    // 短信内容（Base64 编码）
 	Timestamp string `json:"timestamp"`                     // 时间戳（可选）
 	SMSIndex  int    `json:"sms_index"`                     // SMS 索引（可选）
+
+	// 长短信分段信息（可选，PDU 与分段字段任选其一）
+	PDU         string `json:"pdu"`          // 原始 PDU（十六进制），用于解析 UDH 分段信息
+	ConcatRef   int    `json:"concat_ref"`   // 分段参考号
+	ConcatTotal int    `json:"concat_total"` // 总段数
+	ConcatSeq   int    `json:"concat_seq"`   // 当前段序号（从 1 开始）
 }
 
-// receiveSMS 接收 SMS（从 Asterisk 内部调用，不需要认证）
+// receiveSMS 接收 SMS（从 Asterisk 内部调用，经由内部回调接口）
 func (r *Router) receiveSMS(c *gin.Context) {
 	var req ReceiveSMSRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -200,10 +218,21 @@ func (r *Router) receiveSMS(c *gin.Context) {
 	}
 	message := string(messageBytes)
 
-	// 创建 SMS handler 并处理短信
-	smsHandler := sms.NewHandler()
-	smsHandler.Register() // 注册到 AMI manager，以便可以获取 AMI client 来删除短信
-	smsHandler.OnSMSReceivedWithIndex(req.Device, req.Sender, message, req.Timestamp, req.SMSIndex)
+	// 交给与 AMI 事件入口共用的短信处理器，同一条短信从两个入口到达时只处理一次
+	if r.smsHandler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SMS handler not available"})
+		return
+	}
+	if req.PDU != "" || req.ConcatTotal > 1 {
+		r.smsHandler.OnSMSPartReceived(req.Device, req.Sender, message, req.Timestamp, req.SMSIndex, ami.SMSPart{
+			PDU:   req.PDU,
+			Ref:   req.ConcatRef,
+			Total: req.ConcatTotal,
+			Seq:   req.ConcatSeq,
+		})
+	} else {
+		r.smsHandler.OnSMSReceivedWithIndex(req.Device, req.Sender, message, req.Timestamp, req.SMSIndex)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "SMS received and queued for processing"})
 }
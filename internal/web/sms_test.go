@@ -0,0 +1,390 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/ami"
+	"github.com/ety001/lzc-mobile/internal/amitest"
+	"github.com/ety001/lzc-mobile/internal/auth"
+	"github.com/ety001/lzc-mobile/internal/config"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/sms"
+	"github.com/gin-gonic/gin"
+)
+
+// amiServer 所有测试共享的模拟 AMI 服务器
+var amiServer *amitest.Server
+
+// smsHandler 所有测试共享的短信处理器（与 main 一样订阅 AMI 事件）
+var smsHandler *sms.Handler
+
+// sessionToken 所有测试共享的管理员会话令牌
+var sessionToken string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests 启动模拟 AMI 服务器和临时数据库后运行测试
+func runTests(m *testing.M) int {
+	gin.SetMode(gin.TestMode)
+
+	srv, err := amitest.NewServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer srv.Close()
+	srv.Setenv()
+	amiServer = srv
+
+	dir, err := os.MkdirTemp("", "web-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("DB_PATH", filepath.Join(dir, "data.db"))
+	if err := database.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	admin := database.AdminUser{Name: "admin", Subject: "admin", Role: database.RoleAdmin}
+	if err := database.DB.Create(&admin).Error; err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if sessionToken, _, err = auth.NewSession(admin.ID, "127.0.0.1", "test"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := ami.GetManager().Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer ami.GetManager().Close()
+
+	smsHandler = sms.NewHandler()
+	smsHandler.Register()
+	defer smsHandler.Close(context.Background())
+
+	return m.Run()
+}
+
+// newTestEngine 创建注册了所有路由的 gin 引擎
+func newTestEngine() *gin.Engine {
+	engine := gin.New()
+	NewRouter(nil, smsHandler).SetupRoutes(engine)
+	return engine
+}
+
+// newIngestEngine 创建内部回调接口的 gin 引擎
+func newIngestEngine() *gin.Engine {
+	engine := gin.New()
+	NewRouter(nil, smsHandler).SetupIngestRoutes(engine)
+	return engine
+}
+
+// newJSONRequest 创建 JSON 请求
+func newJSONRequest(t *testing.T, method, path string, body interface{}) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:40000"
+	return req
+}
+
+// doJSON 以管理员的会话发送 JSON 请求
+func doJSON(t *testing.T, engine *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONAs(t, engine, sessionToken, method, path, body)
+}
+
+// doJSONAs 以指定的会话发送 JSON 请求
+func doJSONAs(t *testing.T, engine *gin.Engine, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newJSONRequest(t, method, path, body)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+// doIngest 以 Asterisk dialplan 的身份（携带共享密钥）调用内部回调接口
+func doIngest(t *testing.T, engine *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	secret, err := config.IngestSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := newJSONRequest(t, method, path, body)
+	req.Header.Set(config.IngestHeader, secret)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+// waitForInboundSMS 等待号码对应的入站短信推送完成
+func waitForInboundSMS(t *testing.T, number string) database.SMSMessage {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		var msg database.SMSMessage
+		if err := database.DB.Where("phone_number = ? AND direction = ? AND pushed = ?", number, "inbound", true).First(&msg).Error; err == nil {
+			return msg
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("SMS from %s was not processed", number)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestReceiveSMSValidation(t *testing.T) {
+	engine := newIngestEngine()
+
+	w := doIngest(t, engine, http.MethodPost, "/api/v1/sms/receive", gin.H{"device": "quectel0", "sender": "10086"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing message: status = %d, want 400", w.Code)
+	}
+
+	w = doIngest(t, engine, http.MethodPost, "/api/v1/sms/receive", gin.H{"device": "quectel0", "sender": "10086", "message": "not base64!"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid base64: status = %d, want 400", w.Code)
+	}
+}
+
+func TestReceiveSMSRequiresIngestToken(t *testing.T) {
+	body := gin.H{"device": "quectel0", "sender": "10086", "message": b64("hi")}
+
+	// 内部回调接口：没有或错误的共享密钥
+	engine := newIngestEngine()
+	for _, token := range []string{"", "wrong"} {
+		req := newJSONRequest(t, http.MethodPost, "/api/v1/sms/receive", body)
+		if token != "" {
+			req.Header.Set(config.IngestHeader, token)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: status = %d, want 401", token, w.Code)
+		}
+	}
+
+	// 公开接口上不再有回调路由，本地请求也不能跳过认证
+	engine = newTestEngine()
+	w := doJSON(t, engine, http.MethodPost, "/api/v1/sms/receive", body)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("public receive: status = %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, newJSONRequest(t, http.MethodGet, "/api/v1/sms", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("local request without session: status = %d, want 401", w.Code)
+	}
+}
+
+func TestReceiveSMSStoresMessage(t *testing.T) {
+	engine := newIngestEngine()
+
+	w := doIngest(t, engine, http.MethodPost, "/api/v1/sms/receive", gin.H{
+		"device":    "quectel0",
+		"sender":    "+8613900000001",
+		"message":   b64("验证码 5678"),
+		"timestamp": "24/05/01 10:00:00",
+		"sms_index": 2,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	msg := waitForInboundSMS(t, "+8613900000001")
+	if msg.Content != "验证码 5678" || msg.DongleID != "quectel0" || msg.SMSIndex != 2 {
+		t.Fatalf("stored SMS = %+v", msg)
+	}
+}
+
+func TestReceiveSMSMergesMultipartRequests(t *testing.T) {
+	engine := newIngestEngine()
+
+	// 每个分段由 dialplan 单独回调一次
+	for _, part := range []struct {
+		seq  int
+		text string
+	}{{2, "second half"}, {1, "first half, "}} {
+		w := doIngest(t, engine, http.MethodPost, "/api/v1/sms/receive", gin.H{
+			"device":       "quectel0",
+			"sender":       "+8613900000002",
+			"message":      b64(part.text),
+			"concat_ref":   11,
+			"concat_total": 2,
+			"concat_seq":   part.seq,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("part %d: status = %d", part.seq, w.Code)
+		}
+	}
+
+	msg := waitForInboundSMS(t, "+8613900000002")
+	if msg.Content != "first half, second half" || msg.PartsReceived != 2 {
+		t.Fatalf("merged SMS = %q (%d parts)", msg.Content, msg.PartsReceived)
+	}
+	var count int64
+	database.DB.Model(&database.SMSMessage{}).Where("phone_number = ?", "+8613900000002").Count(&count)
+	if count != 1 {
+		t.Fatalf("stored %d messages, want 1", count)
+	}
+}
+
+func TestReceiveSMSDeduplicatesAMIEvent(t *testing.T) {
+	engine := newIngestEngine()
+
+	// 同一条短信先通过 AMI 事件到达，再由 dialplan 回调一次（时间戳带时区后缀，内容含换行）
+	amiServer.Emit(amitest.Event("UserEvent", "UserEvent", "SMSReceived",
+		"Device", "quectel0", "Sender", "+8613900000004", "Message", "line one line two",
+		"Timestamp", "24/05/01 11:00:00"))
+	waitForInboundSMS(t, "+8613900000004")
+
+	w := doIngest(t, engine, http.MethodPost, "/api/v1/sms/receive", gin.H{
+		"device":    "quectel0",
+		"sender":    "+8613900000004",
+		"message":   b64("line one\nline two"),
+		"timestamp": "24/05/01 11:00:00+32",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 同一时间的另一条短信不受影响
+	w = doIngest(t, engine, http.MethodPost, "/api/v1/sms/receive", gin.H{
+		"device":    "quectel0",
+		"sender":    "+8613900000004",
+		"message":   b64("another message"),
+		"timestamp": "24/05/01 11:00:00",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	var count int64
+	for {
+		database.DB.Model(&database.SMSMessage{}).Where("phone_number = ?", "+8613900000004").Count(&count)
+		if count >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// 等待可能的重复短信处理完
+	time.Sleep(100 * time.Millisecond)
+	database.DB.Model(&database.SMSMessage{}).Where("phone_number = ?", "+8613900000004").Count(&count)
+	if count != 2 {
+		t.Fatalf("stored %d messages, want 2", count)
+	}
+}
+
+func TestSendSMSDirect(t *testing.T) {
+	engine := newTestEngine()
+
+	w := doJSON(t, engine, http.MethodPost, "/api/v1/sms/send", gin.H{"dongle_id": "quectel0", "number": "13900000003", "message": "hello"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !amiServer.WaitForCommand("quectel sms quectel0 13900000003 hello", time.Second) {
+		t.Fatalf("commands = %v", amiServer.Commands())
+	}
+
+	var msg database.SMSMessage
+	if err := database.DB.Where("phone_number = ? AND direction = ?", "13900000003", "outbound").First(&msg).Error; err != nil {
+		t.Fatalf("outbound SMS not stored: %v", err)
+	}
+
+	amiServer.SetCommand("quectel sms quectel9 13900000003 hello", "Device quectel9 not found")
+	w = doJSON(t, engine, http.MethodPost, "/api/v1/sms/send", gin.H{"dongle_id": "quectel9", "number": "13900000003", "message": "hello"})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unknown device: status = %d, want 500", w.Code)
+	}
+}
+
+func TestListAndDeleteSMSMessages(t *testing.T) {
+	engine := newTestEngine()
+
+	messages := []database.SMSMessage{
+		{DongleID: "quectel5", PhoneNumber: "1001", Content: "a", Direction: "inbound"},
+		{DongleID: "quectel5", PhoneNumber: "1002", Content: "b", Direction: "inbound"},
+		{DongleID: "quectel5", PhoneNumber: "1003", Content: "c", Direction: "outbound"},
+	}
+	for i := range messages {
+		if err := database.DB.Create(&messages[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var resp struct {
+		Data       []database.SMSMessage `json:"data"`
+		Total      int64                 `json:"total"`
+		TotalPages int                   `json:"total_pages"`
+	}
+	w := doJSON(t, engine, http.MethodGet, "/api/v1/sms?dongle_id=quectel5&direction=inbound&page_size=1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || resp.TotalPages != 2 || len(resp.Data) != 1 {
+		t.Fatalf("list = total %d, pages %d, %d items", resp.Total, resp.TotalPages, len(resp.Data))
+	}
+
+	w = doJSON(t, engine, http.MethodDelete, fmt.Sprintf("/api/v1/sms/%d", messages[0].ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d", w.Code)
+	}
+	w = doJSON(t, engine, http.MethodDelete, fmt.Sprintf("/api/v1/sms/%d", messages[0].ID), nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("delete again: status = %d, want 404", w.Code)
+	}
+
+	w = doJSON(t, engine, http.MethodDelete, "/api/v1/sms", gin.H{"ids": []uint{messages[1].ID, messages[2].ID}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch delete: status = %d", w.Code)
+	}
+	var count int64
+	database.DB.Model(&database.SMSMessage{}).Where("dongle_id = ?", "quectel5").Count(&count)
+	if count != 0 {
+		t.Fatalf("%d messages left after delete", count)
+	}
+}
+
+func TestDeleteAllSMSFromSIM(t *testing.T) {
+	engine := newTestEngine()
+
+	w := doJSON(t, engine, http.MethodPost, "/api/v1/sms/delete-all-sim", gin.H{"device": "quectel1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !amiServer.WaitForCommand("quectel cmd quectel1 AT+CMGD=1,4", time.Second) {
+		t.Fatalf("commands = %v", amiServer.Commands())
+	}
+}
@@ -13,8 +13,9 @@ func (r *Router) getSystemStatus(c *gin.Context) {
 	client := amiManager.GetClient()
 	if client == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status": "error",
-			"error":  "AMI client not connected",
+			"status":     "error",
+			"error":      "AMI client not connected",
+			"connection": amiManager.ConnectionStats(),
 		})
 		return
 	}
@@ -28,6 +29,11 @@ func (r *Router) getSystemStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, info)
 }
 
+// getAMIConnection 获取 AMI 连接状态和重连统计
+func (r *Router) getAMIConnection(c *gin.Context) {
+	c.JSON(http.StatusOK, ami.GetManager().ConnectionStats())
+}
+
 // reloadAsterisk 重新加载 Asterisk 配置
 func (r *Router) reloadAsterisk(c *gin.Context) {
 	amiManager := ami.GetManager()
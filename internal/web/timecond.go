@@ -0,0 +1,541 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/timecond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxICalSize 导入日历的大小上限
+const maxICalSize = 2 << 20
+
+// TimeConditionRuleRequest 每周工作时间段
+type TimeConditionRuleRequest struct {
+	Weekdays  string `json:"weekdays"` // 为空时默认 *
+	StartTime string `json:"start_time" binding:"required"`
+	EndTime   string `json:"end_time" binding:"required"`
+}
+
+// TimeConditionRequest 时间条件请求结构（工作时间段整体替换，例外日期单独管理）
+type TimeConditionRequest struct {
+	Name     string                     `json:"name" binding:"required"`
+	Timezone string                     `json:"timezone"`
+	Rules    []TimeConditionRuleRequest `json:"rules"`
+}
+
+// rules 校验并生成工作时间段记录
+func (req *TimeConditionRequest) rules(conditionID uint) ([]database.TimeConditionRule, error) {
+	if _, err := timecond.LoadLocation(req.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", req.Timezone)
+	}
+	rules := make([]database.TimeConditionRule, len(req.Rules))
+	for i, r := range req.Rules {
+		weekdays := strings.ToLower(strings.TrimSpace(r.Weekdays))
+		if weekdays == "" {
+			weekdays = "*"
+		}
+		rules[i] = database.TimeConditionRule{
+			ConditionID: conditionID,
+			Weekdays:    weekdays,
+			StartTime:   r.StartTime,
+			EndTime:     r.EndTime,
+		}
+		if err := timecond.ValidateRule(&rules[i]); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// TimeConditionHolidayRequest 例外日期请求结构
+type TimeConditionHolidayRequest struct {
+	Name      string `json:"name"`
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date"` // 为空时与 start_date 相同
+	Kind      string `json:"kind"`     // closed（默认）或 open
+}
+
+// ICalImportRequest iCalendar 导入请求（ics 与 url 二选一，也可以 multipart 上传 file）
+type ICalImportRequest struct {
+	ICS          string   `json:"ics" form:"ics"`
+	URL          string   `json:"url" form:"url"`
+	Replace      bool     `json:"replace" form:"replace"`             // 先删除之前从日历导入的例外日期
+	OpenKeywords []string `json:"open_keywords" form:"open_keywords"` // 为空时使用默认关键字（补班、上班）
+}
+
+// loadTimeCondition 按 ID 加载时间条件（含工作时间段和例外日期）
+func loadTimeCondition(id uint64) (*database.TimeCondition, error) {
+	var cond database.TimeCondition
+	err := database.DB.Preload("Rules").Preload("Holidays", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_date ASC")
+	}).First(&cond, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
+
+// parseTimeConditionID 解析路径中的时间条件 ID
+func parseTimeConditionID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// listTimeConditions 列出所有时间条件
+func (r *Router) listTimeConditions(c *gin.Context) {
+	var conds []database.TimeCondition
+	if err := database.DB.Preload("Rules").Preload("Holidays", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_date ASC")
+	}).Order("name ASC").Find(&conds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, conds)
+}
+
+// getTimeCondition 获取单个时间条件
+func (r *Router) getTimeCondition(c *gin.Context) {
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	cond, err := loadTimeCondition(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time condition not found"})
+		return
+	}
+	c.JSON(http.StatusOK, cond)
+}
+
+// createTimeCondition 创建时间条件
+func (r *Router) createTimeCondition(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	var req TimeConditionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := req.rules(0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cond := database.TimeCondition{Name: req.Name, Timezone: req.Timezone}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Rules", "Holidays").Create(&cond).Error; err != nil {
+			return err
+		}
+		rules, _ := req.rules(cond.ID)
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	created, err := loadTimeCondition(uint64(cond.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// updateTimeCondition 更新时间条件（工作时间段整体替换）
+func (r *Router) updateTimeCondition(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	var cond database.TimeCondition
+	if err := database.DB.First(&cond, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time condition not found"})
+		return
+	}
+
+	var req TimeConditionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rules, err := req.rules(cond.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&cond).Updates(map[string]interface{}{
+			"name":     req.Name,
+			"timezone": req.Timezone,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("condition_id = ?", cond.ID).Delete(&database.TimeConditionRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	updated, err := loadTimeCondition(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteTimeCondition 删除时间条件（仍被路由引用时拒绝）
+func (r *Router) deleteTimeCondition(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	var cond database.TimeCondition
+	if err := database.DB.First(&cond, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time condition not found"})
+		return
+	}
+
+	var inbound, outbound, forwards int64
+	database.DB.Model(&database.InboundRoute{}).Where("time_condition_id = ?", cond.ID).Count(&inbound)
+	database.DB.Model(&database.OutboundRoute{}).Where("time_condition_id = ?", cond.ID).Count(&outbound)
+	database.DB.Model(&database.CallForward{}).Where("time_condition_id = ?", cond.ID).Count(&forwards)
+	if inbound+outbound+forwards > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Time condition is used by %d inbound route(s), %d outbound route(s) and %d call forward(s)", inbound, outbound, forwards),
+		})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("condition_id = ?", cond.ID).Delete(&database.TimeConditionRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("condition_id = ?", cond.ID).Delete(&database.TimeConditionHoliday{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&cond).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time condition deleted"})
+}
+
+// createTimeConditionHoliday 添加例外日期
+func (r *Router) createTimeConditionHoliday(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	var cond database.TimeCondition
+	if err := database.DB.First(&cond, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time condition not found"})
+		return
+	}
+
+	var req TimeConditionHolidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	holiday := database.TimeConditionHoliday{
+		ConditionID: cond.ID,
+		Name:        req.Name,
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+		Kind:        req.Kind,
+		Source:      "manual",
+	}
+	if err := timecond.ValidateHoliday(&holiday); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&holiday).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, holiday)
+}
+
+// deleteTimeConditionHoliday 删除例外日期
+func (r *Router) deleteTimeConditionHoliday(c *gin.Context) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	holidayID, err := strconv.ParseUint(c.Param("holidayId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid holiday ID"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND condition_id = ?", holidayID, id).Delete(&database.TimeConditionHoliday{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Holiday not found"})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Holiday deleted"})
+}
+
+// importTimeConditionHolidays 从 iCalendar 导入例外日期
+func (r *Router) importTimeConditionHolidays(c *gin.Context) {
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	var cond database.TimeCondition
+	if err := database.DB.First(&cond, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time condition not found"})
+		return
+	}
+
+	var req ICalImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 下载日历不持有路由锁
+	content, err := readICalSource(c, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	keywords := req.OpenKeywords
+	if len(keywords) == 0 {
+		keywords = timecond.DefaultOpenKeywords
+	}
+	holidays, err := timecond.ParseICal(bytes.NewReader(content), keywords)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse calendar: " + err.Error()})
+		return
+	}
+	if len(holidays) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Calendar contains no events"})
+		return
+	}
+
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Replace {
+			if err := tx.Where("condition_id = ? AND source = ?", cond.ID, "ical").Delete(&database.TimeConditionHoliday{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range holidays {
+			holidays[i].ConditionID = cond.ID
+		}
+		return tx.Create(&holidays).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.reloadConfig(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(holidays), "holidays": holidays})
+}
+
+// readICalSource 读取上传的文件、请求中的 ics 文本或下载 url 指向的日历
+func readICalSource(c *gin.Context, req *ICalImportRequest) ([]byte, error) {
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(io.LimitReader(f, maxICalSize))
+	}
+	if req.ICS != "" {
+		return []byte(req.ICS), nil
+	}
+	if req.URL == "" {
+		return nil, errors.New("file, ics or url is required")
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		return nil, errors.New("url must be http or https")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download calendar: HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxICalSize))
+}
+
+// evaluateTimeCondition 计算时间条件在指定时刻（默认当前）的结果，以及引用它的路由会如何处理
+// at 参数为 RFC3339 格式，例如 2026-10-01T10:00:00+08:00
+func (r *Router) evaluateTimeCondition(c *gin.Context) {
+	id, ok := parseTimeConditionID(c)
+	if !ok {
+		return
+	}
+	cond, err := loadTimeCondition(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time condition not found"})
+		return
+	}
+
+	at := time.Now()
+	if s := c.Query("at"); s != "" {
+		if at, err = time.Parse(time.RFC3339, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC3339 (e.g. 2026-10-01T10:00:00+08:00)"})
+			return
+		}
+	}
+
+	result, err := timecond.Evaluate(cond, at)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var inboundRoutes []database.InboundRoute
+	database.DB.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Preload("Members.Extension").Where("time_condition_id = ?", cond.ID).Find(&inboundRoutes)
+	inbound := make([]gin.H, 0, len(inboundRoutes))
+	for _, route := range inboundRoutes {
+		inbound = append(inbound, gin.H{
+			"id":          route.ID,
+			"dongle_id":   route.DongleID,
+			"enabled":     route.Enabled,
+			"destination": inboundDestination(&route, result.Open),
+		})
+	}
+
+	var outboundRoutes []database.OutboundRoute
+	database.DB.Where("time_condition_id = ?", cond.ID).Order("pattern ASC, priority ASC").Find(&outboundRoutes)
+	outbound := make([]gin.H, 0, len(outboundRoutes))
+	for _, route := range outboundRoutes {
+		outbound = append(outbound, gin.H{
+			"id":      route.ID,
+			"name":    route.Name,
+			"pattern": route.Pattern,
+			"enabled": route.Enabled,
+			"active":  route.Enabled && result.Open, // 不在生效时间时跳到同一模式的下一条路由
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"at":              at.Format(time.RFC3339),
+		"result":          result,
+		"inbound_routes":  inbound,
+		"outbound_routes": outbound,
+	})
+}
+
+// inboundDestination 描述来电路由在工作时间/非工作时间的去向
+func inboundDestination(route *database.InboundRoute, open bool) string {
+	if !open {
+		return describeDestination(route.OffHoursType, route.OffHoursTarget, route.OffHoursDongleID)
+	}
+	if len(route.Members) == 0 {
+		return describeDestination(route.FinalType, route.FinalTarget, route.FinalDongleID)
+	}
+	names := make([]string, len(route.Members))
+	for i, m := range route.Members {
+		names[i] = m.Extension.Username
+	}
+	return fmt.Sprintf("ring %s (%s), then %s", strings.Join(names, ", "), route.Strategy,
+		describeDestination(route.FinalType, route.FinalTarget, route.FinalDongleID))
+}
+
+// describeDestination 去向的文字描述
+func describeDestination(kind, target, dongleID string) string {
+	switch kind {
+	case database.FinalDestExtension:
+		return "extension " + target
+	case database.FinalDestVoicemail:
+		return "voicemail " + target
+	case database.FinalDestExternal:
+		return fmt.Sprintf("external %s via %s", target, dongleID)
+	default:
+		return "hangup"
+	}
+}
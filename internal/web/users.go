@@ -0,0 +1,224 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/ety001/lzc-mobile/internal/auth"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserAccessRequest 修改用户角色和 dongle 范围的请求结构
+type UserAccessRequest struct {
+	Role       string `json:"role" binding:"required"` // admin、operator 或 viewer
+	DongleIDs  string `json:"dongle_ids"`              // 逗号分隔的设备 ID
+	AllDongles bool   `json:"all_dongles"`             // 可以访问所有 dongle（操作员和只读用户需要设置 dongle_ids 或 all_dongles）
+}
+
+// UserInviteRequest 邀请用户的请求结构
+type UserInviteRequest struct {
+	Kind       string `json:"kind" binding:"required"`  // email、subject 或 group
+	Value      string `json:"value" binding:"required"` // 邮箱、OIDC subject 或群组名
+	Role       string `json:"role" binding:"required"`
+	DongleIDs  string `json:"dongle_ids"`
+	AllDongles bool   `json:"all_dongles"`
+}
+
+// validateDongleIDs 规范化 dongle 范围并检查设备是否存在
+// 操作员和只读用户必须明确指定 dongle 或设置 allDongles，避免漏填范围时默认可以访问所有 dongle
+func validateDongleIDs(role, s string, allDongles bool) (string, error) {
+	ids := auth.ParseDongleIDs(s)
+	if len(ids) == 0 {
+		if role != database.RoleAdmin && !allDongles {
+			return "", fmt.Errorf("dongle_ids is required unless all_dongles is set")
+		}
+		return "", nil
+	}
+	var count int64
+	if err := database.DB.Model(&database.Dongle{}).Where("device_id IN ?", ids).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if int(count) != len(ids) {
+		return "", fmt.Errorf("dongle_ids contains unknown devices")
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// getCurrentUser 获取当前登录用户的信息（角色和 dongle 范围，前端据此显示可用的功能）
+func (r *Router) getCurrentUser(c *gin.Context) {
+	user := auth.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// listUsers 列出所有用户
+func (r *Router) listUsers(c *gin.Context) {
+	var users []database.AdminUser
+	if err := database.DB.Order("id").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// updateUser 修改用户角色和 dongle 范围（立即对该用户已有的会话生效）
+func (r *Router) updateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req UserAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin, operator or viewer"})
+		return
+	}
+	dongleIDs, err := validateDongleIDs(req.Role, req.DongleIDs, req.AllDongles)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := auth.UpdateUserAccess(uint(id), req.Role, dongleIDs, req.AllDongles)
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	log.Printf("[Users] User %d (%s) set to %s, dongles %q (all: %v) by user %d", user.ID, user.Subject, user.Role, user.DongleIDs, user.AllDongles, auth.CurrentUser(c).ID)
+	c.JSON(http.StatusOK, user)
+}
+
+// deleteUser 删除用户并撤销其所有会话（不能删除自己和最后一个管理员）
+func (r *Router) deleteUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if current := auth.CurrentUser(c); current != nil && current.ID == uint(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete yourself"})
+		return
+	}
+	if err := auth.DeleteUser(uint(id)); err != nil {
+		userError(c, err)
+		return
+	}
+	log.Printf("[Users] User %d deleted by user %d", id, auth.CurrentUser(c).ID)
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// userError 返回用户管理操作的错误
+func userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, auth.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// listUserInvites 列出还有效的邀请
+func (r *Router) listUserInvites(c *gin.Context) {
+	var invites []database.UserInvite
+	if err := database.DB.Order("id").Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, invites)
+}
+
+// createUserInvite 邀请用户：按邮箱或 OIDC subject 邀请单个用户，或按群组邀请群组的所有成员
+func (r *Router) createUserInvite(c *gin.Context) {
+	var req UserInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	value := strings.TrimSpace(req.Value)
+	switch req.Kind {
+	case database.InviteByEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+			return
+		}
+		value = strings.ToLower(addr.Address)
+	case database.InviteBySubject, database.InviteByGroup:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be email, subject or group"})
+		return
+	}
+	if value == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "value is required"})
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin, operator or viewer"})
+		return
+	}
+	dongleIDs, err := validateDongleIDs(req.Role, req.DongleIDs, req.AllDongles)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing int64
+	if err := database.DB.Model(&database.UserInvite{}).Where("kind = ? AND value = ?", req.Kind, value).Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invite already exists"})
+		return
+	}
+
+	invite := database.UserInvite{
+		Kind:       req.Kind,
+		Value:      value,
+		Role:       req.Role,
+		DongleIDs:  dongleIDs,
+		AllDongles: req.AllDongles,
+		CreatedBy:  auth.CurrentUser(c).ID,
+	}
+	if err := database.DB.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[Users] Invite %d created: %s %s as %s", invite.ID, invite.Kind, invite.Value, invite.Role)
+	c.JSON(http.StatusCreated, invite)
+}
+
+// deleteUserInvite 撤回邀请（已经登录的用户不受影响）
+func (r *Router) deleteUserInvite(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	result := database.DB.Delete(&database.UserInvite{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invite deleted"})
+}
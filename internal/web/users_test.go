@@ -0,0 +1,183 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ety001/lzc-mobile/internal/auth"
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// newUserSession 创建指定角色和 dongle 范围的用户并返回会话令牌（dongleIDs 为 "*" 时可以访问所有 dongle）
+func newUserSession(t *testing.T, subject, role, dongleIDs string) (database.AdminUser, string) {
+	t.Helper()
+	user := database.AdminUser{Name: subject, Subject: subject, Role: role, DongleIDs: dongleIDs}
+	if dongleIDs == "*" {
+		user.DongleIDs, user.AllDongles = "", true
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := auth.NewSession(user.ID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+func TestAccessRulesMatchRoutes(t *testing.T) {
+	routes := make(map[string]bool)
+	for _, route := range newTestEngine().Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+	for key := range accessRules {
+		if !routes[key] {
+			t.Errorf("access rule %q does not match any route", key)
+		}
+	}
+}
+
+func TestRoleEnforcement(t *testing.T) {
+	engine := newTestEngine()
+	_, viewer := newUserSession(t, "role-viewer", database.RoleViewer, "*")
+	_, operator := newUserSession(t, "role-operator", database.RoleOperator, "quectel0")
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"viewer reads messages", viewer, http.MethodGet, "/api/v1/sms", nil, http.StatusOK},
+		{"viewer reads own user", viewer, http.MethodGet, "/api/v1/me", nil, http.StatusOK},
+		{"viewer cannot send", viewer, http.MethodPost, "/api/v1/sms/send", gin.H{"dongle_id": "quectel0", "number": "1", "message": "x"}, http.StatusForbidden},
+		{"viewer cannot read extensions", viewer, http.MethodGet, "/api/v1/extensions", nil, http.StatusForbidden},
+		{"viewer cannot delete messages", viewer, http.MethodDelete, "/api/v1/sms/1", nil, http.StatusForbidden},
+		{"operator cannot change settings", operator, http.MethodPut, "/api/v1/settings", gin.H{}, http.StatusForbidden},
+		{"operator cannot manage users", operator, http.MethodGet, "/api/v1/users", nil, http.StatusForbidden},
+		{"operator cannot send outside scope", operator, http.MethodPost, "/api/v1/sms/send", gin.H{"dongle_id": "quectel1", "number": "1", "message": "x"}, http.StatusForbidden},
+		{"admin manages users", sessionToken, http.MethodGet, "/api/v1/users", nil, http.StatusOK},
+	} {
+		if w := doJSONAs(t, engine, tc.token, tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d, body = %s", tc.name, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
+
+func TestDongleScope(t *testing.T) {
+	engine := newTestEngine()
+	_, scoped := newUserSession(t, "scope-viewer", database.RoleViewer, "scope0")
+
+	dongles := []database.Dongle{{DeviceID: "scope0"}, {DeviceID: "scope1"}}
+	if err := database.DB.Create(&dongles).Error; err != nil {
+		t.Fatal(err)
+	}
+	messages := []database.SMSMessage{
+		{DongleID: "scope0", PhoneNumber: "2001", Content: "visible", Direction: "inbound"},
+		{DongleID: "scope1", PhoneNumber: "2002", Content: "hidden", Direction: "inbound"},
+	}
+	if err := database.DB.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := doJSONAs(t, engine, scoped, http.MethodGet, "/api/v1/sms?page_size=100", nil)
+	var resp struct {
+		Data []database.SMSMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range resp.Data {
+		if m.DongleID != "scope0" {
+			t.Fatalf("scoped user sees SMS of %s", m.DongleID)
+		}
+	}
+	if len(resp.Data) == 0 {
+		t.Fatal("scoped user sees no SMS")
+	}
+
+	w = doJSONAs(t, engine, scoped, http.MethodGet, "/api/v1/dongle-devices", nil)
+	var listed []database.Dongle
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].DeviceID != "scope0" {
+		t.Fatalf("scoped user sees dongles %+v", listed)
+	}
+
+	if w := doJSONAs(t, engine, scoped, http.MethodGet, fmt.Sprintf("/api/v1/dongle-devices/%d/identity-history", dongles[1].ID), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("out of scope dongle: status = %d, want 403", w.Code)
+	}
+	if w := doJSONAs(t, engine, scoped, http.MethodGet, fmt.Sprintf("/api/v1/dongle-devices/%d/identity-history", dongles[0].ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("in scope dongle: status = %d, want 200", w.Code)
+	}
+
+	// 没有设置范围的用户看不到任何 dongle 的数据
+	_, unscoped := newUserSession(t, "scope-none", database.RoleViewer, "")
+	w = doJSONAs(t, engine, unscoped, http.MethodGet, "/api/v1/sms?page_size=100", nil)
+	resp.Data = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(resp.Data) != 0 {
+		t.Fatalf("user without scope: status = %d, sees %d SMS", w.Code, len(resp.Data))
+	}
+	if w := doJSONAs(t, engine, unscoped, http.MethodGet, fmt.Sprintf("/api/v1/dongle-devices/%d", dongles[0].ID), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("user without scope: status = %d, want 403", w.Code)
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	engine := newTestEngine()
+	if err := database.DB.Create(&database.Dongle{DeviceID: "invite0"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		body gin.H
+		want int
+	}{
+		{gin.H{"kind": "email", "value": "New@Example.com", "role": "operator", "dongle_ids": "invite0"}, http.StatusCreated},
+		{gin.H{"kind": "email", "value": "new@example.com", "role": "viewer", "all_dongles": true}, http.StatusConflict},
+		{gin.H{"kind": "email", "value": "not an email", "role": "viewer"}, http.StatusBadRequest},
+		{gin.H{"kind": "group", "value": "ops", "role": "root"}, http.StatusBadRequest},
+		{gin.H{"kind": "team", "value": "ops", "role": "viewer"}, http.StatusBadRequest},
+		{gin.H{"kind": "group", "value": "ops", "role": "viewer", "dongle_ids": "missing0"}, http.StatusBadRequest},
+		{gin.H{"kind": "group", "value": "ops", "role": "viewer"}, http.StatusBadRequest},
+		{gin.H{"kind": "group", "value": "ops", "role": "viewer", "all_dongles": true}, http.StatusCreated},
+		{gin.H{"kind": "subject", "value": "new-admin", "role": "admin"}, http.StatusCreated},
+	} {
+		if w := doJSON(t, engine, http.MethodPost, "/api/v1/user-invites", tc.body); w.Code != tc.want {
+			t.Fatalf("invite %v: status = %d, want %d, body = %s", tc.body, w.Code, tc.want, w.Body.String())
+		}
+	}
+
+	// 被邀请的用户首次登录时使用邀请中的角色
+	user, err := auth.ResolveUser(auth.Identity{Subject: "invited", Email: "new@example.com", EmailVerified: true})
+	if err != nil || user.Role != database.RoleOperator || user.DongleIDs != "invite0" {
+		t.Fatalf("invited user = %+v, err = %v", user, err)
+	}
+
+	var admin database.AdminUser
+	if err := database.DB.Where("subject = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := doJSON(t, engine, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", admin.ID), nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("delete self: status = %d, want 400", w.Code)
+	}
+
+	if w := doJSON(t, engine, http.MethodPut, fmt.Sprintf("/api/v1/users/%d", user.ID), gin.H{"role": "viewer"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("update without scope: status = %d, want 400", w.Code)
+	}
+	if w := doJSON(t, engine, http.MethodPut, fmt.Sprintf("/api/v1/users/%d", user.ID), gin.H{"role": "viewer", "all_dongles": true}); w.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, engine, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", user.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,175 @@
+package web
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ety001/lzc-mobile/internal/database"
+	"github.com/ety001/lzc-mobile/internal/ussd"
+	"github.com/gin-gonic/gin"
+)
+
+// ussdCodeRegex USSD 代码和菜单回复只允许数字、*、# 和 +（代码会拼接到 CLI 命令中）
+var ussdCodeRegex = regexp.MustCompile(`^[0-9*#+]{1,64}$`)
+
+// SendUSSDRequest 发送 USSD 请求结构
+type SendUSSDRequest struct {
+	Code    string `json:"code" binding:"required"` // USSD 代码（如 *100#）或菜单选项（如 1）
+	Timeout int    `json:"timeout"`                 // 等待响应的超时时间（秒，可选，默认 30）
+}
+
+// findDongleByParam 根据路径参数 :id 查找 Dongle，失败时写入错误响应
+func findDongleByParam(c *gin.Context) (*database.Dongle, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+
+	var dongle database.Dongle
+	if err := database.DB.First(&dongle, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dongle not found"})
+		return nil, false
+	}
+	return &dongle, true
+}
+
+// sendUSSD 发送 USSD 请求并等待响应
+// 网络返回菜单时 waiting_input 为 true，再次调用即可回复菜单选项
+func (r *Router) sendUSSD(c *gin.Context) {
+	dongle, ok := findDongleByParam(c)
+	if !ok {
+		return
+	}
+
+	var req SendUSSDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !ussdCodeRegex.MatchString(req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid USSD code"})
+		return
+	}
+
+	timeout := ussd.DefaultResponseTimeout
+	if req.Timeout > 0 && req.Timeout <= 180 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+
+	session, resp, err := ussd.GetService().Send(dongle.DeviceID, req.Code, timeout)
+	switch {
+	case errors.Is(err, ussd.ErrBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ussd.ErrTimeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error(), "session": session})
+		return
+	case errors.Is(err, ussd.ErrCancelled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "session": session})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send USSD: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session":       session,
+		"response":      resp.Message,
+		"type":          resp.Type,
+		"waiting_input": resp.WaitingInput(),
+	})
+}
+
+// listUSSDSessions 列出设备的 USSD 会话历史（分页，包含会话消息）
+func (r *Router) listUSSDSessions(c *gin.Context) {
+	dongle, ok := findDongleByParam(c)
+	if !ok {
+		return
+	}
+
+	page := 1
+	pageSize := 20
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if sizeStr := c.Query("page_size"); sizeStr != "" {
+		if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 && s <= 100 {
+			pageSize = s
+		}
+	}
+
+	query := database.DB.Model(&database.USSDSession{}).Where("dongle_id = ?", dongle.DeviceID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessions []database.USSDSession
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Messages").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        sessions,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (int(total) + pageSize - 1) / pageSize,
+	})
+}
+
+// cancelUSSD 结束设备上正在进行的 USSD 会话
+func (r *Router) cancelUSSD(c *gin.Context) {
+	dongle, ok := findDongleByParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ussd.GetService().Cancel(dongle.DeviceID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel USSD session: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "USSD session cancelled"})
+}
+
+// ReceiveUSSDRequest 接收 USSD 响应请求结构（从 Asterisk dialplan 调用）
+type ReceiveUSSDRequest struct {
+	Device  string `json:"device" binding:"required"`  // 设备名（如 quectel0）
+	Message string `json:"message" binding:"required"` // 响应内容（Base64 编码）
+	Type    string `json:"type"`                       // 响应类型（USSD_TYPE，可选）
+}
+
+// receiveUSSD 接收 USSD 响应（从 Asterisk 内部调用）
+func (r *Router) receiveUSSD(c *gin.Context) {
+	var req ReceiveUSSDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	messageBytes, err := base64.StdEncoding.DecodeString(req.Message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Base64 message: " + err.Error()})
+		return
+	}
+
+	ussdType := ussd.TypeUnknown
+	if t, err := strconv.Atoi(req.Type); err == nil {
+		ussdType = t
+	}
+
+	ussd.GetService().Deliver(req.Device, string(messageBytes), ussdType)
+	c.JSON(http.StatusOK, gin.H{"message": "USSD received"})
+}
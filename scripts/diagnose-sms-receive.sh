@@ -20,7 +20,7 @@ lzc-docker logs $CONTAINER_NAME 2>&1 | grep -E "(Incoming SMS|sms\.txt|quectel.*
 echo ""
 
 echo "3. 查看 API 请求日志..."
-lzc-docker logs $CONTAINER_NAME 2>&1 | grep -E "POST.*sms/receive|SMS queued|Processing SMS|receiveSMS" | tail -30 || echo "未找到 API 日志"
+lzc-docker logs $CONTAINER_NAME 2>&1 | grep -E "POST.*sms/receive|\\[Ingest\\]|SMS queued|Processing SMS|receiveSMS" | tail -30 || echo "未找到 API 日志"
 echo ""
 
 echo "4. 查看 SMS handler 错误..."
@@ -44,7 +44,7 @@ lzc-docker logs $CONTAINER_NAME 2>&1 | grep -E "AMI.*connected|AMI.*disconnected
 echo ""
 
 echo "9. 测试 API 端点是否响应..."
-lzc-docker exec $CONTAINER_NAME curl -s -o /dev/null -w "HTTP Status: %{http_code}\n" http://localhost:8071/api/v1/system/status || echo "API 无法访问"
+lzc-docker exec $CONTAINER_NAME curl -s -o /dev/null -w "HTTP Status: %{http_code}\n" http://localhost:8071/healthz || echo "API 无法访问"
 echo ""
 
 echo "10. 查看 Asterisk 完整日志中最近的 ERROR..."
@@ -32,6 +32,7 @@ export LAZYCAT_AUTH_OIDC_REDIRECT_URI="${LAZYCAT_AUTH_OIDC_REDIRECT_URI:-/auth/o
 
 # 创建必要的目录
 mkdir -p /var/lib/lzc-mobile
+mkdir -p /var/lib/lzc-mobile/recordings
 mkdir -p /var/lib/asterisk
 mkdir -p /var/lib/asterisk/agi-bin
 mkdir -p /var/log/asterisk
@@ -84,6 +85,9 @@ set_file_permissions() {
 # 设置应用数据目录权限（root 和 asterisk 都可写）
 set_directory_permissions /var/lib/lzc-mobile 755 true
 
+# 录音目录：Asterisk（MixMonitor）写入，webpanel 读取和清理
+set_directory_permissions /var/lib/lzc-mobile/recordings 755 true
+
 # 确保数据库文件可写（如果存在）
 # 注意：新创建的数据库文件会在 Go 代码中创建，需要确保目录权限正确
 if [ -f /var/lib/lzc-mobile/data.db ]; then